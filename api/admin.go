@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+
+	"finala/api/auth"
+	"finala/api/storage"
+)
+
+// CreateCollectorKeyRequest describes the collector api key creation request
+type CreateCollectorKeyRequest struct {
+	Name string `json:"name"`
+}
+
+// CreateCollectorKeyResponse is returned once when a collector api key is created
+type CreateCollectorKeyResponse struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// GetCollectorKeys returns the collectors that have an api key
+func (server *Server) GetCollectorKeys(resp http.ResponseWriter, req *http.Request) {
+	if !server.collectorAuthEnabled(resp) {
+		return
+	}
+	server.JSONWrite(resp, http.StatusOK, server.collectorKeys.List())
+}
+
+// CreateCollectorKey issues a new api key for a collector, an existing key of the collector is replaced
+func (server *Server) CreateCollectorKey(resp http.ResponseWriter, req *http.Request) {
+	if !server.collectorAuthEnabled(resp) {
+		return
+	}
+
+	var createRequest CreateCollectorKeyRequest
+	if err := json.NewDecoder(req.Body).Decode(&createRequest); err != nil {
+		server.JSONWrite(resp, http.StatusBadRequest, HttpErrorResponse{Error: err.Error()})
+		return
+	}
+
+	key, err := server.collectorKeys.Create(createRequest.Name)
+	if errors.Is(err, auth.ErrInvalidCollectorName) {
+		server.JSONWrite(resp, http.StatusBadRequest, HttpErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		server.JSONWrite(resp, http.StatusInternalServerError, HttpErrorResponse{Error: err.Error()})
+		return
+	}
+
+	server.JSONWrite(resp, http.StatusCreated, CreateCollectorKeyResponse{
+		Name: createRequest.Name,
+		Key:  key,
+	})
+}
+
+// DeleteCollectorKey revokes the api key of a collector
+func (server *Server) DeleteCollectorKey(resp http.ResponseWriter, req *http.Request) {
+	if !server.collectorAuthEnabled(resp) {
+		return
+	}
+
+	err := server.collectorKeys.Delete(req.PathValue("name"))
+	if errors.Is(err, auth.ErrCollectorKeyNotFound) {
+		server.JSONWrite(resp, http.StatusNotFound, HttpErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		server.JSONWrite(resp, http.StatusInternalServerError, HttpErrorResponse{Error: err.Error()})
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeUserSessions revokes all the sessions and tokens of a user, e.g. when the user is offboarded
+func (server *Server) RevokeUserSessions(resp http.ResponseWriter, req *http.Request) {
+
+	username := req.PathValue("username")
+	if err := server.sessions.RevokeUser(username); err != nil {
+		server.JSONWrite(resp, http.StatusInternalServerError, HttpErrorResponse{Error: err.Error()})
+		return
+	}
+
+	log.WithField("username", username).Info("user sessions revoked")
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// GetIndexes returns the storage indexes
+func (server *Server) GetIndexes(resp http.ResponseWriter, req *http.Request) {
+	lifecycle, ok := server.indexLifecycle(resp)
+	if !ok {
+		return
+	}
+
+	indexes, err := lifecycle.ListIndexes()
+	if err != nil {
+		server.JSONWrite(resp, http.StatusInternalServerError, HttpErrorResponse{Error: err.Error()})
+		return
+	}
+	server.JSONWrite(resp, http.StatusOK, indexes)
+}
+
+// PruneIndexes applies the storage retention policy, with dry_run=true the deleted indexes and executions are only reported
+func (server *Server) PruneIndexes(resp http.ResponseWriter, req *http.Request) {
+	lifecycle, ok := server.indexLifecycle(resp)
+	if !ok {
+		return
+	}
+
+	dryRun := req.URL.Query().Get("dry_run") == "true"
+	report, err := lifecycle.Prune(dryRun)
+	if err != nil {
+		server.JSONWrite(resp, http.StatusInternalServerError, HttpErrorResponse{Error: err.Error()})
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"dry_run":            dryRun,
+		"deleted_indexes":    len(report.DeletedIndexes),
+		"deleted_executions": len(report.DeletedExecutions),
+	}).Info("storage indexes pruned")
+	server.JSONWrite(resp, http.StatusOK, report)
+}
+
+// DeleteIndex deletes a storage index
+func (server *Server) DeleteIndex(resp http.ResponseWriter, req *http.Request) {
+	lifecycle, ok := server.indexLifecycle(resp)
+	if !ok {
+		return
+	}
+
+	err := lifecycle.DeleteIndex(req.PathValue("name"))
+	switch {
+	case errors.Is(err, storage.ErrIndexNotFound):
+		server.JSONWrite(resp, http.StatusNotFound, HttpErrorResponse{Error: err.Error()})
+		return
+	case errors.Is(err, storage.ErrIndexInUse):
+		server.JSONWrite(resp, http.StatusConflict, HttpErrorResponse{Error: err.Error()})
+		return
+	case err != nil:
+		server.JSONWrite(resp, http.StatusInternalServerError, HttpErrorResponse{Error: err.Error()})
+		return
+	}
+
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// indexLifecycle returns the index management of the storage, an error response is written when the storage
+// does not keep the events in indexes
+func (server *Server) indexLifecycle(resp http.ResponseWriter) (storage.IndexLifecycleManager, bool) {
+	lifecycle, ok := server.storage.(storage.IndexLifecycleManager)
+	if !ok {
+		server.JSONWrite(resp, http.StatusNotImplemented, HttpErrorResponse{Error: "storage does not support index management"})
+		return nil, false
+	}
+	return lifecycle, true
+}
+
+// collectorAuthEnabled writes an error response and returns false when collector authentication is disabled
+func (server *Server) collectorAuthEnabled(resp http.ResponseWriter) bool {
+	if server.collectorKeys == nil {
+		server.JSONWrite(resp, http.StatusNotFound, HttpErrorResponse{Error: "collector authentication is not enabled"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,190 @@
+package api_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"finala/api"
+	"finala/api/auth"
+	"finala/api/storage"
+	"finala/api/testutils"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func MockCollectorAuthServer(t *testing.T) (*api.Server, *testutils.MockStorage, *auth.CollectorKeyStore) {
+	store, err := auth.NewCollectorKeyStore(filepath.Join(t.TempDir(), "collector_keys.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions, err := auth.NewSessionManager("", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mockStorage := testutils.NewMockStorage()
+	server := api.NewServer(9090, mockStorage, testutils.NewMockVersion(), store, nil, sessions, nil, nil)
+	server.Serve()
+	return server, mockStorage, store
+}
+
+func TestCollectorAuthentication(t *testing.T) {
+
+	ms, mockStorage, store := MockCollectorAuthServer(t)
+	key, err := store.Create("general")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name               string
+		executionID        string
+		apiKey             string
+		expectedStatusCode int
+	}{
+		{"missing_key", "general_1", "", http.StatusUnauthorized},
+		{"invalid_key", "general_1", "fck_invalid", http.StatusUnauthorized},
+		{"foreign_execution", "other_1", key, http.StatusForbidden},
+		{"prefixed_collector", "general_eu_1", key, http.StatusForbidden},
+		{"collector_prefix", "gen_1", key, http.StatusForbidden},
+		{"non_numeric_timestamp", "general_abc", key, http.StatusForbidden},
+		{"signed_timestamp", "general_+1", key, http.StatusForbidden},
+		{"valid", "general_1", key, http.StatusAccepted},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req, err := http.NewRequest("POST", "/api/v1/detect-events/"+test.executionID, bytes.NewBufferString(`[{"ResourceName": "resource_1"}]`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.apiKey != "" {
+				req.Header.Set("X-API-Key", test.apiKey)
+			}
+
+			ms.Router().ServeHTTP(rr, req)
+			if rr.Code != test.expectedStatusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, test.expectedStatusCode)
+			}
+		})
+	}
+
+	time.Sleep(time.Millisecond * 500)
+	if mockStorage.Events != 1 {
+		t.Fatalf("unexpected saved data, got %d expected %d", mockStorage.Events, 1)
+	}
+}
+
+func TestCollectorKeysAdmin(t *testing.T) {
+
+	ms, _, store := MockCollectorAuthServer(t)
+	token, _, err := auth.GenerateJWT("admin", auth.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/v1/admin/collector-keys", bytes.NewBufferString(`{"name": "general"}`))
+	ms.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("handler returned wrong status code without token: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/api/v1/admin/collector-keys", bytes.NewBufferString(`{"name": "general"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	ms.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusCreated)
+	}
+	created := api.CreateCollectorKeyResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if name, ok := store.Authenticate(created.Key); !ok || name != "general" {
+		t.Fatalf("created key is not valid for collector %s", "general")
+	}
+
+	rr = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/v1/admin/collector-keys", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	ms.Router().ServeHTTP(rr, req)
+	keys := []auth.CollectorKey{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &keys); err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Name != "general" {
+		t.Fatalf("unexpected collector keys, got %v", keys)
+	}
+	if bytes.Contains(rr.Body.Bytes(), []byte("key_hash")) {
+		t.Fatalf("unexpected key hash in list response")
+	}
+
+	for _, expectedStatusCode := range []int{http.StatusNoContent, http.StatusNotFound} {
+		rr = httptest.NewRecorder()
+		req, _ = http.NewRequest("DELETE", "/api/v1/admin/collector-keys/general", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		ms.Router().ServeHTTP(rr, req)
+		if rr.Code != expectedStatusCode {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, expectedStatusCode)
+		}
+	}
+}
+
+func TestIndexesAdmin(t *testing.T) {
+
+	ms, _ := MockServer()
+	ms.Serve()
+
+	rr := httptest.NewRecorder()
+	req, _ := newAuthorizedRequest("GET", "/api/v1/admin/indexes", nil)
+	ms.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	indexes := []storage.IndexInfo{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &indexes); err != nil {
+		t.Fatal(err)
+	}
+	if len(indexes) != 2 || !indexes[0].Current {
+		t.Fatalf("unexpected indexes, got %v", indexes)
+	}
+
+	rr = httptest.NewRecorder()
+	req, _ = newAuthorizedRequest("POST", "/api/v1/admin/indexes/prune?dry_run=true", nil)
+	ms.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	report := storage.PruneReport{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || len(report.DeletedIndexes) != 1 {
+		t.Fatalf("unexpected prune report, got %v", report)
+	}
+
+	testCases := []struct {
+		index              string
+		expectedStatusCode int
+	}{
+		{"finala-2024-01-01", http.StatusNoContent},
+		{"finala-2024-01-02", http.StatusConflict},
+		{"finala-2023-01-01", http.StatusNotFound},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.index, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req, _ := newAuthorizedRequest("DELETE", "/api/v1/admin/indexes/"+test.index, nil)
+			ms.Router().ServeHTTP(rr, req)
+			if rr.Code != test.expectedStatusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, test.expectedStatusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"finala/serverutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// collectorKeyLength defines the length of the generated collector api keys
+	collectorKeyLength = 40
+
+	// collectorKeyPrefix defines the prefix of the generated collector api keys
+	collectorKeyPrefix = "fck_"
+)
+
+var (
+	// ErrCollectorKeyNotFound defines the error when the collector has no api key
+	ErrCollectorKeyNotFound = errors.New("collector api key was not found")
+
+	// ErrInvalidCollectorName defines the error when the collector name is empty
+	ErrInvalidCollectorName = errors.New("collector name is required")
+)
+
+// CollectorKey describes an api key issued to a collector. Only the key hash is stored
+type CollectorKey struct {
+	Name      string    `yaml:"name" json:"name"`
+	KeyHash   string    `yaml:"key_hash" json:"-"`
+	CreatedAt time.Time `yaml:"created_at" json:"created_at"`
+}
+
+// collectorKeysFile describes the collector keys file structure
+type collectorKeysFile struct {
+	Keys []CollectorKey `yaml:"keys"`
+}
+
+// CollectorKeyStore manages the collectors api keys, persisted to a yaml file
+type CollectorKeyStore struct {
+	mu   sync.RWMutex
+	path string
+	keys map[string]CollectorKey
+}
+
+// NewCollectorKeyStore loads the collector keys from the given file, a missing file is treated as an empty store
+func NewCollectorKeyStore(path string) (*CollectorKeyStore, error) {
+
+	store := &CollectorKeyStore{
+		path: path,
+		keys: map[string]CollectorKey{},
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	keysFile := collectorKeysFile{}
+	if err := yaml.Unmarshal(data, &keysFile); err != nil {
+		return nil, fmt.Errorf("could not parse collector keys file %s: %w", path, err)
+	}
+
+	for _, key := range keysFile.Keys {
+		store.keys[key.Name] = key
+	}
+
+	return store, nil
+}
+
+// Create issues a new api key for the given collector and returns it.
+// An existing key of the collector is replaced, so this is also used for key rotation
+func (s *CollectorKeyStore) Create(name string) (string, error) {
+
+	if name == "" {
+		return "", ErrInvalidCollectorName
+	}
+
+	random, err := serverutil.GenerateRandomPassword(collectorKeyLength)
+	if err != nil {
+		return "", err
+	}
+	key := collectorKeyPrefix + random
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, found := s.keys[name]
+	s.keys[name] = CollectorKey{
+		Name:      name,
+		KeyHash:   hashToken(key),
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := s.persist(); err != nil {
+		if found {
+			s.keys[name] = previous
+		} else {
+			delete(s.keys, name)
+		}
+		return "", err
+	}
+
+	return key, nil
+}
+
+// Delete revokes the api key of the given collector
+func (s *CollectorKeyStore) Delete(name string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, found := s.keys[name]
+	if !found {
+		return ErrCollectorKeyNotFound
+	}
+
+	delete(s.keys, name)
+	if err := s.persist(); err != nil {
+		s.keys[name] = previous
+		return err
+	}
+
+	return nil
+}
+
+// List returns all the collector keys sorted by collector name
+func (s *CollectorKeyStore) List() []CollectorKey {
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]CollectorKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].Name < keys[j].Name
+	})
+
+	return keys
+}
+
+// Authenticate returns the collector name of the given api key
+func (s *CollectorKeyStore) Authenticate(key string) (string, bool) {
+
+	if key == "" {
+		return "", false
+	}
+	hash := []byte(hashToken(key))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for name, collectorKey := range s.keys {
+		if subtle.ConstantTimeCompare(hash, []byte(collectorKey.KeyHash)) == 1 {
+			return name, true
+		}
+	}
+
+	return "", false
+}
+
+// persist writes the keys to the store file, the caller must hold the lock
+func (s *CollectorKeyStore) persist() error {
+
+	keysFile := collectorKeysFile{
+		Keys: make([]CollectorKey, 0, len(s.keys)),
+	}
+	for _, key := range s.keys {
+		keysFile.Keys = append(keysFile.Keys, key)
+	}
+	sort.Slice(keysFile.Keys, func(i, j int) bool {
+		return keysFile.Keys[i].Name < keysFile.Keys[j].Name
+	})
+
+	data, err := yaml.Marshal(&keysFile)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0750); err != nil {
+		return err
+	}
+
+	tempPath := s.path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, s.path)
+}
+
+// hashToken returns the hex encoded sha256 hash of the given token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,73 @@
+package auth_test
+
+import (
+	"errors"
+	"finala/api/auth"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCollectorKeyStore(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "collector_keys.yaml")
+	store, err := auth.NewCollectorKeyStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := store.Create(""); !errors.Is(err, auth.ErrInvalidCollectorName) {
+		t.Fatalf("unexpected error for empty name, got %v expected %v", err, auth.ErrInvalidCollectorName)
+	}
+
+	key, err := store.Create("general")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(key, "fck_") {
+		t.Fatalf("unexpected key format, got %s", key)
+	}
+
+	name, ok := store.Authenticate(key)
+	if !ok || name != "general" {
+		t.Fatalf("unexpected authentication result, got %s %t expected %s %t", name, ok, "general", true)
+	}
+	if _, ok := store.Authenticate("fck_invalid"); ok {
+		t.Fatalf("unexpected authentication of invalid key")
+	}
+
+	// keys are persisted, and only the hash is stored
+	reloaded, err := auth.NewCollectorKeyStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := reloaded.Authenticate(key); !ok {
+		t.Fatalf("expected key to be valid after reload")
+	}
+
+	// rotation invalidates the previous key
+	rotated, err := store.Create("general")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := store.Authenticate(key); ok {
+		t.Fatalf("unexpected authentication of rotated key")
+	}
+	if _, ok := store.Authenticate(rotated); !ok {
+		t.Fatalf("expected rotated key to be valid")
+	}
+
+	if len(store.List()) != 1 {
+		t.Fatalf("unexpected keys count, got %d expected %d", len(store.List()), 1)
+	}
+
+	if err := store.Delete("general"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.Delete("general"); !errors.Is(err, auth.ErrCollectorKeyNotFound) {
+		t.Fatalf("unexpected error, got %v expected %v", err, auth.ErrCollectorKeyNotFound)
+	}
+	if _, ok := store.Authenticate(rotated); ok {
+		t.Fatalf("unexpected authentication of deleted key")
+	}
+}
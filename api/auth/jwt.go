@@ -1,29 +1,138 @@
 package auth
 
 import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecretKey = []byte("your-super-secret-and-long-enough-key-please-change-this-ASAP")
+const (
+	// jwtIssuer defines the issuer of the api tokens
+	jwtIssuer = "finala-api"
 
-// GenerateJWT creates a new JWT for a given username.
-func GenerateJWT(username string) (string, time.Time, error) {
-	expirationTime := time.Now().Add(24 * time.Hour) // Token valid for 24 hours
+	// minSigningKeyLength defines the minimum length of the tokens signing secret
+	minSigningKeyLength = 32
+)
+
+var (
+	// ErrInvalidToken defines the error when the given token is not valid
+	ErrInvalidToken = errors.New("invalid token")
+
+	// ErrWeakSigningKey defines the error when the signing secret is too short
+	ErrWeakSigningKey = fmt.Errorf("jwt secret must be at least %d characters", minSigningKeyLength)
+)
+
+var (
+	signingKeyMu sync.RWMutex
+	// jwtSecretKey defaults to a random secret, so tokens are valid only until the api restarts
+	jwtSecretKey = randomSigningKey()
+)
+
+// SetSigningKey sets the secret used to sign and validate the api tokens
+func SetSigningKey(secret string) error {
+	if len(secret) < minSigningKeyLength {
+		return ErrWeakSigningKey
+	}
+
+	signingKeyMu.Lock()
+	defer signingKeyMu.Unlock()
+	jwtSecretKey = []byte(secret)
+	return nil
+}
+
+// signingKey returns the secret used to sign and validate the api tokens
+func signingKey() []byte {
+	signingKeyMu.RLock()
+	defer signingKeyMu.RUnlock()
+	return jwtSecretKey
+}
 
-	claims := &jwt.RegisteredClaims{
-		Subject:   username,
-		ExpiresAt: jwt.NewNumericDate(expirationTime),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		Issuer:    "finala-api",
+// randomSigningKey generates a random tokens signing secret
+func randomSigningKey() []byte {
+	key := make([]byte, minSigningKeyLength)
+	if _, err := rand.Read(key); err != nil {
+		panic(fmt.Sprintf("could not generate jwt signing key: %v", err))
+	}
+	return key
+}
+
+// Claims describe the api token claims
+type Claims struct {
+	Role Role `json:"role"`
+	// SessionID is the session of the token, used for the token revocation
+	SessionID string `json:"sid,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// GenerateJWT creates a new access token for a given username and role, that is not bound to a session.
+func GenerateJWT(username string, role Role) (string, time.Time, error) {
+	return generateJWT(username, role, "", DefaultAccessTokenTTL)
+}
+
+// generateJWT creates a new access token of the given session
+func generateJWT(username string, role Role, sessionID string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expirationTime := now.Add(ttl)
+
+	tokenID, err := randomToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	claims := &Claims{
+		Role:      role,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID,
+			Subject:   username,
+			ExpiresAt: jwt.NewNumericDate(expirationTime),
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    jwtIssuer,
+		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtSecretKey)
+	tokenString, err := token.SignedString(signingKey())
 	if err != nil {
 		return "", time.Time{}, err
 	}
 
 	return tokenString, expirationTime, nil
 }
+
+// ValidateJWT parses the given token and returns its claims when the signature, expiry and issuer are valid.
+func ValidateJWT(tokenString string) (*Claims, error) {
+
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return signingKey(), nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(jwtIssuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	return claims, nil
+}
+
+// claimsContextKey is the request context key of the token claims
+type claimsContextKey struct{}
+
+// ContextWithClaims returns a copy of the given context that holds the token claims
+func ContextWithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsContextKey{}, claims)
+}
+
+// ClaimsFromContext returns the token claims of the given context
+func ClaimsFromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(*Claims)
+	return claims, ok
+}
@@ -0,0 +1,38 @@
+package auth_test
+
+import (
+	"errors"
+	"finala/api/auth"
+	"testing"
+)
+
+func TestSetSigningKey(t *testing.T) {
+
+	if err := auth.SetSigningKey("short"); !errors.Is(err, auth.ErrWeakSigningKey) {
+		t.Fatalf("unexpected error, got %v expected %v", err, auth.ErrWeakSigningKey)
+	}
+
+	if err := auth.SetSigningKey("first-secret-first-secret-first-secret"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	token, _, err := auth.GenerateJWT("admin", auth.RoleAdmin)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	claims, err := auth.ValidateJWT(token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Subject != "admin" {
+		t.Fatalf("unexpected token subject, got %s expected %s", claims.Subject, "admin")
+	}
+
+	// tokens signed with a previous secret are rejected
+	if err := auth.SetSigningKey("second-secret-second-secret-second-secret"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := auth.ValidateJWT(token); !errors.Is(err, auth.ErrInvalidToken) {
+		t.Fatalf("unexpected error, got %v expected %v", err, auth.ErrInvalidToken)
+	}
+}
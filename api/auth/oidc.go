@@ -0,0 +1,474 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	apiconfig "finala/api/config"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// oidcLoginTTL defines how long a started login waits for the identity provider callback
+	oidcLoginTTL = 10 * time.Minute
+
+	// oidcKeysRefreshInterval defines the minimum time between identity provider keys fetches
+	oidcKeysRefreshInterval = 10 * time.Second
+)
+
+var (
+	// ErrInvalidOIDCState defines the error when the callback state is unknown or expired
+	ErrInvalidOIDCState = errors.New("invalid or expired login state")
+
+	// ErrOIDCNoRole defines the error when none of the user groups is mapped to a role
+	ErrOIDCNoRole = errors.New("user groups are not mapped to a role")
+
+	// ErrInvalidIDToken defines the error when the identity provider id token is not valid
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+// oidcMetadata describe the identity provider discovery document
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcTokenResponse describe the identity provider token endpoint response
+type oidcTokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// jsonWebKey describe a public key of the identity provider key set
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// pendingLogin describe a started login that waits for the identity provider callback
+type pendingLogin struct {
+	nonce    string
+	verifier string
+	expires  time.Time
+}
+
+// OIDCIdentity describe the user authenticated by the identity provider
+type OIDCIdentity struct {
+	Username string
+	Groups   []string
+	Role     Role
+}
+
+// OIDCProvider implements the OpenID Connect authorization code flow with PKCE
+type OIDCProvider struct {
+	config      apiconfig.OIDCConfig
+	client      *http.Client
+	metadata    oidcMetadata
+	roleMapping map[string]Role
+	defaultRole Role
+
+	mu      sync.Mutex
+	pending map[string]pendingLogin
+
+	keysMu        sync.RWMutex
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// NewOIDCProvider discovers the identity provider endpoints and returns a new OIDC provider
+func NewOIDCProvider(ctx context.Context, config apiconfig.OIDCConfig, client *http.Client) (*OIDCProvider, error) {
+
+	if config.IssuerURL == "" || config.ClientID == "" || config.RedirectURL == "" {
+		return nil, errors.New("oidc issuer_url, client_id and redirect_url are required")
+	}
+
+	provider := &OIDCProvider{
+		config:      config,
+		client:      client,
+		roleMapping: map[string]Role{},
+		pending:     map[string]pendingLogin{},
+		keys:        map[string]interface{}{},
+	}
+
+	for group, roleName := range config.RoleMapping {
+		role, err := ParseRole(roleName)
+		if err != nil {
+			return nil, fmt.Errorf("oidc role mapping of group %s: %w", group, err)
+		}
+		provider.roleMapping[group] = role
+	}
+
+	if config.DefaultRole != "" {
+		role, err := ParseRole(config.DefaultRole)
+		if err != nil {
+			return nil, fmt.Errorf("oidc default role: %w", err)
+		}
+		provider.defaultRole = role
+	}
+
+	discoveryURL := strings.TrimSuffix(config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	if err := provider.getJSON(ctx, discoveryURL, &provider.metadata); err != nil {
+		return nil, fmt.Errorf("could not discover oidc provider: %w", err)
+	}
+
+	if strings.TrimSuffix(provider.metadata.Issuer, "/") != strings.TrimSuffix(config.IssuerURL, "/") {
+		return nil, fmt.Errorf("oidc issuer mismatch, got %s expected %s", provider.metadata.Issuer, config.IssuerURL)
+	}
+
+	return provider, nil
+}
+
+// RedirectURL returns the api callback url
+func (p *OIDCProvider) RedirectURL() string {
+	return p.config.RedirectURL
+}
+
+// UIRedirectURL returns the ui page the user is redirected to after the login
+func (p *OIDCProvider) UIRedirectURL() string {
+	return p.config.UIRedirectURL
+}
+
+// AuthCodeURL starts a new login and returns the identity provider authorization url and the login state
+func (p *OIDCProvider) AuthCodeURL() (string, string, error) {
+
+	state, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	for key, login := range p.pending {
+		if now.After(login.expires) {
+			delete(p.pending, key)
+		}
+	}
+	p.pending[state] = pendingLogin{
+		nonce:    nonce,
+		verifier: verifier,
+		expires:  now.Add(oidcLoginTTL),
+	}
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.config.RedirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(p.metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return p.metadata.AuthorizationEndpoint + separator + params.Encode(), state, nil
+}
+
+// Exchange completes the login of the given state, exchanging the authorization code for a verified identity
+func (p *OIDCProvider) Exchange(ctx context.Context, state, code string) (OIDCIdentity, error) {
+
+	p.mu.Lock()
+	login, found := p.pending[state]
+	delete(p.pending, state)
+	p.mu.Unlock()
+
+	if !found || time.Now().After(login.expires) {
+		return OIDCIdentity{}, ErrInvalidOIDCState
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.config.RedirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {login.verifier},
+	}
+	if p.config.ClientSecret != "" {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	defer resp.Body.Close()
+
+	tokenResponse := oidcTokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil {
+		return OIDCIdentity{}, fmt.Errorf("could not decode oidc token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || tokenResponse.Error != "" {
+		return OIDCIdentity{}, fmt.Errorf("oidc token request failed with status %d: %s %s", resp.StatusCode, tokenResponse.Error, tokenResponse.ErrorDescription)
+	}
+
+	claims, err := p.verifyIDToken(ctx, tokenResponse.IDToken)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+
+	if nonce, _ := claims["nonce"].(string); nonce != login.nonce {
+		return OIDCIdentity{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+
+	identity := OIDCIdentity{
+		Username: stringClaim(claims, p.config.UsernameClaim, "email", "sub"),
+		Groups:   stringsClaim(claims, p.config.GroupsClaim),
+	}
+	if identity.Username == "" {
+		return OIDCIdentity{}, fmt.Errorf("%w: missing username claim", ErrInvalidIDToken)
+	}
+
+	identity.Role, err = p.MapRole(identity.Groups)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+
+	return identity, nil
+}
+
+// MapRole returns the highest role mapped to the given groups, or the default role when none is mapped
+func (p *OIDCProvider) MapRole(groups []string) (Role, error) {
+
+	var role Role
+	for _, group := range groups {
+		mapped, ok := p.roleMapping[group]
+		if ok && (role == "" || !role.Allows(mapped)) {
+			role = mapped
+		}
+	}
+
+	if role == "" {
+		role = p.defaultRole
+	}
+	if role == "" {
+		return "", ErrOIDCNoRole
+	}
+
+	return role, nil
+}
+
+// verifyIDToken validates the id token signature, issuer, audience and expiry and returns its claims
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, idToken string) (jwt.MapClaims, error) {
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.metadata.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+
+	return claims, nil
+}
+
+// publicKey returns the identity provider key of the given id, the key set is fetched again for unknown keys
+func (p *OIDCProvider) publicKey(ctx context.Context, kid string) (interface{}, error) {
+
+	p.keysMu.RLock()
+	key, found := lookupKey(p.keys, kid)
+	fetchedAt := p.keysFetchedAt
+	p.keysMu.RUnlock()
+
+	if found {
+		return key, nil
+	}
+	if time.Since(fetchedAt) < oidcKeysRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	keySet := struct {
+		Keys []jsonWebKey `json:"keys"`
+	}{}
+	if err := p.getJSON(ctx, p.metadata.JWKSURI, &keySet); err != nil {
+		return nil, fmt.Errorf("could not fetch oidc keys: %w", err)
+	}
+
+	keys := map[string]interface{}{}
+	for _, webKey := range keySet.Keys {
+		publicKey, err := webKey.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[webKey.Kid] = publicKey
+	}
+
+	p.keysMu.Lock()
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+	p.keysMu.Unlock()
+
+	key, found = lookupKey(keys, kid)
+	if !found {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// getJSON decodes the JSON response of the given url
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, target interface{}) error {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s from %s", resp.Status, url)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(target)
+}
+
+// lookupKey returns the key of the given id, a token without key id matches a key set with a single key
+func lookupKey(keys map[string]interface{}, kid string) (interface{}, bool) {
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	key, found := keys[kid]
+	return key, found
+}
+
+// publicKey returns the RSA or EC public key of the json web key
+func (k jsonWebKey) publicKey() (interface{}, error) {
+
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+// decodeBigInt decodes a base64url encoded big endian integer
+func decodeBigInt(value string) (*big.Int, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(buf), nil
+}
+
+// stringClaim returns the first non empty string claim of the given names
+func stringClaim(claims jwt.MapClaims, names ...string) string {
+	for _, name := range names {
+		if value, ok := claims[name].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// stringsClaim returns a claim that holds a list of strings or a single string
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := []string{}
+		for _, item := range value {
+			if str, ok := item.(string); ok {
+				values = append(values, str)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// randomToken returns a random url safe token
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,125 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"finala/api/auth"
+	apiconfig "finala/api/config"
+	"finala/api/testutils"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// authorize follows the login to the mock provider and returns the callback code
+func authorize(t *testing.T, authURL string) string {
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return location.Query().Get("code")
+}
+
+func newOIDCProvider(t *testing.T, mock *testutils.MockOIDCProvider, defaultRole string) *auth.OIDCProvider {
+	provider, err := auth.NewOIDCProvider(context.Background(), apiconfig.OIDCConfig{
+		IssuerURL:     mock.URL(),
+		ClientID:      mock.ClientID,
+		RedirectURL:   "http://127.0.0.1:8089/api/v1/auth/oidc/callback",
+		Scopes:        []string{"openid", "groups"},
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		RoleMapping: map[string]string{
+			"finops":   "reporter",
+			"platform": "admin",
+			"everyone": "viewer",
+		},
+		DefaultRole: defaultRole,
+	}, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return provider
+}
+
+func TestOIDCExchange(t *testing.T) {
+
+	mock := testutils.NewMockOIDCProvider("finala")
+	defer mock.Close()
+
+	testCases := []struct {
+		name          string
+		claims        map[string]interface{}
+		defaultRole   string
+		expectedRole  auth.Role
+		expectedError error
+	}{
+		{"highest_role", map[string]interface{}{"groups": []string{"everyone", "platform", "finops"}}, "", auth.RoleAdmin, nil},
+		{"single_group", map[string]interface{}{"groups": "finops"}, "", auth.RoleReporter, nil},
+		{"default_role", map[string]interface{}{"groups": []string{"sales"}}, "viewer", auth.RoleViewer, nil},
+		{"no_role", map[string]interface{}{"groups": []string{"sales"}}, "", "", auth.ErrOIDCNoRole},
+		{"invalid_nonce", map[string]interface{}{"groups": "finops", "nonce": "other"}, "", "", auth.ErrInvalidIDToken},
+		{"invalid_audience", map[string]interface{}{"groups": "finops", "aud": "other"}, "", "", auth.ErrInvalidIDToken},
+		{"expired", map[string]interface{}{"groups": "finops", "exp": 1}, "", "", auth.ErrInvalidIDToken},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			mock.Claims = test.claims
+			provider := newOIDCProvider(t, mock, test.defaultRole)
+
+			authURL, state, err := provider.AuthCodeURL()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			identity, err := provider.Exchange(context.Background(), state, authorize(t, authURL))
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("unexpected error, got %v expected %v", err, test.expectedError)
+			}
+			if identity.Role != test.expectedRole {
+				t.Fatalf("unexpected role, got %s expected %s", identity.Role, test.expectedRole)
+			}
+			if err == nil && identity.Username != "jane" {
+				t.Fatalf("unexpected username, got %s expected %s", identity.Username, "jane")
+			}
+		})
+	}
+}
+
+func TestOIDCInvalidState(t *testing.T) {
+
+	mock := testutils.NewMockOIDCProvider("finala")
+	defer mock.Close()
+	provider := newOIDCProvider(t, mock, "viewer")
+
+	authURL, state, err := provider.AuthCodeURL()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	code := authorize(t, authURL)
+
+	if _, err := provider.Exchange(context.Background(), "unknown", code); !errors.Is(err, auth.ErrInvalidOIDCState) {
+		t.Fatalf("unexpected error, got %v expected %v", err, auth.ErrInvalidOIDCState)
+	}
+
+	if _, err := provider.Exchange(context.Background(), state, code); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a state can be used only once
+	if _, err := provider.Exchange(context.Background(), state, code); !errors.Is(err, auth.ErrInvalidOIDCState) {
+		t.Fatalf("unexpected error, got %v expected %v", err, auth.ErrInvalidOIDCState)
+	}
+}
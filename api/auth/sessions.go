@@ -0,0 +1,337 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// DefaultAccessTokenTTL defines the default lifetime of the access tokens
+	DefaultAccessTokenTTL = 15 * time.Minute
+
+	// DefaultRefreshTokenTTL defines the default lifetime of the refresh tokens
+	DefaultRefreshTokenTTL = 7 * 24 * time.Hour
+
+	// refreshTokenPrefix defines the prefix of the refresh tokens
+	refreshTokenPrefix = "frt_"
+)
+
+// ErrInvalidRefreshToken defines the error when the refresh token is unknown, expired or revoked
+var ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+// TokenPair describe the tokens issued to a user session
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// UserLookup returns the current user of the given username, ErrUserNotFound when the user was removed
+type UserLookup func(username string) (User, error)
+
+// session describe a user session, only the refresh token hash is stored
+type session struct {
+	ID       string `yaml:"id"`
+	Username string `yaml:"username"`
+	Role     Role   `yaml:"role"`
+	// SingleSignOn is set for the sessions of the identity provider users, which are not in the users store
+	SingleSignOn bool      `yaml:"single_sign_on,omitempty"`
+	RefreshHash  string    `yaml:"refresh_hash"`
+	ExpiresAt    time.Time `yaml:"expires_at"`
+}
+
+// sessionsFile describes the sessions file structure
+type sessionsFile struct {
+	Sessions []session `yaml:"sessions"`
+	// RevokedSessions holds the revoked sessions until their access tokens expire
+	RevokedSessions map[string]time.Time `yaml:"revoked_sessions"`
+	// RevokedUsers holds the time the users tokens were revoked, tokens issued before are rejected
+	RevokedUsers map[string]time.Time `yaml:"revoked_users"`
+}
+
+// SessionManager issues access and refresh tokens, and keeps the revocation list
+type SessionManager struct {
+	mu         sync.Mutex
+	path       string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+
+	sessions        map[string]session
+	refreshIndex    map[string]string
+	revokedSessions map[string]time.Time
+	revokedUsers    map[string]time.Time
+}
+
+// NewSessionManager loads the sessions from the given file, a missing file is treated as no sessions.
+// When path is empty, the sessions are kept in memory only
+func NewSessionManager(path string, accessTTL, refreshTTL time.Duration) (*SessionManager, error) {
+
+	if accessTTL <= 0 {
+		accessTTL = DefaultAccessTokenTTL
+	}
+	if refreshTTL <= 0 {
+		refreshTTL = DefaultRefreshTokenTTL
+	}
+
+	manager := &SessionManager{
+		path:            path,
+		accessTTL:       accessTTL,
+		refreshTTL:      refreshTTL,
+		sessions:        map[string]session{},
+		refreshIndex:    map[string]string{},
+		revokedSessions: map[string]time.Time{},
+		revokedUsers:    map[string]time.Time{},
+	}
+
+	if path == "" {
+		return manager, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return manager, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	file := sessionsFile{}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("could not parse sessions file %s: %w", path, err)
+	}
+
+	for _, s := range file.Sessions {
+		manager.sessions[s.ID] = s
+		manager.refreshIndex[s.RefreshHash] = s.ID
+	}
+	for id, until := range file.RevokedSessions {
+		manager.revokedSessions[id] = until
+	}
+	for username, revokedAt := range file.RevokedUsers {
+		manager.revokedUsers[username] = revokedAt
+	}
+
+	return manager, nil
+}
+
+// AccessTokenTTL returns the lifetime of the access tokens
+func (m *SessionManager) AccessTokenTTL() time.Duration {
+	return m.accessTTL
+}
+
+// Issue starts a new session for the given user of the users store and returns its tokens
+func (m *SessionManager) Issue(username string, role Role) (TokenPair, error) {
+	return m.start(session{
+		Username: username,
+		Role:     role,
+	})
+}
+
+// IssueSingleSignOn starts a new session for the given identity provider user and returns its tokens.
+// The user is not in the users store, so its role is kept until the session expires or is revoked
+func (m *SessionManager) IssueSingleSignOn(username string, role Role) (TokenPair, error) {
+	return m.start(session{
+		Username:     username,
+		Role:         role,
+		SingleSignOn: true,
+	})
+}
+
+// start issues the tokens of a new session
+func (m *SessionManager) start(s session) (TokenPair, error) {
+
+	sessionID, err := randomToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	s.ID = sessionID
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.issue(s)
+}
+
+// Refresh rotates the given refresh token and returns new tokens of the same session. The user of the
+// session is looked up, the refresh is rejected when the user was removed and the tokens get its current role
+func (m *SessionManager) Refresh(refreshToken string, lookup UserLookup) (TokenPair, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	hash := hashToken(refreshToken)
+	sessionID, found := m.refreshIndex[hash]
+	if !found {
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	s := m.sessions[sessionID]
+	if time.Now().After(s.ExpiresAt) {
+		m.removeSession(sessionID)
+		return TokenPair{}, ErrInvalidRefreshToken
+	}
+
+	if !s.SingleSignOn {
+		user, err := lookup(s.Username)
+		if errors.Is(err, ErrUserNotFound) {
+			m.removeSession(sessionID)
+			if err := m.persist(); err != nil {
+				return TokenPair{}, err
+			}
+			return TokenPair{}, ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return TokenPair{}, err
+		}
+		s.Role = user.Role
+	}
+
+	delete(m.refreshIndex, hash)
+	return m.issue(s)
+}
+
+// Revoke ends the given session, its refresh token and access tokens are rejected immediately
+func (m *SessionManager) Revoke(sessionID string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.removeSession(sessionID)
+	m.revokedSessions[sessionID] = time.Now().Add(m.accessTTL)
+	return m.persist()
+}
+
+// RevokeUser ends all the sessions of the given user, tokens issued until now are rejected immediately
+func (m *SessionManager) RevokeUser(username string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, s := range m.sessions {
+		if s.Username == username {
+			m.removeSession(id)
+		}
+	}
+	m.revokedUsers[username] = time.Now()
+	return m.persist()
+}
+
+// IsRevoked returns true when the token session or user was revoked
+func (m *SessionManager) IsRevoked(claims *Claims) bool {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if claims.SessionID != "" {
+		if _, revoked := m.revokedSessions[claims.SessionID]; revoked {
+			return true
+		}
+	}
+
+	revokedAt, revoked := m.revokedUsers[claims.Subject]
+	if !revoked {
+		return false
+	}
+
+	// tokens issued in the same second as the revocation are rejected as well
+	return claims.IssuedAt == nil || claims.IssuedAt.Unix() <= revokedAt.Unix()
+}
+
+// issue creates the session tokens and stores the session, the caller must hold the lock
+func (m *SessionManager) issue(s session) (TokenPair, error) {
+
+	accessToken, expiresAt, err := generateJWT(s.Username, s.Role, s.ID, m.accessTTL)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	random, err := randomToken()
+	if err != nil {
+		return TokenPair{}, err
+	}
+	refreshToken := refreshTokenPrefix + random
+
+	s.RefreshHash = hashToken(refreshToken)
+	s.ExpiresAt = time.Now().Add(m.refreshTTL)
+	m.sessions[s.ID] = s
+	m.refreshIndex[s.RefreshHash] = s.ID
+
+	if err := m.persist(); err != nil {
+		m.removeSession(s.ID)
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// removeSession deletes the session and its refresh token, the caller must hold the lock
+func (m *SessionManager) removeSession(sessionID string) {
+	if s, found := m.sessions[sessionID]; found {
+		delete(m.refreshIndex, s.RefreshHash)
+		delete(m.sessions, sessionID)
+	}
+}
+
+// persist prunes the expired entries and writes the sessions to the file, the caller must hold the lock
+func (m *SessionManager) persist() error {
+
+	now := time.Now()
+	for id, s := range m.sessions {
+		if now.After(s.ExpiresAt) {
+			m.removeSession(id)
+		}
+	}
+	for id, until := range m.revokedSessions {
+		if now.After(until) {
+			delete(m.revokedSessions, id)
+		}
+	}
+	for username, revokedAt := range m.revokedUsers {
+		if now.After(revokedAt.Add(m.accessTTL)) {
+			delete(m.revokedUsers, username)
+		}
+	}
+
+	if m.path == "" {
+		return nil
+	}
+
+	file := sessionsFile{
+		Sessions:        make([]session, 0, len(m.sessions)),
+		RevokedSessions: m.revokedSessions,
+		RevokedUsers:    m.revokedUsers,
+	}
+	for _, s := range m.sessions {
+		file.Sessions = append(file.Sessions, s)
+	}
+	sort.Slice(file.Sessions, func(i, j int) bool {
+		return file.Sessions[i].ID < file.Sessions[j].ID
+	})
+
+	data, err := yaml.Marshal(&file)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.path), 0750); err != nil {
+		return err
+	}
+
+	tempPath := m.path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, m.path)
+}
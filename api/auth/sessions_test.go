@@ -0,0 +1,166 @@
+package auth_test
+
+import (
+	"errors"
+	"finala/api/auth"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// mockUserLookup returns the lookup of the given users store
+func mockUserLookup(users map[string]auth.Role) auth.UserLookup {
+	return func(username string) (auth.User, error) {
+		role, found := users[username]
+		if !found {
+			return auth.User{}, auth.ErrUserNotFound
+		}
+		return auth.User{Username: username, Role: role}, nil
+	}
+}
+
+func TestSessionRefresh(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "sessions.yaml")
+	sessions, err := auth.NewSessionManager(path, time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tokens, err := sessions.Issue("jane", auth.RoleReporter)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if time.Until(tokens.ExpiresAt) > time.Minute {
+		t.Fatalf("unexpected access token expiry, got %s", tokens.ExpiresAt)
+	}
+
+	claims, err := auth.ValidateJWT(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.SessionID == "" || claims.Role != auth.RoleReporter {
+		t.Fatalf("unexpected access token claims, got %+v", claims)
+	}
+
+	// refresh tokens survive a restart
+	reloaded, err := auth.NewSessionManager(path, time.Minute, time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lookup := mockUserLookup(map[string]auth.Role{"jane": auth.RoleReporter})
+	refreshed, err := reloaded.Refresh(tokens.RefreshToken, lookup)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	refreshedClaims, err := auth.ValidateJWT(refreshed.AccessToken)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if refreshedClaims.SessionID != claims.SessionID || refreshedClaims.Subject != "jane" {
+		t.Fatalf("unexpected refreshed claims, got %+v", refreshedClaims)
+	}
+
+	// refresh tokens are rotated
+	if _, err := reloaded.Refresh(tokens.RefreshToken, lookup); !errors.Is(err, auth.ErrInvalidRefreshToken) {
+		t.Fatalf("unexpected error, got %v expected %v", err, auth.ErrInvalidRefreshToken)
+	}
+	if _, err := reloaded.Refresh("frt_unknown", lookup); !errors.Is(err, auth.ErrInvalidRefreshToken) {
+		t.Fatalf("unexpected error, got %v expected %v", err, auth.ErrInvalidRefreshToken)
+	}
+}
+
+func TestSessionRevoke(t *testing.T) {
+
+	sessions, err := auth.NewSessionManager("", 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	lookup := mockUserLookup(map[string]auth.Role{"jane": auth.RoleViewer, "john": auth.RoleViewer})
+	first, _ := sessions.Issue("jane", auth.RoleViewer)
+	second, _ := sessions.Issue("jane", auth.RoleViewer)
+	other, _ := sessions.Issue("john", auth.RoleViewer)
+
+	firstClaims, _ := auth.ValidateJWT(first.AccessToken)
+	secondClaims, _ := auth.ValidateJWT(second.AccessToken)
+	otherClaims, _ := auth.ValidateJWT(other.AccessToken)
+
+	if err := sessions.Revoke(firstClaims.SessionID); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !sessions.IsRevoked(firstClaims) {
+		t.Fatalf("expected revoked session token to be rejected")
+	}
+	if sessions.IsRevoked(secondClaims) {
+		t.Fatalf("unexpected revocation of another session")
+	}
+	if _, err := sessions.Refresh(first.RefreshToken, lookup); !errors.Is(err, auth.ErrInvalidRefreshToken) {
+		t.Fatalf("unexpected error, got %v expected %v", err, auth.ErrInvalidRefreshToken)
+	}
+
+	if err := sessions.RevokeUser("jane"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !sessions.IsRevoked(secondClaims) {
+		t.Fatalf("expected revoked user token to be rejected")
+	}
+	if _, err := sessions.Refresh(second.RefreshToken, lookup); !errors.Is(err, auth.ErrInvalidRefreshToken) {
+		t.Fatalf("unexpected error, got %v expected %v", err, auth.ErrInvalidRefreshToken)
+	}
+	if sessions.IsRevoked(otherClaims) {
+		t.Fatalf("unexpected revocation of another user")
+	}
+}
+
+func TestSessionRefreshUserLookup(t *testing.T) {
+
+	sessions, err := auth.NewSessionManager("", 0, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	users := map[string]auth.Role{"jane": auth.RoleAdmin, "john": auth.RoleAdmin}
+	lookup := mockUserLookup(users)
+	jane, _ := sessions.Issue("jane", auth.RoleAdmin)
+	john, _ := sessions.Issue("john", auth.RoleAdmin)
+	sso, _ := sessions.IssueSingleSignOn("alice", auth.RoleReporter)
+
+	// the role is read from the users store
+	users["jane"] = auth.RoleViewer
+	refreshed, err := sessions.Refresh(jane.RefreshToken, lookup)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	claims, err := auth.ValidateJWT(refreshed.AccessToken)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Role != auth.RoleViewer {
+		t.Fatalf("unexpected refreshed role, got %s expected %s", claims.Role, auth.RoleViewer)
+	}
+
+	// the sessions of a removed user can not be refreshed
+	delete(users, "john")
+	if _, err := sessions.Refresh(john.RefreshToken, lookup); !errors.Is(err, auth.ErrInvalidRefreshToken) {
+		t.Fatalf("unexpected error, got %v expected %v", err, auth.ErrInvalidRefreshToken)
+	}
+	users["john"] = auth.RoleAdmin
+	if _, err := sessions.Refresh(john.RefreshToken, lookup); !errors.Is(err, auth.ErrInvalidRefreshToken) {
+		t.Fatalf("unexpected error, got %v expected %v", err, auth.ErrInvalidRefreshToken)
+	}
+
+	// the identity provider users are not in the users store
+	refreshed, err = sessions.Refresh(sso.RefreshToken, lookup)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	claims, err = auth.ValidateJWT(refreshed.AccessToken)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.Subject != "alice" || claims.Role != auth.RoleReporter {
+		t.Fatalf("unexpected refreshed claims, got %+v", claims)
+	}
+}
@@ -0,0 +1,398 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v2"
+)
+
+// Role describe the permissions level of a user
+type Role string
+
+const (
+	// RoleViewer can read the collected resources
+	RoleViewer Role = "viewer"
+
+	// RoleReporter can read the collected resources and send reports
+	RoleReporter Role = "reporter"
+
+	// RoleAdmin can manage the api
+	RoleAdmin Role = "admin"
+)
+
+// roleLevels defines the permissions level of each role, a role includes the permissions of the lower levels
+var roleLevels = map[Role]int{
+	RoleViewer:   1,
+	RoleReporter: 2,
+	RoleAdmin:    3,
+}
+
+const (
+	// minPasswordLength defines the minimum length of a user password
+	minPasswordLength = 8
+)
+
+var (
+	// ErrUserNotFound defines the error when the user does not exist
+	ErrUserNotFound = errors.New("user was not found")
+
+	// ErrUserExists defines the error when the user already exists
+	ErrUserExists = errors.New("user already exists")
+
+	// ErrInvalidCredentials defines the error when the username or password are wrong
+	ErrInvalidCredentials = errors.New("invalid username or password")
+
+	// ErrInvalidUsername defines the error when the username is empty
+	ErrInvalidUsername = errors.New("username is required")
+
+	// ErrInvalidRole defines the error when the role is not supported
+	ErrInvalidRole = errors.New("invalid role, supported roles: viewer, reporter, admin")
+
+	// ErrWeakPassword defines the error when the password is too short
+	ErrWeakPassword = fmt.Errorf("password must be at least %d characters", minPasswordLength)
+)
+
+// ParseRole returns the role of the given name
+func ParseRole(name string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(name)))
+	if _, ok := roleLevels[role]; !ok {
+		return "", ErrInvalidRole
+	}
+	return role, nil
+}
+
+// Allows returns true when the role has the permissions of the required role
+func (r Role) Allows(required Role) bool {
+	level, ok := roleLevels[r]
+	if !ok {
+		return false
+	}
+	return level >= roleLevels[required]
+}
+
+// User describe an api user. Only the password hash is stored
+type User struct {
+	Username     string    `yaml:"username" json:"username"`
+	PasswordHash string    `yaml:"password_hash" json:"-"`
+	Role         Role      `yaml:"role" json:"role"`
+	CreatedAt    time.Time `yaml:"created_at" json:"created_at"`
+}
+
+// usersFile describes the users file structure
+type usersFile struct {
+	Users []User `yaml:"users"`
+}
+
+// UserStore manages the api users, persisted to a yaml file. The file is reloaded when it was changed by
+// another process, e.g. the users command, so a removed user can not log in to a running api
+type UserStore struct {
+	mu    sync.RWMutex
+	path  string
+	users map[string]User
+	// loaded holds the file info of the loaded users file, nil when the file did not exist
+	loaded os.FileInfo
+	// dummyHash is compared against when the user does not exist, to keep a constant login time
+	dummyHash []byte
+}
+
+// NewUserStore loads the users from the given file, a missing file is treated as an empty store
+func NewUserStore(path string) (*UserStore, error) {
+
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("finala-dummy-password"), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &UserStore{
+		path:      path,
+		users:     map[string]User{},
+		dummyHash: dummyHash,
+	}
+
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// reload loads the users file when it changed since it was loaded, the caller must hold the lock.
+// The loaded users are kept when the changed file can not be read
+func (s *UserStore) reload() error {
+
+	info, err := os.Stat(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if !fileChanged(s.loaded, info) {
+		return nil
+	}
+
+	return s.load()
+}
+
+// load reads the users from the store file, the caller must hold the lock
+func (s *UserStore) load() error {
+
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		s.users = map[string]User{}
+		s.loaded = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	file := usersFile{}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("could not parse users file %s: %w", s.path, err)
+	}
+
+	users := make(map[string]User, len(file.Users))
+	for _, user := range file.Users {
+		if _, err := ParseRole(string(user.Role)); err != nil {
+			return fmt.Errorf("user %s: %w", user.Username, err)
+		}
+		users[user.Username] = user
+	}
+
+	s.users = users
+	s.loaded = info
+	return nil
+}
+
+// fileChanged returns true when the current file info is not the loaded one. The file is replaced on
+// every write, so a new file, modification time or size means it was changed
+func fileChanged(loaded, current os.FileInfo) bool {
+	if loaded == nil || current == nil {
+		return loaded != current
+	}
+	return !os.SameFile(loaded, current) ||
+		!loaded.ModTime().Equal(current.ModTime()) ||
+		loaded.Size() != current.Size()
+}
+
+// refresh reloads the users file when it changed, a failed reload is logged and the loaded users are kept
+func (s *UserStore) refresh() {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		log.WithError(err).WithField("path", s.path).Error("could not reload the users file")
+	}
+}
+
+// Add creates a new user with the given password and role
+func (s *UserStore) Add(username, password string, role Role) error {
+
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return ErrInvalidUsername
+	}
+	if _, err := ParseRole(string(role)); err != nil {
+		return err
+	}
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return err
+	}
+	if _, found := s.users[username]; found {
+		return ErrUserExists
+	}
+
+	s.users[username] = User{
+		Username:     username,
+		PasswordHash: hash,
+		Role:         role,
+		CreatedAt:    time.Now().UTC(),
+	}
+
+	if err := s.persist(); err != nil {
+		delete(s.users, username)
+		return err
+	}
+
+	return nil
+}
+
+// Remove deletes the given user
+func (s *UserStore) Remove(username string) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return err
+	}
+	previous, found := s.users[username]
+	if !found {
+		return ErrUserNotFound
+	}
+
+	delete(s.users, username)
+	if err := s.persist(); err != nil {
+		s.users[username] = previous
+		return err
+	}
+
+	return nil
+}
+
+// SetPassword replaces the password of the given user
+func (s *UserStore) SetPassword(username, password string) error {
+
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.reload(); err != nil {
+		return err
+	}
+	previous, found := s.users[username]
+	if !found {
+		return ErrUserNotFound
+	}
+
+	user := previous
+	user.PasswordHash = hash
+	s.users[username] = user
+	if err := s.persist(); err != nil {
+		s.users[username] = previous
+		return err
+	}
+
+	return nil
+}
+
+// Get returns the given user
+func (s *UserStore) Get(username string) (User, error) {
+
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, found := s.users[username]
+	if !found {
+		return User{}, ErrUserNotFound
+	}
+	return user, nil
+}
+
+// List returns all the users sorted by username
+func (s *UserStore) List() []User {
+
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]User, 0, len(s.users))
+	for _, user := range s.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	return users
+}
+
+// Authenticate returns the user when the given password matches the stored hash
+func (s *UserStore) Authenticate(username, password string) (User, error) {
+
+	s.refresh()
+	s.mu.RLock()
+	user, found := s.users[username]
+	s.mu.RUnlock()
+
+	if !found {
+		_ = bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		return User{}, ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return User{}, ErrInvalidCredentials
+	}
+
+	return user, nil
+}
+
+// persist writes the users to the store file, the caller must hold the lock
+func (s *UserStore) persist() error {
+
+	file := usersFile{
+		Users: make([]User, 0, len(s.users)),
+	}
+	for _, user := range s.users {
+		file.Users = append(file.Users, user)
+	}
+	sort.Slice(file.Users, func(i, j int) bool {
+		return file.Users[i].Username < file.Users[j].Username
+	})
+
+	data, err := yaml.Marshal(&file)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0750); err != nil {
+		return err
+	}
+
+	tempPath := s.path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tempPath, s.path); err != nil {
+		return err
+	}
+
+	// the written file is the loaded one, it is not reloaded on the next read
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	s.loaded = info
+	return nil
+}
+
+// hashPassword returns the bcrypt hash of the given password
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", ErrWeakPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
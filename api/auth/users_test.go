@@ -0,0 +1,161 @@
+package auth_test
+
+import (
+	"errors"
+	"finala/api/auth"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUserStore(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "users.yaml")
+	store, err := auth.NewUserStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		username string
+		password string
+		role     auth.Role
+		expected error
+	}{
+		{"empty_username", "", "password1", auth.RoleViewer, auth.ErrInvalidUsername},
+		{"weak_password", "viewer", "short", auth.RoleViewer, auth.ErrWeakPassword},
+		{"invalid_role", "viewer", "password1", auth.Role("owner"), auth.ErrInvalidRole},
+		{"valid", "viewer", "password1", auth.RoleViewer, nil},
+		{"exists", "viewer", "password1", auth.RoleViewer, auth.ErrUserExists},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			err := store.Add(test.username, test.password, test.role)
+			if !errors.Is(err, test.expected) {
+				t.Fatalf("unexpected error, got %v expected %v", err, test.expected)
+			}
+		})
+	}
+
+	// passwords are stored as hashes only
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(data), "password1") {
+		t.Fatalf("unexpected plaintext password in users file")
+	}
+
+	reloaded, err := auth.NewUserStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	user, err := reloaded.Authenticate("viewer", "password1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if user.Role != auth.RoleViewer {
+		t.Fatalf("unexpected user role, got %s expected %s", user.Role, auth.RoleViewer)
+	}
+
+	if _, err := store.Authenticate("viewer", "wrong-password"); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("unexpected error, got %v expected %v", err, auth.ErrInvalidCredentials)
+	}
+	if _, err := store.Authenticate("unknown", "password1"); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("unexpected error, got %v expected %v", err, auth.ErrInvalidCredentials)
+	}
+
+	if err := store.SetPassword("viewer", "password2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := store.Authenticate("viewer", "password1"); err == nil {
+		t.Fatalf("unexpected authentication with the previous password")
+	}
+	if _, err := store.Authenticate("viewer", "password2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := store.Remove("viewer"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := store.Remove("viewer"); !errors.Is(err, auth.ErrUserNotFound) {
+		t.Fatalf("unexpected error, got %v expected %v", err, auth.ErrUserNotFound)
+	}
+}
+
+func TestUserStoreReload(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "users.yaml")
+	api, err := auth.NewUserStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// cli changes the users file as the users command does, while the api is running
+	cli, err := auth.NewUserStore(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := cli.Add("alice", "password1", auth.RoleAdmin); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := api.Authenticate("alice", "password1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := cli.SetPassword("alice", "password2"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := api.Authenticate("alice", "password1"); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("unexpected error, got %v expected %v", err, auth.ErrInvalidCredentials)
+	}
+
+	// the api writes on top of the reloaded file, the users of the cli are kept
+	if err := api.Add("bob", "password1", auth.RoleViewer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := cli.Remove("alice"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := api.Authenticate("alice", "password2"); !errors.Is(err, auth.ErrInvalidCredentials) {
+		t.Fatalf("unexpected error, got %v expected %v", err, auth.ErrInvalidCredentials)
+	}
+	if _, err := api.Get("bob"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a users file that can not be parsed keeps the loaded users
+	if err := os.WriteFile(path, []byte("users: ["), 0600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := api.Authenticate("bob", "password1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRoleAllows(t *testing.T) {
+
+	testCases := []struct {
+		role     auth.Role
+		required auth.Role
+		expected bool
+	}{
+		{auth.RoleViewer, auth.RoleViewer, true},
+		{auth.RoleViewer, auth.RoleReporter, false},
+		{auth.RoleReporter, auth.RoleViewer, true},
+		{auth.RoleReporter, auth.RoleAdmin, false},
+		{auth.RoleAdmin, auth.RoleReporter, true},
+		{auth.Role(""), auth.RoleViewer, false},
+	}
+
+	for _, test := range testCases {
+		t.Run(string(test.role)+"_"+string(test.required), func(t *testing.T) {
+			if test.role.Allows(test.required) != test.expected {
+				t.Fatalf("unexpected allows result, got %t expected %t", !test.expected, test.expected)
+			}
+		})
+	}
+}
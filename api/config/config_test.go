@@ -2,6 +2,7 @@ package config_test
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
@@ -37,4 +38,49 @@ func TestConfig(t *testing.T) {
 
 	})
 
+	t.Run("invalid_ingestion_mode", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "api.yaml")
+		if err := os.WriteFile(path, []byte("ingestion:\n  mode: async\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := config.LoadAPI(path)
+		if err == nil {
+			t.Fatalf("expected an error for an unsupported ingestion mode")
+		}
+	})
+
+	t.Run("storage_type", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "api.yaml")
+		if err := os.WriteFile(path, []byte("storage:\n  type: postgres\n  postgres:\n    dsn: postgres://localhost/finala\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		conf, err := config.LoadAPI(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if conf.Storage.Type != config.StorageTypePostgres || conf.Storage.Postgres.DSN != "postgres://localhost/finala" {
+			t.Fatalf("unexpected storage configuration, got %+v", conf.Storage)
+		}
+
+		if err := os.WriteFile(path, []byte("storage:\n  type: mysql\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := config.LoadAPI(path); err == nil {
+			t.Fatalf("expected an error for an unsupported storage type")
+		}
+
+		if err := os.WriteFile(path, []byte("storage: memory\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		conf, err = config.LoadAPI(path)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if conf.Storage.Type != config.StorageTypeMemory {
+			t.Fatalf("unexpected storage type, got %s expected %s", conf.Storage.Type, config.StorageTypeMemory)
+		}
+	})
+
 }
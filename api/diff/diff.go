@@ -0,0 +1,174 @@
+package diff
+
+import (
+	"errors"
+	"finala/api/storage"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrExecutionNotFound is returned when the storage has no event of an execution
+var ErrExecutionNotFound = errors.New("execution not found")
+
+// Resource describes a detected resource in the diff of two executions
+type Resource struct {
+	ResourceType  string  `json:"resource_type"`
+	ResourceID    string  `json:"resource_id"`
+	Region        string  `json:"region,omitempty"`
+	AccountID     string  `json:"account_id,omitempty"`
+	PricePerMonth float64 `json:"price_per_month"`
+	// PreviousPricePerMonth is the price of an unchanged resource in the first execution
+	PreviousPricePerMonth *float64               `json:"previous_price_per_month,omitempty"`
+	Data                  map[string]interface{} `json:"data"`
+}
+
+// ResourceTypeDiff describes the changes of a resource type between two executions
+type ResourceTypeDiff struct {
+	Added     int     `json:"added"`
+	Removed   int     `json:"removed"`
+	Unchanged int     `json:"unchanged"`
+	FromCost  float64 `json:"from_cost"`
+	ToCost    float64 `json:"to_cost"`
+	CostDelta float64 `json:"cost_delta"`
+}
+
+// Result describes the resources that were added, removed or unchanged from an execution to another one
+type Result struct {
+	From          string                      `json:"from"`
+	To            string                      `json:"to"`
+	Added         []Resource                  `json:"added"`
+	Removed       []Resource                  `json:"removed"`
+	Unchanged     []Resource                  `json:"unchanged"`
+	ResourceTypes map[string]ResourceTypeDiff `json:"resource_types"`
+	CostDelta     float64                     `json:"cost_delta"`
+}
+
+// Executions returns the diff of the detected resources of two executions. The resources are matched by
+// resource type, resource id, region and account id, the resources without a resource id are only counted
+// in the costs. The resources of each set are sorted by resource type and resource id
+func Executions(s storage.StorageDescriber, from string, to string) (Result, error) {
+	result := Result{
+		From:          from,
+		To:            to,
+		Added:         []Resource{},
+		Removed:       []Resource{},
+		Unchanged:     []Resource{},
+		ResourceTypes: map[string]ResourceTypeDiff{},
+	}
+
+	resourceTypes := map[string]bool{}
+	for _, executionID := range []string{from, to} {
+		summary, err := s.GetSummary(executionID, nil)
+		if err != nil {
+			return result, err
+		}
+		if len(summary) == 0 {
+			return result, fmt.Errorf("%w: %s", ErrExecutionNotFound, executionID)
+		}
+		for resourceType := range summary {
+			resourceTypes[resourceType] = true
+		}
+	}
+
+	for resourceType := range resourceTypes {
+		fromResources, fromCost, err := readResources(s, resourceType, from)
+		if err != nil {
+			return result, err
+		}
+		toResources, toCost, err := readResources(s, resourceType, to)
+		if err != nil {
+			return result, err
+		}
+
+		typeDiff := ResourceTypeDiff{FromCost: fromCost, ToCost: toCost, CostDelta: toCost - fromCost}
+		for key, resource := range toResources {
+			previous, ok := fromResources[key]
+			if !ok {
+				result.Added = append(result.Added, resource)
+				typeDiff.Added++
+				continue
+			}
+			previousPrice := previous.PricePerMonth
+			resource.PreviousPricePerMonth = &previousPrice
+			result.Unchanged = append(result.Unchanged, resource)
+			typeDiff.Unchanged++
+		}
+		for key, resource := range fromResources {
+			if _, ok := toResources[key]; !ok {
+				result.Removed = append(result.Removed, resource)
+				typeDiff.Removed++
+			}
+		}
+
+		if typeDiff != (ResourceTypeDiff{}) {
+			result.ResourceTypes[resourceType] = typeDiff
+		}
+		result.CostDelta += typeDiff.CostDelta
+	}
+
+	for _, resources := range [][]Resource{result.Added, result.Removed, result.Unchanged} {
+		sortResources(resources)
+	}
+	return result, nil
+}
+
+// readResources reads all the resources of a type in an execution, and returns them by their match key with
+// the total cost of the resource type
+func readResources(s storage.StorageDescriber, resourceType string, executionID string) (map[string]Resource, float64, error) {
+	resources := map[string]Resource{}
+	cost := 0.0
+	err := s.EachResource(resourceType, executionID, nil, func(document map[string]interface{}) error {
+		resource := newResource(resourceType, document)
+		cost += resource.PricePerMonth
+		if resource.ResourceID == "" {
+			return nil
+		}
+		key := strings.Join([]string{resource.ResourceID, resource.Region, resource.AccountID}, "\x00")
+		if _, ok := resources[key]; !ok {
+			resources[key] = resource
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return resources, cost, nil
+}
+
+// newResource returns the diff resource of a resource document
+func newResource(resourceType string, document map[string]interface{}) Resource {
+	text := func(path string) string {
+		if value := storage.FieldValue(document, path); value != nil {
+			return fmt.Sprint(value)
+		}
+		return ""
+	}
+
+	resource := Resource{
+		ResourceType: resourceType,
+		ResourceID:   text("Data.ResourceID"),
+		Region:       text("Data.Region"),
+		AccountID:    text("Data.AccountID"),
+	}
+	resource.PricePerMonth, _ = storage.FieldValue(document, "Data.PricePerMonth").(float64)
+	resource.Data, _ = document["Data"].(map[string]interface{})
+	return resource
+}
+
+// sortResources sorts the resources by resource type, resource id, region and account id
+func sortResources(resources []Resource) {
+	sort.Slice(resources, func(i, j int) bool {
+		left, right := resources[i], resources[j]
+		if left.ResourceType != right.ResourceType {
+			return left.ResourceType < right.ResourceType
+		}
+		if left.ResourceID != right.ResourceID {
+			return left.ResourceID < right.ResourceID
+		}
+		if left.Region != right.Region {
+			return left.Region < right.Region
+		}
+		return left.AccountID < right.AccountID
+	})
+}
@@ -0,0 +1,199 @@
+package diff_test
+
+import (
+	"encoding/json"
+	"errors"
+	"finala/api/diff"
+	"finala/api/storage"
+	"finala/api/storage/memory"
+	"finala/collector"
+	"finala/collector/aws/resources"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func resourceEvent(executionID, resourceName, resourceID, region string, price float64) string {
+	return fmt.Sprintf(`{"ExecutionID":"%s","ResourceName":"%s","EventType":"resource_detected","EventTime":1,`+
+		`"Data":{"ResourceID":"%s","Region":"%s","PricePerMonth":%g}}`, executionID, resourceName, resourceID, region, price)
+}
+
+func TestExecutions(t *testing.T) {
+	first := "general_1700000000"
+	second := "general_1700086400"
+
+	sm := memory.NewStorageManager()
+	_, err := sm.SaveBatch([]string{
+		resourceEvent(first, "aws_ec2", "i-1", "us-east-1", 10),
+		resourceEvent(first, "aws_ec2", "i-2", "us-east-1", 5),
+		resourceEvent(first, "aws_ec2", "i-3", "us-east-1", 1),
+		resourceEvent(first, "aws_rds", "db-1", "eu-west-1", 100),
+		resourceEvent(second, "aws_ec2", "i-1", "us-east-1", 12),
+		resourceEvent(second, "aws_ec2", "i-3", "eu-west-1", 1),
+		resourceEvent(second, "aws_lambda", "fn-1", "us-east-1", 0),
+		`{"ExecutionID":"general_1700086400","ResourceName":"aws_rds","EventType":"service_status","EventTime":1,"Data":{"Status":2}}`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	result, err := diff.Executions(sm, first, second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ids := func(resources []diff.Resource) []string {
+		result := []string{}
+		for _, resource := range resources {
+			result = append(result, resource.ResourceType+"/"+resource.ResourceID+"/"+resource.Region)
+		}
+		return result
+	}
+	testCases := []struct {
+		name     string
+		got      []string
+		expected []string
+	}{
+		{"added", ids(result.Added), []string{"aws_ec2/i-3/eu-west-1", "aws_lambda/fn-1/us-east-1"}},
+		{"removed", ids(result.Removed), []string{"aws_ec2/i-2/us-east-1", "aws_ec2/i-3/us-east-1", "aws_rds/db-1/eu-west-1"}},
+		{"unchanged", ids(result.Unchanged), []string{"aws_ec2/i-1/us-east-1"}},
+	}
+	for _, test := range testCases {
+		if !reflect.DeepEqual(test.got, test.expected) {
+			t.Fatalf("unexpected %s resources, got %v expected %v", test.name, test.got, test.expected)
+		}
+	}
+
+	unchanged := result.Unchanged[0]
+	if unchanged.PricePerMonth != 12 || unchanged.PreviousPricePerMonth == nil || *unchanged.PreviousPricePerMonth != 10 {
+		t.Fatalf("unexpected unchanged resource prices, got %v", unchanged)
+	}
+
+	expectedTypes := map[string]diff.ResourceTypeDiff{
+		"aws_ec2":    {Added: 1, Removed: 2, Unchanged: 1, FromCost: 16, ToCost: 13, CostDelta: -3},
+		"aws_rds":    {Removed: 1, FromCost: 100, CostDelta: -100},
+		"aws_lambda": {Added: 1},
+	}
+	if !reflect.DeepEqual(result.ResourceTypes, expectedTypes) {
+		t.Fatalf("unexpected resource types, got %v expected %v", result.ResourceTypes, expectedTypes)
+	}
+	if result.CostDelta != -103 {
+		t.Fatalf("unexpected cost delta, got %v expected %v", result.CostDelta, -103)
+	}
+
+	_, err = diff.Executions(sm, first, "general_1")
+	if !errors.Is(err, diff.ErrExecutionNotFound) {
+		t.Fatalf("unexpected error, got %v expected %v", err, diff.ErrExecutionNotFound)
+	}
+}
+
+// collectorEvent returns the event the api stores for a resource detected by a collector in an account, the
+// account is saved as the Data.AccountID field of the event
+func collectorEvent(t *testing.T, executionID string, resourceName string, eventType string, accountID string, data interface{}) string {
+	encoded, err := json.Marshal(collector.EventCollector{AccountID: accountID, Data: data})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	detected := struct {
+		AccountID string
+		Data      map[string]interface{}
+	}{}
+	if err := json.Unmarshal(encoded, &detected); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if detected.AccountID != "" {
+		detected.Data["AccountID"] = detected.AccountID
+	}
+
+	event, err := json.Marshal(storage.EventRow{
+		ExecutionID:  executionID,
+		ResourceName: resourceName,
+		EventType:    eventType,
+		EventTime:    time.Now().UnixNano(),
+		Timestamp:    time.Now(),
+		Data:         detected.Data,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return string(event)
+}
+
+func TestExecutions_CollectorEvents(t *testing.T) {
+	first := "general_1700000000"
+	second := "general_1700086400"
+
+	instance := func(id string, price float64) resources.DetectedEC2 {
+		return resources.DetectedEC2{
+			Region:       "us-east-1",
+			Metric:       "CPUUtilization",
+			Name:         "web",
+			InstanceType: "t3.large",
+			PriceDetectedFields: collector.PriceDetectedFields{
+				ResourceID:    id,
+				LaunchTime:    time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC),
+				PricePerHour:  price / collector.TotalMonthHours,
+				PricePerMonth: price,
+				Tag:           map[string]string{"Team": "finops"},
+			},
+		}
+	}
+	finished := collector.EventStatusData{Status: collector.EventFinish}
+	production, staging := "123456789012", "210987654321"
+
+	sm := memory.NewStorageManager()
+	_, err := sm.SaveBatch([]string{
+		collectorEvent(t, first, "aws_ec2", "service_status", "", finished),
+		collectorEvent(t, first, "aws_ec2", "resource_detected", production, instance("i-1", 60)),
+		collectorEvent(t, first, "aws_ec2", "resource_detected", staging, instance("i-1", 20)),
+		collectorEvent(t, first, "aws_ec2", "resource_detected", production, instance("i-2", 30)),
+		collectorEvent(t, first, "aws_iam_users", "service_status", "", finished),
+		collectorEvent(t, first, "aws_iam_users", "resource_detected", production, resources.DetectedAWSLastActivity{
+			UserName:     "jane",
+			AccessKey:    "AKIA1",
+			LastUsedDate: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			LastActivity: "300 days",
+		}),
+		collectorEvent(t, second, "aws_ec2", "service_status", "", finished),
+		collectorEvent(t, second, "aws_ec2", "resource_detected", production, instance("i-1", 60)),
+		collectorEvent(t, second, "aws_ec2", "resource_detected", production, instance("i-3", 90)),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	result, err := diff.Executions(sm, first, second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := map[string][]diff.Resource{
+		"added": {{ResourceType: "aws_ec2", ResourceID: "i-3", Region: "us-east-1", AccountID: production, PricePerMonth: 90}},
+		"removed": {
+			{ResourceType: "aws_ec2", ResourceID: "i-1", Region: "us-east-1", AccountID: staging, PricePerMonth: 20},
+			{ResourceType: "aws_ec2", ResourceID: "i-2", Region: "us-east-1", AccountID: production, PricePerMonth: 30},
+		},
+		"unchanged": {{ResourceType: "aws_ec2", ResourceID: "i-1", Region: "us-east-1", AccountID: production, PricePerMonth: 60}},
+	}
+	for name, got := range map[string][]diff.Resource{"added": result.Added, "removed": result.Removed, "unchanged": result.Unchanged} {
+		for i := range got {
+			if got[i].Data["InstanceType"] != "t3.large" {
+				t.Fatalf("unexpected %s resource data, got %v", name, got[i].Data)
+			}
+			got[i].Data = nil
+			got[i].PreviousPricePerMonth = nil
+		}
+		if !reflect.DeepEqual(got, expected[name]) {
+			t.Fatalf("unexpected %s resources, got %+v expected %+v", name, got, expected[name])
+		}
+	}
+
+	// the iam users are detected without a resource id, they are not matched
+	expectedTypes := map[string]diff.ResourceTypeDiff{
+		"aws_ec2": {Added: 1, Removed: 2, Unchanged: 1, FromCost: 110, ToCost: 150, CostDelta: 40},
+	}
+	if !reflect.DeepEqual(result.ResourceTypes, expectedTypes) {
+		t.Fatalf("unexpected resource types, got %v expected %v", result.ResourceTypes, expectedTypes)
+	}
+}
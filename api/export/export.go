@@ -0,0 +1,204 @@
+package export
+
+import (
+	"errors"
+	"finala/api/storage"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Format describes the file format of an export
+type Format string
+
+const (
+	// FormatCSV exports the resources as comma separated values with a header row
+	FormatCSV Format = "csv"
+	// FormatXLSX exports the resources as an Excel workbook with a single sheet
+	FormatXLSX Format = "xlsx"
+	// FormatJSON exports the resources as a JSON array of objects keyed by column
+	FormatJSON Format = "json"
+)
+
+const (
+	// resourceTypeColumn is the column of the resource type, e.g. aws_ec2
+	resourceTypeColumn = "ResourceType"
+	// tagColumnPrefix is the column prefix of the flattened resource tags, e.g. Tag.Team
+	tagColumnPrefix = "Tag."
+)
+
+// ErrUnsupportedFormat is returned when the export format is not csv, xlsx or json
+var ErrUnsupportedFormat = errors.New("unsupported export format")
+
+// contentTypes maps the export formats to their content type
+var contentTypes = map[Format]string{
+	FormatCSV:  "text/csv; charset=utf-8",
+	FormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	FormatJSON: "application/json",
+}
+
+// rowWriter writes the rows of an export format
+type rowWriter interface {
+	WriteHeader(columns []string) error
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+// ParseFormat returns the format of the given name, csv is returned when the name is empty
+func ParseFormat(name string) (Format, error) {
+	if name == "" {
+		return FormatCSV, nil
+	}
+	format := Format(strings.ToLower(name))
+	if _, ok := contentTypes[format]; !ok {
+		return "", fmt.Errorf("%w: %q, expected csv, xlsx or json", ErrUnsupportedFormat, name)
+	}
+	return format, nil
+}
+
+// ContentType returns the content type of the format
+func (f Format) ContentType() string {
+	return contentTypes[f]
+}
+
+// Exporter writes the detected resources of an execution, one row per resource with the Data fields
+// and the flattened Data.Tag as columns
+type Exporter struct {
+	storage       storage.StorageDescriber
+	executionID   string
+	filter        storage.Expression
+	resourceTypes []string
+	columns       []string
+}
+
+// NewExporter returns the exporter of the resources of the given types, all the resource types of the
+// execution are exported when none is given. The resource types without a matching resource are skipped.
+// The storage errors, such as an invalid filter, are returned before anything is written
+func NewExporter(s storage.StorageDescriber, executionID string, resourceTypes []string, filter storage.Expression) (*Exporter, error) {
+	if len(resourceTypes) == 0 {
+		summary, err := s.GetSummary(executionID, nil)
+		if err != nil {
+			return nil, err
+		}
+		for resourceType := range summary {
+			resourceTypes = append(resourceTypes, resourceType)
+		}
+	}
+	sort.Strings(resourceTypes)
+
+	exporter := &Exporter{storage: s, executionID: executionID, filter: filter}
+	dataColumns := map[string]bool{}
+	for _, resourceType := range resourceTypes {
+		// The resources of a type are detected by the same collector, the first one has all the fields
+		page, err := s.GetResources(resourceType, executionID, storage.ResourcesQuery{Filter: filter, Limit: 1})
+		if err != nil {
+			return nil, err
+		}
+		if len(page.Resources) == 0 {
+			continue
+		}
+		exporter.resourceTypes = append(exporter.resourceTypes, resourceType)
+		if data, ok := page.Resources[0]["Data"].(map[string]interface{}); ok {
+			for field := range data {
+				if field != "Tag" {
+					dataColumns[field] = true
+				}
+			}
+		}
+	}
+
+	tags, err := s.GetExecutionTags(executionID)
+	if err != nil {
+		return nil, err
+	}
+	exporter.columns = columns(dataColumns, tags)
+	return exporter, nil
+}
+
+// columns returns the resource type column, then the data columns with ResourceID first, then the tag columns
+func columns(dataColumns map[string]bool, tags map[string][]storage.TagValue) []string {
+	sorted := []string{}
+	for field := range dataColumns {
+		if field != "ResourceID" {
+			sorted = append(sorted, field)
+		}
+	}
+	sort.Strings(sorted)
+
+	result := []string{resourceTypeColumn}
+	if dataColumns["ResourceID"] {
+		result = append(result, "ResourceID")
+	}
+	result = append(result, sorted...)
+
+	tagKeys := make([]string, 0, len(tags))
+	for key := range tags {
+		tagKeys = append(tagKeys, key)
+	}
+	sort.Strings(tagKeys)
+	for _, key := range tagKeys {
+		result = append(result, tagColumnPrefix+key)
+	}
+	return result
+}
+
+// Columns returns the columns of the export
+func (e *Exporter) Columns() []string {
+	return e.columns
+}
+
+// Write writes the resources to w in the given format and returns the number of exported resources. The
+// resources of every type are read in a single pass of the storage
+func (e *Exporter) Write(w io.Writer, format Format) (int, error) {
+	var writer rowWriter
+	switch format {
+	case FormatCSV:
+		writer = newCSVWriter(w)
+	case FormatXLSX:
+		writer = newXLSXWriter(w)
+	case FormatJSON:
+		writer = newJSONWriter(w)
+	default:
+		return 0, fmt.Errorf("%w: %q", ErrUnsupportedFormat, format)
+	}
+
+	if err := writer.WriteHeader(e.columns); err != nil {
+		return 0, err
+	}
+
+	exported := 0
+	for _, resourceType := range e.resourceTypes {
+		err := e.storage.EachResource(resourceType, e.executionID, e.filter, func(resource map[string]interface{}) error {
+			if err := writer.WriteRow(e.row(resourceType, resource)); err != nil {
+				return err
+			}
+			exported++
+			return nil
+		})
+		if err != nil {
+			return exported, err
+		}
+	}
+	return exported, writer.Close()
+}
+
+// row returns the column values of a resource, nil when the resource does not have the column. The tag keys
+// are read as is, since they can have dots
+func (e *Exporter) row(resourceType string, resource map[string]interface{}) []interface{} {
+	data, _ := resource["Data"].(map[string]interface{})
+	tags, _ := data["Tag"].(map[string]interface{})
+
+	values := make([]interface{}, len(e.columns))
+	for i, column := range e.columns {
+		switch {
+		case column == resourceTypeColumn:
+			values[i] = resourceType
+		case strings.HasPrefix(column, tagColumnPrefix):
+			values[i] = tags[strings.TrimPrefix(column, tagColumnPrefix)]
+		default:
+			values[i] = data[column]
+		}
+	}
+	return values
+}
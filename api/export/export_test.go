@@ -0,0 +1,156 @@
+package export_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"finala/api/export"
+	"finala/api/storage"
+	"finala/api/storage/memory"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const executionID = "general_1700000000"
+
+func newStorage(t *testing.T) storage.StorageDescriber {
+	sm := memory.NewStorageManager()
+	_, err := sm.SaveBatch([]string{
+		`{"ExecutionID":"general_1700000000","ResourceName":"aws_ec2","EventType":"service_status","EventTime":1,"Data":{"Status":2}}`,
+		`{"ExecutionID":"general_1700000000","ResourceName":"aws_ec2","EventType":"resource_detected","EventTime":2,` +
+			`"Data":{"ResourceID":"i-1","Region":"us-east-1","PricePerMonth":10.5,"Tag":{"Team":"finops","kubernetes.io/cluster":"main"}}}`,
+		`{"ExecutionID":"general_1700000000","ResourceName":"aws_ec2","EventType":"resource_detected","EventTime":2,` +
+			`"Data":{"ResourceID":"i-2","Region":"eu-west-1","PricePerMonth":3,"Tag":{"Team":"=HYPERLINK(\"x\")"}}}`,
+		`{"ExecutionID":"general_1700000000","ResourceName":"aws_lambda","EventType":"resource_detected","EventTime":2,` +
+			`"Data":{"ResourceID":"fn-1","Region":"us-east-1","Metric":"invocations","Tag":{}}}`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return sm
+}
+
+func TestParseFormat(t *testing.T) {
+	testCases := []struct {
+		name     string
+		expected export.Format
+		err      error
+	}{
+		{"", export.FormatCSV, nil},
+		{"XLSX", export.FormatXLSX, nil},
+		{"json", export.FormatJSON, nil},
+		{"pdf", "", export.ErrUnsupportedFormat},
+	}
+
+	for _, test := range testCases {
+		format, err := export.ParseFormat(test.name)
+		if format != test.expected || !errors.Is(err, test.err) {
+			t.Fatalf("unexpected format of %q, got %q, %v expected %q, %v", test.name, format, err, test.expected, test.err)
+		}
+	}
+}
+
+func TestExporter(t *testing.T) {
+	s := newStorage(t)
+
+	exporter, err := export.NewExporter(s, executionID, nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expectedColumns := []string{"ResourceType", "ResourceID", "Metric", "PricePerMonth", "Region", "Tag.Team", "Tag.kubernetes.io/cluster"}
+	if !reflect.DeepEqual(exporter.Columns(), expectedColumns) {
+		t.Fatalf("unexpected columns, got %v expected %v", exporter.Columns(), expectedColumns)
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		exported, err := exporter.Write(&buf, export.FormatCSV)
+		if err != nil || exported != 3 {
+			t.Fatalf("unexpected export, got %d, %v expected %d", exported, err, 3)
+		}
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		expected := [][]string{
+			expectedColumns,
+			{"aws_ec2", "i-1", "", "10.5", "us-east-1", "finops", "main"},
+			{"aws_ec2", "i-2", "", "3", "eu-west-1", `'=HYPERLINK("x")`, ""},
+			{"aws_lambda", "fn-1", "invocations", "", "us-east-1", "", ""},
+		}
+		if !reflect.DeepEqual(records, expected) {
+			t.Fatalf("unexpected csv records, got %v expected %v", records, expected)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+		if _, err := exporter.Write(&buf, export.FormatJSON); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		rows := []map[string]interface{}{}
+		if err := json.Unmarshal(buf.Bytes(), &rows); err != nil {
+			t.Fatalf("could not parse the json export: %v", err)
+		}
+		if len(rows) != 3 || rows[0]["PricePerMonth"] != 10.5 || rows[0]["Tag.Team"] != "finops" {
+			t.Fatalf("unexpected json rows, got %v", rows)
+		}
+		if _, ok := rows[2]["PricePerMonth"]; ok {
+			t.Fatalf("unexpected column without a value, got %v", rows[2])
+		}
+	})
+
+	t.Run("xlsx", func(t *testing.T) {
+		var buf bytes.Buffer
+		if _, err := exporter.Write(&buf, export.FormatXLSX); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatalf("could not open the workbook: %v", err)
+		}
+		sheet := ""
+		for _, file := range archive.File {
+			if file.Name != "xl/worksheets/sheet1.xml" {
+				continue
+			}
+			reader, err := file.Open()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			content, _ := io.ReadAll(reader)
+			sheet = string(content)
+		}
+		for _, expected := range []string{
+			`<c r="A1" t="inlineStr"><is><t xml:space="preserve">ResourceType</t></is></c>`,
+			`<c r="D2"><v>10.5</v></c>`,
+			`<c r="F3" t="inlineStr"><is><t xml:space="preserve">=HYPERLINK(&#34;x&#34;)</t></is></c>`,
+			`<row r="4">`,
+		} {
+			if !strings.Contains(sheet, expected) {
+				t.Fatalf("unexpected sheet, got %s expected it to contain %s", sheet, expected)
+			}
+		}
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		exporter, err := export.NewExporter(s, executionID, []string{"aws_ec2", "aws_lambda"}, storage.In("Data.Region", "us-east-1"))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var buf bytes.Buffer
+		exported, err := exporter.Write(&buf, export.FormatCSV)
+		if err != nil || exported != 2 {
+			t.Fatalf("unexpected export, got %d, %v expected %d", exported, err, 2)
+		}
+
+		_, err = export.NewExporter(s, executionID, nil, storage.In("Data..Region", "us-east-1"))
+		if !errors.Is(err, storage.ErrInvalidFilter) {
+			t.Fatalf("unexpected error, got %v expected %v", err, storage.ErrInvalidFilter)
+		}
+	})
+}
@@ -0,0 +1,119 @@
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// formulaPrefixes are the first characters that make a spreadsheet evaluate a CSV cell as a formula
+const formulaPrefixes = "=+-@\t\r"
+
+// formatValue returns the text of a column value, numbers are written without exponent and objects as JSON
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
+// csvWriter writes the rows as comma separated values
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{writer: csv.NewWriter(w)}
+}
+
+// WriteHeader writes the header row
+func (c *csvWriter) WriteHeader(columns []string) error {
+	return c.writer.Write(columns)
+}
+
+// WriteRow writes a row. Text that a spreadsheet would evaluate as a formula is prefixed with a quote
+func (c *csvWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = formatValue(value)
+		if _, isText := value.(string); isText && record[i] != "" && strings.ContainsRune(formulaPrefixes, rune(record[i][0])) {
+			record[i] = "'" + record[i]
+		}
+	}
+	return c.writer.Write(record)
+}
+
+// Close flushes the written rows
+func (c *csvWriter) Close() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// jsonWriter writes the rows as a JSON array of objects, the columns without a value are left out
+type jsonWriter struct {
+	writer  *bufio.Writer
+	columns []string
+	rows    int
+}
+
+func newJSONWriter(w io.Writer) *jsonWriter {
+	return &jsonWriter{writer: bufio.NewWriter(w)}
+}
+
+// WriteHeader starts the array, the columns are the keys of the row objects
+func (j *jsonWriter) WriteHeader(columns []string) error {
+	j.columns = columns
+	_, err := j.writer.WriteString("[")
+	return err
+}
+
+// WriteRow writes a row object
+func (j *jsonWriter) WriteRow(values []interface{}) error {
+	row := map[string]interface{}{}
+	for i, value := range values {
+		if value != nil {
+			row[j.columns[i]] = value
+		}
+	}
+	encoded, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	separator := ",\n"
+	if j.rows == 0 {
+		separator = "\n"
+	}
+	j.rows++
+	if _, err := j.writer.WriteString(separator); err != nil {
+		return err
+	}
+	_, err = j.writer.Write(encoded)
+	return err
+}
+
+// Close ends the array and flushes the written rows
+func (j *jsonWriter) Close() error {
+	end := "\n]\n"
+	if j.rows == 0 {
+		end = "]\n"
+	}
+	if _, err := j.writer.WriteString(end); err != nil {
+		return err
+	}
+	return j.writer.Flush()
+}
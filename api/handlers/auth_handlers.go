@@ -2,55 +2,130 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"strings"
+	"time"
 
 	"finala/api/auth"
 	"finala/api/models"
-	"finala/config"
 	"finala/serverutil"
 )
 
-// LoginHandler handles user login requests.
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		serverutil.RespondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
-		return
-	}
+// NewLoginHandler returns the user login requests handler, authenticating the users of the given store.
+func NewLoginHandler(users *auth.UserStore, sessions *auth.SessionManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			serverutil.RespondWithError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
 
-	var req models.LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		serverutil.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
-		return
-	}
-	defer r.Body.Close()
+		var req models.LoginRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			serverutil.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		defer r.Body.Close()
 
-	req.Username = strings.TrimSpace(req.Username)
-	if req.Username == "" {
-		serverutil.RespondWithError(w, http.StatusBadRequest, "Username is required")
-		return
-	}
+		req.Username = strings.TrimSpace(req.Username)
+		if req.Username == "" {
+			serverutil.RespondWithError(w, http.StatusBadRequest, "Username is required")
+			return
+		}
 
-	if req.Password == "" {
-		serverutil.RespondWithError(w, http.StatusBadRequest, "Password is required")
-		return
-	}
+		if req.Password == "" {
+			serverutil.RespondWithError(w, http.StatusBadRequest, "Password is required")
+			return
+		}
+
+		user, err := users.Authenticate(req.Username, req.Password)
+		if err != nil {
+			log.Printf("WARN: Failed login attempt for username: %s", req.Username)
+			serverutil.RespondWithError(w, http.StatusUnauthorized, "Invalid username or password")
+			return
+		}
 
-	if req.Username == config.AppCredentials.Username && req.Password == config.AppCredentials.Password {
-		tokenString, _, err := auth.GenerateJWT(req.Username)
+		tokens, err := sessions.Issue(user.Username, user.Role)
 		if err != nil {
 			log.Printf("ERROR: Generating JWT: %v", err)
 			serverutil.RespondWithError(w, http.StatusInternalServerError, "Could not generate token")
 			return
 		}
 
-		serverutil.RespondWithJSON(w, http.StatusOK, models.LoginResponse{
-			Token:   tokenString,
-			Message: "Login successful",
-		})
-	} else {
-		log.Printf("WARN: Failed login attempt for username: %s", req.Username)
-		serverutil.RespondWithError(w, http.StatusUnauthorized, "Invalid username or password")
+		serverutil.RespondWithJSON(w, http.StatusOK, newLoginResponse(tokens, user.Role, "Login successful"))
+	}
+}
+
+// NewRefreshHandler returns the handler that exchanges a refresh token for new session tokens.
+// The refresh token is rotated, so each refresh token can be used only once, and the role is read from the users store.
+func NewRefreshHandler(users *auth.UserStore, sessions *auth.SessionManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req models.RefreshRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			serverutil.RespondWithError(w, http.StatusBadRequest, "Invalid request payload")
+			return
+		}
+		defer r.Body.Close()
+
+		if req.RefreshToken == "" {
+			serverutil.RespondWithError(w, http.StatusBadRequest, "Refresh token is required")
+			return
+		}
+
+		tokens, err := sessions.Refresh(req.RefreshToken, users.Get)
+		if errors.Is(err, auth.ErrInvalidRefreshToken) {
+			serverutil.RespondWithError(w, http.StatusUnauthorized, "Invalid or expired refresh token")
+			return
+		}
+		if err != nil {
+			log.Printf("ERROR: Refreshing session: %v", err)
+			serverutil.RespondWithError(w, http.StatusInternalServerError, "Could not generate token")
+			return
+		}
+
+		claims, err := auth.ValidateJWT(tokens.AccessToken)
+		if err != nil {
+			log.Printf("ERROR: Validating refreshed JWT: %v", err)
+			serverutil.RespondWithError(w, http.StatusInternalServerError, "Could not generate token")
+			return
+		}
+
+		serverutil.RespondWithJSON(w, http.StatusOK, newLoginResponse(tokens, claims.Role, "Token refreshed"))
+	}
+}
+
+// NewLogoutHandler returns the handler that revokes the session of the request token.
+func NewLogoutHandler(sessions *auth.SessionManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.ClaimsFromContext(r.Context())
+		if !ok {
+			serverutil.RespondWithError(w, http.StatusUnauthorized, "Missing token")
+			return
+		}
+
+		if claims.SessionID == "" {
+			serverutil.RespondWithError(w, http.StatusBadRequest, "Token is not bound to a session")
+			return
+		}
+
+		if err := sessions.Revoke(claims.SessionID); err != nil {
+			log.Printf("ERROR: Revoking session: %v", err)
+			serverutil.RespondWithError(w, http.StatusInternalServerError, "Could not revoke session")
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// newLoginResponse returns the response of the issued session tokens
+func newLoginResponse(tokens auth.TokenPair, role auth.Role, message string) models.LoginResponse {
+	return models.LoginResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    int64(time.Until(tokens.ExpiresAt).Seconds()),
+		Role:         string(role),
+		Message:      message,
 	}
 }
@@ -8,26 +8,24 @@ import (
 	"strings"
 	"testing"
 
+	"finala/api/auth"
 	"finala/api/handlers"
 	"finala/api/models"
-	"finala/config"
-	// "finala/serverutil" // Not directly used here but handlers depend on it
+	"path/filepath"
 )
 
 func TestLoginHandler(t *testing.T) {
-	// Store original AppCredentials and JWT secret if any, and restore after test
-	originalAppCreds := config.AppCredentials
-	// originalJWTSecret := auth.jwtSecretKey // If jwtSecretKey was public, otherwise can't easily mock it without DI
-
-	defer func() {
-		config.AppCredentials = originalAppCreds
-		// auth.jwtSecretKey = originalJWTSecret
-	}()
-
-	// Setup mock credentials for testing
-	config.AppCredentials = config.AuthCredentialsConfig{
-		Username: "testuser",
-		Password: "testpassword",
+	// Setup mock users store for testing
+	users, err := auth.NewUserStore(filepath.Join(t.TempDir(), "users.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Add("testuser", "testpassword", auth.RoleReporter); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := auth.NewSessionManager("", 0, 0)
+	if err != nil {
+		t.Fatal(err)
 	}
 
 	tests := []struct {
@@ -123,7 +121,7 @@ func TestLoginHandler(t *testing.T) {
 			}
 
 			rr := httptest.NewRecorder()
-			h := http.HandlerFunc(handlers.LoginHandler)
+			h := handlers.NewLoginHandler(users, sessions)
 			h.ServeHTTP(rr, req)
 
 			if status := rr.Code; status != tt.expectedStatusCode {
@@ -137,6 +135,10 @@ func TestLoginHandler(t *testing.T) {
 					t.Errorf("Failed to unmarshal response body: %v. Body: %s", err, rr.Body.String())
 				}
 
+				if resp.RefreshToken == "" || resp.ExpiresIn <= 0 {
+					t.Errorf("Expected refresh token and expiry in response. Body: %s", rr.Body.String())
+				}
+
 				if resp.Token == "" {
 					t.Errorf("Expected token in response, got none. Body: %s", rr.Body.String())
 				}
@@ -144,6 +146,13 @@ func TestLoginHandler(t *testing.T) {
 				if !strings.Contains(resp.Message, "Login successful") {
 					t.Errorf("Expected success message, got: %s", resp.Message)
 				}
+
+				claims, err := auth.ValidateJWT(resp.Token)
+				if err != nil {
+					t.Errorf("Expected valid token, got: %v", err)
+				} else if claims.Role != auth.RoleReporter {
+					t.Errorf("Expected token role %s, got: %s", auth.RoleReporter, claims.Role)
+				}
 			} else if tt.expectErrorMsg != "" {
 				var errResp struct { // Using anonymous struct as ErrorResponse is in serverutil
 					Error string `json:"error"`
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"finala/api/auth"
+	"finala/serverutil"
+)
+
+const (
+	// oidcStateCookie is the cookie that binds the login state to the browser that started the login
+	oidcStateCookie = "finala_oidc_state"
+
+	// oidcCookiePath limits the state cookie to the oidc routes
+	oidcCookiePath = "/api/v1/auth/oidc"
+)
+
+// NewOIDCLoginHandler returns the handler that redirects the user to the identity provider login.
+func NewOIDCLoginHandler(provider *auth.OIDCProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authURL, state, err := provider.AuthCodeURL()
+		if err != nil {
+			log.Printf("ERROR: Starting OIDC login: %v", err)
+			serverutil.RespondWithError(w, http.StatusInternalServerError, "Could not start single sign-on")
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    state,
+			Path:     oidcCookiePath,
+			MaxAge:   600,
+			HttpOnly: true,
+			Secure:   strings.HasPrefix(provider.RedirectURL(), "https://"),
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, authURL, http.StatusFound)
+	}
+}
+
+// NewOIDCCallbackHandler returns the identity provider callback handler, issuing a finala token for the authenticated user.
+func NewOIDCCallbackHandler(provider *auth.OIDCProvider, sessions *auth.SessionManager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if providerError := query.Get("error"); providerError != "" {
+			log.Printf("WARN: OIDC login failed: %s %s", providerError, query.Get("error_description"))
+			serverutil.RespondWithError(w, http.StatusUnauthorized, "Single sign-on failed")
+			return
+		}
+
+		state := query.Get("state")
+		cookie, err := r.Cookie(oidcStateCookie)
+		if err != nil || state == "" || cookie.Value != state {
+			serverutil.RespondWithError(w, http.StatusBadRequest, "Invalid login state")
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:   oidcStateCookie,
+			Path:   oidcCookiePath,
+			MaxAge: -1,
+		})
+
+		identity, err := provider.Exchange(r.Context(), state, query.Get("code"))
+		if errors.Is(err, auth.ErrOIDCNoRole) {
+			log.Printf("WARN: OIDC user without a mapped role: %v", err)
+			serverutil.RespondWithError(w, http.StatusForbidden, "User is not allowed to access finala")
+			return
+		}
+		if err != nil {
+			log.Printf("WARN: OIDC login failed: %v", err)
+			serverutil.RespondWithError(w, http.StatusUnauthorized, "Single sign-on failed")
+			return
+		}
+
+		tokens, err := sessions.IssueSingleSignOn(identity.Username, identity.Role)
+		if err != nil {
+			log.Printf("ERROR: Generating JWT: %v", err)
+			serverutil.RespondWithError(w, http.StatusInternalServerError, "Could not generate token")
+			return
+		}
+
+		// the tokens are passed in the url fragment, so they are not sent to the ui server
+		if provider.UIRedirectURL() != "" {
+			fragment := url.Values{
+				"token":         {tokens.AccessToken},
+				"refresh_token": {tokens.RefreshToken},
+			}
+			http.Redirect(w, r, provider.UIRedirectURL()+"#"+fragment.Encode(), http.StatusFound)
+			return
+		}
+
+		serverutil.RespondWithJSON(w, http.StatusOK, newLoginResponse(tokens, identity.Role, "Login successful"))
+	}
+}
@@ -0,0 +1,127 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"finala/api/auth"
+	apiconfig "finala/api/config"
+	"finala/api/handlers"
+	"finala/api/models"
+	"finala/api/testutils"
+)
+
+func TestOIDCLogin(t *testing.T) {
+
+	mock := testutils.NewMockOIDCProvider("finala")
+	defer mock.Close()
+	mock.Claims = map[string]interface{}{"groups": []string{"finops"}}
+	sessions, err := auth.NewSessionManager("", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name               string
+		uiRedirectURL      string
+		tamperState        bool
+		expectedStatusCode int
+	}{
+		{"json_response", "", false, http.StatusOK},
+		{"ui_redirect", "http://127.0.0.1:8080/login", false, http.StatusFound},
+		{"invalid_state", "", true, http.StatusBadRequest},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			provider, err := auth.NewOIDCProvider(context.Background(), apiconfig.OIDCConfig{
+				IssuerURL:     mock.URL(),
+				ClientID:      mock.ClientID,
+				RedirectURL:   "http://127.0.0.1:8089/api/v1/auth/oidc/callback",
+				Scopes:        []string{"openid"},
+				UsernameClaim: "preferred_username",
+				GroupsClaim:   "groups",
+				RoleMapping:   map[string]string{"finops": "reporter"},
+				UIRedirectURL: test.uiRedirectURL,
+			}, http.DefaultClient)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// start the login
+			rr := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil)
+			handlers.NewOIDCLoginHandler(provider).ServeHTTP(rr, req)
+			if rr.Code != http.StatusFound {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusFound)
+			}
+			cookies := rr.Result().Cookies()
+			if len(cookies) != 1 {
+				t.Fatalf("expected login state cookie")
+			}
+
+			// the mock provider approves the login and redirects back to the callback
+			client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			}}
+			resp, err := client.Get(rr.Header().Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			callback, err := url.Parse(resp.Header.Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.tamperState {
+				cookies[0].Value = "tampered"
+			}
+
+			rr = httptest.NewRecorder()
+			req, _ = http.NewRequest(http.MethodGet, "/api/v1/auth/oidc/callback?"+callback.RawQuery, nil)
+			req.AddCookie(cookies[0])
+			handlers.NewOIDCCallbackHandler(provider, sessions).ServeHTTP(rr, req)
+			if rr.Code != test.expectedStatusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v. Body: %s", rr.Code, test.expectedStatusCode, rr.Body.String())
+			}
+
+			token := ""
+			switch rr.Code {
+			case http.StatusOK:
+				var loginResponse models.LoginResponse
+				if err := json.Unmarshal(rr.Body.Bytes(), &loginResponse); err != nil {
+					t.Fatal(err)
+				}
+				token = loginResponse.Token
+			case http.StatusFound:
+				location := rr.Header().Get("Location")
+				if !strings.HasPrefix(location, test.uiRedirectURL+"#") {
+					t.Fatalf("unexpected ui redirect, got %s", location)
+				}
+				fragment, err := url.ParseQuery(strings.TrimPrefix(location, test.uiRedirectURL+"#"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if fragment.Get("refresh_token") == "" {
+					t.Fatalf("expected refresh token in ui redirect")
+				}
+				token = fragment.Get("token")
+			default:
+				return
+			}
+
+			claims, err := auth.ValidateJWT(token)
+			if err != nil {
+				t.Fatalf("expected a valid finala token, got %v", err)
+			}
+			if claims.Subject != "jane" || claims.Role != auth.RoleReporter {
+				t.Fatalf("unexpected token claims, got %s %s", claims.Subject, claims.Role)
+			}
+		})
+	}
+}
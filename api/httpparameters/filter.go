@@ -0,0 +1,421 @@
+package httpparameters
+
+import (
+	"finala/api/storage"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxFilterDepth defines the maximum nesting of parentheses and NOT in a filter expression
+	maxFilterDepth = 20
+
+	// rangeSeparator separates the bounds of a range filter_ value, e.g. 10..100
+	rangeSeparator = ".."
+)
+
+// tokenKind describes the kind of a filter expression token
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOperator
+	tokenOpen
+	tokenClose
+	tokenComma
+)
+
+// filterToken describes a token of a filter expression and its 1-based position in the expression
+type filterToken struct {
+	kind     tokenKind
+	text     string
+	position int
+}
+
+// String returns the token as it is shown in the errors
+func (t filterToken) String() string {
+	if t.kind == tokenEnd {
+		return "end of filter"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// isKeyword returns true when the token is the given keyword, keywords are case insensitive
+func (t filterToken) isKeyword(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+// filterOperators maps the comparison operators of the filter expression to the storage operators,
+// != is an IN that is negated
+var filterOperators = map[string]storage.Operator{
+	"=":  storage.OpIn,
+	"!=": storage.OpIn,
+	">":  storage.OpGreater,
+	">=": storage.OpGreaterOrEqual,
+	"<":  storage.OpLess,
+	"<=": storage.OpLessOrEqual,
+}
+
+// filterError returns an invalid filter error at the given position of the expression
+func filterError(position int, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s at position %d", storage.ErrInvalidFilter, fmt.Sprintf(format, args...), position)
+}
+
+// ParseFilterExpression parses a filter expression, e.g.
+// Data.PricePerMonth > 50 AND Data.Region IN (us-east-1, eu-west-1) AND NOT Data.Tag.env = prod
+//
+// Comparisons are joined with AND, OR and NOT and grouped with parentheses. A comparison is a dotted
+// document field, an operator (=, !=, >, >=, <, <=, IN or NOT IN) and a value or a list of values. Values
+// can be quoted with double or single quotes, the ordered operators need an unquoted number.
+// A nil expression is returned when the filter is empty
+func ParseFilterExpression(filter string) (storage.Expression, error) {
+	if strings.TrimSpace(filter) == "" {
+		return nil, nil
+	}
+
+	tokens, err := tokenizeFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := &filterParser{tokens: tokens}
+	expression, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if next := parser.peek(); next.kind != tokenEnd {
+		return nil, filterError(next.position, "unexpected %s, expected AND, OR or end of filter", next)
+	}
+	return expression, nil
+}
+
+// tokenizeFilter splits a filter expression to its tokens, the last token is always the end of the filter
+func tokenizeFilter(filter string) ([]filterToken, error) {
+	tokens := []filterToken{}
+	runes := []rune(filter)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		position := i + 1
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, filterToken{kind: tokenOpen, text: "(", position: position})
+			i++
+		case r == ')':
+			tokens = append(tokens, filterToken{kind: tokenClose, text: ")", position: position})
+			i++
+		case r == ',':
+			tokens = append(tokens, filterToken{kind: tokenComma, text: ",", position: position})
+			i++
+		case r == '=' || r == '!' || r == '<' || r == '>':
+			operator := string(r)
+			if i+1 < len(runes) && runes[i+1] == '=' && r != '=' {
+				operator += "="
+			}
+			if _, ok := filterOperators[operator]; !ok {
+				return nil, filterError(position, "unknown operator %q", operator)
+			}
+			tokens = append(tokens, filterToken{kind: tokenOperator, text: operator, position: position})
+			i += len(operator)
+		case r == '"' || r == '\'':
+			var text strings.Builder
+			i++
+			for ; i < len(runes) && runes[i] != r; i++ {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				}
+				text.WriteRune(runes[i])
+			}
+			if i == len(runes) {
+				return nil, filterError(position, "unterminated quoted value")
+			}
+			tokens = append(tokens, filterToken{kind: tokenString, text: text.String(), position: position})
+			i++
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(`(),=!<>"'`, runes[i]) {
+				i++
+			}
+			tokens = append(tokens, filterToken{kind: tokenWord, text: string(runes[start:i]), position: position})
+		}
+	}
+	return append(tokens, filterToken{kind: tokenEnd, position: len(runes) + 1}), nil
+}
+
+// filterParser is a recursive descent parser of the filter expression tokens
+type filterParser struct {
+	tokens  []filterToken
+	current int
+	depth   int
+}
+
+// peek returns the current token
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.current]
+}
+
+// next returns the current token and moves to the next one
+func (p *filterParser) next() filterToken {
+	token := p.tokens[p.current]
+	if token.kind != tokenEnd {
+		p.current++
+	}
+	return token
+}
+
+// nest increases the nesting depth, it returns an error when the expression is nested too deep
+func (p *filterParser) nest(token filterToken) error {
+	p.depth++
+	if p.depth > maxFilterDepth {
+		return filterError(token.position, "filter is nested deeper than %d levels", maxFilterDepth)
+	}
+	return nil
+}
+
+// parseOr parses expressions joined with OR
+func (p *filterParser) parseOr() (storage.Expression, error) {
+	expression, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	or := storage.Or{expression}
+	for p.peek().isKeyword("OR") {
+		p.next()
+		expression, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, expression)
+	}
+	if len(or) == 1 {
+		return or[0], nil
+	}
+	return or, nil
+}
+
+// parseAnd parses expressions joined with AND
+func (p *filterParser) parseAnd() (storage.Expression, error) {
+	expression, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	and := storage.And{expression}
+	for p.peek().isKeyword("AND") {
+		p.next()
+		expression, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, expression)
+	}
+	if len(and) == 1 {
+		return and[0], nil
+	}
+	return and, nil
+}
+
+// parseUnary parses a negated expression or a primary expression
+func (p *filterParser) parseUnary() (storage.Expression, error) {
+	if !p.peek().isKeyword("NOT") {
+		return p.parsePrimary()
+	}
+
+	if err := p.nest(p.next()); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+
+	expression, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return storage.Not{Expression: expression}, nil
+}
+
+// parsePrimary parses an expression in parentheses or a comparison
+func (p *filterParser) parsePrimary() (storage.Expression, error) {
+	if p.peek().kind != tokenOpen {
+		return p.parseComparison()
+	}
+
+	if err := p.nest(p.next()); err != nil {
+		return nil, err
+	}
+	defer func() { p.depth-- }()
+
+	expression, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if closing := p.next(); closing.kind != tokenClose {
+		return nil, filterError(closing.position, "unexpected %s, expected )", closing)
+	}
+	return expression, nil
+}
+
+// parseComparison parses a field, its operator and its values
+func (p *filterParser) parseComparison() (storage.Expression, error) {
+	field := p.next()
+	if field.kind != tokenWord || field.isKeyword("AND") || field.isKeyword("OR") || field.isKeyword("NOT") || field.isKeyword("IN") {
+		return nil, filterError(field.position, "unexpected %s, expected a field", field)
+	}
+	if err := storage.ValidateField(field.text); err != nil {
+		return nil, filterError(field.position, "%q is not a document field", field.text)
+	}
+
+	operator := p.next()
+	switch {
+	case operator.isKeyword("IN"):
+		values, err := p.parseValues()
+		if err != nil {
+			return nil, err
+		}
+		return storage.Comparison{Field: field.text, Operator: storage.OpIn, Values: values}, nil
+	case operator.isKeyword("NOT"):
+		if in := p.next(); !in.isKeyword("IN") {
+			return nil, filterError(in.position, "unexpected %s, expected IN after NOT", in)
+		}
+		values, err := p.parseValues()
+		if err != nil {
+			return nil, err
+		}
+		return storage.Not{Expression: storage.Comparison{Field: field.text, Operator: storage.OpIn, Values: values}}, nil
+	case operator.kind != tokenOperator:
+		return nil, filterError(operator.position, "unexpected %s, expected an operator after %s", operator, field.text)
+	}
+
+	value, err := p.parseValue(operator.text)
+	if err != nil {
+		return nil, err
+	}
+	comparison := storage.Comparison{Field: field.text, Operator: filterOperators[operator.text], Values: []storage.Value{value}}
+	if comparison.Operator.Ordered() && value.Number == nil {
+		return nil, filterError(operator.position, "%s %s needs a number, got %q", field.text, operator.text, value.Text)
+	}
+	if operator.text == "!=" {
+		return storage.Not{Expression: comparison}, nil
+	}
+	return comparison, nil
+}
+
+// parseValues parses a list of values in parentheses
+func (p *filterParser) parseValues() ([]storage.Value, error) {
+	if open := p.next(); open.kind != tokenOpen {
+		return nil, filterError(open.position, "unexpected %s, expected ( after IN", open)
+	}
+
+	values := []storage.Value{}
+	for {
+		value, err := p.parseValue("IN")
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		separator := p.next()
+		if separator.kind == tokenClose {
+			return values, nil
+		}
+		if separator.kind != tokenComma {
+			return nil, filterError(separator.position, "unexpected %s, expected , or )", separator)
+		}
+	}
+}
+
+// parseValue parses a quoted or unquoted value, unquoted numbers are numeric values
+func (p *filterParser) parseValue(after string) (storage.Value, error) {
+	token := p.next()
+	switch token.kind {
+	case tokenString:
+		return storage.Value{Text: token.text}, nil
+	case tokenWord:
+		return storage.NewValue(token.text), nil
+	}
+	return storage.Value{}, filterError(token.position, "unexpected %s, expected a value after %s", token, after)
+}
+
+// FilterParamsExpression returns the expression of the filter_ query params without their prefix. A filter
+// value is a comma separated list of values and ranges, a document matches when its field equals one of the
+// values or is in one of the ranges. A range is written min..max and either bound can be left out,
+// e.g. 10.. or ..100. A nil expression is returned when there are no filters
+func FilterParamsExpression(filters map[string]string) (storage.Expression, error) {
+	fields := make([]string, 0, len(filters))
+	for field := range filters {
+		if err := storage.ValidateField(field); err != nil {
+			return nil, fmt.Errorf("%w: %q is not a document field", storage.ErrInvalidFilter, field)
+		}
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	expressions := []storage.Expression{}
+	for _, field := range fields {
+		values := []string{}
+		matches := storage.Or{}
+		for _, item := range strings.Split(filters[field], ",") {
+			if r, ok := rangeExpression(field, item); ok {
+				matches = append(matches, r)
+				continue
+			}
+			values = append(values, item)
+		}
+		if len(values) > 0 {
+			matches = append(storage.Or{storage.In(field, values...)}, matches...)
+		}
+
+		if len(matches) == 1 {
+			expressions = append(expressions, matches[0])
+			continue
+		}
+		expressions = append(expressions, matches)
+	}
+	return storage.AndExpressions(expressions...), nil
+}
+
+// rangeExpression returns the expression of a min..max filter_ value, values whose bounds are not
+// numbers are not ranges
+func rangeExpression(field, value string) (storage.Expression, bool) {
+	minValue, maxValue, found := strings.Cut(value, rangeSeparator)
+	if !found || (minValue == "" && maxValue == "") {
+		return nil, false
+	}
+
+	bounds := storage.And{}
+	for _, bound := range []struct {
+		value    string
+		operator storage.Operator
+	}{{minValue, storage.OpGreaterOrEqual}, {maxValue, storage.OpLessOrEqual}} {
+		if bound.value == "" {
+			continue
+		}
+		number, err := strconv.ParseFloat(bound.value, 64)
+		if err != nil {
+			return nil, false
+		}
+		bounds = append(bounds, storage.Compare(field, bound.operator, number))
+	}
+	return storage.AndExpressions(bounds...), true
+}
+
+// FilterQueryExpression returns the expression of the filter query param and the filter_ prefixed query
+// params, a document must match all of them
+func FilterQueryExpression(filterParam string, queryParamFilterPrefix string, queryParams url.Values) (storage.Expression, error) {
+	expression, err := ParseFilterExpression(queryParams.Get(filterParam))
+	if err != nil {
+		return nil, err
+	}
+	paramsExpression, err := FilterParamsExpression(GetFilterQueryParamWithOutPrefix(queryParamFilterPrefix, queryParams))
+	if err != nil {
+		return nil, err
+	}
+	return storage.AndExpressions(paramsExpression, expression), nil
+}
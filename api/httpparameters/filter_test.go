@@ -0,0 +1,138 @@
+package httpparameters_test
+
+import (
+	"errors"
+	"finala/api/httpparameters"
+	"finala/api/storage"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseFilterExpression(t *testing.T) {
+
+	t.Run("valid", func(t *testing.T) {
+		testCases := []struct {
+			filter   string
+			expected storage.Expression
+		}{
+			{"", nil},
+			{"Data.Tag.env = prod", storage.In("Data.Tag.env", "prod")},
+			{
+				"Data.PricePerMonth > 50 AND Data.Region IN (us-east-1, eu-west-1) AND NOT Data.Tag.env = prod",
+				storage.And{
+					storage.Compare("Data.PricePerMonth", storage.OpGreater, 50),
+					storage.In("Data.Region", "us-east-1", "eu-west-1"),
+					storage.Not{Expression: storage.In("Data.Tag.env", "prod")},
+				},
+			},
+			{
+				"Data.PricePerMonth>=1 and Data.PricePerMonth<=2.5 or (Data.Tag.Team != 'fin ops' AND Data.Tag.Team not in (\"a\\\"b\", c))",
+				storage.Or{
+					storage.And{
+						storage.Compare("Data.PricePerMonth", storage.OpGreaterOrEqual, 1),
+						storage.Compare("Data.PricePerMonth", storage.OpLessOrEqual, 2.5),
+					},
+					storage.And{
+						storage.Not{Expression: storage.Comparison{Field: "Data.Tag.Team", Operator: storage.OpIn, Values: []storage.Value{{Text: "fin ops"}}}},
+						storage.Not{Expression: storage.Comparison{Field: "Data.Tag.Team", Operator: storage.OpIn, Values: []storage.Value{{Text: `a"b`}, storage.NewValue("c")}}},
+					},
+				},
+			},
+		}
+
+		for _, test := range testCases {
+			expression, err := httpparameters.ParseFilterExpression(test.filter)
+			if err != nil {
+				t.Fatalf("unexpected error for %q, got %v expected nil", test.filter, err)
+			}
+			if !reflect.DeepEqual(expression, test.expected) {
+				t.Fatalf("unexpected expression for %q, got %#v expected %#v", test.filter, expression, test.expected)
+			}
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		testCases := []struct {
+			filter        string
+			expectedError string
+		}{
+			{"Data.PricePerMonth > cheap", `Data.PricePerMonth > needs a number, got "cheap" at position 20`},
+			{"Data.Region IN us-east-1", `unexpected "us-east-1", expected ( after IN at position 16`},
+			{"(Data.Region = us-east-1", `unexpected end of filter, expected ) at position 25`},
+			{"Data.Region = us-east-1 Data.Tag.Team = finops", `unexpected "Data.Tag.Team", expected AND, OR or end of filter at position 25`},
+			{"Data..Region = us-east-1", `"Data..Region" is not a document field at position 1`},
+			{"Data.Region == us-east-1", `unexpected "=", expected a value after = at position 14`},
+			{"Data.Region = 'us-east-1", `unterminated quoted value at position 15`},
+			{"AND Data.Region = us-east-1", `unexpected "AND", expected a field at position 1`},
+			{"Data.Region ! us-east-1", `unknown operator "!" at position 13`},
+			{strings.Repeat("NOT ", 21) + "Data.Region = us-east-1", `filter is nested deeper than 20 levels at position 81`},
+		}
+
+		for _, test := range testCases {
+			_, err := httpparameters.ParseFilterExpression(test.filter)
+			if !errors.Is(err, storage.ErrInvalidFilter) {
+				t.Fatalf("unexpected error for %q, got %v expected %v", test.filter, err, storage.ErrInvalidFilter)
+			}
+			if !strings.HasSuffix(err.Error(), test.expectedError) {
+				t.Fatalf("unexpected error message for %q, got %s expected %s", test.filter, err.Error(), test.expectedError)
+			}
+		}
+	})
+}
+
+func TestFilterParamsExpression(t *testing.T) {
+	expression, err := httpparameters.FilterParamsExpression(map[string]string{
+		"Data.Tag.Team":      "finops,platform",
+		"Data.PricePerMonth": "0,10..20,..5",
+		"Data.Version":       "1..x",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error, got %v expected nil", err)
+	}
+
+	expected := storage.And{
+		storage.Or{
+			storage.In("Data.PricePerMonth", "0"),
+			storage.And{
+				storage.Compare("Data.PricePerMonth", storage.OpGreaterOrEqual, 10),
+				storage.Compare("Data.PricePerMonth", storage.OpLessOrEqual, 20),
+			},
+			storage.Compare("Data.PricePerMonth", storage.OpLessOrEqual, 5),
+		},
+		storage.In("Data.Tag.Team", "finops", "platform"),
+		storage.In("Data.Version", "1..x"),
+	}
+	if !reflect.DeepEqual(expression, expected) {
+		t.Fatalf("unexpected expression, got %#v expected %#v", expression, expected)
+	}
+
+	expression, err = httpparameters.FilterParamsExpression(map[string]string{})
+	if err != nil || expression != nil {
+		t.Fatalf("unexpected expression, got %v, %v expected nil", expression, err)
+	}
+
+	_, err = httpparameters.FilterParamsExpression(map[string]string{"Data.Tag.Team' OR 1=1": "finops"})
+	if !errors.Is(err, storage.ErrInvalidFilter) {
+		t.Fatalf("unexpected error, got %v expected %v", err, storage.ErrInvalidFilter)
+	}
+}
+
+func TestFilterQueryExpression(t *testing.T) {
+	v := url.Values{}
+	v.Set("filter", "Data.PricePerMonth > 50")
+	v.Set("filter_Data.Tag.Team", "finops")
+
+	expression, err := httpparameters.FilterQueryExpression("filter", "filter_", v)
+	if err != nil {
+		t.Fatalf("unexpected error, got %v expected nil", err)
+	}
+	expected := storage.And{
+		storage.In("Data.Tag.Team", "finops"),
+		storage.Compare("Data.PricePerMonth", storage.OpGreater, 50),
+	}
+	if !reflect.DeepEqual(expression, expected) {
+		t.Fatalf("unexpected expression, got %#v expected %#v", expression, expected)
+	}
+}
@@ -0,0 +1,253 @@
+package ingestion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"finala/api/storage"
+	"finala/serverutil"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// batchExtension describe the file extension of a queued events batch
+	batchExtension = ".json"
+
+	// tempExtension describe the file extension of a batch that was not fully written yet
+	tempExtension = ".tmp"
+
+	// defaultRetryInterval defines the wait time before a failed batch is saved again
+	defaultRetryInterval = 5 * time.Second
+)
+
+// ErrQueueFull is returned when the queue already holds the max number of pending batches
+var ErrQueueFull = errors.New("ingestion queue is full")
+
+// queuedBatch describe the content of a queued batch file
+type queuedBatch struct {
+	ExecutionID string
+	Rows        []string
+}
+
+// Queue is a bounded on disk queue of events batches. A batch is acknowledged once it is synced to
+// disk, and is saved to the storage in the background until the storage accepts it
+type Queue struct {
+	dir           string
+	maxBatches    int
+	retryInterval time.Duration
+	storage       storage.StorageDescriber
+
+	mu      sync.Mutex
+	pending int
+	seq     int64
+	notify  chan struct{}
+}
+
+// NewQueue creates the queue directory (if not exists) and returns a queue that holds up to maxBatches
+// pending batches. Batches that remained in the directory are saved once the queue is served
+func NewQueue(dir string, maxBatches int, retryInterval time.Duration, storage storage.StorageDescriber) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("could not create ingestion queue directory %s: %w", dir, err)
+	}
+	if retryInterval <= 0 {
+		retryInterval = defaultRetryInterval
+	}
+
+	queue := &Queue{
+		dir:           dir,
+		maxBatches:    maxBatches,
+		retryInterval: retryInterval,
+		storage:       storage,
+		notify:        make(chan struct{}, 1),
+	}
+
+	batches, err := queue.list()
+	if err != nil {
+		return nil, err
+	}
+	queue.pending = len(batches)
+
+	return queue, nil
+}
+
+// Len returns the number of pending batches
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pending
+}
+
+// Enqueue persists the events rows of an execution. The batch is written to a temporary file first
+// and renamed once synced, so a crash never leaves a partial batch behind
+func (q *Queue) Enqueue(executionID string, rows []string) error {
+	body, err := json.Marshal(queuedBatch{ExecutionID: executionID, Rows: rows})
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.maxBatches > 0 && q.pending >= q.maxBatches {
+		return ErrQueueFull
+	}
+
+	q.seq++
+	path := filepath.Join(q.dir, fmt.Sprintf("%020d-%06d%s", time.Now().UnixNano(), q.seq%1000000, batchExtension))
+	tempPath := path + tempExtension
+
+	file, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(body)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempPath, path)
+	}
+	if err != nil {
+		_ = os.Remove(tempPath)
+		return err
+	}
+
+	q.pending++
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Serve saves the queued batches to the storage until StopFunc is called
+func (q *Queue) Serve() serverutil.StopFunc {
+	ctx, cancelFn := context.WithCancel(context.Background())
+	stopped := make(chan bool)
+	go func() {
+		q.run(ctx)
+		stopped <- true
+	}()
+
+	return func() {
+		cancelFn()
+		<-stopped
+		log.WithField("pending", q.Len()).Warn("ingestion queue has been stopped")
+	}
+}
+
+// run saves the pending batches by order, a batch that could not be saved is retried after the retry interval
+func (q *Queue) run(ctx context.Context) {
+	for {
+		wait := q.notify
+		var retry <-chan time.Time
+		if err := q.drain(ctx); err != nil {
+			retry = time.After(q.retryInterval)
+			wait = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wait:
+		case <-retry:
+		}
+	}
+}
+
+// drain saves all the pending batches, it stops on the first batch that could not be saved
+func (q *Queue) drain(ctx context.Context) error {
+	batches, err := q.list()
+	if err != nil {
+		log.WithError(err).Error("could not list the ingestion queue batches")
+		return err
+	}
+
+	for _, path := range batches {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := q.save(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// save writes a queued batch to the storage and removes it from the queue. Events that the storage
+// rejects are logged and dropped, since saving them again would fail the same way
+func (q *Queue) save(path string) error {
+	body, err := os.ReadFile(path)
+	if err != nil {
+		log.WithError(err).WithField("path", path).Error("could not read ingestion queue batch")
+		return err
+	}
+
+	batch := queuedBatch{}
+	if err := json.Unmarshal(body, &batch); err != nil {
+		log.WithError(err).WithField("path", path).Error("dropping invalid ingestion queue batch")
+		return q.remove(path)
+	}
+
+	result, err := q.storage.SaveBatch(batch.Rows)
+	if err != nil {
+		log.WithError(err).WithFields(log.Fields{
+			"execution_id": batch.ExecutionID,
+			"events":       len(batch.Rows),
+		}).Error("could not save ingestion queue batch, retrying")
+		return err
+	}
+
+	for _, failure := range result.Failed {
+		log.WithFields(log.Fields{
+			"execution_id": batch.ExecutionID,
+			"event":        failure.Index,
+			"error":        failure.Error,
+		}).Warn("event was rejected by the storage")
+	}
+
+	return q.remove(path)
+}
+
+// remove deletes a saved batch from the queue
+func (q *Queue) remove(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pending > 0 {
+		q.pending--
+	}
+	return nil
+}
+
+// list returns the pending batches ordered by creation time
+func (q *Queue) list() ([]string, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	batches := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), batchExtension) {
+			continue
+		}
+		batches = append(batches, filepath.Join(q.dir, entry.Name()))
+	}
+	sort.Strings(batches)
+	return batches, nil
+}
@@ -0,0 +1,109 @@
+package ingestion_test
+
+import (
+	"errors"
+	"finala/api/ingestion"
+	"finala/api/storage"
+	"finala/api/testutils"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyStorage fails to save batches until it is marked as available
+type flakyStorage struct {
+	*testutils.MockStorage
+	mu        sync.Mutex
+	available bool
+	saved     [][]string
+}
+
+func (fs *flakyStorage) SaveBatch(data []string) (storage.BatchResult, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if !fs.available {
+		return storage.BatchResult{}, errors.New("storage is unavailable")
+	}
+	fs.saved = append(fs.saved, data)
+	return storage.BatchResult{Saved: len(data)}, nil
+}
+
+func (fs *flakyStorage) setAvailable() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.available = true
+}
+
+func (fs *flakyStorage) savedBatches() [][]string {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.saved
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("condition was not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	queue, err := ingestion.NewQueue(t.TempDir(), 2, time.Second, testutils.NewMockStorage())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := queue.Enqueue("general_1", []string{`{}`}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if err := queue.Enqueue("general_1", []string{`{}`}); !errors.Is(err, ingestion.ErrQueueFull) {
+		t.Fatalf("unexpected error, got %v expected %v", err, ingestion.ErrQueueFull)
+	}
+}
+
+func TestQueueSave(t *testing.T) {
+	dir := t.TempDir()
+	flaky := &flakyStorage{MockStorage: testutils.NewMockStorage()}
+
+	queue, err := ingestion.NewQueue(dir, 10, 50*time.Millisecond, flaky)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Enqueue("general_1", []string{`{"ResourceName":"resource_1"}`}); err != nil {
+		t.Fatal(err)
+	}
+	if err := queue.Enqueue("general_1", []string{`{"ResourceName":"resource_2"}`}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Queued batches remain after a restart
+	queue, err = ingestion.NewQueue(dir, 10, 50*time.Millisecond, flaky)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queue.Len() != 2 {
+		t.Fatalf("unexpected pending batches, got %d expected %d", queue.Len(), 2)
+	}
+
+	stop := queue.Serve()
+	defer stop()
+
+	time.Sleep(100 * time.Millisecond)
+	if queue.Len() != 2 {
+		t.Fatalf("unexpected pending batches while the storage is unavailable, got %d expected %d", queue.Len(), 2)
+	}
+
+	flaky.setAvailable()
+	waitFor(t, func() bool { return queue.Len() == 0 })
+
+	saved := flaky.savedBatches()
+	if len(saved) != 2 || saved[0][0] != `{"ResourceName":"resource_1"}` {
+		t.Fatalf("unexpected saved batches, got %v", saved)
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"finala/api/auth"
+	"finala/interpolation"
+)
+
+const (
+	// collectorAPIKeyHeader defines the header that holds the collector api key
+	collectorAPIKeyHeader = "X-API-Key"
+
+	// bearerPrefix defines the authorization header prefix of a JWT
+	bearerPrefix = "Bearer "
+)
+
+// collectorAuth allows only authenticated collectors to write events of their own executions.
+// The check is skipped when collector authentication is not enabled.
+func (server *Server) collectorAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		if server.collectorKeys == nil {
+			next(resp, req)
+			return
+		}
+
+		name, ok := server.collectorKeys.Authenticate(req.Header.Get(collectorAPIKeyHeader))
+		if !ok {
+			log.WithField("remote_addr", req.RemoteAddr).Warn("rejected collector request with invalid api key")
+			server.JSONWrite(resp, http.StatusUnauthorized, HttpErrorResponse{Error: "invalid collector api key"})
+			return
+		}
+
+		executionID := req.PathValue("executionID")
+		if !collectorExecution(name, executionID) {
+			log.WithFields(log.Fields{
+				"collector":    name,
+				"execution_id": executionID,
+			}).Warn("rejected collector request for a foreign execution")
+			server.JSONWrite(resp, http.StatusForbidden, HttpErrorResponse{Error: "execution does not belong to the collector"})
+			return
+		}
+
+		next(resp, req)
+	}
+}
+
+// collectorExecution returns true when the execution id is <collector name>_<unix time> of the given collector,
+// a collector name is never a prefix match, so the key of prod cannot write the executions of prod_eu
+func collectorExecution(collector string, executionID string) bool {
+	name, err := interpolation.ExtractExecutionName(executionID)
+	if err != nil || name != collector {
+		return false
+	}
+	timestamp, err := interpolation.ExtractTimestamp(executionID)
+	if err != nil || timestamp < 0 {
+		return false
+	}
+	// ParseInt accepts a sign and leading zeros, the collector writes the bare unix time
+	return executionID == name+"_"+strconv.FormatInt(timestamp, 10)
+}
+
+// requireRole allows only requests with a valid bearer token of a user with at least the given role
+func (server *Server) requireRole(role auth.Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(resp http.ResponseWriter, req *http.Request) {
+		header := req.Header.Get("Authorization")
+		if !strings.HasPrefix(header, bearerPrefix) {
+			resp.Header().Set("WWW-Authenticate", "Bearer")
+			server.JSONWrite(resp, http.StatusUnauthorized, HttpErrorResponse{Error: "missing bearer token"})
+			return
+		}
+
+		claims, err := auth.ValidateJWT(strings.TrimPrefix(header, bearerPrefix))
+		if err != nil {
+			log.WithError(err).WithField("path", req.URL.Path).Debug("rejected request with invalid token")
+			resp.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			server.JSONWrite(resp, http.StatusUnauthorized, HttpErrorResponse{Error: "invalid or expired token"})
+			return
+		}
+
+		if server.sessions != nil && server.sessions.IsRevoked(claims) {
+			resp.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			server.JSONWrite(resp, http.StatusUnauthorized, HttpErrorResponse{Error: "token has been revoked"})
+			return
+		}
+
+		if !claims.Role.Allows(role) {
+			log.WithFields(log.Fields{
+				"user": claims.Subject,
+				"role": claims.Role,
+				"path": req.URL.Path,
+			}).Warn("rejected request with insufficient role")
+			server.JSONWrite(resp, http.StatusForbidden, HttpErrorResponse{Error: "insufficient permissions"})
+			return
+		}
+
+		next(resp, req.WithContext(auth.ContextWithClaims(req.Context(), claims)))
+	}
+}
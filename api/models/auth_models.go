@@ -8,6 +8,15 @@ type LoginRequest struct {
 
 // LoginResponse defines the structure for the JSON response on successful login.
 type LoginResponse struct {
-	Token   string `json:"token"`
-	Message string `json:"message,omitempty"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	// ExpiresIn is the access token lifetime in seconds
+	ExpiresIn int64  `json:"expires_in"`
+	Role      string `json:"role"`
+	Message   string `json:"message,omitempty"`
+}
+
+// RefreshRequest defines the structure for the JSON body expected in token refresh requests.
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
 }
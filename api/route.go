@@ -1,15 +1,23 @@
 package api
 
 import (
+	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"finala/api/config"
+	"finala/api/diff"
 	"finala/api/email_utility"
+	"finala/api/export"
 	"finala/api/httpparameters"
+	"finala/api/ingestion"
 	"finala/api/storage"
 	"io"
+	"math"
+	"mime"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -17,17 +25,45 @@ import (
 
 const (
 	queryParamFilterPrefix     = "filter_"
+	queryParamFilter           = "filter"
 	resourceTrendsLimitDefault = 60
+
+	// resourcesPageSizeDefault is the number of resources per page when no page size is requested
+	resourcesPageSizeDefault = 100
+	// resourcesPageSizeMax is the max number of resources per page
+	resourcesPageSizeMax = 1000
+
+	// detectEventsMaxBodySize is the max size of the (decompressed) detect events request body
+	detectEventsMaxBodySize = 64 * 1024 * 1024
+
+	// detectEventsRetryAfter is the number of seconds a collector should wait when the ingestion queue is full
+	detectEventsRetryAfter = "30"
 )
 
-// DetectEventsInfo describes the incoming HTTP events
+// DetectEventsInfo describes the incoming HTTP events. The AccountID of a detected resource is saved as
+// the Data.AccountID field of the event, so the resources can be filtered by account
 type DetectEventsInfo struct {
 	ResourceName string
 	EventType    string
 	EventTime    int64
+	AccountID    string
 	Data         interface{}
 }
 
+// DetectEventsErrorResponse describes the events that could not be saved when the ingestion failed
+type DetectEventsErrorResponse struct {
+	Error string `json:"error"`
+	storage.BatchResult
+}
+
+// ResourcesResponse describes a page of the resources of a resource type
+type ResourcesResponse struct {
+	Resources []map[string]interface{} `json:"resources"`
+	Total     int64                    `json:"total"`
+	Page      int                      `json:"page"`
+	PageSize  int                      `json:"page_size"`
+}
+
 type ReportAPIResponse struct {
 	Message string     `json:"message"`
 	Status  int        `json:"status"`
@@ -38,9 +74,17 @@ type ReportAPIResponse struct {
 func (server *Server) GetSummary(resp http.ResponseWriter, req *http.Request) {
 	queryParams := req.URL.Query()
 	executionID := req.PathValue("executionID")
-	filters := httpparameters.GetFilterQueryParamWithOutPrefix(queryParamFilterPrefix, queryParams)
+	filter, err := httpparameters.FilterQueryExpression(queryParamFilter, queryParamFilterPrefix, queryParams)
+	if err != nil {
+		server.JSONWrite(resp, http.StatusBadRequest, HttpErrorResponse{Error: err.Error()})
+		return
+	}
 
-	response, err := server.storage.GetSummary(executionID, filters)
+	response, err := server.storage.GetSummary(executionID, filter)
+	if errors.Is(err, storage.ErrInvalidFilter) {
+		server.JSONWrite(resp, http.StatusBadRequest, HttpErrorResponse{Error: err.Error()})
+		return
+	}
 	if err != nil {
 		server.JSONWrite(resp, http.StatusInternalServerError, HttpErrorResponse{Error: err.Error()})
 		return
@@ -61,42 +105,139 @@ func (server *Server) GetExecutions(resp http.ResponseWriter, req *http.Request)
 	server.JSONWrite(resp, http.StatusOK, results)
 }
 
-// GetResourceData return resuts details by resource type
+// GetExecutionsDiff returns the resources that were added, removed or unchanged from execution a to
+// execution b, with the cost delta of every resource type
+func (server *Server) GetExecutionsDiff(resp http.ResponseWriter, req *http.Request) {
+	response, err := diff.Executions(server.storage, req.PathValue("a"), req.PathValue("b"))
+	if errors.Is(err, diff.ErrExecutionNotFound) {
+		server.JSONWrite(resp, http.StatusNotFound, HttpErrorResponse{Error: err.Error()})
+		return
+	}
+	if errors.Is(err, storage.ErrPageOutOfRange) {
+		server.JSONWrite(resp, http.StatusBadRequest, HttpErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		server.JSONWrite(resp, http.StatusInternalServerError, HttpErrorResponse{Error: err.Error()})
+		return
+	}
+	server.JSONWrite(resp, http.StatusOK, response)
+}
+
+// GetResourceData return a page of the resources of a resource type. The resources can be searched with q,
+// sorted with sort=<field>:asc|desc and projected with fields=<field>,<field>
 func (server *Server) GetResourceData(resp http.ResponseWriter, req *http.Request) {
 	queryParams := req.URL.Query()
 	queryErrs := url.Values{}
 	resourceType := req.PathValue("type")
-	var search string
-	filters := httpparameters.GetFilterQueryParamWithOutPrefix(queryParamFilterPrefix, queryParams)
 
 	executionID := req.URL.Query().Get("executionID")
 	if executionID == "" {
 		queryErrs.Add("executionID", "executionID field is mandatory")
 	}
 
+	query, page, pageSize := resourcesQuery(queryParams, queryErrs)
 	if len(queryErrs) > 0 {
 		server.JSONWrite(resp, http.StatusBadRequest, HttpErrorResponse{ErrorQuery: queryErrs})
 		return
 	}
 
-	response, err := server.storage.GetResources(resourceType, executionID, filters, search)
+	response, err := server.storage.GetResources(resourceType, executionID, query)
+	if errors.Is(err, storage.ErrInvalidField) || errors.Is(err, storage.ErrInvalidFilter) || errors.Is(err, storage.ErrPageOutOfRange) {
+		server.JSONWrite(resp, http.StatusBadRequest, HttpErrorResponse{Error: err.Error()})
+		return
+	}
 	if err != nil {
 		server.JSONWrite(resp, http.StatusInternalServerError, HttpErrorResponse{Error: err.Error()})
 		return
 
 	}
-	server.JSONWrite(resp, http.StatusOK, response)
+	server.JSONWrite(resp, http.StatusOK, ResourcesResponse{
+		Resources: response.Resources,
+		Total:     response.Total,
+		Page:      page,
+		PageSize:  pageSize,
+	})
+}
+
+// resourcesQuery parses the page, sort, projection, search and filter query params of the resources.
+// Invalid params are added to queryErrs
+func resourcesQuery(queryParams url.Values, queryErrs url.Values) (storage.ResourcesQuery, int, int) {
+	query := storage.ResourcesQuery{
+		Search: strings.TrimSpace(queryParams.Get("q")),
+	}
+
+	filter, err := httpparameters.FilterQueryExpression(queryParamFilter, queryParamFilterPrefix, queryParams)
+	if err != nil {
+		queryErrs.Add(queryParamFilter, err.Error())
+	}
+	query.Filter = filter
+
+	page := 1
+	if value := queryParams.Get("page"); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 {
+			queryErrs.Add("page", "page must be a positive number")
+		}
+		page = number
+	}
+
+	pageSize := resourcesPageSizeDefault
+	if value := queryParams.Get("page_size"); value != "" {
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 || number > resourcesPageSizeMax {
+			queryErrs.Add("page_size", "page_size must be a number between 1 and "+strconv.Itoa(resourcesPageSizeMax))
+		}
+		pageSize = number
+	}
+	// the offset of the page must fit an int
+	if pageSize > 0 && page > math.MaxInt/pageSize {
+		queryErrs.Add("page", "page must be at most "+strconv.Itoa(math.MaxInt/pageSize))
+	}
+	query.Offset = (page - 1) * pageSize
+	query.Limit = pageSize
+
+	if value := queryParams.Get("sort"); value != "" {
+		field, direction, _ := strings.Cut(value, ":")
+		query.Sort = storage.SortField{Field: field}
+		switch strings.ToLower(direction) {
+		case "", "asc":
+		case "desc":
+			query.Sort.Descending = true
+		default:
+			queryErrs.Add("sort", "sort direction must be asc or desc")
+		}
+		if storage.ValidateField(field) != nil {
+			queryErrs.Add("sort", "sort field must be a document field, such as Data.PricePerMonth")
+		}
+	}
+
+	if value := queryParams.Get("fields"); value != "" {
+		for _, field := range strings.Split(value, ",") {
+			field = strings.TrimSpace(field)
+			if storage.ValidateField(field) != nil {
+				queryErrs.Add("fields", "fields must be a comma separated list of document fields")
+				break
+			}
+			query.Fields = append(query.Fields, field)
+		}
+	}
+
+	return query, page, pageSize
 }
 
 // GetResourceTrends return trends by resource type, id, region and metric
 func (server *Server) GetResourceTrends(resp http.ResponseWriter, req *http.Request) {
 	queryParams := req.URL.Query()
 	resourceType := req.PathValue("type")
-	filters := httpparameters.GetFilterQueryParamWithOutPrefix(queryParamFilterPrefix, queryParams)
+	filter, err := httpparameters.FilterQueryExpression(queryParamFilter, queryParamFilterPrefix, queryParams)
+	if err != nil {
+		server.JSONWrite(resp, http.StatusBadRequest, HttpErrorResponse{Error: err.Error()})
+		return
+	}
 
 	limitString := req.URL.Query().Get("limit")
 	var limit int = resourceTrendsLimitDefault
-	var err error
 	if limitString != "" {
 		limit, err = strconv.Atoi(limitString)
 		if err != nil || limit < 1 {
@@ -104,7 +245,11 @@ func (server *Server) GetResourceTrends(resp http.ResponseWriter, req *http.Requ
 		}
 	}
 
-	trends, err := server.storage.GetResourceTrends(resourceType, filters, limit)
+	trends, err := server.storage.GetResourceTrends(resourceType, filter, limit)
+	if errors.Is(err, storage.ErrInvalidFilter) {
+		server.JSONWrite(resp, http.StatusBadRequest, HttpErrorResponse{Error: err.Error()})
+		return
+	}
 	if err != nil {
 		server.JSONWrite(resp, http.StatusInternalServerError, HttpErrorResponse{Error: err.Error()})
 		return
@@ -126,17 +271,114 @@ func (server *Server) GetExecutionTags(resp http.ResponseWriter, req *http.Reque
 	server.JSONWrite(resp, http.StatusOK, response)
 }
 
-// DetectEvents save collectors events data
+// exportResponseWriter sets the headers of the export file on the first write of its content
+type exportResponseWriter struct {
+	http.ResponseWriter
+	headers map[string]string
+	written bool
+}
+
+// Write sets the export headers before the first bytes of the file are written
+func (w *exportResponseWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		for key, value := range w.headers {
+			w.Header().Set(key, value)
+		}
+		w.written = true
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// ExportResources streams the detected resources of an execution as csv, xlsx or json, with the resource
+// tags flattened into columns. The resource types of the comma separated type query param are exported,
+// all the resource types of the execution when it is empty
+func (server *Server) ExportResources(resp http.ResponseWriter, req *http.Request) {
+	queryParams := req.URL.Query()
+	executionID := req.PathValue("executionID")
+
+	format, err := export.ParseFormat(queryParams.Get("format"))
+	if err != nil {
+		server.JSONWrite(resp, http.StatusBadRequest, HttpErrorResponse{Error: err.Error()})
+		return
+	}
+	filter, err := httpparameters.FilterQueryExpression(queryParamFilter, queryParamFilterPrefix, queryParams)
+	if err != nil {
+		server.JSONWrite(resp, http.StatusBadRequest, HttpErrorResponse{Error: err.Error()})
+		return
+	}
+	resourceTypes := []string{}
+	if value := queryParams.Get("type"); value != "" {
+		for _, resourceType := range strings.Split(value, ",") {
+			resourceTypes = append(resourceTypes, strings.TrimSpace(resourceType))
+		}
+	}
+
+	exporter, err := export.NewExporter(server.storage, executionID, resourceTypes, filter)
+	if errors.Is(err, storage.ErrInvalidFilter) {
+		server.JSONWrite(resp, http.StatusBadRequest, HttpErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		server.JSONWrite(resp, http.StatusInternalServerError, HttpErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// The response is streamed, the file headers are sent with its first bytes. An error before them is
+	// answered as an error, an error after them can only end the file early
+	fileName := "finala_" + executionID + "." + string(format)
+	writer := &exportResponseWriter{ResponseWriter: resp, headers: map[string]string{
+		"Content-Type":        format.ContentType(),
+		"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": fileName}),
+	}}
+	exported, err := exporter.Write(writer, format)
+	if err != nil {
+		log.WithError(err).WithField("execution_id", executionID).Error("could not export the resources")
+		if !writer.written {
+			server.JSONWrite(resp, http.StatusInternalServerError, HttpErrorResponse{Error: err.Error()})
+		}
+		return
+	}
+	log.WithFields(log.Fields{
+		"execution_id": executionID,
+		"format":       format,
+		"resources":    exported,
+	}).Debug("resources exported")
+}
+
+// DetectEvents save collectors events data in a single storage batch. The request is acknowledged only
+// once the events are saved, or queued on disk in the queue ingestion mode. Events that could not be
+// saved are reported back with 207 Multi-Status
 func (server *Server) DetectEvents(resp http.ResponseWriter, req *http.Request) {
 	executionID := req.PathValue("executionID")
 
-	buf, bodyErr := io.ReadAll(req.Body)
+	body := io.Reader(req.Body)
+	switch strings.ToLower(req.Header.Get("Content-Encoding")) {
+	case "":
+	case "gzip":
+		gzipReader, err := gzip.NewReader(req.Body)
+		if err != nil {
+			server.JSONWrite(resp, http.StatusBadRequest, HttpErrorResponse{Error: err.Error()})
+			return
+		}
+		defer gzipReader.Close()
+		body = gzipReader
+	default:
+		server.JSONWrite(resp, http.StatusUnsupportedMediaType, HttpErrorResponse{Error: "unsupported content encoding"})
+		return
+	}
+
+	buf, bodyErr := io.ReadAll(io.LimitReader(body, detectEventsMaxBodySize+1))
 
 	if bodyErr != nil {
 		server.JSONWrite(resp, http.StatusBadRequest, HttpErrorResponse{Error: bodyErr.Error()})
 		return
 	}
 
+	if len(buf) > detectEventsMaxBodySize {
+		server.JSONWrite(resp, http.StatusRequestEntityTooLarge, HttpErrorResponse{Error: "request body is too large"})
+		return
+	}
+
 	var detectEventsInfo []DetectEventsInfo
 	err := json.Unmarshal(buf, &detectEventsInfo)
 	if err != nil {
@@ -148,21 +390,58 @@ func (server *Server) DetectEvents(resp http.ResponseWriter, req *http.Request)
 		"events": len(detectEventsInfo),
 	}).Info("Got bulk events")
 
-	go func() {
-		for _, event := range detectEventsInfo {
+	rows := make([]string, 0, len(detectEventsInfo))
+	for _, event := range detectEventsInfo {
+		if data, ok := event.Data.(map[string]interface{}); ok && event.AccountID != "" {
+			data["AccountID"] = event.AccountID
+		}
+		rowData := storage.EventRow{
+			ExecutionID:  executionID,
+			ResourceName: event.ResourceName,
+			EventType:    event.EventType,
+			EventTime:    event.EventTime,
+			Timestamp:    time.Now(),
+			Data:         event.Data,
+		}
+		bolB, _ := json.Marshal(rowData)
+		rows = append(rows, string(bolB))
+	}
 
-			rowData := storage.EventRow{
-				ExecutionID:  executionID,
-				ResourceName: event.ResourceName,
-				EventType:    event.EventType,
-				EventTime:    event.EventTime,
-				Timestamp:    time.Now(),
-				Data:         event.Data,
-			}
-			bolB, _ := json.Marshal(rowData)
-			server.storage.Save(string(bolB))
+	if server.ingestionQueue != nil {
+		err := server.ingestionQueue.Enqueue(executionID, rows)
+		if errors.Is(err, ingestion.ErrQueueFull) {
+			resp.Header().Set("Retry-After", detectEventsRetryAfter)
+			server.JSONWrite(resp, http.StatusServiceUnavailable, DetectEventsErrorResponse{Error: err.Error()})
+			return
 		}
-	}()
+		if err != nil {
+			log.WithError(err).WithField("execution_id", executionID).Error("could not queue events")
+			server.JSONWrite(resp, http.StatusInternalServerError, DetectEventsErrorResponse{Error: err.Error()})
+			return
+		}
+		server.JSONWrite(resp, http.StatusAccepted, nil)
+		return
+	}
+
+	result, err := server.storage.SaveBatch(rows)
+	if err != nil {
+		log.WithError(err).WithField("execution_id", executionID).Error("could not save events")
+		server.JSONWrite(resp, http.StatusServiceUnavailable, DetectEventsErrorResponse{
+			Error:       err.Error(),
+			BatchResult: result,
+		})
+		return
+	}
+
+	if len(result.Failed) > 0 {
+		log.WithFields(log.Fields{
+			"execution_id": executionID,
+			"saved":        result.Saved,
+			"failed":       len(result.Failed),
+		}).Warn("some events could not be saved")
+		server.JSONWrite(resp, http.StatusMultiStatus, result)
+		return
+	}
 
 	server.JSONWrite(resp, http.StatusAccepted, nil)
 }
@@ -219,14 +498,21 @@ func (server *Server) SendReport(resp http.ResponseWriter, req *http.Request) {
 	responseMsg := "Email sent successfully"
 	statusCode := 200
 
-	//queryParams := req.URL.Query()
-	// filters := map[string]string{}
-	//filters := httpparameters.GetFilterQueryParamWithOutPrefix(queryParamFilterPrefix, queryParams)
-	responseData, err := server.storage.GetResources(resourceType, executionID, sendEmailInfo.Filters, sendEmailInfo.Search)
+	filter, err := httpparameters.FilterParamsExpression(sendEmailInfo.Filters)
+	if err != nil {
+		server.JSONWrite(resp, http.StatusBadRequest, HttpErrorResponse{Error: err.Error()})
+		return
+	}
+
+	resources, err := server.storage.GetResources(resourceType, executionID, storage.ResourcesQuery{
+		Filter: filter,
+		Search: sendEmailInfo.Search,
+	})
 	if err != nil {
 		server.JSONWrite(resp, http.StatusInternalServerError, HttpErrorResponse{Error: err.Error()})
 		return
 	}
+	responseData := resources.Resources
 
 	if len(responseData) == 0 {
 		server.JSONWrite(resp, http.StatusOK, ReportAPIResponse{Message: "No data", Status: statusCode})
@@ -11,7 +11,9 @@ import (
 
 	log "github.com/sirupsen/logrus"
 
+	"finala/api/auth"
 	authhandlers "finala/api/handlers"
+	"finala/api/ingestion"
 	"finala/api/storage"
 	"finala/serverutil"
 	"finala/version"
@@ -28,21 +30,34 @@ type Server struct {
 	httpserver *http.Server
 	storage    storage.StorageDescriber
 	version    version.VersionManagerDescriptor
+	// collectorKeys authenticates the collectors events ingestion, nil disables the authentication
+	collectorKeys *auth.CollectorKeyStore
+	users         *auth.UserStore
+	sessions      *auth.SessionManager
+	// oidc enables the single sign-on login, nil disables it
+	oidc *auth.OIDCProvider
+	// ingestionQueue acknowledges the collectors events once they are queued on disk, nil saves the events before responding
+	ingestionQueue *ingestion.Queue
 }
 
 // NewServer returns a new Server
-func NewServer(port int, storage storage.StorageDescriber, version version.VersionManagerDescriptor) *Server {
+func NewServer(port int, storage storage.StorageDescriber, version version.VersionManagerDescriptor, collectorKeys *auth.CollectorKeyStore, users *auth.UserStore, sessions *auth.SessionManager, oidc *auth.OIDCProvider, ingestionQueue *ingestion.Queue) *Server {
 
 	router := http.NewServeMux()
 	// Define more specific CORS options
 	allowedOrigins := handlers.AllowedOrigins([]string{"http://localhost:8080"})
 	allowedMethods := handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"})
-	allowedHeaders := handlers.AllowedHeaders([]string{"Content-Type", "Authorization", "X-Requested-With"})
+	allowedHeaders := handlers.AllowedHeaders([]string{"Content-Type", "Authorization", "X-Requested-With", collectorAPIKeyHeader})
 
 	return &Server{
-		router:  router,
-		storage: storage,
-		version: version,
+		router:         router,
+		storage:        storage,
+		version:        version,
+		collectorKeys:  collectorKeys,
+		users:          users,
+		sessions:       sessions,
+		oidc:           oidc,
+		ingestionQueue: ingestionQueue,
 		httpserver: &http.Server{
 			// Apply the more specific CORS options
 			Handler: handlers.CORS(allowedOrigins, allowedMethods, allowedHeaders)(router),
@@ -81,26 +96,84 @@ func (server *Server) Serve() serverutil.StopFunc {
 	}
 }
 
+// publicRoutes defines the routes that are served without a bearer token.
+// The collectors events ingestion is authenticated by the collector api key.
+var publicRoutes = map[string]bool{
+	"GET /api/v1/health":                       true,
+	"GET /api/v1/version":                      true,
+	"POST /api/v1/auth/login":                  true,
+	"POST /api/v1/auth/refresh":                true,
+	"GET /api/v1/auth/oidc/login":              true,
+	"GET /api/v1/auth/oidc/callback":           true,
+	"POST /api/v1/detect-events/{executionID}": true,
+}
+
+// routeRoles defines the minimum user role of the routes, other routes that are not public require the viewer role
+var routeRoles = map[string]auth.Role{
+	"POST /api/v1/send-report":                   auth.RoleReporter,
+	"GET /api/v1/admin/collector-keys":           auth.RoleAdmin,
+	"POST /api/v1/admin/collector-keys":          auth.RoleAdmin,
+	"DELETE /api/v1/admin/collector-keys/{name}": auth.RoleAdmin,
+	"POST /api/v1/admin/users/{username}/revoke": auth.RoleAdmin,
+	"GET /api/v1/admin/indexes":                  auth.RoleAdmin,
+	"POST /api/v1/admin/indexes/prune":           auth.RoleAdmin,
+	"DELETE /api/v1/admin/indexes/{name}":        auth.RoleAdmin,
+}
+
 // BindEndpoints sets up the router to handle API endpoints
 func (server *Server) BindEndpoints() {
 	// Add pattern handlers using Go 1.22's ServeMux
-	server.router.HandleFunc("GET /api/v1/summary/{executionID}", server.GetSummary)
-	server.router.HandleFunc("GET /api/v1/executions", server.GetExecutions)
-	server.router.HandleFunc("GET /api/v1/resources/{type}", server.GetResourceData)
-	server.router.HandleFunc("GET /api/v1/trends/{type}", server.GetResourceTrends)
-	server.router.HandleFunc("GET /api/v1/tags/{executionID}", server.GetExecutionTags)
-	server.router.HandleFunc("POST /api/v1/detect-events/{executionID}", server.DetectEvents)
-	server.router.HandleFunc("POST /api/v1/send-report", server.SendReport)
-	server.router.HandleFunc("GET /api/v1/version", server.VersionHandler)
-	server.router.HandleFunc("GET /api/v1/health", server.HealthCheckHandler)
+	server.handle("GET /api/v1/summary/{executionID}", server.GetSummary)
+	server.handle("GET /api/v1/executions", server.GetExecutions)
+	server.handle("GET /api/v1/executions/{a}/diff/{b}", server.GetExecutionsDiff)
+	server.handle("GET /api/v1/resources/{type}", server.GetResourceData)
+	server.handle("GET /api/v1/trends/{type}", server.GetResourceTrends)
+	server.handle("GET /api/v1/tags/{executionID}", server.GetExecutionTags)
+	server.handle("GET /api/v1/export/{executionID}", server.ExportResources)
+	server.handle("POST /api/v1/detect-events/{executionID}", server.collectorAuth(server.DetectEvents))
+	server.handle("POST /api/v1/send-report", server.SendReport)
+	server.handle("GET /api/v1/version", server.VersionHandler)
+	server.handle("GET /api/v1/health", server.HealthCheckHandler)
 
 	// ADDED: Login route
-	server.router.HandleFunc("POST /api/v1/auth/login", authhandlers.LoginHandler)
+	server.handle("POST /api/v1/auth/login", authhandlers.NewLoginHandler(server.users, server.sessions))
+	server.handle("POST /api/v1/auth/refresh", authhandlers.NewRefreshHandler(server.users, server.sessions))
+	server.handle("POST /api/v1/auth/logout", authhandlers.NewLogoutHandler(server.sessions))
+	if server.oidc != nil {
+		server.handle("GET /api/v1/auth/oidc/login", authhandlers.NewOIDCLoginHandler(server.oidc))
+		server.handle("GET /api/v1/auth/oidc/callback", authhandlers.NewOIDCCallbackHandler(server.oidc, server.sessions))
+	}
+
+	// Collectors api keys management
+	server.handle("GET /api/v1/admin/collector-keys", server.GetCollectorKeys)
+	server.handle("POST /api/v1/admin/collector-keys", server.CreateCollectorKey)
+	server.handle("DELETE /api/v1/admin/collector-keys/{name}", server.DeleteCollectorKey)
+
+	// Users sessions management
+	server.handle("POST /api/v1/admin/users/{username}/revoke", server.RevokeUserSessions)
+
+	// Storage indexes lifecycle
+	server.handle("GET /api/v1/admin/indexes", server.GetIndexes)
+	server.handle("POST /api/v1/admin/indexes/prune", server.PruneIndexes)
+	server.handle("DELETE /api/v1/admin/indexes/{name}", server.DeleteIndex)
 
 	// Add a catch-all handler for not found routes
 	server.router.HandleFunc("/", server.NotFoundRoute)
 }
 
+// handle registers the handler for the given pattern, routes that are not public require a valid bearer token
+// of a user with the route role
+func (server *Server) handle(pattern string, handler http.HandlerFunc) {
+	if !publicRoutes[pattern] {
+		role, ok := routeRoles[pattern]
+		if !ok {
+			role = auth.RoleViewer
+		}
+		handler = server.requireRole(role, handler)
+	}
+	server.router.HandleFunc(pattern, handler)
+}
+
 // Router returns the Go ServeMux HTTP router defined for this server
 func (server *Server) Router() *http.ServeMux {
 	return server.router
@@ -2,17 +2,29 @@ package api_test
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"finala/api"
+	"finala/api/auth"
+	"finala/api/diff"
+	"finala/api/ingestion"
+	"finala/api/models"
 	"finala/api/storage"
+	"finala/api/storage/memory"
 	"finala/api/testutils"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	notifier "github.com/similarweb/client-notifier"
 )
 
@@ -20,10 +32,26 @@ func MockServer() (*api.Server, *testutils.MockStorage) {
 	version := testutils.NewMockVersion()
 
 	mockStorage := testutils.NewMockStorage()
-	server := api.NewServer(9090, mockStorage, version)
+	sessions, _ := auth.NewSessionManager("", 0, 0)
+	server := api.NewServer(9090, mockStorage, version, nil, nil, sessions, nil, nil)
 	return server, mockStorage
 }
 
+// newAuthorizedRequest returns a new request with a valid bearer token
+func newAuthorizedRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	token, _, err := auth.GenerateJWT("admin", auth.RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req, nil
+}
+
 func TestInvalidRoue(t *testing.T) {
 
 	ms, _ := MockServer()
@@ -99,7 +127,7 @@ func TestGetSummary(t *testing.T) {
 		t.Run(test.endpoint, func(t *testing.T) {
 
 			rr := httptest.NewRecorder()
-			req, err := http.NewRequest("GET", test.endpoint, nil)
+			req, err := newAuthorizedRequest("GET", test.endpoint, nil)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -142,16 +170,25 @@ func TestGetResourcesData(t *testing.T) {
 		endpoint           string
 		expectedStatusCode int
 		Count              int
+		Total              int64
 	}{
-		{"/api/v1/resources/table", http.StatusBadRequest, 0},
-		{"/api/v1/resources/table?executionID=1", http.StatusOK, 2},
-		{"/api/v1/resources/table?executionID=err", http.StatusInternalServerError, 0},
+		{"/api/v1/resources/table", http.StatusBadRequest, 0, 0},
+		{"/api/v1/resources/table?executionID=1", http.StatusOK, 2, 2},
+		{"/api/v1/resources/table?executionID=1&page=2&page_size=1", http.StatusOK, 1, 2},
+		{"/api/v1/resources/table?executionID=1&page=3&page_size=1", http.StatusOK, 0, 2},
+		{"/api/v1/resources/table?executionID=1&page=0", http.StatusBadRequest, 0, 0},
+		{"/api/v1/resources/table?executionID=1&page=9223372036854775807&page_size=1000", http.StatusBadRequest, 0, 0},
+		{"/api/v1/resources/table?executionID=1&page_size=1001", http.StatusBadRequest, 0, 0},
+		{"/api/v1/resources/table?executionID=1&sort=Data.PricePerMonth:up", http.StatusBadRequest, 0, 0},
+		{"/api/v1/resources/table?executionID=1&sort=Data')--", http.StatusBadRequest, 0, 0},
+		{"/api/v1/resources/table?executionID=1&fields=Data.ResourceID,", http.StatusBadRequest, 0, 0},
+		{"/api/v1/resources/table?executionID=err", http.StatusInternalServerError, 0, 0},
 	}
 
 	for _, test := range testCases {
 		t.Run(test.endpoint, func(t *testing.T) {
 			rr := httptest.NewRecorder()
-			req, err := http.NewRequest("GET", test.endpoint, nil)
+			req, err := newAuthorizedRequest("GET", test.endpoint, nil)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -168,14 +205,17 @@ func TestGetResourcesData(t *testing.T) {
 					t.Fatal(err)
 				}
 
-				resourceData := &[]map[string]interface{}{}
+				resourceData := &api.ResourcesResponse{}
 				err = json.Unmarshal(body, resourceData)
 				if err != nil {
 					t.Fatalf("Could not parse http response")
 				}
 
-				if len(*resourceData) != test.Count {
-					t.Fatalf("unexpected resources data response, got %d expected %d", len(*resourceData), test.Count)
+				if len(resourceData.Resources) != test.Count {
+					t.Fatalf("unexpected resources data response, got %d expected %d", len(resourceData.Resources), test.Count)
+				}
+				if resourceData.Total != test.Total {
+					t.Fatalf("unexpected resources total, got %d expected %d", resourceData.Total, test.Total)
 				}
 
 			} else {
@@ -188,6 +228,43 @@ func TestGetResourcesData(t *testing.T) {
 	}
 
 }
+
+// TestGetResourcesData_Query tests that the page, sort, projection and search params are passed to the storage
+func TestGetResourcesData_Query(t *testing.T) {
+	ms, mockStorage := MockServer()
+	ms.Serve()
+
+	rr := httptest.NewRecorder()
+	req, err := newAuthorizedRequest("GET", "/api/v1/resources/table?executionID=1&page=3&page_size=20&sort=Data.PricePerMonth:desc&fields=Data.ResourceID,%20Data.Tag&q=web&filter_Data.Tag.Team=finops", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	expected := storage.ResourcesQuery{
+		Filter: storage.In("Data.Tag.Team", "finops"),
+		Search: "web",
+		Sort:   storage.SortField{Field: "Data.PricePerMonth", Descending: true},
+		Fields: []string{"Data.ResourceID", "Data.Tag"},
+		Offset: 40,
+		Limit:  20,
+	}
+	if !reflect.DeepEqual(mockStorage.ResourcesQuery, expected) {
+		t.Fatalf("unexpected resources query, got %v expected %v", mockStorage.ResourcesQuery, expected)
+	}
+
+	response := api.ResourcesResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Could not parse http response")
+	}
+	if response.Page != 3 || response.PageSize != 20 {
+		t.Fatalf("unexpected page, got %d/%d expected %d/%d", response.Page, response.PageSize, 3, 20)
+	}
+}
+
 func TestGetExecutions(t *testing.T) {
 	ms, _ := MockServer()
 	ms.Serve()
@@ -203,7 +280,7 @@ func TestGetExecutions(t *testing.T) {
 	for _, test := range testCases {
 		t.Run(test.endpoint, func(t *testing.T) {
 			rr := httptest.NewRecorder()
-			req, err := http.NewRequest("GET", test.endpoint, nil)
+			req, err := newAuthorizedRequest("GET", test.endpoint, nil)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -287,6 +364,144 @@ func TestSave(t *testing.T) {
 
 }
 
+func TestSavePartialFailure(t *testing.T) {
+	ms, mockStorage := MockServer()
+	ms.Serve()
+
+	rr := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/api/v1/detect-events/1", bytes.NewBufferString(`[{"ResourceName": "resource_1"}, {"ResourceName": "invalid"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusMultiStatus {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusMultiStatus)
+	}
+
+	result := storage.BatchResult{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Saved != 1 || len(result.Failed) != 1 || result.Failed[0].Index != 1 {
+		t.Fatalf("unexpected batch result, got %v", result)
+	}
+	if mockStorage.Events != 1 {
+		t.Fatalf("unexpected saved data, got %d expected %d", mockStorage.Events, 1)
+	}
+}
+
+func TestSaveStorageUnavailable(t *testing.T) {
+	ms, mockStorage := MockServer()
+	ms.Serve()
+
+	rr := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/api/v1/detect-events/1", bytes.NewBufferString(`[{"ResourceName": "resource_1"}, {"ResourceName": "unavailable"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusServiceUnavailable)
+	}
+
+	response := api.DetectEventsErrorResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Error == "" || len(response.Failed) != 2 {
+		t.Fatalf("unexpected error response, got %v", response)
+	}
+	if mockStorage.Events != 0 {
+		t.Fatalf("unexpected saved data, got %d expected %d", mockStorage.Events, 0)
+	}
+}
+
+func TestSaveIngestionQueue(t *testing.T) {
+	mockStorage := testutils.NewMockStorage()
+	queue, err := ingestion.NewQueue(t.TempDir(), 1, time.Second, mockStorage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, _ := auth.NewSessionManager("", 0, 0)
+	ms := api.NewServer(9090, mockStorage, testutils.NewMockVersion(), nil, nil, sessions, nil, queue)
+	ms.BindEndpoints()
+
+	for _, expectedStatusCode := range []int{http.StatusAccepted, http.StatusServiceUnavailable} {
+		rr := httptest.NewRecorder()
+		req, err := http.NewRequest("POST", "/api/v1/detect-events/1", bytes.NewBufferString(`[{"ResourceName": "resource_1"}]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ms.Router().ServeHTTP(rr, req)
+		if rr.Code != expectedStatusCode {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, expectedStatusCode)
+		}
+	}
+
+	if queue.Len() != 1 {
+		t.Fatalf("unexpected queued batches, got %d expected %d", queue.Len(), 1)
+	}
+	if mockStorage.Events != 0 {
+		t.Fatalf("unexpected saved data before the queue is served, got %d expected %d", mockStorage.Events, 0)
+	}
+}
+
+func TestSaveEncoding(t *testing.T) {
+
+	events := []map[string]string{
+		{"ResourceName": "resource_1"},
+		{"ResourceName": "resource_2"},
+	}
+	buf, err := json.Marshal(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gzipBuf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipBuf)
+	_, _ = gzipWriter.Write(buf)
+	_ = gzipWriter.Close()
+
+	testCases := []struct {
+		name               string
+		contentEncoding    string
+		body               []byte
+		expectedStatusCode int
+		expectedEvents     int
+	}{
+		{"gzip", "gzip", gzipBuf.Bytes(), http.StatusAccepted, 2},
+		{"invalid_gzip", "gzip", buf, http.StatusBadRequest, 0},
+		{"unsupported", "br", buf, http.StatusUnsupportedMediaType, 0},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ms, mockStorage := MockServer()
+			ms.Serve()
+
+			rr := httptest.NewRecorder()
+			req, err := http.NewRequest("POST", "/api/v1/detect-events/1", bytes.NewBuffer(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Encoding", test.contentEncoding)
+
+			ms.Router().ServeHTTP(rr, req)
+			if rr.Code != test.expectedStatusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, test.expectedStatusCode)
+			}
+
+			time.Sleep(time.Millisecond * 500)
+			if mockStorage.Events != test.expectedEvents {
+				t.Fatalf("unexpected saved data, got %d expected %d", mockStorage.Events, test.expectedEvents)
+			}
+		})
+	}
+}
+
 func TestGetExecutionTags(t *testing.T) {
 	ms, _ := MockServer()
 	ms.Serve()
@@ -303,7 +518,7 @@ func TestGetExecutionTags(t *testing.T) {
 	for _, test := range testCases {
 		t.Run(test.endpoint, func(t *testing.T) {
 			rr := httptest.NewRecorder()
-			req, err := http.NewRequest("GET", test.endpoint, nil)
+			req, err := newAuthorizedRequest("GET", test.endpoint, nil)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -318,7 +533,7 @@ func TestGetExecutionTags(t *testing.T) {
 					t.Fatal(err)
 				}
 
-				tagsData := &map[string][]string{}
+				tagsData := &map[string][]storage.TagValue{}
 
 				err = json.Unmarshal(body, tagsData)
 				if err != nil {
@@ -356,7 +571,7 @@ func TestGetResourceTrends(t *testing.T) {
 	for _, test := range testCases {
 		t.Run(test.endpoint, func(t *testing.T) {
 			rr := httptest.NewRecorder()
-			req, err := http.NewRequest("GET", test.endpoint, nil)
+			req, err := newAuthorizedRequest("GET", test.endpoint, nil)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -413,7 +628,7 @@ func TestVersion(t *testing.T) {
 	for _, test := range testCases {
 		t.Run(test.endpoint, func(t *testing.T) {
 			rr := httptest.NewRecorder()
-			req, err := http.NewRequest("GET", test.endpoint, nil)
+			req, err := newAuthorizedRequest("GET", test.endpoint, nil)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -451,3 +666,368 @@ func TestVersion(t *testing.T) {
 	}
 
 }
+
+func TestAuthentication(t *testing.T) {
+	ms, _ := MockServer()
+	ms.Serve()
+
+	validToken, _, err := auth.GenerateJWT("admin", auth.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiredToken := jwt.NewWithClaims(jwt.SigningMethodHS256, &jwt.RegisteredClaims{
+		Subject:   "admin",
+		Issuer:    "finala-api",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+	})
+	forgedToken, err := expiredToken.SignedString([]byte("not-the-api-secret-not-the-api-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name               string
+		endpoint           string
+		authorization      string
+		expectedStatusCode int
+	}{
+		{"missing_token", "/api/v1/summary/1", "", http.StatusUnauthorized},
+		{"invalid_token", "/api/v1/executions", "Bearer invalid", http.StatusUnauthorized},
+		{"forged_token", "/api/v1/resources/ec2", "Bearer " + forgedToken, http.StatusUnauthorized},
+		{"not_bearer", "/api/v1/trends/ec2", validToken, http.StatusUnauthorized},
+		{"valid_token", "/api/v1/summary/1", "Bearer " + validToken, http.StatusOK},
+		{"public_health", "/api/v1/health", "", http.StatusOK},
+		{"public_version", "/api/v1/version", "", http.StatusOK},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req, err := http.NewRequest("GET", test.endpoint, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+
+			ms.Router().ServeHTTP(rr, req)
+			if rr.Code != test.expectedStatusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, test.expectedStatusCode)
+			}
+		})
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	ms, _ := MockServer()
+	ms.Serve()
+
+	testCases := []struct {
+		name               string
+		method             string
+		endpoint           string
+		role               auth.Role
+		expectedStatusCode int
+	}{
+		{"viewer_read", "GET", "/api/v1/summary/1", auth.RoleViewer, http.StatusOK},
+		{"viewer_send_report", "POST", "/api/v1/send-report", auth.RoleViewer, http.StatusForbidden},
+		{"reporter_send_report", "POST", "/api/v1/send-report", auth.RoleReporter, http.StatusBadRequest},
+		{"reporter_admin", "GET", "/api/v1/admin/collector-keys", auth.RoleReporter, http.StatusForbidden},
+		{"admin_admin", "GET", "/api/v1/admin/collector-keys", auth.RoleAdmin, http.StatusNotFound},
+		{"viewer_prune_indexes", "POST", "/api/v1/admin/indexes/prune", auth.RoleViewer, http.StatusForbidden},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			token, _, err := auth.GenerateJWT("user", test.role)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			req, err := http.NewRequest(test.method, test.endpoint, bytes.NewBufferString("invalid"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			ms.Router().ServeHTTP(rr, req)
+			if rr.Code != test.expectedStatusCode {
+				t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, test.expectedStatusCode)
+			}
+		})
+	}
+}
+
+func TestLogout(t *testing.T) {
+	users, err := auth.NewUserStore(filepath.Join(t.TempDir(), "users.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := users.Add("jane", "jane-password", auth.RoleViewer); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := auth.NewSessionManager("", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms := api.NewServer(9090, testutils.NewMockStorage(), testutils.NewMockVersion(), nil, users, sessions, nil, nil)
+	ms.Serve()
+
+	send := func(method, endpoint, token string, body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req, err := http.NewRequest(method, endpoint, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		ms.Router().ServeHTTP(rr, req)
+		return rr
+	}
+
+	login := func() models.LoginResponse {
+		rr := send("POST", "/api/v1/auth/login", "", `{"username": "jane", "password": "jane-password"}`)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		loginResponse := models.LoginResponse{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &loginResponse); err != nil {
+			t.Fatal(err)
+		}
+		return loginResponse
+	}
+
+	// refresh returns new tokens of the session
+	session := login()
+	rr := send("POST", "/api/v1/auth/refresh", "", fmt.Sprintf(`{"refresh_token": %q}`, session.RefreshToken))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	refreshed := models.LoginResponse{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &refreshed); err != nil {
+		t.Fatal(err)
+	}
+
+	// logout revokes the access and refresh tokens of the session
+	if rr := send("POST", "/api/v1/auth/logout", refreshed.Token, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if rr := send("GET", "/api/v1/executions", refreshed.Token, ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+	if rr := send("POST", "/api/v1/auth/refresh", "", fmt.Sprintf(`{"refresh_token": %q}`, refreshed.RefreshToken)); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+
+	// revoking a user kills all of its sessions
+	session = login()
+	if rr := send("GET", "/api/v1/executions", session.Token, ""); rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if rr := send("POST", "/api/v1/admin/users/jane/revoke", session.Token, ""); rr.Code != http.StatusForbidden {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusForbidden)
+	}
+
+	adminToken, _, err := auth.GenerateJWT("admin", auth.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr := send("POST", "/api/v1/admin/users/jane/revoke", adminToken, ""); rr.Code != http.StatusNoContent {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNoContent)
+	}
+	if rr := send("GET", "/api/v1/executions", session.Token, ""); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusUnauthorized)
+	}
+}
+
+// TestMemoryStorage tests the events ingestion and queries end-to-end on the in memory storage
+func TestMemoryStorage(t *testing.T) {
+	sessions, _ := auth.NewSessionManager("", 0, 0)
+	ms := api.NewServer(9090, memory.NewStorageManager(), testutils.NewMockVersion(), nil, nil, sessions, nil, nil)
+	ms.Serve()
+
+	events := `[
+		{"ResourceName": "aws_ec2", "EventType": "service_status", "EventTime": 1, "Data": {"Status": 2, "ErrorMessage": ""}},
+		{"ResourceName": "aws_ec2", "EventType": "resource_detected", "EventTime": 2, "AccountID": "123456789012", "Data": {"ResourceID": "i-1", "PricePerMonth": 10, "Tag": {"Team": "finops"}}},
+		{"ResourceName": "aws_ec2", "EventType": "resource_detected", "EventTime": 3, "AccountID": "210987654321", "Data": {"ResourceID": "i-2", "PricePerMonth": 5.5, "Tag": {"Team": "platform"}}}
+	]`
+	rr := httptest.NewRecorder()
+	req, err := http.NewRequest("POST", "/api/v1/detect-events/general_1700000000", bytes.NewBufferString(events))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusAccepted)
+	}
+
+	get := func(endpoint string, response interface{}) {
+		rr := httptest.NewRecorder()
+		req, err := newAuthorizedRequest("GET", endpoint, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms.Router().ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), response); err != nil {
+			t.Fatalf("Could not parse http response")
+		}
+	}
+
+	summary := map[string]storage.CollectorsSummary{}
+	get("/api/v1/summary/general_1700000000", &summary)
+	if summary["aws_ec2"].ResourceCount != 2 || summary["aws_ec2"].TotalSpent != 15.5 || summary["aws_ec2"].Status != 2 {
+		t.Fatalf("unexpected summary response, got %v", summary)
+	}
+
+	executions := []storage.Executions{}
+	get("/api/v1/executions", &executions)
+	if len(executions) != 1 || executions[0].ID != "general_1700000000" {
+		t.Fatalf("unexpected executions response, got %v", executions)
+	}
+
+	resources := api.ResourcesResponse{}
+	get("/api/v1/resources/aws_ec2?executionID=general_1700000000", &resources)
+	if len(resources.Resources) != 2 || resources.Total != 2 {
+		t.Fatalf("unexpected resources data response, got %d expected %d", len(resources.Resources), 2)
+	}
+
+	resources = api.ResourcesResponse{}
+	get("/api/v1/resources/aws_ec2?executionID=general_1700000000&sort=Data.PricePerMonth:asc&page_size=1&fields=Data.ResourceID", &resources)
+	if len(resources.Resources) != 1 || resources.Total != 2 || resources.Resources[0]["Data"].(map[string]interface{})["ResourceID"] != "i-2" {
+		t.Fatalf("unexpected sorted resources response, got %v", resources)
+	}
+
+	trends := []storage.ExecutionCost{}
+	get("/api/v1/trends/aws_ec2?filter_Data.Tag.Team=platform", &trends)
+	if len(trends) != 1 || trends[0].CostSum != 5.5 {
+		t.Fatalf("unexpected trends response, got %v", trends)
+	}
+
+	tags := map[string][]storage.TagValue{}
+	get("/api/v1/tags/general_1700000000", &tags)
+	if len(tags["Team"]) != 2 || tags["Team"][0] != (storage.TagValue{Value: "finops", Count: 1}) {
+		t.Fatalf("unexpected tags response, got %v", tags)
+	}
+
+	summary = map[string]storage.CollectorsSummary{}
+	get("/api/v1/summary/general_1700000000?filter_Data.Tag.Team=platform", &summary)
+	if summary["aws_ec2"].ResourceCount != 1 || summary["aws_ec2"].TotalSpent != 5.5 || summary["aws_ec2"].Status != 2 {
+		t.Fatalf("unexpected filtered summary response, got %v", summary)
+	}
+
+	resources = api.ResourcesResponse{}
+	get("/api/v1/resources/aws_ec2?executionID=general_1700000000&filter_Data.PricePerMonth=6..", &resources)
+	if resources.Total != 1 || resources.Resources[0]["Data"].(map[string]interface{})["ResourceID"] != "i-1" {
+		t.Fatalf("unexpected filtered resources response, got %v", resources)
+	}
+
+	resources = api.ResourcesResponse{}
+	get("/api/v1/resources/aws_ec2?executionID=general_1700000000&filter="+
+		url.QueryEscape("Data.PricePerMonth > 5 AND (Data.Tag.Team IN (finops, ops) OR Data.ResourceID = 'i-3') AND NOT Data.Region = us-east-1"), &resources)
+	if resources.Total != 1 || resources.Resources[0]["Data"].(map[string]interface{})["ResourceID"] != "i-1" {
+		t.Fatalf("unexpected filter expression resources response, got %v", resources)
+	}
+
+	resources = api.ResourcesResponse{}
+	get("/api/v1/resources/aws_ec2?executionID=general_1700000000&filter="+url.QueryEscape("Data.AccountID = 210987654321"), &resources)
+	if resources.Total != 1 || resources.Resources[0]["Data"].(map[string]interface{})["ResourceID"] != "i-2" {
+		t.Fatalf("unexpected account filter resources response, got %v", resources)
+	}
+
+	summary = map[string]storage.CollectorsSummary{}
+	get("/api/v1/summary/general_1700000000?filter_Data.AccountID=123456789012", &summary)
+	if summary["aws_ec2"].ResourceCount != 1 || summary["aws_ec2"].TotalSpent != 10 {
+		t.Fatalf("unexpected account filter summary response, got %v", summary)
+	}
+
+	executionsDiff := diff.Result{}
+	get("/api/v1/executions/general_1700000000/diff/general_1700000000", &executionsDiff)
+	if len(executionsDiff.Unchanged) != 2 || len(executionsDiff.Added) != 0 || executionsDiff.ResourceTypes["aws_ec2"].ToCost != 15.5 {
+		t.Fatalf("unexpected executions diff response, got %v", executionsDiff)
+	}
+
+	rr = httptest.NewRecorder()
+	req, err = newAuthorizedRequest("GET", "/api/v1/executions/general_1700000000/diff/general_1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusNotFound)
+	}
+
+	rr = httptest.NewRecorder()
+	req, err = newAuthorizedRequest("GET", "/api/v1/export/general_1700000000?format=csv&type=aws_ec2&filter="+url.QueryEscape("Data.PricePerMonth > 6"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	expectedExport := "ResourceType,ResourceID,AccountID,PricePerMonth,Tag.Team\naws_ec2,i-1,123456789012,10,finops\n"
+	if rr.Body.String() != expectedExport || rr.Header().Get("Content-Disposition") != `attachment; filename=finala_general_1700000000.csv` {
+		t.Fatalf("unexpected export response, got %q %q expected %q", rr.Header().Get("Content-Disposition"), rr.Body.String(), expectedExport)
+	}
+
+	for _, endpoint := range []string{
+		"/api/v1/summary/general_1700000000?filter_Data..Tag=platform",
+		"/api/v1/summary/general_1700000000?filter=" + url.QueryEscape("Data.PricePerMonth > cheap"),
+		"/api/v1/resources/aws_ec2?executionID=general_1700000000&filter=" + url.QueryEscape("(Data.Tag.Team = finops"),
+		"/api/v1/export/general_1700000000?format=pdf",
+		"/api/v1/export/general_1700000000?filter=" + url.QueryEscape("Data.Region IN us-east-1"),
+	} {
+		rr = httptest.NewRecorder()
+		req, err = newAuthorizedRequest("GET", endpoint, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ms.Router().ServeHTTP(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("handler returned wrong status code for %s: got %v want %v", endpoint, rr.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+// failingResourcesStorage is a storage whose full read of the resources fails
+type failingResourcesStorage struct {
+	storage.StorageDescriber
+}
+
+func (s failingResourcesStorage) EachResource(resourceType string, executionID string, filter storage.Expression, fn func(resource map[string]interface{}) error) error {
+	return errors.New("storage is unavailable")
+}
+
+func TestExportResources_StorageError(t *testing.T) {
+	sm := memory.NewStorageManager()
+	_, err := sm.SaveBatch([]string{
+		`{"ExecutionID":"general_1700000000","ResourceName":"aws_ec2","EventType":"resource_detected","EventTime":2,"Data":{"ResourceID":"i-1"}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, _ := auth.NewSessionManager("", 0, 0)
+	ms := api.NewServer(9090, failingResourcesStorage{StorageDescriber: sm}, testutils.NewMockVersion(), nil, nil, sessions, nil, nil)
+	ms.Serve()
+
+	rr := httptest.NewRecorder()
+	req, err := newAuthorizedRequest("GET", "/api/v1/export/general_1700000000?format=csv", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms.Router().ServeHTTP(rr, req)
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("handler returned wrong status code: got %v want %v", rr.Code, http.StatusInternalServerError)
+	}
+	if rr.Header().Get("Content-Disposition") != "" {
+		t.Fatalf("unexpected export file header, got %q", rr.Header().Get("Content-Disposition"))
+	}
+}
@@ -0,0 +1,96 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"finala/api/storage"
+	"fmt"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultBatchSize defines how many events are saved per storage batch when an archive is imported
+const DefaultBatchSize = 500
+
+// ErrExportNotSupported is returned when the storage cannot read back its saved events
+var ErrExportNotSupported = errors.New("storage does not support export")
+
+// Export writes every event of the storage to w as NDJSON, one event document per line, and returns the number of exported events
+func Export(w io.Writer, s storage.StorageDescriber) (int, error) {
+	exporter, ok := s.(storage.EventsExporter)
+	if !ok {
+		return 0, ErrExportNotSupported
+	}
+
+	writer := bufio.NewWriter(w)
+	exported := 0
+	err := exporter.ExportEvents(func(document string) error {
+		if _, err := writer.WriteString(document); err != nil {
+			return err
+		}
+		if err := writer.WriteByte('\n'); err != nil {
+			return err
+		}
+		exported++
+		return nil
+	})
+	if err != nil {
+		return exported, err
+	}
+	return exported, writer.Flush()
+}
+
+// Import saves the events of an NDJSON archive in batches of the given size. The failures index is the
+// line of the event in the archive, counting from 0. An error is returned when a batch could not be saved
+func Import(r io.Reader, s storage.StorageDescriber, batchSize int) (storage.BatchResult, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	result := storage.BatchResult{}
+	reader := bufio.NewReader(r)
+	batch := make([]string, 0, batchSize)
+	positions := make([]int, 0, batchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		batchResult, err := s.SaveBatch(batch)
+		result.Saved += batchResult.Saved
+		for _, failure := range batchResult.Failed {
+			result.Failed = append(result.Failed, storage.BatchFailure{Index: positions[failure.Index], Error: failure.Error})
+		}
+		log.WithFields(log.Fields{
+			"saved":  result.Saved,
+			"failed": len(result.Failed),
+		}).Debug("archive batch imported")
+		batch = batch[:0]
+		positions = positions[:0]
+		return err
+	}
+
+	for line := 0; ; line++ {
+		row, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return result, fmt.Errorf("could not read line %d of the archive: %w", line+1, readErr)
+		}
+
+		row = bytes.TrimSpace(row)
+		if len(row) > 0 {
+			batch = append(batch, string(row))
+			positions = append(positions, line)
+		}
+
+		if len(batch) == batchSize || readErr == io.EOF {
+			if err := flush(); err != nil {
+				return result, err
+			}
+		}
+		if readErr == io.EOF {
+			return result, nil
+		}
+	}
+}
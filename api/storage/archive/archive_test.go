@@ -0,0 +1,98 @@
+package archive
+
+import (
+	"bytes"
+	"finala/api/storage"
+	"finala/api/storage/memory"
+	"finala/api/testutils"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func resourceEvent(executionID, resourceID string, price float64) string {
+	return fmt.Sprintf(`{"ExecutionID":"%s","ResourceName":"aws_ec2","EventType":"resource_detected","EventTime":1,`+
+		`"Data":{"ResourceID":"%s","PricePerMonth":%g,"Tag":{"Team":"finops"}}}`, executionID, resourceID, price)
+}
+
+// TestExportImport tests that an exported storage is imported into another storage with the same content.
+func TestExportImport(t *testing.T) {
+	source := memory.NewStorageManager()
+	_, err := source.SaveBatch([]string{
+		`{"ExecutionID":"general_1700000000","ResourceName":"aws_ec2","EventType":"service_status","EventTime":1700000000,"Data":{"Status":2,"ErrorMessage":""}}`,
+		resourceEvent("general_1700000000", "i-1", 10),
+		resourceEvent("general_1700000000", "i-2", 0),
+		resourceEvent("general_1700086400", "i-1", 12.5),
+	})
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	exported, err := Export(&buf, source)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, exported)
+	assert.Equal(t, 4, strings.Count(buf.String(), "\n"))
+
+	target := memory.NewStorageManager()
+	result, err := Import(&buf, target, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, storage.BatchResult{Saved: 4}, result)
+
+	for _, executionID := range []string{"general_1700000000", "general_1700086400"} {
+		expected, _ := source.GetSummary(executionID, nil)
+		imported, _ := target.GetSummary(executionID, nil)
+		assert.Equal(t, expected, imported)
+
+		expectedResources, _ := source.GetResources("aws_ec2", executionID, storage.ResourcesQuery{})
+		importedResources, _ := target.GetResources("aws_ec2", executionID, storage.ResourcesQuery{})
+		assert.Equal(t, expectedResources, importedResources, "expected the documents to keep their ids")
+	}
+
+	// Importing the archive again replaces the saved events
+	buf.Reset()
+	_, err = Export(&buf, source)
+	assert.NoError(t, err)
+	_, err = Import(&buf, target, 0)
+	assert.NoError(t, err)
+	executions, _ := target.GetExecutions(0)
+	assert.Len(t, executions, 2)
+	resources, _ := target.GetResources("aws_ec2", "general_1700000000", storage.ResourcesQuery{})
+	assert.Equal(t, int64(2), resources.Total)
+}
+
+// TestImport_InvalidEvents tests that the failures are reported with the archive line of the event.
+func TestImport_InvalidEvents(t *testing.T) {
+	archive := strings.Join([]string{
+		resourceEvent("general_1700000000", "i-1", 10),
+		"",
+		`{"ResourceName":"aws_ec2"}`,
+		resourceEvent("general_1700000000", "i-2", 10),
+		`not json`,
+	}, "\n")
+
+	result, err := Import(strings.NewReader(archive), memory.NewStorageManager(), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Saved)
+	assert.Len(t, result.Failed, 2)
+	assert.Equal(t, 2, result.Failed[0].Index)
+	assert.Equal(t, 4, result.Failed[1].Index)
+}
+
+// TestImport_StorageUnavailable tests that the import stops when a batch could not be saved.
+func TestImport_StorageUnavailable(t *testing.T) {
+	archive := `{"ResourceName":"resource_1"}` + "\n" + `{"ResourceName":"unavailable"}` + "\n" + `{"ResourceName":"resource_2"}`
+
+	mockStorage := testutils.NewMockStorage()
+	result, err := Import(strings.NewReader(archive), mockStorage, 2)
+	assert.Error(t, err)
+	assert.Equal(t, 0, result.Saved)
+	assert.Len(t, result.Failed, 2)
+	assert.Equal(t, 0, mockStorage.Events, "expected the import to stop at the failed batch")
+}
+
+// TestExport_NotSupported tests the export of a storage that cannot read back its events.
+func TestExport_NotSupported(t *testing.T) {
+	_, err := Export(&bytes.Buffer{}, testutils.NewMockStorage())
+	assert.ErrorIs(t, err, ErrExportNotSupported)
+}
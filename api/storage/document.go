@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// DocumentID returns a deterministic id of an event document, so an event that is sent twice replaces
+// the existing document. Detected resources are identified by the execution, resource, resource id, metric
+// and account when it is recorded, other events by the execution, resource, event type and event time
+func DocumentID(doc map[string]interface{}) string {
+	parts := []string{fmt.Sprint(doc["ExecutionID"]), fmt.Sprint(doc["ResourceName"])}
+
+	data, _ := doc["Data"].(map[string]interface{})
+	if resourceID, ok := data["ResourceID"]; ok && resourceID != "" {
+		parts = append(parts, fmt.Sprint(resourceID), fmt.Sprint(data["Metric"]))
+		// The resources of different accounts can have the same id, e.g. the load balancer names
+		if accountID, ok := data["AccountID"]; ok && accountID != "" {
+			parts = append(parts, fmt.Sprint(accountID))
+		}
+	} else {
+		parts = append(parts, fmt.Sprint(doc["EventType"]), fmt.Sprint(doc["EventTime"]))
+	}
+
+	hash := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,696 @@
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"finala/api/config"
+	"finala/api/storage"
+	"finala/interpolation"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrMissingEndpoints is returned when no elasticsearch endpoint is configured
+	ErrMissingEndpoints = errors.New("elasticsearch endpoints are not configured")
+	// ErrAggregationTermNotFound is returned when the response does not include the requested aggregation
+	ErrAggregationTermNotFound = errors.New("aggregation terms was not found")
+)
+
+const (
+	// indexDayLayout defines the date layout of the daily index names
+	indexDayLayout = "2006-01-02"
+
+	// requestTimeout defines how long to wait for an elasticsearch response
+	requestTimeout = 30 * time.Second
+
+	// maxResultWindow defines the max number of documents and aggregation buckets a query returns
+	maxResultWindow = 10000
+
+	// scrollPageSize defines how many documents are fetched per scroll page
+	scrollPageSize = 1000
+
+	// eventServiceStatus describes the status event of a collected resource type
+	eventServiceStatus = "service_status"
+
+	// eventResourceDetected describes a detected resource event
+	eventResourceDetected = "resource_detected"
+)
+
+// StorageManager describes elasticsearchStorage
+type StorageManager struct {
+	client      *elastic.Client
+	indexPrefix string
+
+	mu              sync.RWMutex
+	currentIndexDay string
+}
+
+// NewStorageManager creates new elasticsearch storage. The index template is applied on every start,
+// and a new daily index is created when the day changes
+func NewStorageManager(conf config.ElasticsearchConfig) (*StorageManager, error) {
+	if len(conf.Endpoints) == 0 {
+		return nil, ErrMissingEndpoints
+	}
+
+	options := []elastic.ClientOptionFunc{
+		elastic.SetURL(conf.Endpoints...),
+		// The nodes addresses are not reachable from outside of a docker network
+		elastic.SetSniff(false),
+	}
+	if conf.Username != "" || conf.Password != "" {
+		options = append(options, elastic.SetBasicAuth(conf.Username, conf.Password))
+	}
+
+	client, err := elastic.NewClient(options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to elasticsearch: %w", err)
+	}
+
+	storageManager := &StorageManager{
+		client:      client,
+		indexPrefix: conf.Index,
+	}
+
+	if err := storageManager.putIndexTemplate(); err != nil {
+		return nil, err
+	}
+
+	if !storageManager.setCreateCurrentIndexDay() {
+		return nil, errors.New("could not create initial index")
+	}
+
+	go func() {
+		for {
+			now := time.Now().In(time.UTC)
+			diff := storageManager.getDurationUntilTomorrow(now)
+			log.WithFields(log.Fields{
+				"now":      now,
+				"duration": diff,
+			}).Info("next index change check in")
+			<-time.After(diff)
+			storageManager.setCreateCurrentIndexDay()
+		}
+	}()
+
+	return storageManager, nil
+}
+
+// putIndexTemplate creates or updates the template of the daily indexes
+func (sm *StorageManager) putIndexTemplate() error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	_, err := sm.client.IndexPutIndexTemplate(sm.indexPrefix).BodyString(indexTemplate(sm.indexPrefix)).Do(ctx)
+	if err != nil {
+		return fmt.Errorf("could not put the index template %s: %w", sm.indexPrefix, err)
+	}
+	log.WithField("template", sm.indexPrefix).Info("index template applied")
+	return nil
+}
+
+// getDurationUntilTomorrow calculates the duration until the next day in UTC
+func (sm *StorageManager) getDurationUntilTomorrow(t time.Time) time.Duration {
+	year, month, day := t.Date()
+	tomorrow := time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+	return tomorrow.Sub(t)
+}
+
+// indexName returns the daily index name of the given time
+func (sm *StorageManager) indexName(t time.Time) string {
+	return fmt.Sprintf("%s-%s", sm.indexPrefix, t.In(time.UTC).Format(indexDayLayout))
+}
+
+// searchIndex returns the pattern of all the daily indexes
+func (sm *StorageManager) searchIndex() string {
+	return sm.indexPrefix + "-*"
+}
+
+// getCurrentIndexDay returns the index that new events are written to
+func (sm *StorageManager) getCurrentIndexDay() string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.currentIndexDay
+}
+
+// setCreateCurrentIndexDay sets the current index name and ensures it exists
+func (sm *StorageManager) setCreateCurrentIndexDay() bool {
+	index := sm.indexName(time.Now())
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	exists, err := sm.client.IndexExists(index).Do(ctx)
+	if err != nil {
+		log.WithError(err).WithField("index", index).Error("Failed to check if index exists")
+		return false
+	}
+
+	if !exists {
+		log.WithField("index", index).Info("Index does not exist, creating...")
+		_, err := sm.client.CreateIndex(index).Do(ctx)
+		if err != nil && !elastic.IsConflict(err) && !isIndexAlreadyExists(err) {
+			log.WithError(err).WithField("index", index).Error("Failed to create index")
+			return false
+		}
+		log.WithField("index", index).Info("Index created successfully")
+	}
+
+	sm.mu.Lock()
+	sm.currentIndexDay = index
+	sm.mu.Unlock()
+	return true
+}
+
+// isIndexAlreadyExists returns true when the index was created by another api instance
+func isIndexAlreadyExists(err error) bool {
+	elasticErr, ok := err.(*elastic.Error)
+	return ok && elasticErr.Details != nil && elasticErr.Details.Type == "resource_already_exists_exception"
+}
+
+// Save new documents
+func (sm *StorageManager) Save(data string) bool {
+	result, err := sm.SaveBatch([]string{data})
+	if err != nil || len(result.Failed) > 0 {
+		log.WithField("data", data).Error("Fail to save document")
+		return false
+	}
+	return true
+}
+
+// SaveBatch saves the documents with a single bulk request. Documents that are not valid or rejected by
+// elasticsearch are reported as failures, an error is returned when the bulk request failed
+func (sm *StorageManager) SaveBatch(data []string) (storage.BatchResult, error) {
+	result := storage.BatchResult{}
+	index := sm.getCurrentIndexDay()
+	bulk := sm.client.Bulk().Index(index)
+	positions := make([]int, 0, len(data))
+	for i, row := range data {
+		id, err := documentID(row)
+		if err != nil {
+			result.Failed = append(result.Failed, storage.BatchFailure{Index: i, Error: err.Error()})
+			continue
+		}
+		bulk.Add(elastic.NewBulkIndexRequest().Id(id).Doc(json.RawMessage(row)))
+		positions = append(positions, i)
+	}
+
+	if len(positions) == 0 {
+		return result, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	response, err := bulk.Do(ctx)
+	if err != nil {
+		log.WithFields(log.Fields{
+			"index":     index,
+			"documents": len(positions),
+		}).WithError(err).Error("Fail to save documents batch")
+		for _, position := range positions {
+			result.Failed = append(result.Failed, storage.BatchFailure{Index: position, Error: err.Error()})
+		}
+		sortFailures(result.Failed)
+		return result, err
+	}
+
+	for i, item := range response.Items {
+		if i >= len(positions) {
+			break
+		}
+		for _, itemResult := range item {
+			if itemResult.Error != nil {
+				result.Failed = append(result.Failed, storage.BatchFailure{
+					Index: positions[i],
+					Error: fmt.Sprintf("%s: %s", itemResult.Error.Type, itemResult.Error.Reason),
+				})
+				continue
+			}
+			result.Saved++
+		}
+	}
+	sortFailures(result.Failed)
+	return result, nil
+}
+
+// sortFailures orders the batch failures by the document position
+func sortFailures(failures []storage.BatchFailure) {
+	sort.Slice(failures, func(i, j int) bool {
+		return failures[i].Index < failures[j].Index
+	})
+}
+
+// documentID returns the id of an event document, so an event that is sent twice replaces the existing document
+func documentID(data string) (string, error) {
+	var doc map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(data))
+	// Keep the numbers as is, the event time is part of the document id
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return "", err
+	}
+
+	if id, ok := doc["id"]; ok {
+		return fmt.Sprint(id), nil
+	}
+	return storage.DocumentID(doc), nil
+}
+
+// search runs a query on all the daily indexes
+func (sm *StorageManager) search(query elastic.Query) *elastic.SearchService {
+	return sm.client.Search(sm.searchIndex()).Query(query)
+}
+
+// executionQuery returns a query of the events of an execution with the given event type
+func executionQuery(executionID string, eventType string) *elastic.BoolQuery {
+	return elastic.NewBoolQuery().Filter(
+		elastic.NewTermQuery("ExecutionID", executionID),
+		elastic.NewTermQuery("EventType", eventType),
+	)
+}
+
+// withFilters adds the filter expression to the query
+func withFilters(query *elastic.BoolQuery, filter storage.Expression) (*elastic.BoolQuery, error) {
+	if filter == nil {
+		return query, nil
+	}
+	if err := storage.Validate(filter); err != nil {
+		return nil, err
+	}
+
+	compiled, err := compileFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	return query.Filter(compiled), nil
+}
+
+// compileFilter returns the Elasticsearch query of a filter expression
+func compileFilter(filter storage.Expression) (elastic.Query, error) {
+	switch e := filter.(type) {
+	case storage.And:
+		queries, err := compileFilters(e)
+		if err != nil {
+			return nil, err
+		}
+		return elastic.NewBoolQuery().Filter(queries...), nil
+	case storage.Or:
+		queries, err := compileFilters(e)
+		if err != nil {
+			return nil, err
+		}
+		return elastic.NewBoolQuery().Should(queries...).MinimumNumberShouldMatch(1), nil
+	case storage.Not:
+		query, err := compileFilter(e.Expression)
+		if err != nil {
+			return nil, err
+		}
+		return elastic.NewBoolQuery().MustNot(query), nil
+	case storage.Comparison:
+		if e.Operator == storage.OpIn {
+			values := make([]interface{}, 0, len(e.Values))
+			for _, value := range e.Values {
+				values = append(values, value.Text)
+			}
+			return elastic.NewTermsQuery(e.Field, values...), nil
+		}
+
+		number := *e.Values[0].Number
+		rangeQuery := elastic.NewRangeQuery(e.Field)
+		switch e.Operator {
+		case storage.OpGreater:
+			return rangeQuery.Gt(number), nil
+		case storage.OpGreaterOrEqual:
+			return rangeQuery.Gte(number), nil
+		case storage.OpLess:
+			return rangeQuery.Lt(number), nil
+		case storage.OpLessOrEqual:
+			return rangeQuery.Lte(number), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unknown expression %T", storage.ErrInvalidFilter, filter)
+}
+
+// compileFilters returns the Elasticsearch queries of the filter expressions of a group
+func compileFilters(filters []storage.Expression) ([]elastic.Query, error) {
+	if len(filters) == 0 {
+		return nil, fmt.Errorf("%w: empty expression", storage.ErrInvalidFilter)
+	}
+
+	queries := make([]elastic.Query, 0, len(filters))
+	for _, filter := range filters {
+		query, err := compileFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, query)
+	}
+	return queries, nil
+}
+
+// GetSummary returns executions summary, the filters apply to the detected resources
+func (sm *StorageManager) GetSummary(executionID string, filter storage.Expression) (map[string]storage.CollectorsSummary, error) {
+	summary := make(map[string]storage.CollectorsSummary)
+	detectedQuery, err := withFilters(executionQuery(executionID, eventResourceDetected), filter)
+	if err != nil {
+		return summary, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	// The latest status of every resource type
+	statuses, err := sm.search(executionQuery(executionID, eventServiceStatus)).
+		Size(0).
+		Aggregation("resources", elastic.NewTermsAggregation().Field("ResourceName").Size(maxResultWindow).
+			SubAggregation("latest", elastic.NewTopHitsAggregation().Size(1).Sort("EventTime", false))).
+		Do(ctx)
+	if err != nil {
+		log.WithError(err).Error("error when trying to get service_status summary data")
+		return summary, err
+	}
+
+	resources, ok := statuses.Aggregations.Terms("resources")
+	if !ok {
+		return summary, ErrAggregationTermNotFound
+	}
+	for _, bucket := range resources.Buckets {
+		latest, ok := bucket.TopHits("latest")
+		if !ok || latest.Hits == nil || len(latest.Hits.Hits) == 0 {
+			continue
+		}
+
+		var status storage.Summary
+		if err := json.Unmarshal(latest.Hits.Hits[0].Source, &status); err != nil {
+			log.WithError(err).Error("could not parse service_status row")
+			continue
+		}
+		summary[status.ResourceName] = storage.CollectorsSummary{
+			ResourceName: status.ResourceName,
+			Status:       status.Data.Status,
+			ErrorMessage: status.Data.ErrorMessage,
+			EventTime:    status.EventTime,
+		}
+	}
+
+	// The count and cost of the detected resources of every resource type
+	detected, err := sm.search(detectedQuery).
+		Size(0).
+		Aggregation("resources", elastic.NewTermsAggregation().Field("ResourceName").Size(maxResultWindow).
+			SubAggregation("priced", elastic.NewFilterAggregation().Filter(elastic.NewRangeQuery("Data.PricePerMonth").Gt(0)).
+				SubAggregation("spent", elastic.NewSumAggregation().Field("Data.PricePerMonth")))).
+		Do(ctx)
+	if err != nil {
+		log.WithError(err).Error("error when trying to get resource_detected summary data")
+		return summary, err
+	}
+
+	resources, ok = detected.Aggregations.Terms("resources")
+	if !ok {
+		return summary, ErrAggregationTermNotFound
+	}
+	for _, bucket := range resources.Buckets {
+		resourceName := fmt.Sprint(bucket.Key)
+		collector := summary[resourceName]
+		collector.ResourceName = resourceName
+		collector.ResourceCount = bucket.DocCount
+		collector.Category = "unused_resource"
+
+		if priced, ok := bucket.Filter("priced"); ok && priced.DocCount > 0 {
+			collector.HasPricing = true
+			collector.Category = "potential_cost_saving"
+			if spent, ok := priced.Sum("spent"); ok && spent.Value != nil {
+				collector.TotalSpent = *spent.Value
+			}
+		}
+		summary[resourceName] = collector
+	}
+
+	return summary, nil
+}
+
+// GetExecutions returns list of executions
+func (sm *StorageManager) GetExecutions(queryLimit int) ([]storage.Executions, error) {
+	executions := []storage.Executions{}
+	if queryLimit <= 0 || queryLimit > maxResultWindow {
+		queryLimit = maxResultWindow
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	result, err := sm.search(elastic.NewTermQuery("EventType", eventServiceStatus)).
+		Size(0).
+		Aggregation("executions", elastic.NewTermsAggregation().Field("ExecutionID").Size(queryLimit).
+			OrderByAggregation("latest", false).
+			SubAggregation("latest", elastic.NewMaxAggregation().Field("EventTime"))).
+		Do(ctx)
+	if err != nil {
+		log.WithError(err).Error("error when trying to get executions collectors")
+		return executions, err
+	}
+
+	buckets, ok := result.Aggregations.Terms("executions")
+	if !ok {
+		return executions, ErrAggregationTermNotFound
+	}
+	for _, bucket := range buckets.Buckets {
+		executionID := fmt.Sprint(bucket.Key)
+		timestamp, err := interpolation.ExtractTimestamp(executionID)
+		if err != nil {
+			timestamp = 0
+		}
+		executions = append(executions, storage.Executions{
+			ID:   executionID,
+			Name: "Execution " + executionID,
+			Time: time.Unix(timestamp, 0),
+		})
+	}
+
+	sort.SliceStable(executions, func(i, j int) bool {
+		return executions[i].Time.After(executions[j].Time)
+	})
+	return executions, nil
+}
+
+// GetResources returns a page of resources, Elasticsearch pages are limited to the max result window
+func (sm *StorageManager) GetResources(resourceType string, executionID string, query storage.ResourcesQuery) (storage.ResourcesPage, error) {
+	page := storage.ResourcesPage{Resources: []map[string]interface{}{}}
+	if err := query.Validate(); err != nil {
+		return page, err
+	}
+
+	size := query.Limit
+	if size == 0 {
+		size = maxResultWindow - query.Offset
+	}
+	if query.Offset+size > maxResultWindow {
+		return page, fmt.Errorf("%w: elasticsearch returns the first %d resources", storage.ErrPageOutOfRange, maxResultWindow)
+	}
+
+	searchQuery, err := withFilters(executionQuery(executionID, eventResourceDetected).Filter(elastic.NewTermQuery("ResourceName", resourceType)), query.Filter)
+	if err != nil {
+		return page, err
+	}
+	if query.Search != "" {
+		searchQuery = searchQuery.Must(elastic.NewMatchQuery(searchTextField, query.Search).Operator("and"))
+	}
+
+	search := sm.search(searchQuery).From(query.Offset).Size(size).TrackTotalHits(true)
+	if query.Sort.Field != "" {
+		search = search.SortBy(elastic.NewFieldSort(query.Sort.Field).Order(!query.Sort.Descending).Missing("_last").UnmappedType("keyword"))
+	}
+	if len(query.Fields) > 0 {
+		search = search.FetchSourceContext(elastic.NewFetchSourceContext(true).Include(query.Fields...))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	result, err := search.Do(ctx)
+	if err != nil {
+		log.WithError(err).Error("elasticsearch query error")
+		return page, err
+	}
+
+	page.Total = result.TotalHits()
+	for _, hit := range result.Hits.Hits {
+		rowData := make(map[string]interface{})
+		if err := json.Unmarshal(hit.Source, &rowData); err != nil {
+			log.WithError(err).Error("error when trying to parse search result hits data")
+			continue
+		}
+		page.Resources = append(page.Resources, rowData)
+	}
+
+	return page, nil
+}
+
+// EachResource calls fn with every resource of the type in the execution that matches the filter. The
+// resources are scrolled, so they are not limited by the max result window
+func (sm *StorageManager) EachResource(resourceType string, executionID string, filter storage.Expression, fn func(resource map[string]interface{}) error) error {
+	searchQuery, err := withFilters(executionQuery(executionID, eventResourceDetected).Filter(elastic.NewTermQuery("ResourceName", resourceType)), filter)
+	if err != nil {
+		return err
+	}
+
+	return sm.scroll(searchQuery, nil, func(hit *elastic.SearchHit) error {
+		rowData := make(map[string]interface{})
+		if err := json.Unmarshal(hit.Source, &rowData); err != nil {
+			log.WithError(err).Error("error when trying to parse search result hits data")
+			return nil
+		}
+		return fn(rowData)
+	})
+}
+
+// GetResourceTrends returns the cost of the resource type in the latest executions, oldest first
+func (sm *StorageManager) GetResourceTrends(resourceType string, filter storage.Expression, limit int) ([]storage.ExecutionCost, error) {
+	resources := []storage.ExecutionCost{}
+	if limit <= 0 || limit > maxResultWindow {
+		limit = maxResultWindow
+	}
+
+	query := elastic.NewBoolQuery().
+		Filter(elastic.NewTermQuery("ResourceName", resourceType)).
+		MustNot(elastic.NewTermQuery("EventType", eventServiceStatus))
+
+	query, err := withFilters(query, filter)
+	if err != nil {
+		return resources, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	result, err := sm.search(query).
+		Size(0).
+		Aggregation("executions", elastic.NewTermsAggregation().Field("ExecutionID").Size(limit).
+			OrderByAggregation("latest", false).
+			SubAggregation("latest", elastic.NewMaxAggregation().Field("EventTime")).
+			SubAggregation("cost", elastic.NewSumAggregation().Field("Data.PricePerMonth"))).
+		Do(ctx)
+	if err != nil {
+		log.WithError(err).Error("elasticsearch query error")
+		return resources, err
+	}
+
+	buckets, ok := result.Aggregations.Terms("executions")
+	if !ok {
+		return resources, ErrAggregationTermNotFound
+	}
+	for i := len(buckets.Buckets) - 1; i >= 0; i-- {
+		bucket := buckets.Buckets[i]
+		executionID := fmt.Sprint(bucket.Key)
+		timestamp, err := interpolation.ExtractTimestamp(executionID)
+		if err != nil {
+			timestamp = 0
+		}
+
+		cost := storage.ExecutionCost{
+			ExecutionID:        executionID,
+			ExtractedTimestamp: timestamp,
+		}
+		if sum, ok := bucket.Sum("cost"); ok && sum.Value != nil {
+			cost.CostSum = *sum.Value
+		}
+		resources = append(resources, cost)
+	}
+
+	return resources, nil
+}
+
+// GetExecutionTags returns the values of every tag of the execution resources, with the number of resources that have them
+func (sm *StorageManager) GetExecutionTags(executionID string) (map[string][]storage.TagValue, error) {
+	counter := storage.TagCounter{}
+
+	source := elastic.NewFetchSourceContext(true).Include("Data.Tag")
+	err := sm.scroll(executionQuery(executionID, eventResourceDetected), source, func(hit *elastic.SearchHit) error {
+		var tagsData struct {
+			Data struct {
+				Tag map[string]interface{} `json:"Tag"`
+			} `json:"Data"`
+		}
+		if err := json.Unmarshal(hit.Source, &tagsData); err != nil {
+			log.WithError(err).Debug("Error parsing tags structure")
+			return nil
+		}
+		counter.Add(tagsData.Data.Tag)
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Error("got an elasticsearch error while running the query")
+		return map[string][]storage.TagValue{}, err
+	}
+
+	return counter.Tags(), nil
+}
+
+// ExportEvents calls fn with every document of all the daily indexes
+func (sm *StorageManager) ExportEvents(fn func(document string) error) error {
+	return sm.scroll(elastic.NewMatchAllQuery(), nil, func(hit *elastic.SearchHit) error {
+		document, err := exportDocument(hit)
+		if err != nil {
+			return err
+		}
+		return fn(document)
+	})
+}
+
+// scroll calls fn with every document of all the daily indexes that match the query, page by page
+func (sm *StorageManager) scroll(query elastic.Query, source *elastic.FetchSourceContext, fn func(hit *elastic.SearchHit) error) error {
+	scroll := sm.client.Scroll(sm.searchIndex()).Query(query).Size(scrollPageSize).Sort("_doc", true)
+	if source != nil {
+		scroll = scroll.FetchSourceContext(source)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		if err := scroll.Clear(ctx); err != nil {
+			log.WithError(err).Warn("could not clear the scroll")
+		}
+	}()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		result, err := scroll.Do(ctx)
+		cancel()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, hit := range result.Hits.Hits {
+			if err := fn(hit); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// exportDocument returns the source of a document with its id, the id is not part of the source of
+// the documents that were saved without one
+func exportDocument(hit *elastic.SearchHit) (string, error) {
+	var doc map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(string(hit.Source)))
+	// Keep the numbers as is
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return "", err
+	}
+	if _, ok := doc["id"]; !ok {
+		doc["id"] = hit.Id
+	}
+
+	document, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	return string(document), nil
+}
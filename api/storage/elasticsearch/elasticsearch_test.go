@@ -0,0 +1,379 @@
+package elasticsearch
+
+import (
+	"finala/api/config"
+	"finala/api/storage"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRequest describes a request that was sent to the elasticsearch stand-in
+type fakeRequest struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// fakeElasticsearch is a local HTTP stand-in of the elasticsearch endpoints that the storage uses
+type fakeElasticsearch struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	indexes  map[string]bool
+	requests []fakeRequest
+	bulk     func(body string) (int, string)
+	search   func(body string) string
+	scroll   func(body string) string
+}
+
+func newFakeElasticsearch(t *testing.T) *fakeElasticsearch {
+	fake := &fakeElasticsearch{indexes: map[string]bool{}}
+	fake.Server = httptest.NewServer(http.HandlerFunc(fake.handle))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+func (fake *fakeElasticsearch) handle(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	fake.mu.Lock()
+	fake.requests = append(fake.requests, fakeRequest{Method: r.Method, Path: r.URL.Path, Body: string(body)})
+	fake.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	switch {
+	case path == "":
+		_, _ = io.WriteString(w, `{"version":{"number":"7.17.0"}}`)
+	case strings.HasPrefix(path, "_index_template/"):
+		_, _ = io.WriteString(w, `{"acknowledged":true}`)
+	case strings.HasSuffix(path, "/_bulk"):
+		status, response := fake.bulk(string(body))
+		w.WriteHeader(status)
+		_, _ = io.WriteString(w, response)
+	case strings.HasSuffix(path, "/_search"):
+		_, _ = io.WriteString(w, fake.search(string(body)))
+	case path == "_search/scroll" && r.Method == http.MethodDelete:
+		_, _ = io.WriteString(w, `{"succeeded":true,"num_freed":1}`)
+	case path == "_search/scroll":
+		_, _ = io.WriteString(w, fake.scroll(string(body)))
+	case r.Method == http.MethodHead:
+		fake.mu.Lock()
+		exists := fake.indexes[path]
+		fake.mu.Unlock()
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPut:
+		fake.mu.Lock()
+		fake.indexes[path] = true
+		fake.mu.Unlock()
+		_, _ = io.WriteString(w, `{"acknowledged":true,"index":"`+path+`"}`)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// lastRequest returns the last request sent to a path with the given suffix
+func (fake *fakeElasticsearch) lastRequest(suffix string) fakeRequest {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	for i := len(fake.requests) - 1; i >= 0; i-- {
+		if strings.HasSuffix(fake.requests[i].Path, suffix) {
+			return fake.requests[i]
+		}
+	}
+	return fakeRequest{}
+}
+
+func newTestStorageManager(t *testing.T) (*StorageManager, *fakeElasticsearch) {
+	fake := newFakeElasticsearch(t)
+	sm, err := NewStorageManager(config.ElasticsearchConfig{Endpoints: []string{fake.URL}, Index: "finala"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return sm, fake
+}
+
+// TestNewStorageManager tests that the index template and the index of the current day are created.
+func TestNewStorageManager(t *testing.T) {
+	sm, fake := newTestStorageManager(t)
+
+	today := "finala-" + time.Now().In(time.UTC).Format(indexDayLayout)
+	assert.Equal(t, today, sm.getCurrentIndexDay())
+	assert.True(t, fake.indexes[today])
+
+	template := fake.lastRequest("/_index_template/finala")
+	assert.Equal(t, http.MethodPut, template.Method)
+	assert.Contains(t, template.Body, `"index_patterns": ["finala-*"]`)
+	assert.Contains(t, template.Body, `"match_mapping_type": "string"`, "expected the dynamic fields, e.g. the resource tags, to be mapped as keywords")
+
+	_, err := NewStorageManager(config.ElasticsearchConfig{Index: "finala"})
+	assert.ErrorIs(t, err, ErrMissingEndpoints)
+}
+
+// TestStorageManager_setCreateCurrentIndexDay_Exists tests that an existing daily index is not created again.
+func TestStorageManager_setCreateCurrentIndexDay_Exists(t *testing.T) {
+	sm, fake := newTestStorageManager(t)
+
+	fake.mu.Lock()
+	fake.requests = nil
+	fake.mu.Unlock()
+
+	assert.True(t, sm.setCreateCurrentIndexDay())
+	assert.Equal(t, http.MethodHead, fake.lastRequest(sm.getCurrentIndexDay()).Method)
+	for _, request := range fake.requests {
+		assert.NotEqual(t, http.MethodPut, request.Method)
+	}
+}
+
+// TestStorageManager_SaveBatch tests that the documents are saved with a single bulk request and rejected documents are reported.
+func TestStorageManager_SaveBatch(t *testing.T) {
+	sm, fake := newTestStorageManager(t)
+	fake.bulk = func(body string) (int, string) {
+		return http.StatusOK, `{"errors":true,"items":[
+			{"index":{"_id":"a","status":201,"result":"created"}},
+			{"index":{"_id":"b","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [EventTime]"}}}
+		]}`
+	}
+
+	result, err := sm.SaveBatch([]string{
+		`{"ExecutionID":"general_1","ResourceName":"aws_ec2","EventType":"service_status","EventTime":1}`,
+		`not json`,
+		`{"ExecutionID":"general_1","ResourceName":"aws_ec2","EventType":"service_status","EventTime":"invalid"}`,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Saved)
+	assert.Equal(t, 2, len(result.Failed))
+	assert.Equal(t, 1, result.Failed[0].Index)
+	assert.Equal(t, 2, result.Failed[1].Index)
+	assert.Contains(t, result.Failed[1].Error, "mapper_parsing_exception")
+
+	bulk := fake.lastRequest("/_bulk")
+	assert.Equal(t, "/"+sm.getCurrentIndexDay()+"/_bulk", bulk.Path)
+	id, _ := documentID(`{"ExecutionID":"general_1","ResourceName":"aws_ec2","EventType":"service_status","EventTime":1}`)
+	assert.Contains(t, bulk.Body, `"_id":"`+id+`"`)
+}
+
+// TestStorageManager_SaveBatch_Unavailable tests that all the documents are reported when the bulk request failed.
+func TestStorageManager_SaveBatch_Unavailable(t *testing.T) {
+	sm, fake := newTestStorageManager(t)
+	fake.bulk = func(body string) (int, string) {
+		return http.StatusServiceUnavailable, `{"error":{"type":"cluster_block_exception","reason":"blocked"},"status":503}`
+	}
+
+	result, err := sm.SaveBatch([]string{
+		`{"ExecutionID":"general_1","ResourceName":"aws_ec2","EventType":"service_status","EventTime":1}`,
+		`{"ExecutionID":"general_1","ResourceName":"aws_rds","EventType":"service_status","EventTime":1}`,
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 0, result.Saved)
+	assert.Len(t, result.Failed, 2)
+	assert.False(t, sm.Save(`{"ExecutionID":"general_1"}`))
+}
+
+// TestStorageManager_GetSummary tests that the latest statuses and the aggregated resources are merged.
+func TestStorageManager_GetSummary(t *testing.T) {
+	sm, fake := newTestStorageManager(t)
+	statusBody := ""
+	fake.search = func(body string) string {
+		if strings.Contains(body, `"service_status"`) {
+			statusBody = body
+			return `{"hits":{"hits":[]},"aggregations":{"resources":{"buckets":[
+				{"key":"aws_ec2","doc_count":2,"latest":{"hits":{"hits":[{"_source":{"ResourceName":"aws_ec2","EventTime":3,"Data":{"Status":2}}}]}}},
+				{"key":"aws_rds","doc_count":1,"latest":{"hits":{"hits":[{"_source":{"ResourceName":"aws_rds","EventTime":4,"Data":{"Status":1,"ErrorMessage":"access denied"}}}]}}}
+			]}}}`
+		}
+		return `{"hits":{"hits":[]},"aggregations":{"resources":{"buckets":[
+			{"key":"aws_ec2","doc_count":3,"priced":{"doc_count":2,"spent":{"value":25.5}}},
+			{"key":"aws_lambda","doc_count":1,"priced":{"doc_count":0,"spent":{"value":0}}}
+		]}}}`
+	}
+
+	summary, err := sm.GetSummary("general_1", storage.And{
+		storage.In("Data.Tag.Team", "finops"),
+		storage.Or{storage.In("Data.PricePerMonth", "0"), storage.Compare("Data.PricePerMonth", storage.OpGreater, 10)},
+		storage.Not{Expression: storage.In("Data.Region", "us-east-1")},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]storage.CollectorsSummary{
+		"aws_ec2":    {ResourceName: "aws_ec2", ResourceCount: 3, TotalSpent: 25.5, Status: 2, EventTime: 3, HasPricing: true, Category: "potential_cost_saving"},
+		"aws_rds":    {ResourceName: "aws_rds", Status: 1, ErrorMessage: "access denied", EventTime: 4},
+		"aws_lambda": {ResourceName: "aws_lambda", ResourceCount: 1, Category: "unused_resource"},
+	}, summary)
+
+	search := fake.lastRequest("/_search")
+	assert.Equal(t, "/finala-*/_search", search.Path)
+	assert.Contains(t, search.Body, `"sum":{"field":"Data.PricePerMonth"}`)
+	assert.Contains(t, search.Body, `{"terms":{"Data.Tag.Team":["finops"]}}`)
+	assert.Contains(t, search.Body, `{"bool":{"minimum_should_match":"1","should":[{"terms":{"Data.PricePerMonth":["0"]}},`+
+		`{"range":{"Data.PricePerMonth":{"from":10,"include_lower":false,"include_upper":true,"to":null}}}]}}`)
+	assert.Contains(t, search.Body, `{"bool":{"must_not":{"terms":{"Data.Region":["us-east-1"]}}}}`)
+	assert.NotContains(t, statusBody, "Data.Tag.Team", "expected the statuses not to be filtered")
+
+	_, err = sm.GetSummary("general_1", storage.In(`Data.Tag.Team"}`, "finops"))
+	assert.ErrorIs(t, err, storage.ErrInvalidFilter)
+}
+
+// TestStorageManager_GetExecutions tests that the executions are returned newest first.
+func TestStorageManager_GetExecutions(t *testing.T) {
+	sm, fake := newTestStorageManager(t)
+	fake.search = func(body string) string {
+		return `{"hits":{"hits":[]},"aggregations":{"executions":{"buckets":[
+			{"key":"general_1700000000","doc_count":2,"latest":{"value":2}},
+			{"key":"general_1700086400","doc_count":2,"latest":{"value":1}}
+		]}}}`
+	}
+
+	executions, err := sm.GetExecutions(5)
+	assert.NoError(t, err)
+	assert.Len(t, executions, 2)
+	assert.Equal(t, "general_1700086400", executions[0].ID)
+	assert.Contains(t, fake.lastRequest("/_search").Body, `"size":5`)
+}
+
+// TestStorageManager_GetResourceTrends tests the trends query filters and order.
+func TestStorageManager_GetResourceTrends(t *testing.T) {
+	sm, fake := newTestStorageManager(t)
+	fake.search = func(body string) string {
+		return `{"hits":{"hits":[]},"aggregations":{"executions":{"buckets":[
+			{"key":"general_1700086400","doc_count":2,"latest":{"value":2},"cost":{"value":20}},
+			{"key":"general_1700000000","doc_count":2,"latest":{"value":1},"cost":{"value":10}}
+		]}}}`
+	}
+
+	trends, err := sm.GetResourceTrends("aws_ec2", storage.In("Data.Tag.Team", "finops", "platform"), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.ExecutionCost{
+		{ExecutionID: "general_1700000000", ExtractedTimestamp: 1700000000, CostSum: 10},
+		{ExecutionID: "general_1700086400", ExtractedTimestamp: 1700086400, CostSum: 20},
+	}, trends)
+	assert.Contains(t, fake.lastRequest("/_search").Body, `{"terms":{"Data.Tag.Team":["finops","platform"]}}`)
+}
+
+// TestStorageManager_GetResources tests that the resources page is searched, sorted and projected by Elasticsearch.
+func TestStorageManager_GetResources(t *testing.T) {
+	sm, fake := newTestStorageManager(t)
+	fake.search = func(body string) string {
+		return `{"hits":{"total":{"value":42,"relation":"eq"},"hits":[{"_source":{"ExecutionID":"general_1","Data":{"ResourceID":"i-1"}}}]}}`
+	}
+
+	page, err := sm.GetResources("aws_ec2", "general_1", storage.ResourcesQuery{
+		Search: "i-1",
+		Sort:   storage.SortField{Field: "Data.PricePerMonth", Descending: true},
+		Fields: []string{"Data.ResourceID"},
+		Offset: 20,
+		Limit:  10,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), page.Total)
+	assert.Len(t, page.Resources, 1)
+	assert.Equal(t, "general_1", page.Resources[0]["ExecutionID"])
+
+	body := fake.lastRequest("/_search").Body
+	assert.Contains(t, body, `"SearchText":{"operator":"and","query":"i-1"}`)
+	assert.Contains(t, body, `"from":20`)
+	assert.Contains(t, body, `"size":10`)
+	assert.Contains(t, body, `"track_total_hits":true`)
+	assert.Contains(t, body, `{"Data.PricePerMonth":{"missing":"_last","order":"desc","unmapped_type":"keyword"}}`)
+	assert.Contains(t, body, `"_source":{"includes":["Data.ResourceID"]}`)
+
+	_, err = sm.GetResources("aws_ec2", "general_1", storage.ResourcesQuery{Offset: maxResultWindow, Limit: 10})
+	assert.ErrorIs(t, err, storage.ErrPageOutOfRange)
+}
+
+// TestStorageManager_EachResource tests that the resources are scrolled past the max result window.
+func TestStorageManager_EachResource(t *testing.T) {
+	sm, fake := newTestStorageManager(t)
+	fake.search = func(body string) string {
+		return `{"_scroll_id":"page","hits":{"total":{"value":10001},"hits":[{"_source":{"Data":{"ResourceID":"i-1"}}}]}}`
+	}
+	pages := 0
+	fake.scroll = func(body string) string {
+		pages++
+		if pages > 1 {
+			return `{"_scroll_id":"page","hits":{"total":{"value":10001},"hits":[]}}`
+		}
+		return `{"_scroll_id":"page","hits":{"total":{"value":10001},"hits":[{"_source":{"Data":{"ResourceID":"i-2"}}}]}}`
+	}
+
+	resourceIDs := []interface{}{}
+	err := sm.EachResource("aws_ec2", "general_1", storage.In("Data.Region", "us-east-1"), func(resource map[string]interface{}) error {
+		resourceIDs = append(resourceIDs, storage.FieldValue(resource, "Data.ResourceID"))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"i-1", "i-2"}, resourceIDs)
+
+	body := fake.lastRequest("/finala-*/_search").Body
+	assert.Contains(t, body, `"ResourceName":"aws_ec2"`)
+	assert.Contains(t, body, `"Data.Region":["us-east-1"]`)
+	assert.Equal(t, http.MethodDelete, fake.lastRequest("/_search/scroll").Method)
+}
+
+// TestStorageManager_GetExecutionTags tests that the tag values of all the scroll pages are counted and sorted.
+func TestStorageManager_GetExecutionTags(t *testing.T) {
+	sm, fake := newTestStorageManager(t)
+	fake.search = func(body string) string {
+		return `{"_scroll_id":"page","hits":{"hits":[
+			{"_source":{"Data":{"Tag":{"Team":"platform","Env":"prod"}}}},
+			{"_source":{"Data":{"Tag":{"Team":"finops","Size":3}}}},
+			{"_source":{"Data":{}}}
+		]}}`
+	}
+	pages := 0
+	fake.scroll = func(body string) string {
+		pages++
+		if pages > 1 {
+			return `{"_scroll_id":"page","hits":{"hits":[]}}`
+		}
+		return `{"_scroll_id":"page","hits":{"hits":[{"_source":{"Data":{"Tag":{"Team":"platform"}}}}]}}`
+	}
+
+	tags, err := sm.GetExecutionTags("general_1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]storage.TagValue{
+		"Env":  {{Value: "prod", Count: 1}},
+		"Size": {{Value: "3", Count: 1}},
+		"Team": {{Value: "finops", Count: 1}, {Value: "platform", Count: 2}},
+	}, tags)
+	assert.Contains(t, fake.lastRequest("/finala-*/_search").Body, `"ExecutionID":"general_1"`)
+}
+
+// TestStorageManager_ExportEvents tests that the documents of all the daily indexes are scrolled with their ids.
+func TestStorageManager_ExportEvents(t *testing.T) {
+	sm, fake := newTestStorageManager(t)
+	fake.search = func(body string) string {
+		return `{"_scroll_id":"page","hits":{"total":{"value":2},"hits":[
+			{"_index":"finala-2024-01-01","_id":"a","_source":{"ExecutionID":"general_1704067200","EventTime":1704067200}}]}}`
+	}
+	pages := 0
+	fake.scroll = func(body string) string {
+		pages++
+		if pages > 1 {
+			return `{"_scroll_id":"page","hits":{"total":{"value":2},"hits":[]}}`
+		}
+		return `{"_scroll_id":"page","hits":{"total":{"value":2},"hits":[
+			{"_index":"finala-2024-01-02","_id":"b","_source":{"ExecutionID":"general_1704153600","id":"custom"}}]}}`
+	}
+
+	documents := []string{}
+	err := sm.ExportEvents(func(document string) error {
+		documents = append(documents, document)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`{"EventTime":1704067200,"ExecutionID":"general_1704067200","id":"a"}`,
+		`{"ExecutionID":"general_1704153600","id":"custom"}`,
+	}, documents)
+	assert.Contains(t, fake.lastRequest("/finala-*/_search").Body, `"_doc"`)
+	assert.Equal(t, http.MethodDelete, fake.lastRequest("/_search/scroll").Method)
+}
@@ -0,0 +1,48 @@
+package elasticsearch
+
+import "fmt"
+
+// searchTextField is a text field that holds a copy of all the dynamic string fields, used by the resources search
+const searchTextField = "SearchText"
+
+// indexTemplate returns the template of the daily indexes. The event fields are keywords so they can be
+// filtered and aggregated on, including the dynamic fields such as the resource tags (Data.Tag.<key>)
+func indexTemplate(prefix string) string {
+	return fmt.Sprintf(`{
+	"index_patterns": ["%s-*"],
+	"template": {
+		"settings": {
+			"number_of_shards": 1
+		},
+		"mappings": {
+			"dynamic_templates": [
+				{
+					"strings": {
+						"match_mapping_type": "string",
+						"mapping": {
+							"type": "keyword",
+							"ignore_above": 1024,
+							"copy_to": "%s"
+						}
+					}
+				}
+			],
+			"properties": {
+				"ExecutionID": {"type": "keyword"},
+				"ResourceName": {"type": "keyword"},
+				"EventType": {"type": "keyword"},
+				"EventTime": {"type": "long"},
+				"%s": {"type": "text"},
+				"Data": {
+					"properties": {
+						"AccountID": {"type": "keyword"},
+						"PricePerHour": {"type": "double"},
+						"PricePerMonth": {"type": "double"},
+						"Status": {"type": "integer"}
+					}
+				}
+			}
+		}
+	}
+}`, prefix, searchTextField, searchTextField)
+}
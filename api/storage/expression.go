@@ -0,0 +1,223 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrInvalidFilter is returned when a filter field or value cannot be applied by the storage
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Operator describes how a document field is compared to the values of a comparison
+type Operator string
+
+const (
+	// OpIn matches the fields that equal one of the values, a = comparison is an IN with a single value
+	OpIn Operator = "IN"
+	// OpGreater matches the numeric fields that are greater than the value
+	OpGreater Operator = ">"
+	// OpGreaterOrEqual matches the numeric fields that are greater than or equal to the value
+	OpGreaterOrEqual Operator = ">="
+	// OpLess matches the numeric fields that are less than the value
+	OpLess Operator = "<"
+	// OpLessOrEqual matches the numeric fields that are less than or equal to the value
+	OpLessOrEqual Operator = "<="
+)
+
+// Expression describes a filter on the event documents, a nil expression matches every document.
+// The storages compile the expression to their native filter syntax
+type Expression interface {
+	// Match returns true when the document matches the expression
+	Match(document map[string]interface{}) bool
+}
+
+// And matches the documents that match all of its expressions
+type And []Expression
+
+// Or matches the documents that match one of its expressions
+type Or []Expression
+
+// Not matches the documents that do not match its expression, including the documents without the field
+type Not struct {
+	Expression Expression
+}
+
+// Comparison compares a document field to its values. The documents without the field never match
+type Comparison struct {
+	Field    string
+	Operator Operator
+	// Values holds the values of IN, the other operators have a single numeric value
+	Values []Value
+}
+
+// Value describes a literal of a comparison. Number is set when the literal is an unquoted number
+type Value struct {
+	Text   string
+	Number *float64
+}
+
+// NewValue returns the value of an unquoted literal, which is a number when it can be parsed as one
+func NewValue(text string) Value {
+	value := Value{Text: text}
+	if number, err := strconv.ParseFloat(text, 64); err == nil {
+		value.Number = &number
+	}
+	return value
+}
+
+// NumberValue returns the value of a number
+func NumberValue(number float64) Value {
+	return Value{Text: strconv.FormatFloat(number, 'f', -1, 64), Number: &number}
+}
+
+// In returns the comparison of a field that equals one of the unquoted values
+func In(field string, values ...string) Comparison {
+	comparison := Comparison{Field: field, Operator: OpIn}
+	for _, value := range values {
+		comparison.Values = append(comparison.Values, NewValue(value))
+	}
+	return comparison
+}
+
+// Compare returns the ordered comparison of a numeric field to a number
+func Compare(field string, operator Operator, number float64) Comparison {
+	return Comparison{Field: field, Operator: operator, Values: []Value{NumberValue(number)}}
+}
+
+// Ordered returns true when the operator compares numbers
+func (o Operator) Ordered() bool {
+	return o != OpIn
+}
+
+// Match returns true when the document matches all the expressions
+func (a And) Match(document map[string]interface{}) bool {
+	for _, expression := range a {
+		if !expression.Match(document) {
+			return false
+		}
+	}
+	return true
+}
+
+// Match returns true when the document matches one of the expressions
+func (o Or) Match(document map[string]interface{}) bool {
+	for _, expression := range o {
+		if expression.Match(document) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns true when the document does not match the expression
+func (n Not) Match(document map[string]interface{}) bool {
+	return !n.Expression.Match(document)
+}
+
+// Match returns true when the document field compares to the values
+func (c Comparison) Match(document map[string]interface{}) bool {
+	value := FieldValue(document, c.Field)
+	if value == nil {
+		return false
+	}
+	number, isNumber := value.(float64)
+
+	if c.Operator == OpIn {
+		text := fmt.Sprint(value)
+		for _, expected := range c.Values {
+			if text == expected.Text || (isNumber && expected.Number != nil && number == *expected.Number) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !isNumber || len(c.Values) != 1 || c.Values[0].Number == nil {
+		return false
+	}
+	expected := *c.Values[0].Number
+	switch c.Operator {
+	case OpGreater:
+		return number > expected
+	case OpGreaterOrEqual:
+		return number >= expected
+	case OpLess:
+		return number < expected
+	case OpLessOrEqual:
+		return number <= expected
+	}
+	return false
+}
+
+// Matches returns true when the document matches the expression, every document matches a nil expression
+func Matches(expression Expression, document map[string]interface{}) bool {
+	return expression == nil || expression.Match(document)
+}
+
+// Walk calls fn with every comparison of the expression, it stops on the first error of fn
+func Walk(expression Expression, fn func(c Comparison) error) error {
+	switch e := expression.(type) {
+	case nil:
+		return nil
+	case And:
+		for _, child := range e {
+			if err := Walk(child, fn); err != nil {
+				return err
+			}
+		}
+	case Or:
+		for _, child := range e {
+			if err := Walk(child, fn); err != nil {
+				return err
+			}
+		}
+	case Not:
+		return Walk(e.Expression, fn)
+	case Comparison:
+		return fn(e)
+	default:
+		return fmt.Errorf("%w: unknown expression %T", ErrInvalidFilter, expression)
+	}
+	return nil
+}
+
+// Validate returns an error when a comparison field is not a dotted document path, or an ordered
+// comparison does not have a single numeric value
+func Validate(expression Expression) error {
+	return Walk(expression, func(c Comparison) error {
+		if !fieldPattern.MatchString(c.Field) {
+			return fmt.Errorf("%w: %q is not a document field", ErrInvalidFilter, c.Field)
+		}
+		switch c.Operator {
+		case OpIn, OpGreater, OpGreaterOrEqual, OpLess, OpLessOrEqual:
+		default:
+			return fmt.Errorf("%w: unknown operator %q", ErrInvalidFilter, c.Operator)
+		}
+		if len(c.Values) == 0 {
+			return fmt.Errorf("%w: %s has no value", ErrInvalidFilter, c.Field)
+		}
+		if c.Operator.Ordered() && (len(c.Values) != 1 || c.Values[0].Number == nil) {
+			return fmt.Errorf("%w: %s %s needs a number", ErrInvalidFilter, c.Field, c.Operator)
+		}
+		return nil
+	})
+}
+
+// AndExpressions returns the expression that matches the documents matching all the given expressions,
+// nil expressions are skipped
+func AndExpressions(expressions ...Expression) Expression {
+	and := And{}
+	for _, expression := range expressions {
+		if expression != nil {
+			and = append(and, expression)
+		}
+	}
+	switch len(and) {
+	case 0:
+		return nil
+	case 1:
+		return and[0]
+	}
+	return and
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestExpression_Match tests the expressions against a document, including the documents without the field.
+func TestExpression_Match(t *testing.T) {
+	document := map[string]interface{}{
+		"Data": map[string]interface{}{"PricePerMonth": 12.5, "Region": "us-east-1", "Tag": map[string]interface{}{"Team": "finops"}},
+	}
+
+	assert.True(t, Matches(nil, document))
+	assert.True(t, Matches(And{In("Data.Tag.Team", "platform", "finops"), In("Data.Region", "us-east-1")}, document))
+	assert.True(t, Matches(In("Data.PricePerMonth", "12.50"), document), "expected numbers to be compared by value")
+	assert.True(t, Matches(And{Compare("Data.PricePerMonth", OpGreater, 10), Compare("Data.PricePerMonth", OpLessOrEqual, 12.5)}, document))
+	assert.False(t, Matches(Or{Compare("Data.PricePerMonth", OpLess, 10), Compare("Data.PricePerMonth", OpGreaterOrEqual, 20)}, document))
+	assert.False(t, Matches(And{In("Data.Tag.Team", "finops"), In("Data.Region", "eu-west-1")}, document))
+	assert.False(t, Matches(In("Data.Tag.Env", "prod"), document))
+	assert.True(t, Matches(Not{Expression: In("Data.Tag.Env", "prod")}, document), "expected NOT to match the documents without the field")
+	assert.False(t, Matches(Compare("Data.Region", OpGreater, 1), document), "expected ordered comparisons to match numbers only")
+}
+
+// TestValidate tests that only dotted document fields and numeric ordered comparisons are valid.
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(nil))
+	assert.NoError(t, Validate(Not{Expression: Or{In("Data.Tag.cost_center", "a"), Compare("EventTime", OpLess, 10)}}))
+	assert.ErrorIs(t, Validate(In("Data.Tag.Team' OR 1=1", "finops")), ErrInvalidFilter)
+	assert.ErrorIs(t, Validate(Comparison{Field: "Data.PricePerMonth", Operator: OpGreater, Values: []Value{NewValue("cheap")}}), ErrInvalidFilter)
+	assert.ErrorIs(t, Validate(Comparison{Field: "Data.PricePerMonth", Operator: "LIKE", Values: []Value{NewValue("1")}}), ErrInvalidFilter)
+	assert.ErrorIs(t, Validate(In("Data.Region")), ErrInvalidFilter)
+}
+
+// TestAndExpressions tests that the nil expressions are skipped.
+func TestAndExpressions(t *testing.T) {
+	region := In("Data.Region", "us-east-1")
+	assert.Nil(t, AndExpressions(nil, nil))
+	assert.Equal(t, region, AndExpressions(nil, region))
+	assert.Equal(t, And{region, region}, AndExpressions(region, nil, region))
+}
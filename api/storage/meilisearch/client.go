@@ -1,13 +1,41 @@
 package meilisearch
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"finala/api/config"
 	ms "github.com/meilisearch/meilisearch-go"
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// taskPollInterval defines the interval between two checks of an indexing task status
+	taskPollInterval = 50 * time.Millisecond
+
+	// taskTimeout defines how long to wait for an indexing task to be processed
+	taskTimeout = 30 * time.Second
+
+	// maxTotalHits defines how many hits of a search can be paged through, Meilisearch stops at 1000 by default.
+	// Meilisearch can not sort on every document field, so GetResources loads all the matching hits into memory
+	// and pages them with storage.PageResources; the hits of a daily index past this limit are not read
+	maxTotalHits = 100000
+)
+
+// ErrTaskFailed is returned when Meilisearch could not process an indexing task
+var ErrTaskFailed = errors.New("indexing task failed")
+
+var (
+	// filterableAttributes defines the document fields that the storage queries filter on.
+	// Data.Tag makes every resource tag filterable, e.g. Data.Tag.Team
+	filterableAttributes = []string{"ExecutionID", "ResourceName", "EventType", "EventTime", "Data.ResourceID", "Data.AccountID", "Data.Metric", "Data.Region", "Data.PricePerMonth", "Data.Tag"}
+
+	// sortableAttributes defines the document fields that the storage queries sort on
+	sortableAttributes = []string{"EventTime", "Timestamp", "Data.PricePerMonth"}
+)
+
 // meilisearchClient is a wrapper around the Meilisearch client
 type meilisearchClient struct {
 	client ms.ServiceManager // Changed from *ms.Client
@@ -17,12 +45,17 @@ type meilisearchClient struct {
 type Client interface {
 	Connect(conf config.MeilisearchConfig) error
 	Index(index string, document interface{}) error
+	IndexBatch(index string, documents []map[string]interface{}) error
 	Search(index string, query interface{}) (*ms.SearchResponse, error)
 	CreateIndex(name string) error
 	DeleteIndex(name string) (bool, error)
 	GetIndex(name string) (ms.IndexManager, error) // Changed from *ms.Index
 	ListIndexes() (*ms.IndexesResults, error)
 	IndexExists(name string) (bool, error)
+	DeleteDocumentsByFilter(index string, filter string) error
+	GetIndexSettings(name string) (*ms.Settings, error)
+	UpdateIndexSettings(name string) error
+	GetDocuments(index string, query *ms.DocumentsQuery) (*ms.DocumentsResult, error)
 }
 
 // NewMeilisearchClient creates a new Meilisearch client instance
@@ -89,6 +122,25 @@ func (m *meilisearchClient) Index(index string, document interface{}) error {
 	return err
 }
 
+// IndexBatch adds the documents to the index with a single request and waits until the indexing task is processed.
+func (m *meilisearchClient) IndexBatch(index string, documents []map[string]interface{}) error {
+	taskInfo, err := m.client.Index(index).AddDocuments(documents, "id")
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), taskTimeout)
+	defer cancel()
+	task, err := m.client.WaitForTaskWithContext(ctx, taskInfo.TaskUID, taskPollInterval)
+	if err != nil {
+		return fmt.Errorf("could not get the status of indexing task %d: %w", taskInfo.TaskUID, err)
+	}
+	if task.Status != ms.TaskStatusSucceeded {
+		return fmt.Errorf("%w: task %d %s: %s", ErrTaskFailed, taskInfo.TaskUID, task.Status, task.Error.Message)
+	}
+	return nil
+}
+
 // Search performs a search query on the specified index.
 func (m *meilisearchClient) Search(index string, query interface{}) (*ms.SearchResponse, error) {
 	// Convert the query params from the interface
@@ -102,6 +154,13 @@ func (m *meilisearchClient) Search(index string, query interface{}) (*ms.SearchR
 	if queryStr, ok := searchParams["q"].(string); ok {
 		q = queryStr
 	}
+	// Page through the hits when asked
+	if limit, ok := searchParams["limit"].(int); ok && limit > 0 {
+		searchRequest.Limit = int64(limit)
+	}
+	if offset, ok := searchParams["offset"].(int); ok && offset > 0 {
+		searchRequest.Offset = int64(offset)
+	}
 	// Add filter if present
 	if filterVal, ok := searchParams["filter_by"].(string); ok && filterVal != "" {
 		searchRequest.Filter = filterVal
@@ -121,25 +180,54 @@ func (m *meilisearchClient) CreateIndex(name string) error {
 	if err != nil {
 		return err
 	}
-	// Configure the index with filterable attributes
-	return m.configureIndexSettings(name)
+	// Configure the index with filterable and sortable attributes
+	return m.UpdateIndexSettings(name)
 }
 
-// configureIndexSettings sets filterable attributes for an index
-func (m *meilisearchClient) configureIndexSettings(indexName string) error {
+// GetIndexSettings returns the settings of an index
+func (m *meilisearchClient) GetIndexSettings(name string) (*ms.Settings, error) {
+	return m.client.Index(name).GetSettings()
+}
+
+// UpdateIndexSettings sets the filterable and sortable attributes and the pagination of an index
+func (m *meilisearchClient) UpdateIndexSettings(indexName string) error {
 	idx := m.client.Index(indexName) // Returns IndexManager
 	settings := ms.Settings{
-		FilterableAttributes: []string{"ExecutionID", "ResourceName", "EventType", "tags", "Collector"},
+		FilterableAttributes: filterableAttributes,
+		SortableAttributes:   sortableAttributes,
+		Pagination:           &ms.Pagination{MaxTotalHits: maxTotalHits},
 	}
 	// IndexManager.UpdateSettings returns (*TaskInfo, error)
 	_, err := idx.UpdateSettings(&settings)
 	if err != nil {
 		return fmt.Errorf("failed to update settings for index %s: %w", indexName, err)
 	}
-	log.Infof("Successfully configured filterable attributes for index %s", indexName)
+	log.Infof("Successfully configured filterable and sortable attributes for index %s", indexName)
 	return nil
 }
 
+// indexSettingsApplied returns true when the index settings include all the filterable and sortable attributes
+// and the search pagination limit
+func indexSettingsApplied(settings *ms.Settings) bool {
+	return containsAll(settings.FilterableAttributes, filterableAttributes) &&
+		containsAll(settings.SortableAttributes, sortableAttributes) &&
+		settings.Pagination != nil && settings.Pagination.MaxTotalHits >= maxTotalHits
+}
+
+// containsAll returns true when all the expected values are in the given values
+func containsAll(values []string, expected []string) bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	for _, value := range expected {
+		if !set[value] {
+			return false
+		}
+	}
+	return true
+}
+
 // DeleteIndex deletes an index by its UID.
 func (m *meilisearchClient) DeleteIndex(name string) (bool, error) {
 	// ServiceManager.DeleteIndex returns (*TaskInfo, error)
@@ -165,9 +253,25 @@ func (m *meilisearchClient) GetIndex(name string) (ms.IndexManager, error) { //
 	return idx, nil
 }
 
-// ListIndexes lists all indexes.
+// listIndexesPageSize defines how many indexes are fetched per ListIndexes page
+const listIndexesPageSize = 100
+
+// ListIndexes lists all indexes, following the pagination of the server.
 func (m *meilisearchClient) ListIndexes() (*ms.IndexesResults, error) {
-	return m.client.ListIndexes(nil) // Pass nil for default parameters
+	all := &ms.IndexesResults{}
+	for {
+		page, err := m.client.ListIndexes(&ms.IndexesQuery{Limit: listIndexesPageSize, Offset: int64(len(all.Results))})
+		if err != nil {
+			return nil, err
+		}
+		all.Results = append(all.Results, page.Results...)
+		all.Total = page.Total
+		if len(page.Results) == 0 || int64(len(all.Results)) >= page.Total {
+			break
+		}
+	}
+	all.Limit = int64(len(all.Results))
+	return all, nil
 }
 
 // IndexExists checks if an index exists by its UID.
@@ -185,3 +289,19 @@ func (m *meilisearchClient) IndexExists(name string) (bool, error) {
 	}
 	return false, nil
 }
+
+// DeleteDocumentsByFilter deletes the documents of an index that match the filter.
+func (m *meilisearchClient) DeleteDocumentsByFilter(index string, filter string) error {
+	_, err := m.client.Index(index).DeleteDocumentsByFilter(filter)
+	return err
+}
+
+// GetDocuments returns a page of the documents of an index, the documents can be filtered on the filterable attributes.
+func (m *meilisearchClient) GetDocuments(index string, query *ms.DocumentsQuery) (*ms.DocumentsResult, error) {
+	result := &ms.DocumentsResult{}
+	err := m.client.Index(index).GetDocuments(query, result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -2,6 +2,7 @@ package meilisearch
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
 	ms "github.com/meilisearch/meilisearch-go"
@@ -126,11 +127,36 @@ func TestMeilisearchClient_ListIndexes_Success(t *testing.T) {
 		Offset: 0,
 	}
 
-	mockUnderlyingClient.On("ListIndexes", (*ms.IndexesQuery)(nil)).Return(expectedResponse, nil).Once()
+	mockUnderlyingClient.On("ListIndexes", &ms.IndexesQuery{Limit: listIndexesPageSize}).Return(expectedResponse, nil).Once()
 
 	resp, err := client.ListIndexes()
 	assert.NoError(t, err, "ListIndexes should not return an error on success")
-	assert.Equal(t, expectedResponse, resp, "ListIndexes response should match expected")
+	assert.Equal(t, expectedResponse.Results, resp.Results, "ListIndexes results should match expected")
+	mockUnderlyingClient.AssertExpectations(t)
+}
+
+// TestMeilisearchClient_ListIndexes_Paginated tests that every page of indexes is fetched.
+func TestMeilisearchClient_ListIndexes_Paginated(t *testing.T) {
+	mockUnderlyingClient := new(MockServiceManager)
+	client := &meilisearchClient{client: mockUnderlyingClient}
+
+	firstPage := &ms.IndexesResults{Total: listIndexesPageSize + 1}
+	for i := 0; i < listIndexesPageSize; i++ {
+		firstPage.Results = append(firstPage.Results, &ms.IndexResult{UID: fmt.Sprintf("index%d", i)})
+	}
+	secondPage := &ms.IndexesResults{
+		Results: []*ms.IndexResult{{UID: "last"}},
+		Offset:  listIndexesPageSize,
+		Total:   listIndexesPageSize + 1,
+	}
+
+	mockUnderlyingClient.On("ListIndexes", &ms.IndexesQuery{Limit: listIndexesPageSize}).Return(firstPage, nil).Once()
+	mockUnderlyingClient.On("ListIndexes", &ms.IndexesQuery{Limit: listIndexesPageSize, Offset: listIndexesPageSize}).Return(secondPage, nil).Once()
+
+	resp, err := client.ListIndexes()
+	assert.NoError(t, err, "ListIndexes should not return an error on success")
+	assert.Len(t, resp.Results, listIndexesPageSize+1, "ListIndexes should return the indexes of every page")
+	assert.Equal(t, "last", resp.Results[listIndexesPageSize].UID)
 	mockUnderlyingClient.AssertExpectations(t)
 }
 
@@ -140,7 +166,7 @@ func TestMeilisearchClient_ListIndexes_Failure(t *testing.T) {
 	client := &meilisearchClient{client: mockUnderlyingClient}
 	expectedError := errors.New("list indexes failed")
 
-	mockUnderlyingClient.On("ListIndexes", (*ms.IndexesQuery)(nil)).Return(nil, expectedError).Once()
+	mockUnderlyingClient.On("ListIndexes", &ms.IndexesQuery{Limit: listIndexesPageSize}).Return(nil, expectedError).Once()
 
 	resp, err := client.ListIndexes()
 	assert.Error(t, err, "ListIndexes should return an error on failure")
@@ -161,7 +187,7 @@ func TestMeilisearchClient_IndexExists_True(t *testing.T) {
 		},
 	}
 
-	mockUnderlyingClient.On("ListIndexes", (*ms.IndexesQuery)(nil)).Return(listResponse, nil).Once()
+	mockUnderlyingClient.On("ListIndexes", &ms.IndexesQuery{Limit: listIndexesPageSize}).Return(listResponse, nil).Once()
 
 	exists, err := client.IndexExists(indexName)
 	assert.NoError(t, err, "IndexExists should not return error when underlying call succeeds")
@@ -181,7 +207,7 @@ func TestMeilisearchClient_IndexExists_False(t *testing.T) {
 		},
 	}
 
-	mockUnderlyingClient.On("ListIndexes", (*ms.IndexesQuery)(nil)).Return(listResponse, nil).Once()
+	mockUnderlyingClient.On("ListIndexes", &ms.IndexesQuery{Limit: listIndexesPageSize}).Return(listResponse, nil).Once()
 
 	exists, err := client.IndexExists(indexName)
 	assert.NoError(t, err, "IndexExists should not return error when underlying call succeeds")
@@ -196,7 +222,7 @@ func TestMeilisearchClient_IndexExists_ErrorOnList(t *testing.T) {
 	indexName := "index1"
 	expectedError := errors.New("failed to list indexes")
 
-	mockUnderlyingClient.On("ListIndexes", (*ms.IndexesQuery)(nil)).Return(nil, expectedError).Once()
+	mockUnderlyingClient.On("ListIndexes", &ms.IndexesQuery{Limit: listIndexesPageSize}).Return(nil, expectedError).Once()
 
 	exists, err := client.IndexExists(indexName)
 	assert.Error(t, err, "IndexExists should return error when underlying ListIndexes fails")
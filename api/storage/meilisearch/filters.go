@@ -0,0 +1,97 @@
+package meilisearch
+
+import (
+	"finala/api/storage"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// filterValueReplacer escapes the characters that would end a quoted filter value
+var filterValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+
+// quoteFilterValue quotes a value of a filter expression, so the value cannot change the expression
+func quoteFilterValue(value string) string {
+	return `"` + filterValueReplacer.Replace(value) + `"`
+}
+
+// equalsFilter returns the expression of a field that equals the given value
+func equalsFilter(field string, value string) string {
+	return fmt.Sprintf("%s = %s", field, quoteFilterValue(value))
+}
+
+// isFilterable returns true when the field is one of the filterable attributes, or nested in one of them
+func isFilterable(field string) bool {
+	for _, attribute := range filterableAttributes {
+		if field == attribute || strings.HasPrefix(field, attribute+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// filterExpression compiles the filter expression to a Meilisearch filter prefixed with AND, or returns
+// an empty string when there is no filter
+func filterExpression(expression storage.Expression) (string, error) {
+	if expression == nil {
+		return "", nil
+	}
+	if err := storage.Validate(expression); err != nil {
+		return "", err
+	}
+
+	compiled, err := compileFilter(expression)
+	if err != nil {
+		return "", err
+	}
+	return " AND " + compiled, nil
+}
+
+// compileFilter returns the Meilisearch filter of an expression
+func compileFilter(expression storage.Expression) (string, error) {
+	switch e := expression.(type) {
+	case storage.And:
+		return compileGroup(e, " AND ")
+	case storage.Or:
+		return compileGroup(e, " OR ")
+	case storage.Not:
+		compiled, err := compileFilter(e.Expression)
+		if err != nil {
+			return "", err
+		}
+		return "NOT " + compiled, nil
+	case storage.Comparison:
+		if !isFilterable(e.Field) {
+			return "", fmt.Errorf("%w: %s is not a filterable attribute", storage.ErrInvalidFilter, e.Field)
+		}
+		if e.Operator.Ordered() {
+			return fmt.Sprintf("%s %s %s", e.Field, e.Operator, strconv.FormatFloat(*e.Values[0].Number, 'f', -1, 64)), nil
+		}
+		if len(e.Values) == 1 {
+			return equalsFilter(e.Field, e.Values[0].Text), nil
+		}
+		values := make([]string, 0, len(e.Values))
+		for _, value := range e.Values {
+			values = append(values, quoteFilterValue(value.Text))
+		}
+		return fmt.Sprintf("%s IN [%s]", e.Field, strings.Join(values, ", ")), nil
+	}
+	return "", fmt.Errorf("%w: unknown expression %T", storage.ErrInvalidFilter, expression)
+}
+
+// compileGroup returns the Meilisearch filter of the expressions joined by the operator, in parentheses
+func compileGroup(expressions []storage.Expression, operator string) (string, error) {
+	if len(expressions) == 0 {
+		return "", fmt.Errorf("%w: empty expression", storage.ErrInvalidFilter)
+	}
+
+	compiled := make([]string, 0, len(expressions))
+	for _, expression := range expressions {
+		filter, err := compileFilter(expression)
+		if err != nil {
+			return "", err
+		}
+		compiled = append(compiled, filter)
+	}
+	return "(" + strings.Join(compiled, operator) + ")", nil
+}
@@ -0,0 +1,62 @@
+package meilisearch
+
+import (
+	"finala/api/storage"
+	"testing"
+
+	ms "github.com/meilisearch/meilisearch-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestFilterExpression tests that the expression is compiled and its values quoted.
+func TestFilterExpression(t *testing.T) {
+	expression, err := filterExpression(storage.And{
+		storage.In("Data.Tag.Team", "finops", `a" OR ExecutionID != "x`),
+		storage.Or{
+			storage.Compare("Data.PricePerMonth", storage.OpGreater, 10),
+			storage.Compare("Data.PricePerMonth", storage.OpLessOrEqual, 5.5),
+		},
+		storage.Not{Expression: storage.In("Data.Region", `us-east-1\`)},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, ` AND (Data.Tag.Team IN ["finops", "a\" OR ExecutionID != \"x"]`+
+		` AND (Data.PricePerMonth > 10 OR Data.PricePerMonth <= 5.5)`+
+		` AND NOT Data.Region = "us-east-1\\")`, expression)
+
+	expression, err = filterExpression(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, expression)
+
+	_, err = filterExpression(storage.In("Data.LaunchTime", "1"))
+	assert.ErrorIs(t, err, storage.ErrInvalidFilter)
+	_, err = filterExpression(storage.In("Data.Tag.Team = 1 OR x", "1"))
+	assert.ErrorIs(t, err, storage.ErrInvalidFilter)
+	_, err = filterExpression(storage.Or{})
+	assert.ErrorIs(t, err, storage.ErrInvalidFilter)
+}
+
+// TestStorageManager_GetSummary_Filters tests that the filters apply to the detected resources only.
+func TestStorageManager_GetSummary_Filters(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{client: mockClient, currentIndexDay: dayIndex(0), readWindowDays: 1}
+
+	mockClient.On("ListIndexes").Return(&ms.IndexesResults{Results: []*ms.IndexResult{{UID: dayIndex(0)}}}, nil)
+	mockClient.On("Search", dayIndex(0), mock.MatchedBy(func(params map[string]interface{}) bool {
+		return params["filter_by"] == `EventType=service_status AND ExecutionID = "general"`
+	})).Return(&ms.SearchResponse{Hits: []interface{}{
+		map[string]interface{}{"ResourceName": "aws_ec2", "EventTime": 1, "Data": map[string]interface{}{"Status": 2}},
+	}}, nil).Once()
+	mockClient.On("Search", dayIndex(0), mock.MatchedBy(func(params map[string]interface{}) bool {
+		return params["filter_by"] == `EventType=resource_detected AND ExecutionID = "general" AND Data.Tag.Team = "finops"`
+	})).Return(&ms.SearchResponse{Hits: []interface{}{
+		map[string]interface{}{"ResourceName": "aws_ec2", "Data": map[string]interface{}{"PricePerMonth": 10}},
+	}}, nil).Once()
+
+	summary, err := sm.GetSummary("general", storage.In("Data.Tag.Team", "finops"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), summary["aws_ec2"].ResourceCount)
+	assert.Equal(t, float64(10), summary["aws_ec2"].TotalSpent)
+	assert.Equal(t, 2, summary["aws_ec2"].Status)
+	mockClient.AssertExpectations(t)
+}
@@ -7,29 +7,49 @@ import (
 	"finala/api/storage"
 	"finala/interpolation"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	ms "github.com/meilisearch/meilisearch-go"
 	log "github.com/sirupsen/logrus"
 )
 
 var (
 	ErrInvalidQuery            = errors.New("invalid query")
 	ErrAggregationTermNotFound = errors.New("aggregation terms was not found")
+	ErrInvalidDocumentID       = errors.New("invalid document id")
 )
 
 const (
 	// prefixDayIndex defines the index name of the current day
 	prefixIndexName = "finala-%s"
+
+	// indexDayLayout defines the date layout of the daily index names
+	indexDayLayout = "2006-01-02"
+
+	// defaultReadWindowDays defines the number of daily indexes that are queried when none is configured
+	defaultReadWindowDays = 30
+
+	// documentsPageSize defines how many documents are fetched per page when all the documents of an index are read
+	documentsPageSize = 1000
 )
 
 // StorageManager describes meilisearchStorage
 type StorageManager struct {
-	client          Client
+	client Client
+
+	// mu guards currentIndexDay, which the daily rollover changes while it is read
+	mu              sync.RWMutex
 	currentIndexDay string
+	readWindowDays  int
+	retention       config.RetentionConfig
 }
 
-// NewStorageManager creates new Meilisearch storage
-func NewStorageManager(conf config.MeilisearchConfig) (*StorageManager, error) {
+// NewStorageManager creates new Meilisearch storage, the retention janitor is started when a retention rule is configured
+func NewStorageManager(conf config.MeilisearchConfig, retention config.RetentionConfig) (*StorageManager, error) {
 	client := NewMeilisearchClient()
 	err := client.Connect(conf)
 	if err != nil {
@@ -37,13 +57,19 @@ func NewStorageManager(conf config.MeilisearchConfig) (*StorageManager, error) {
 	}
 
 	storageManager := &StorageManager{
-		client: client,
+		client:         client,
+		readWindowDays: conf.ReadWindowDays,
+		retention:      retention,
 	}
 
 	if !storageManager.setCreateCurrentIndexDay() {
 		return nil, errors.New("could not create initial index")
 	}
 
+	if err := storageManager.migrateIndexSettings(); err != nil {
+		log.WithError(err).Warn("could not migrate the settings of all the indexes")
+	}
+
 	go func() {
 		for {
 			now := time.Now().In(time.UTC)
@@ -57,6 +83,10 @@ func NewStorageManager(conf config.MeilisearchConfig) (*StorageManager, error) {
 		}
 	}()
 
+	if retention.Enabled() {
+		go storageManager.runJanitor(retention.Interval)
+	}
+
 	return storageManager, nil
 }
 
@@ -67,48 +97,221 @@ func (sm *StorageManager) getDurationUntilTomorrow(t time.Time) time.Duration {
 	return tomorrow.Sub(t)
 }
 
+// getCurrentIndexDay returns the index that new events are written to
+func (sm *StorageManager) getCurrentIndexDay() string {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.currentIndexDay
+}
+
 // setCreateCurrentIndexDay sets the current index name and ensures it exists
 func (sm *StorageManager) setCreateCurrentIndexDay() bool {
-	today := time.Now().In(time.UTC).Format("2006-01-02")
-	sm.currentIndexDay = fmt.Sprintf(prefixIndexName, today)
+	today := time.Now().In(time.UTC).Format(indexDayLayout)
+	index := fmt.Sprintf(prefixIndexName, today)
+	sm.mu.Lock()
+	sm.currentIndexDay = index
+	sm.mu.Unlock()
 
-	exists, err := sm.client.IndexExists(sm.currentIndexDay)
+	exists, err := sm.client.IndexExists(index)
 	if err != nil {
-		log.WithError(err).WithField("index", sm.currentIndexDay).Error("Failed to check if index exists")
+		log.WithError(err).WithField("index", index).Error("Failed to check if index exists")
 		return false
 	}
 
 	if !exists {
-		log.WithField("index", sm.currentIndexDay).Info("Index does not exist, creating...")
-		err := sm.client.CreateIndex(sm.currentIndexDay)
+		log.WithField("index", index).Info("Index does not exist, creating...")
+		err := sm.client.CreateIndex(index)
 		if err != nil {
-			log.WithError(err).WithField("index", sm.currentIndexDay).Error("Failed to create index")
+			log.WithError(err).WithField("index", index).Error("Failed to create index")
 			return false
 		}
-		log.WithField("index", sm.currentIndexDay).Info("Index created successfully")
+		log.WithField("index", index).Info("Index created successfully")
 	} else {
-		log.WithField("index", sm.currentIndexDay).Info("Index already exists")
+		log.WithField("index", index).Info("Index already exists")
 	}
 	return true
 }
 
+// getIndexDay returns the day of a daily index name
+func getIndexDay(name string) (time.Time, bool) {
+	prefix := strings.TrimSuffix(prefixIndexName, "%s")
+	if !strings.HasPrefix(name, prefix) {
+		return time.Time{}, false
+	}
+	day, err := time.Parse(indexDayLayout, strings.TrimPrefix(name, prefix))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return day, true
+}
+
+// windowStart returns the first day of the configured read window
+func (sm *StorageManager) windowStart() time.Time {
+	days := sm.readWindowDays
+	if days <= 0 {
+		days = defaultReadWindowDays
+	}
+	year, month, day := time.Now().In(time.UTC).Date()
+	return time.Date(year, month, day-(days-1), 0, 0, 0, 0, time.UTC)
+}
+
+// executionStart returns the day the given execution started on. Executions without
+// a timestamp fall back to the read window
+func (sm *StorageManager) executionStart(executionID string) time.Time {
+	timestamp, err := interpolation.ExtractTimestamp(executionID)
+	if err != nil {
+		return sm.windowStart()
+	}
+	year, month, day := time.Unix(timestamp, 0).In(time.UTC).Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// getIndexes returns the daily indexes from the given day until today, newest first
+func (sm *StorageManager) getIndexes(since time.Time) ([]string, error) {
+	results, err := sm.client.ListIndexes()
+	if err != nil {
+		return nil, err
+	}
+
+	days := map[string]time.Time{}
+	indexes := []string{}
+	for _, index := range results.Results {
+		day, ok := getIndexDay(index.UID)
+		if !ok || day.Before(since) {
+			continue
+		}
+		days[index.UID] = day
+		indexes = append(indexes, index.UID)
+	}
+
+	sort.Slice(indexes, func(i, j int) bool {
+		return days[indexes[i]].After(days[indexes[j]])
+	})
+	return indexes, nil
+}
+
+// search runs the query on every daily index from the given day and merges the hits.
+// An index that fails to answer is skipped, the query fails only when no index answered
+func (sm *StorageManager) search(since time.Time, params map[string]interface{}) (*ms.SearchResponse, error) {
+	indexes, err := sm.getIndexes(since)
+	if err != nil {
+		log.WithError(err).Error("could not list the daily indexes")
+		return nil, err
+	}
+
+	response := &ms.SearchResponse{Hits: []interface{}{}}
+	var lastErr error
+	succeeded := 0
+	for _, index := range indexes {
+		result, err := sm.client.Search(index, params)
+		if err != nil {
+			log.WithError(err).WithField("index", index).Warn("could not search index")
+			lastErr = err
+			continue
+		}
+		succeeded++
+		response.Hits = append(response.Hits, result.Hits...)
+	}
+
+	if succeeded == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	response.EstimatedTotalHits = int64(len(response.Hits))
+	return response, nil
+}
+
+// searchAll runs the search on all the daily indexes since the given day and pages through the hits of
+// every index. Like search, an index that could not be searched is skipped
+func (sm *StorageManager) searchAll(since time.Time, params map[string]interface{}) ([]interface{}, error) {
+	indexes, err := sm.getIndexes(since)
+	if err != nil {
+		log.WithError(err).Error("could not list the daily indexes")
+		return nil, err
+	}
+
+	hits := []interface{}{}
+	var lastErr error
+	succeeded := 0
+	for _, index := range indexes {
+		indexHits, err := sm.searchIndex(index, params)
+		if err != nil {
+			log.WithError(err).WithField("index", index).Warn("could not search index")
+			lastErr = err
+			continue
+		}
+		succeeded++
+		hits = append(hits, indexHits...)
+	}
+
+	if succeeded == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return hits, nil
+}
+
+// searchIndex returns all the hits of the search on one index, page by page
+func (sm *StorageManager) searchIndex(index string, params map[string]interface{}) ([]interface{}, error) {
+	hits := []interface{}{}
+	for {
+		pageParams := map[string]interface{}{
+			"limit":  documentsPageSize,
+			"offset": len(hits),
+		}
+		for key, value := range params {
+			pageParams[key] = value
+		}
+
+		result, err := sm.client.Search(index, pageParams)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, result.Hits...)
+		if len(result.Hits) < documentsPageSize {
+			return hits, nil
+		}
+	}
+}
+
+// migrateIndexSettings applies the index settings on the existing daily indexes that were created
+// before the settings were changed
+func (sm *StorageManager) migrateIndexSettings() error {
+	indexes, err := sm.getIndexes(time.Time{})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, index := range indexes {
+		settings, err := sm.client.GetIndexSettings(index)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("could not get the settings of index %s: %w", index, err))
+			continue
+		}
+		if indexSettingsApplied(settings) {
+			continue
+		}
+		if err := sm.client.UpdateIndexSettings(index); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.WithField("index", index).Info("index settings migrated")
+	}
+	return errors.Join(errs...)
+}
+
 // Save new documents
 func (sm *StorageManager) Save(data string) bool {
-	var doc map[string]interface{}
-	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+	doc, err := decodeDocument(data)
+	if err != nil {
 		log.WithError(err).Error("Failed to unmarshal document")
 		return false
 	}
 
-	// Add an ID field if not present (required by Meilisearch)
-	if _, ok := doc["id"]; !ok {
-		doc["id"] = fmt.Sprintf("%d", time.Now().UnixNano())
-	}
-
-	err := sm.client.Index(sm.currentIndexDay, doc)
+	index := sm.getCurrentIndexDay()
+	err = sm.client.Index(index, doc)
 	if err != nil {
 		log.WithFields(log.Fields{
-			"index": sm.currentIndexDay,
+			"index": index,
 			"data":  data,
 		}).WithError(err).Error("Fail to save document")
 		return false
@@ -117,14 +320,102 @@ func (sm *StorageManager) Save(data string) bool {
 	return true
 }
 
-// GetSummary returns executions summary
-func (sm *StorageManager) GetSummary(executionID string, filters map[string]string) (map[string]storage.CollectorsSummary, error) {
+// SaveBatch saves the documents with a single indexing request. Documents that are not valid are reported
+// as failures and the others are still saved, an error is returned when the indexing request failed
+func (sm *StorageManager) SaveBatch(data []string) (storage.BatchResult, error) {
+	result := storage.BatchResult{}
+	docs := make([]map[string]interface{}, 0, len(data))
+	positions := make([]int, 0, len(data))
+	for i, row := range data {
+		doc, err := decodeDocument(row)
+		if err != nil {
+			result.Failed = append(result.Failed, storage.BatchFailure{Index: i, Error: err.Error()})
+			continue
+		}
+		docs = append(docs, doc)
+		positions = append(positions, i)
+	}
+
+	if len(docs) == 0 {
+		return result, nil
+	}
+
+	index := sm.getCurrentIndexDay()
+	if err := sm.client.IndexBatch(index, docs); err != nil {
+		log.WithFields(log.Fields{
+			"index":     index,
+			"documents": len(docs),
+		}).WithError(err).Error("Fail to save documents batch")
+		for _, position := range positions {
+			result.Failed = append(result.Failed, storage.BatchFailure{Index: position, Error: err.Error()})
+		}
+		sort.Slice(result.Failed, func(i, j int) bool {
+			return result.Failed[i].Index < result.Failed[j].Index
+		})
+		return result, err
+	}
+
+	result.Saved = len(docs)
+	return result, nil
+}
+
+// decodeDocument parses an event document and sets its id
+func decodeDocument(data string) (map[string]interface{}, error) {
+	var doc map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(data))
+	// Keep the numbers as is, the event time is part of the document id
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	// Add an ID field if not present (required by Meilisearch)
+	id, ok := doc["id"]
+	if !ok {
+		doc["id"] = storage.DocumentID(doc)
+		return doc, nil
+	}
+	if !validDocumentID(id) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidDocumentID, id)
+	}
+	return doc, nil
+}
+
+// validDocumentID returns true when the id is accepted by Meilisearch, an integer or a string of
+// alphanumeric characters, hyphens and underscores of up to 511 bytes
+func validDocumentID(id interface{}) bool {
+	switch value := id.(type) {
+	case json.Number:
+		_, err := value.Int64()
+		return err == nil
+	case string:
+		if value == "" || len(value) > 511 {
+			return false
+		}
+		for _, char := range value {
+			if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' || char == '-' || char == '_') {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// GetSummary returns executions summary, the filters apply to the detected resources
+func (sm *StorageManager) GetSummary(executionID string, filter storage.Expression) (map[string]storage.CollectorsSummary, error) {
 	summary := make(map[string]storage.CollectorsSummary)
+	resourceFilters, err := filterExpression(filter)
+	if err != nil {
+		return summary, err
+	}
 
 	// 1. Fetch and process service_status events for status and error messages
-	serviceStatusEvents, err := sm.client.Search(sm.currentIndexDay, map[string]interface{}{
+	since := sm.executionStart(executionID)
+	serviceStatusEvents, err := sm.search(since, map[string]interface{}{
 		"q":         "",
-		"filter_by": fmt.Sprintf("EventType=service_status AND ExecutionID=%s", executionID),
+		"filter_by": "EventType=service_status AND " + equalsFilter("ExecutionID", executionID),
 		// Potentially add limit if there can be many status events per service, though unlikely for summary.
 		// Default MeiliSearch limit is 20, might need to be higher if many resource types.
 		// For now, assuming default limit is sufficient or all relevant statuses are captured.
@@ -164,10 +455,9 @@ func (sm *StorageManager) GetSummary(executionID string, filters map[string]stri
 	}
 
 	// 2. Fetch and process resource_detected events for costs and counts
-	resourceDetectedEvents, err := sm.client.Search(sm.currentIndexDay, map[string]interface{}{
+	resourceDetectedEvents, err := sm.searchAll(since, map[string]interface{}{
 		"q":         "",
-		"filter_by": fmt.Sprintf("EventType=resource_detected AND ExecutionID=%s", executionID),
-		"limit":     1000, // Assuming up to 1000 resources per execution for summary. Adjust if necessary.
+		"filter_by": "EventType=resource_detected AND " + equalsFilter("ExecutionID", executionID) + resourceFilters,
 	})
 
 	if err != nil {
@@ -179,7 +469,7 @@ func (sm *StorageManager) GetSummary(executionID string, filters map[string]stri
 	}
 
 	if resourceDetectedEvents != nil {
-		for _, hit := range resourceDetectedEvents.Hits {
+		for _, hit := range resourceDetectedEvents {
 			var eventDataMap map[string]interface{}
 			hitData, err := json.Marshal(hit)
 			if err != nil {
@@ -240,7 +530,7 @@ func (sm *StorageManager) GetSummary(executionID string, filters map[string]stri
 	// Fill in any missing ResourceNames for services that had detected resources but no explicit status event
 	// (though typically a CollectStart/Finish should exist)
 	if resourceDetectedEvents != nil {
-		for _, hit := range resourceDetectedEvents.Hits {
+		for _, hit := range resourceDetectedEvents {
 			var eventDataMap map[string]interface{}
 			hitData, err := json.Marshal(hit)
 			if err != nil {
@@ -275,7 +565,7 @@ func (sm *StorageManager) GetExecutions(queryLimit int) ([]storage.Executions, e
 		"filter_by": "EventType=service_status",
 	}
 
-	result, err := sm.client.Search(sm.currentIndexDay, searchParams)
+	hits, err := sm.searchAll(sm.windowStart(), searchParams)
 	if err != nil {
 		log.WithError(err).Error("error when trying to get executions collectors")
 		return executions, ErrInvalidQuery
@@ -283,7 +573,7 @@ func (sm *StorageManager) GetExecutions(queryLimit int) ([]storage.Executions, e
 
 	// Group by ExecutionID manually since Meilisearch doesn't support group by
 	executionMap := make(map[string]bool)
-	for _, hit := range result.Hits {
+	for _, hit := range hits {
 		var execData struct {
 			ExecutionID string `json:"ExecutionID"`
 		}
@@ -311,30 +601,41 @@ func (sm *StorageManager) GetExecutions(queryLimit int) ([]storage.Executions, e
 		}
 	}
 
+	sort.SliceStable(executions, func(i, j int) bool {
+		return executions[i].Time.After(executions[j].Time)
+	})
+	if queryLimit > 0 && len(executions) > queryLimit {
+		executions = executions[:queryLimit]
+	}
+
 	return executions, nil
 }
 
-// GetResources returns list of resources
-func (sm *StorageManager) GetResources(resourceType string, executionID string, filters map[string]string, search string) ([]map[string]interface{}, error) {
-	var resources []map[string]interface{}
-
-	searchQuery := ""
-	if search != "" {
-		searchQuery = search
+// GetResources returns a page of resources. Meilisearch cannot sort on every document field, so all the
+// matching resources are read and then sorted and paged
+func (sm *StorageManager) GetResources(resourceType string, executionID string, query storage.ResourcesQuery) (storage.ResourcesPage, error) {
+	if err := query.Validate(); err != nil {
+		return storage.ResourcesPage{}, err
+	}
+	resourceFilters, err := filterExpression(query.Filter)
+	if err != nil {
+		return storage.ResourcesPage{}, err
 	}
 
+	resources := []map[string]interface{}{}
 	searchParams := map[string]interface{}{
-		"q":         searchQuery,
-		"filter_by": fmt.Sprintf("EventType=resource_detected AND ExecutionID=%s AND ResourceName=%s", executionID, resourceType),
+		"q": query.Search,
+		"filter_by": "EventType=resource_detected AND " + equalsFilter("ExecutionID", executionID) +
+			" AND " + equalsFilter("ResourceName", resourceType) + resourceFilters,
 	}
 
-	result, err := sm.client.Search(sm.currentIndexDay, searchParams)
+	hits, err := sm.searchAll(sm.executionStart(executionID), searchParams)
 	if err != nil {
 		log.WithError(err).Error("meilisearch query error")
-		return resources, err
+		return storage.ResourcesPage{}, err
 	}
 
-	for _, hit := range result.Hits {
+	for _, hit := range hits {
 		rowData := make(map[string]interface{})
 		hitData, err := json.Marshal(hit)
 		if err != nil {
@@ -349,27 +650,41 @@ func (sm *StorageManager) GetResources(resourceType string, executionID string,
 		resources = append(resources, rowData)
 	}
 
-	return resources, nil
+	return storage.PageResources(resources, query), nil
+}
+
+// EachResource calls fn with every resource of the type in the execution that matches the filter. The
+// resources are read in a single search of the execution indexes, rather than one search per page
+func (sm *StorageManager) EachResource(resourceType string, executionID string, filter storage.Expression, fn func(resource map[string]interface{}) error) error {
+	page, err := sm.GetResources(resourceType, executionID, storage.ResourcesQuery{Filter: filter})
+	if err != nil {
+		return err
+	}
+	for _, resource := range page.Resources {
+		if err := fn(resource); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // GetResourceTrends returns resource trends
-func (sm *StorageManager) GetResourceTrends(resourceType string, filters map[string]string, limit int) ([]storage.ExecutionCost, error) {
+func (sm *StorageManager) GetResourceTrends(resourceType string, filter storage.Expression, limit int) ([]storage.ExecutionCost, error) {
 	var resources []storage.ExecutionCost
 
 	// Build filter string for Meilisearch
-	filterStr := fmt.Sprintf("ResourceName=%s AND EventType!=service_status", resourceType)
-
-	// Add additional filters if any
-	for key, value := range filters {
-		filterStr += fmt.Sprintf(" AND %s=%s", key, value)
+	resourceFilters, err := filterExpression(filter)
+	if err != nil {
+		return resources, err
 	}
+	filterStr := equalsFilter("ResourceName", resourceType) + " AND EventType!=service_status" + resourceFilters
 
 	searchParams := map[string]interface{}{
 		"q":         "",
 		"filter_by": filterStr,
 	}
 
-	result, err := sm.client.Search(sm.currentIndexDay, searchParams)
+	hits, err := sm.searchAll(sm.windowStart(), searchParams)
 	if err != nil {
 		log.WithError(err).Error("meilisearch query error")
 		return resources, err
@@ -377,7 +692,7 @@ func (sm *StorageManager) GetResourceTrends(resourceType string, filters map[str
 
 	// Group by ExecutionID manually since Meilisearch doesn't support group by
 	executionCosts := make(map[string]float64)
-	for _, hit := range result.Hits {
+	for _, hit := range hits {
 		var execData struct {
 			ExecutionID string                 `json:"ExecutionID"`
 			Data        map[string]interface{} `json:"Data"`
@@ -399,8 +714,8 @@ func (sm *StorageManager) GetResourceTrends(resourceType string, filters map[str
 				// Handle case where PricePerMonth might be a string or other type
 				priceStr, ok := priceData.(string)
 				if ok {
-					if priceVal, err := fmt.Sscanf(priceStr, "%f", new(float64)); err == nil {
-						executionCosts[execData.ExecutionID] += float64(priceVal)
+					if priceVal, err := strconv.ParseFloat(priceStr, 64); err == nil {
+						executionCosts[execData.ExecutionID] += priceVal
 					}
 				}
 			}
@@ -421,72 +736,95 @@ func (sm *StorageManager) GetResourceTrends(resourceType string, filters map[str
 		})
 	}
 
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].ExtractedTimestamp != resources[j].ExtractedTimestamp {
+			return resources[i].ExtractedTimestamp < resources[j].ExtractedTimestamp
+		}
+		return resources[i].ExecutionID < resources[j].ExecutionID
+	})
+	if limit > 0 && len(resources) > limit {
+		resources = resources[len(resources)-limit:]
+	}
 	return resources, nil
 }
 
-// GetExecutionTags returns execution tags
-func (sm *StorageManager) GetExecutionTags(executionID string) (map[string][]string, error) {
-	tags := map[string][]string{}
+// GetExecutionTags returns the values of every tag of the execution resources, with the number of resources that have them
+func (sm *StorageManager) GetExecutionTags(executionID string) (map[string][]storage.TagValue, error) {
+	indexes, err := sm.getIndexes(sm.executionStart(executionID))
+	if err != nil {
+		log.WithError(err).Error("could not list the daily indexes")
+		return map[string][]storage.TagValue{}, err
+	}
 
-	searchParams := map[string]interface{}{
-		"q":         "",
-		"filter_by": fmt.Sprintf("EventType=resource_detected AND ExecutionID=%s", executionID),
+	counter := storage.TagCounter{}
+	query := ms.DocumentsQuery{
+		Filter: "EventType=resource_detected AND " + equalsFilter("ExecutionID", executionID),
+		Fields: []string{"Data"},
+	}
+	var lastErr error
+	succeeded := 0
+	for _, index := range indexes {
+		err := sm.eachDocument(index, query, func(doc map[string]interface{}) error {
+			// Resource types without tags have no Data.Tag field, or a null one
+			data, _ := doc["Data"].(map[string]interface{})
+			tags, _ := data["Tag"].(map[string]interface{})
+			counter.Add(tags)
+			return nil
+		})
+		if err != nil {
+			log.WithError(err).WithField("index", index).Warn("could not read the tags of index")
+			lastErr = err
+			continue
+		}
+		succeeded++
 	}
 
-	result, err := sm.client.Search(sm.currentIndexDay, searchParams)
-	if err != nil {
-		log.WithError(err).Error("got a meilisearch error while running the query")
-		return tags, err
+	if succeeded == 0 && lastErr != nil {
+		return map[string][]storage.TagValue{}, lastErr
 	}
+	return counter.Tags(), nil
+}
 
-	log.WithFields(log.Fields{
-		"hits_count":   len(result.Hits),
-		"execution_id": executionID,
-	}).Debug("Processing tags from search results")
+// ExportEvents calls fn with every document of all the daily indexes, oldest index first
+func (sm *StorageManager) ExportEvents(fn func(document string) error) error {
+	indexes, err := sm.getIndexes(time.Time{})
+	if err != nil {
+		return err
+	}
 
-	for _, hit := range result.Hits {
-		// First try to unmarshal with expected structure
-		var tagsData struct {
-			Data struct {
-				Tag map[string]string `json:"Tag"`
-			} `json:"Data"`
+	for i := len(indexes) - 1; i >= 0; i-- {
+		err := sm.eachDocument(indexes[i], ms.DocumentsQuery{}, func(doc map[string]interface{}) error {
+			document, err := json.Marshal(doc)
+			if err != nil {
+				return err
+			}
+			return fn(string(document))
+		})
+		if err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		hitData, err := json.Marshal(hit)
+// eachDocument calls fn with every document of an index that matches the query, page by page. Unlike
+// the search, the documents are not limited to the max number of hits of a search
+func (sm *StorageManager) eachDocument(index string, query ms.DocumentsQuery, fn func(doc map[string]interface{}) error) error {
+	query.Limit = documentsPageSize
+	query.Offset = 0
+	for {
+		page, err := sm.client.GetDocuments(index, &query)
 		if err != nil {
-			log.WithError(err).Debug("Error marshaling document hit")
-			continue
+			return fmt.Errorf("could not get the documents of index %s: %w", index, err)
 		}
-
-		if err := json.Unmarshal(hitData, &tagsData); err != nil {
-			log.WithFields(log.Fields{
-				"error": err.Error(),
-				"hit":   string(hitData),
-			}).Debug("Error parsing tags structure, trying alternative structure")
-
-			// Try alternative structure where Data.Tag might be a generic map
-			var altTagsData struct {
-				Data map[string]interface{} `json:"Data"`
-			}
-			// Attempt to unmarshal with alternative structure (assuming it's missing)
-			if err := json.Unmarshal(hitData, &altTagsData); err == nil {
-				// TODO: Implement logic to process altTagsData and populate the tags map
-				// For example, iterate over altTagsData.Data if it contains tag-like structures
-				// and add them to the 'tags' map.
-				// Example:
-				// if actualTags, ok := altTagsData.Data["Tag"].(map[string]string); ok {
-				// 	 for k, v := range actualTags {
-				// 		 tags[k] = append(tags[k], v)
-				// 	 }
-				// }
-			} else {
-				log.WithFields(log.Fields{
-					"alt_error": err.Error(),
-					"hit":       string(hitData),
-				}).Debug("Error parsing tags with alternative structure as well")
+		for _, doc := range page.Results {
+			if err := fn(doc); err != nil {
+				return err
 			}
 		}
+		query.Offset += int64(len(page.Results))
+		if len(page.Results) == 0 || query.Offset >= page.Total {
+			return nil
+		}
 	}
-
-	return tags, nil
 }
@@ -2,10 +2,14 @@ package meilisearch
 
 import (
 	"errors"
+	"finala/api/storage"
+	"fmt"
 	"testing"
 	"time"
 
+	ms "github.com/meilisearch/meilisearch-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 // TestNewStorageManager_Success is skipped. Directly testing NewStorageManager is complex
@@ -107,6 +111,432 @@ func TestStorageManager_Save_Success(t *testing.T) {
 	mockClient.AssertExpectations(t)
 }
 
+// TestStorageManager_Save_DeterministicID tests that an event sent twice is saved with the same document id.
+func TestStorageManager_Save_DeterministicID(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{client: mockClient, currentIndexDay: "finala-2023-01-01"}
+
+	ids := []string{}
+	mockClient.On("Index", "finala-2023-01-01", mock.Anything).Run(func(args mock.Arguments) {
+		ids = append(ids, args.Get(1).(map[string]interface{})["id"].(string))
+	}).Return(nil)
+
+	events := []string{
+		`{"ExecutionID": "general_1", "ResourceName": "aws_ec2", "EventType": "resource_detected", "EventTime": 1700000000000000001, "Data": {"ResourceID": "i-1", "Metric": "CPU"}}`,
+		`{"ExecutionID": "general_1", "ResourceName": "aws_ec2", "EventType": "resource_detected", "EventTime": 1700000000000000002, "Data": {"ResourceID": "i-1", "Metric": "CPU"}}`,
+		`{"ExecutionID": "general_1", "ResourceName": "aws_ec2", "EventType": "resource_detected", "EventTime": 1700000000000000003, "Data": {"ResourceID": "i-1", "Metric": "Network"}}`,
+		`{"ExecutionID": "general_1", "ResourceName": "aws_ec2", "EventType": "service_status", "EventTime": 1700000000000000001, "Data": {"Status": 0}}`,
+		`{"ExecutionID": "general_1", "ResourceName": "aws_ec2", "EventType": "service_status", "EventTime": 1700000000000000002, "Data": {"Status": 2}}`,
+		`{"ExecutionID": "general_1", "ResourceName": "aws_ec2", "EventType": "resource_detected", "EventTime": 1700000000000000001, "Data": {"ResourceID": "i-1", "Metric": "CPU", "AccountID": "123456789012"}}`,
+		`{"ExecutionID": "general_1", "ResourceName": "aws_ec2", "EventType": "resource_detected", "EventTime": 1700000000000000001, "Data": {"ResourceID": "i-1", "Metric": "CPU", "AccountID": "210987654321"}}`,
+	}
+	for _, event := range events {
+		assert.True(t, sm.Save(event))
+	}
+
+	assert.Equal(t, ids[0], ids[1], "the same resource and metric should have the same id")
+	assert.NotEqual(t, ids[0], ids[2], "another metric of the resource should have another id")
+	assert.NotEqual(t, ids[3], ids[4], "status events of different times should have different ids")
+	assert.NotEqual(t, ids[5], ids[6], "the same resource of different accounts should have different ids")
+}
+
+// TestStorageManager_SaveBatch tests that valid documents are saved in a single request and invalid ones are reported.
+func TestStorageManager_SaveBatch(t *testing.T) {
+	mockClient := new(MockClient)
+	currentIndex := "finala-2023-01-01"
+	sm := &StorageManager{client: mockClient, currentIndexDay: currentIndex}
+
+	mockClient.On("IndexBatch", currentIndex, mock.MatchedBy(func(docs []map[string]interface{}) bool {
+		return len(docs) == 2 && docs[0]["id"] == "1" && docs[1]["id"] == "2"
+	})).Return(nil).Once()
+
+	result, err := sm.SaveBatch([]string{
+		`{"id": "1"}`,
+		`not json`,
+		`{"id": "invalid/id"}`,
+		`{"id": "2"}`,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Saved)
+	assert.Len(t, result.Failed, 2)
+	assert.Equal(t, 1, result.Failed[0].Index)
+	assert.Equal(t, 2, result.Failed[1].Index)
+	mockClient.AssertExpectations(t)
+}
+
+// TestStorageManager_SaveBatch_Failure tests that every document is reported when the indexing request fails.
+func TestStorageManager_SaveBatch_Failure(t *testing.T) {
+	mockClient := new(MockClient)
+	currentIndex := "finala-2023-01-01"
+	sm := &StorageManager{client: mockClient, currentIndexDay: currentIndex}
+	expectedError := errors.New("indexing task failed")
+
+	mockClient.On("IndexBatch", currentIndex, mock.Anything).Return(expectedError).Once()
+
+	result, err := sm.SaveBatch([]string{`{"id": "1"}`, `not json`, `{"id": "2"}`})
+	assert.ErrorIs(t, err, expectedError)
+	assert.Equal(t, 0, result.Saved)
+	assert.Len(t, result.Failed, 3)
+	for i, failure := range result.Failed {
+		assert.Equal(t, i, failure.Index, "failures should be sorted by the document position")
+	}
+	mockClient.AssertExpectations(t)
+}
+
+// TestStorageManager_migrateIndexSettings tests that only indexes without the current settings are updated.
+func TestStorageManager_migrateIndexSettings(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{client: mockClient, currentIndexDay: dayIndex(0)}
+
+	mockClient.On("ListIndexes").Return(&ms.IndexesResults{Results: []*ms.IndexResult{
+		{UID: dayIndex(0)},
+		{UID: dayIndex(1)},
+		{UID: "other-index"},
+	}}, nil).Once()
+	mockClient.On("GetIndexSettings", dayIndex(0)).Return(&ms.Settings{
+		FilterableAttributes: filterableAttributes,
+		SortableAttributes:   sortableAttributes,
+		Pagination:           &ms.Pagination{MaxTotalHits: maxTotalHits},
+	}, nil).Once()
+	mockClient.On("GetIndexSettings", dayIndex(1)).Return(&ms.Settings{
+		FilterableAttributes: []string{"ExecutionID", "ResourceName", "EventType"},
+	}, nil).Once()
+	mockClient.On("UpdateIndexSettings", dayIndex(1)).Return(nil).Once()
+
+	assert.NoError(t, sm.migrateIndexSettings())
+	mockClient.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "UpdateIndexSettings", dayIndex(0))
+}
+
+// dayIndex returns the daily index name of the given number of days ago
+func dayIndex(daysAgo int) string {
+	return "finala-" + time.Now().In(time.UTC).AddDate(0, 0, -daysAgo).Format(indexDayLayout)
+}
+
+// executionHit returns a service_status hit of an execution started the given number of days ago
+func executionHit(name string, daysAgo int) map[string]interface{} {
+	started := time.Now().In(time.UTC).AddDate(0, 0, -daysAgo).Unix()
+	return map[string]interface{}{
+		"ExecutionID": fmt.Sprintf("%s_%d", name, started),
+		"EventType":   "service_status",
+	}
+}
+
+// TestStorageManager_GetExecutions_ReadWindow tests that executions are read from every daily index of the window.
+func TestStorageManager_GetExecutions_ReadWindow(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{
+		client:          mockClient,
+		currentIndexDay: dayIndex(0),
+		readWindowDays:  7,
+	}
+
+	mockClient.On("ListIndexes").Return(&ms.IndexesResults{Results: []*ms.IndexResult{
+		{UID: dayIndex(1)},
+		{UID: dayIndex(0)},
+		{UID: dayIndex(10)},
+		{UID: "other-index"},
+	}}, nil)
+	mockClient.On("Search", dayIndex(0), mock.Anything).Return(&ms.SearchResponse{Hits: []interface{}{
+		executionHit("today", 0),
+	}}, nil).Twice()
+	mockClient.On("Search", dayIndex(1), mock.Anything).Return(&ms.SearchResponse{Hits: []interface{}{
+		executionHit("yesterday", 1),
+		executionHit("yesterday", 1),
+	}}, nil).Twice()
+
+	executions, err := sm.GetExecutions(20)
+	assert.NoError(t, err)
+	assert.Len(t, executions, 2, "executions should be read from today and yesterday and de-duplicated")
+	assert.Contains(t, executions[0].ID, "today_", "newest execution should be first")
+	assert.Contains(t, executions[1].ID, "yesterday_")
+
+	executions, err = sm.GetExecutions(1)
+	assert.NoError(t, err)
+	assert.Len(t, executions, 1, "executions should be limited to the query limit")
+	mockClient.AssertNotCalled(t, "Search", dayIndex(10), mock.Anything)
+}
+
+// TestStorageManager_GetResources_ExecutionStartedYesterday tests that execution reads start at the execution day.
+func TestStorageManager_GetResources_ExecutionStartedYesterday(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{
+		client:          mockClient,
+		currentIndexDay: dayIndex(0),
+		readWindowDays:  1,
+	}
+	executionID := executionHit("general", 1)["ExecutionID"].(string)
+
+	mockClient.On("ListIndexes").Return(&ms.IndexesResults{Results: []*ms.IndexResult{
+		{UID: dayIndex(2)},
+		{UID: dayIndex(1)},
+		{UID: dayIndex(0)},
+	}}, nil).Once()
+	mockClient.On("Search", dayIndex(1), mock.Anything).Return(&ms.SearchResponse{Hits: []interface{}{
+		map[string]interface{}{"ResourceName": "aws_ec2", "ExecutionID": executionID},
+	}}, nil).Once()
+	mockClient.On("Search", dayIndex(0), mock.Anything).Return(&ms.SearchResponse{Hits: []interface{}{
+		map[string]interface{}{"ResourceName": "aws_ec2", "ExecutionID": executionID},
+	}}, nil).Once()
+
+	page, err := sm.GetResources("aws_ec2", executionID, storage.ResourcesQuery{})
+	assert.NoError(t, err)
+	assert.Len(t, page.Resources, 2, "resources written before and after midnight should be returned")
+	mockClient.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "Search", dayIndex(2), mock.Anything)
+}
+
+// searchPage matches the search params of the page that starts at the given offset
+func searchPage(offset int) interface{} {
+	return mock.MatchedBy(func(params map[string]interface{}) bool {
+		return params["offset"] == offset && params["limit"] == documentsPageSize
+	})
+}
+
+// TestStorageManager_GetResources_Pages tests that all the hits are read before the resources are sorted and paged.
+func TestStorageManager_GetResources_Pages(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{client: mockClient, currentIndexDay: dayIndex(0), readWindowDays: 1}
+
+	firstPage := []interface{}{}
+	for i := 0; i < documentsPageSize; i++ {
+		firstPage = append(firstPage, map[string]interface{}{"Data": map[string]interface{}{"ResourceID": fmt.Sprintf("i-%d", i), "PricePerMonth": float64(i)}})
+	}
+
+	mockClient.On("ListIndexes").Return(&ms.IndexesResults{Results: []*ms.IndexResult{{UID: dayIndex(0)}}}, nil).Once()
+	mockClient.On("Search", dayIndex(0), searchPage(0)).Return(&ms.SearchResponse{Hits: firstPage}, nil).Once()
+	mockClient.On("Search", dayIndex(0), searchPage(documentsPageSize)).Return(&ms.SearchResponse{Hits: []interface{}{
+		map[string]interface{}{"Data": map[string]interface{}{"ResourceID": "i-top", "PricePerMonth": float64(5000)}},
+	}}, nil).Once()
+
+	page, err := sm.GetResources("aws_ec2", "general", storage.ResourcesQuery{
+		Search: "i-",
+		Sort:   storage.SortField{Field: "Data.PricePerMonth", Descending: true},
+		Fields: []string{"Data.ResourceID"},
+		Limit:  2,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(documentsPageSize+1), page.Total)
+	assert.Equal(t, []map[string]interface{}{
+		{"Data": map[string]interface{}{"ResourceID": "i-top"}},
+		{"Data": map[string]interface{}{"ResourceID": fmt.Sprintf("i-%d", documentsPageSize-1)}},
+	}, page.Resources)
+	mockClient.AssertExpectations(t)
+}
+
+// TestStorageManager_EachResource tests that every resource is read with a single pass over the search pages.
+func TestStorageManager_EachResource(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{client: mockClient, currentIndexDay: dayIndex(0), readWindowDays: 1}
+
+	firstPage := []interface{}{}
+	for i := 0; i < documentsPageSize; i++ {
+		firstPage = append(firstPage, map[string]interface{}{"Data": map[string]interface{}{"ResourceID": fmt.Sprintf("i-%d", i)}})
+	}
+
+	mockClient.On("ListIndexes").Return(&ms.IndexesResults{Results: []*ms.IndexResult{{UID: dayIndex(0)}}}, nil).Once()
+	mockClient.On("Search", dayIndex(0), searchPage(0)).Return(&ms.SearchResponse{Hits: firstPage}, nil).Once()
+	mockClient.On("Search", dayIndex(0), searchPage(documentsPageSize)).Return(&ms.SearchResponse{Hits: []interface{}{
+		map[string]interface{}{"Data": map[string]interface{}{"ResourceID": "i-last"}},
+	}}, nil).Once()
+
+	resources := 0
+	err := sm.EachResource("aws_ec2", "general", storage.In("Data.AccountID", "123456789012"), func(resource map[string]interface{}) error {
+		resources++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, documentsPageSize+1, resources)
+	mockClient.AssertExpectations(t)
+	mockClient.AssertNumberOfCalls(t, "Search", 2)
+}
+
+// TestStorageManager_GetExecutions_Pages tests that the executions of every page of hits are returned.
+func TestStorageManager_GetExecutions_Pages(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{client: mockClient, currentIndexDay: dayIndex(0), readWindowDays: 1}
+
+	firstPage := []interface{}{}
+	for i := 0; i < documentsPageSize; i++ {
+		firstPage = append(firstPage, executionHit("first", 0))
+	}
+
+	mockClient.On("ListIndexes").Return(&ms.IndexesResults{Results: []*ms.IndexResult{{UID: dayIndex(0)}}}, nil).Once()
+	mockClient.On("Search", dayIndex(0), searchPage(0)).Return(&ms.SearchResponse{Hits: firstPage}, nil).Once()
+	mockClient.On("Search", dayIndex(0), searchPage(documentsPageSize)).Return(&ms.SearchResponse{Hits: []interface{}{
+		executionHit("second", 0),
+	}}, nil).Once()
+
+	executions, err := sm.GetExecutions(0)
+	assert.NoError(t, err)
+	assert.Len(t, executions, 2, "executions of the second page of hits should be returned")
+	mockClient.AssertExpectations(t)
+}
+
+// TestStorageManager_GetResourceTrends_Pages tests that the execution costs sum the resources of every page of hits.
+func TestStorageManager_GetResourceTrends_Pages(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{client: mockClient, currentIndexDay: dayIndex(0), readWindowDays: 1}
+
+	resourceHit := map[string]interface{}{"ExecutionID": "general_1", "Data": map[string]interface{}{"PricePerMonth": float64(1)}}
+	firstPage := []interface{}{}
+	for i := 0; i < documentsPageSize; i++ {
+		firstPage = append(firstPage, resourceHit)
+	}
+
+	mockClient.On("ListIndexes").Return(&ms.IndexesResults{Results: []*ms.IndexResult{{UID: dayIndex(0)}}}, nil).Once()
+	mockClient.On("Search", dayIndex(0), searchPage(0)).Return(&ms.SearchResponse{Hits: firstPage}, nil).Once()
+	mockClient.On("Search", dayIndex(0), searchPage(documentsPageSize)).Return(&ms.SearchResponse{Hits: []interface{}{
+		resourceHit,
+	}}, nil).Once()
+
+	trends, err := sm.GetResourceTrends("aws_ec2", nil, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.ExecutionCost{
+		{ExecutionID: "general_1", ExtractedTimestamp: 1, CostSum: float64(documentsPageSize + 1)},
+	}, trends)
+	mockClient.AssertExpectations(t)
+}
+
+// TestStorageManager_GetResourceTrends_Limit tests that the latest executions are returned oldest first.
+func TestStorageManager_GetResourceTrends_Limit(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{client: mockClient, currentIndexDay: dayIndex(0), readWindowDays: 1}
+
+	resourceHit := func(executionID string, price interface{}) map[string]interface{} {
+		return map[string]interface{}{"ExecutionID": executionID, "Data": map[string]interface{}{"PricePerMonth": price}}
+	}
+	mockClient.On("ListIndexes").Return(&ms.IndexesResults{Results: []*ms.IndexResult{{UID: dayIndex(0)}}}, nil).Once()
+	mockClient.On("Search", dayIndex(0), searchPage(0)).Return(&ms.SearchResponse{Hits: []interface{}{
+		resourceHit("general_3", float64(30)),
+		resourceHit("general_1", float64(10)),
+		resourceHit("other_3", "12.5"),
+		resourceHit("general_2", float64(20)),
+	}}, nil).Once()
+
+	trends, err := sm.GetResourceTrends("aws_ec2", nil, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.ExecutionCost{
+		{ExecutionID: "general_3", ExtractedTimestamp: 3, CostSum: 30},
+		{ExecutionID: "other_3", ExtractedTimestamp: 3, CostSum: 12.5},
+	}, trends)
+	mockClient.AssertExpectations(t)
+}
+
+// TestStorageManager_search_SkipsFailingIndex tests that a failing index does not fail the whole query.
+func TestStorageManager_search_SkipsFailingIndex(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{client: mockClient}
+
+	mockClient.On("ListIndexes").Return(&ms.IndexesResults{Results: []*ms.IndexResult{
+		{UID: dayIndex(0)},
+		{UID: dayIndex(1)},
+	}}, nil)
+	mockClient.On("Search", dayIndex(0), mock.Anything).Return(&ms.SearchResponse{Hits: []interface{}{"hit"}}, nil).Once()
+	mockClient.On("Search", dayIndex(1), mock.Anything).Return(nil, errors.New("index not found")).Once()
+
+	result, err := sm.search(sm.windowStart(), map[string]interface{}{"q": ""})
+	assert.NoError(t, err)
+	assert.Len(t, result.Hits, 1)
+
+	mockClient.On("Search", dayIndex(0), mock.Anything).Return(nil, errors.New("unavailable")).Once()
+	mockClient.On("Search", dayIndex(1), mock.Anything).Return(nil, errors.New("unavailable")).Once()
+
+	_, err = sm.search(sm.windowStart(), map[string]interface{}{"q": ""})
+	assert.Error(t, err, "search should fail when no index answered")
+}
+
+// documentsPage matches the documents query of the page that starts at the given offset
+func documentsPage(offset int64) interface{} {
+	return mock.MatchedBy(func(query *ms.DocumentsQuery) bool {
+		return query.Offset == offset && query.Limit == documentsPageSize
+	})
+}
+
+// TestStorageManager_ExportEvents tests that the documents of every daily index are exported page by page, oldest index first.
+func TestStorageManager_ExportEvents(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{client: mockClient, currentIndexDay: dayIndex(0)}
+
+	mockClient.On("ListIndexes").Return(&ms.IndexesResults{Results: []*ms.IndexResult{
+		{UID: dayIndex(0)},
+		{UID: dayIndex(1)},
+		{UID: "other-index"},
+	}}, nil).Once()
+	mockClient.On("GetDocuments", dayIndex(1), documentsPage(0)).Return(&ms.DocumentsResult{
+		Results: []map[string]interface{}{{"id": "a"}, {"id": "b"}},
+		Total:   3,
+	}, nil).Once()
+	mockClient.On("GetDocuments", dayIndex(1), documentsPage(2)).Return(&ms.DocumentsResult{
+		Results: []map[string]interface{}{{"id": "c"}},
+		Total:   3,
+	}, nil).Once()
+	mockClient.On("GetDocuments", dayIndex(0), documentsPage(0)).Return(&ms.DocumentsResult{
+		Results: []map[string]interface{}{{"id": "d", "EventTime": float64(1700000000)}},
+		Total:   1,
+	}, nil).Once()
+
+	documents := []string{}
+	err := sm.ExportEvents(func(document string) error {
+		documents = append(documents, document)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`{"id":"a"}`, `{"id":"b"}`, `{"id":"c"}`, `{"EventTime":1700000000,"id":"d"}`}, documents)
+	mockClient.AssertExpectations(t)
+
+	mockClient.On("ListIndexes").Return(&ms.IndexesResults{Results: []*ms.IndexResult{{UID: dayIndex(0)}}}, nil).Once()
+	mockClient.On("GetDocuments", dayIndex(0), documentsPage(0)).Return(nil, errors.New("unavailable")).Once()
+	assert.Error(t, sm.ExportEvents(func(document string) error { return nil }))
+}
+
+// TestStorageManager_GetExecutionTags tests that the tags of all the execution resources are counted, including
+// the resources without tags.
+func TestStorageManager_GetExecutionTags(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{client: mockClient, currentIndexDay: dayIndex(0)}
+	executionID := fmt.Sprintf("general_%d", time.Now().In(time.UTC).AddDate(0, 0, -1).Unix())
+
+	mockClient.On("ListIndexes").Return(&ms.IndexesResults{Results: []*ms.IndexResult{
+		{UID: dayIndex(0)},
+		{UID: dayIndex(1)},
+		{UID: dayIndex(2)},
+	}}, nil)
+	mockClient.On("GetDocuments", dayIndex(1), mock.MatchedBy(func(query *ms.DocumentsQuery) bool {
+		return query.Offset == 0 && query.Filter == `EventType=resource_detected AND ExecutionID = "`+executionID+`"`
+	})).Return(&ms.DocumentsResult{
+		Results: []map[string]interface{}{
+			{"Data": map[string]interface{}{"Tag": map[string]interface{}{"Team": "platform", "Env": "prod"}}},
+			{"Data": map[string]interface{}{"Tag": map[string]interface{}{"Team": "finops"}}},
+		},
+		Total: 4,
+	}, nil).Once()
+	mockClient.On("GetDocuments", dayIndex(1), documentsPage(2)).Return(&ms.DocumentsResult{
+		Results: []map[string]interface{}{
+			{"Data": map[string]interface{}{"Tag": map[string]interface{}{"Team": "platform"}}},
+			{"Data": map[string]interface{}{"Tag": nil}},
+		},
+		Total: 4,
+	}, nil).Once()
+	mockClient.On("GetDocuments", dayIndex(0), documentsPage(0)).Return(&ms.DocumentsResult{
+		Results: []map[string]interface{}{{"Data": map[string]interface{}{"ResourceID": "i-1"}}},
+		Total:   1,
+	}, nil).Once()
+
+	tags, err := sm.GetExecutionTags(executionID)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]storage.TagValue{
+		"Env":  {{Value: "prod", Count: 1}},
+		"Team": {{Value: "finops", Count: 1}, {Value: "platform", Count: 2}},
+	}, tags)
+	mockClient.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "GetDocuments", dayIndex(2), mock.Anything)
+
+	mockClient.On("GetDocuments", mock.Anything, mock.Anything).Return(nil, errors.New("unavailable"))
+	_, err = sm.GetExecutionTags(executionID)
+	assert.Error(t, err, "tags should fail when no index answered")
+}
+
 // Remaining AddEvent and SearchEvents tests commented out as these methods don't exist in the actual StorageManager.
 // The actual StorageManager has Save() method for saving data and various Get methods for querying.
 /*
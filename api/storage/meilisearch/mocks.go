@@ -1236,6 +1236,11 @@ func (m *MockClient) Index(indexName string, document interface{}) error {
 	return args.Error(0)
 }
 
+func (m *MockClient) IndexBatch(indexName string, documents []map[string]interface{}) error {
+	args := m.Called(indexName, documents)
+	return args.Error(0)
+}
+
 func (m *MockClient) Search(indexName string, query interface{}) (*ms.SearchResponse, error) {
 	args := m.Called(indexName, query)
 	if args.Get(0) == nil {
@@ -1277,6 +1282,32 @@ func (m *MockClient) IndexExists(indexName string) (bool, error) {
 	return args.Bool(0), args.Error(1)
 }
 
+func (m *MockClient) DeleteDocumentsByFilter(indexName string, filter string) error {
+	args := m.Called(indexName, filter)
+	return args.Error(0)
+}
+
+func (m *MockClient) GetIndexSettings(indexName string) (*ms.Settings, error) {
+	args := m.Called(indexName)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*ms.Settings), args.Error(1)
+}
+
+func (m *MockClient) UpdateIndexSettings(indexName string) error {
+	args := m.Called(indexName)
+	return args.Error(0)
+}
+
+func (m *MockClient) GetDocuments(indexName string, query *ms.DocumentsQuery) (*ms.DocumentsResult, error) {
+	args := m.Called(indexName, query)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*ms.DocumentsResult), args.Error(1)
+}
+
 func (m *MockClient) Ping() error {
 	args := m.Called()
 	return args.Error(0)
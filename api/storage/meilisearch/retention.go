@@ -0,0 +1,278 @@
+package meilisearch
+
+import (
+	"errors"
+	"finala/api/config"
+	"finala/api/storage"
+	"finala/interpolation"
+	"fmt"
+	"sort"
+	"time"
+
+	ms "github.com/meilisearch/meilisearch-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// ListIndexes returns the daily indexes of the storage, newest first
+func (sm *StorageManager) ListIndexes() ([]storage.IndexInfo, error) {
+	results, err := sm.client.ListIndexes()
+	if err != nil {
+		log.WithError(err).Error("could not list the daily indexes")
+		return nil, err
+	}
+
+	currentIndexDay := sm.getCurrentIndexDay()
+	indexes := []storage.IndexInfo{}
+	for _, index := range results.Results {
+		day, ok := getIndexDay(index.UID)
+		if !ok {
+			continue
+		}
+		indexes = append(indexes, storage.IndexInfo{
+			Name:      index.UID,
+			Day:       day.Format(indexDayLayout),
+			Current:   index.UID == currentIndexDay,
+			CreatedAt: index.CreatedAt,
+			UpdatedAt: index.UpdatedAt,
+		})
+	}
+
+	sort.Slice(indexes, func(i, j int) bool {
+		return indexes[i].Day > indexes[j].Day
+	})
+	return indexes, nil
+}
+
+// DeleteIndex deletes a daily index. The index that new events are written to can not be deleted
+func (sm *StorageManager) DeleteIndex(name string) error {
+	if name == sm.getCurrentIndexDay() {
+		return storage.ErrIndexInUse
+	}
+	if _, ok := getIndexDay(name); !ok {
+		return storage.ErrIndexNotFound
+	}
+
+	exists, err := sm.client.IndexExists(name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return storage.ErrIndexNotFound
+	}
+
+	if _, err := sm.client.DeleteIndex(name); err != nil {
+		log.WithError(err).WithField("index", name).Error("could not delete index")
+		return err
+	}
+
+	log.WithField("index", name).Info("index deleted")
+	return nil
+}
+
+// Prune applies the retention policy on the daily indexes. When dryRun is set the indexes and
+// executions are only reported and nothing is deleted
+func (sm *StorageManager) Prune(dryRun bool) (storage.PruneReport, error) {
+	report := storage.PruneReport{
+		DryRun:            dryRun,
+		DeletedIndexes:    []string{},
+		DeletedExecutions: []string{},
+	}
+	if !sm.retention.Enabled() {
+		return report, nil
+	}
+
+	indexes, err := sm.getIndexes(time.Time{})
+	if err != nil {
+		return report, err
+	}
+
+	now := time.Now().In(time.UTC)
+	year, month, day := now.Date()
+	oldestDay := time.Date(year, month, day-(sm.retention.KeepDays-1), 0, 0, 0, 0, time.UTC)
+
+	currentIndexDay := sm.getCurrentIndexDay()
+	deleteIndexes := []string{}
+	keptIndexes := []string{}
+	for _, index := range indexes {
+		indexDay, _ := getIndexDay(index)
+		if sm.retention.KeepDays > 0 && index != currentIndexDay && indexDay.Before(oldestDay) {
+			deleteIndexes = append(deleteIndexes, index)
+			continue
+		}
+		keptIndexes = append(keptIndexes, index)
+	}
+
+	executionIndexes := map[string][]string{}
+	expired := map[string]bool{}
+	if sm.retention.KeepExecutions > 0 || sm.retention.WeeklyAfterDays > 0 {
+		executionIndexes, err = sm.getExecutionIndexes(keptIndexes)
+		if err != nil {
+			return report, err
+		}
+
+		executionIDs := make([]string, 0, len(executionIndexes))
+		for executionID := range executionIndexes {
+			executionIDs = append(executionIDs, executionID)
+		}
+		for _, executionID := range expiredExecutions(sm.retention, executionIDs, now) {
+			expired[executionID] = true
+		}
+	}
+
+	// An index that holds only expired executions is deleted as a whole
+	indexExecutions := map[string][]string{}
+	for executionID, executionIndexes := range executionIndexes {
+		for _, index := range executionIndexes {
+			indexExecutions[index] = append(indexExecutions[index], executionID)
+		}
+	}
+	deletedIndexes := map[string]bool{}
+	for _, index := range keptIndexes {
+		executions, ok := indexExecutions[index]
+		if !ok || index == currentIndexDay {
+			continue
+		}
+		allExpired := true
+		for _, executionID := range executions {
+			if !expired[executionID] {
+				allExpired = false
+				break
+			}
+		}
+		if allExpired {
+			deleteIndexes = append(deleteIndexes, index)
+		}
+	}
+
+	var errs []error
+	for _, index := range deleteIndexes {
+		if !dryRun {
+			if _, err := sm.client.DeleteIndex(index); err != nil {
+				log.WithError(err).WithField("index", index).Error("could not delete expired index")
+				errs = append(errs, err)
+				continue
+			}
+		}
+		deletedIndexes[index] = true
+		report.DeletedIndexes = append(report.DeletedIndexes, index)
+	}
+
+	expiredIDs := make([]string, 0, len(expired))
+	for executionID := range expired {
+		expiredIDs = append(expiredIDs, executionID)
+	}
+	sort.Strings(expiredIDs)
+
+	for _, executionID := range expiredIDs {
+		deleted := true
+		for _, index := range executionIndexes[executionID] {
+			if dryRun || deletedIndexes[index] {
+				continue
+			}
+			if err := sm.client.DeleteDocumentsByFilter(index, equalsFilter("ExecutionID", executionID)); err != nil {
+				log.WithError(err).WithFields(log.Fields{
+					"index":        index,
+					"execution_id": executionID,
+				}).Error("could not delete expired execution")
+				errs = append(errs, err)
+				deleted = false
+			}
+		}
+		if deleted {
+			report.DeletedExecutions = append(report.DeletedExecutions, executionID)
+		}
+	}
+
+	return report, errors.Join(errs...)
+}
+
+// getExecutionIndexes returns the indexes that hold the events of every execution. The execution id of every
+// document is read, so an index that holds only the detected resources of an execution is found as well.
+// The documents without an execution id are returned under an empty id, which never expires, so their index is kept
+func (sm *StorageManager) getExecutionIndexes(indexes []string) (map[string][]string, error) {
+	executionIndexes := map[string][]string{}
+	for _, index := range indexes {
+		seen := map[string]bool{}
+		err := sm.eachDocument(index, ms.DocumentsQuery{Fields: []string{"ExecutionID"}}, func(doc map[string]interface{}) error {
+			executionID, _ := doc["ExecutionID"].(string)
+			if !seen[executionID] {
+				seen[executionID] = true
+				executionIndexes[executionID] = append(executionIndexes[executionID], index)
+			}
+			return nil
+		})
+		if err != nil {
+			log.WithError(err).WithField("index", index).Error("could not get the executions of index")
+			return nil, err
+		}
+	}
+	return executionIndexes, nil
+}
+
+// expiredExecutions returns the executions that are not kept by the execution rules of the retention policy.
+// Executions without a collector name and timestamp are always kept
+func expiredExecutions(retention config.RetentionConfig, executionIDs []string, now time.Time) []string {
+	type execution struct {
+		id        string
+		timestamp int64
+	}
+
+	collectors := map[string][]execution{}
+	for _, executionID := range executionIDs {
+		name, err := interpolation.ExtractExecutionName(executionID)
+		if err != nil {
+			continue
+		}
+		timestamp, err := interpolation.ExtractTimestamp(executionID)
+		if err != nil {
+			continue
+		}
+		collectors[name] = append(collectors[name], execution{id: executionID, timestamp: timestamp})
+	}
+
+	weeklyBefore := now.AddDate(0, 0, -retention.WeeklyAfterDays)
+	expired := []string{}
+	for _, executions := range collectors {
+		sort.Slice(executions, func(i, j int) bool {
+			return executions[i].timestamp > executions[j].timestamp
+		})
+
+		keptWeeks := map[string]bool{}
+		for i, execution := range executions {
+			if retention.KeepExecutions > 0 && i >= retention.KeepExecutions {
+				expired = append(expired, execution.id)
+				continue
+			}
+
+			executionTime := time.Unix(execution.timestamp, 0).In(time.UTC)
+			if retention.WeeklyAfterDays > 0 && executionTime.Before(weeklyBefore) {
+				year, week := executionTime.ISOWeek()
+				key := fmt.Sprintf("%d-%d", year, week)
+				if keptWeeks[key] {
+					expired = append(expired, execution.id)
+					continue
+				}
+				keptWeeks[key] = true
+			}
+		}
+	}
+
+	sort.Strings(expired)
+	return expired
+}
+
+// runJanitor applies the retention policy periodically
+func (sm *StorageManager) runJanitor(interval time.Duration) {
+	for {
+		report, err := sm.Prune(false)
+		if err != nil {
+			log.WithError(err).Error("retention janitor failed")
+		}
+		log.WithFields(log.Fields{
+			"deleted_indexes":    len(report.DeletedIndexes),
+			"deleted_executions": len(report.DeletedExecutions),
+			"next_run_in":        interval,
+		}).Info("retention janitor finished")
+		<-time.After(interval)
+	}
+}
@@ -0,0 +1,231 @@
+package meilisearch
+
+import (
+	"finala/api/config"
+	"finala/api/storage"
+	"fmt"
+	"testing"
+	"time"
+
+	ms "github.com/meilisearch/meilisearch-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+// TestExpiredExecutions tests the execution rules of the retention policy.
+func TestExpiredExecutions(t *testing.T) {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	execution := func(name string, t time.Time) string {
+		return fmt.Sprintf("%s_%d", name, t.Unix())
+	}
+
+	monday := time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC)
+	executionIDs := []string{
+		execution("general", now.Add(-time.Hour)),
+		execution("general", now.Add(-2*time.Hour)),
+		execution("general", now.Add(-3*time.Hour)),
+		execution("other", now.Add(-3*time.Hour)),
+		execution("weekly", monday),
+		execution("weekly", monday.AddDate(0, 0, 2)),
+		execution("weekly", monday.AddDate(0, 0, 7)),
+		"invalid-execution",
+	}
+
+	testCases := []struct {
+		name      string
+		retention config.RetentionConfig
+		expected  []string
+	}{
+		{"disabled", config.RetentionConfig{}, []string{}},
+		{"keep_executions", config.RetentionConfig{KeepExecutions: 2}, []string{
+			execution("general", now.Add(-3*time.Hour)),
+			execution("weekly", monday),
+		}},
+		{"weekly_after_days", config.RetentionConfig{WeeklyAfterDays: 30}, []string{
+			execution("weekly", monday),
+		}},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			expired := expiredExecutions(test.retention, executionIDs, now)
+			assert.ElementsMatch(t, test.expected, expired)
+		})
+	}
+}
+
+// TestStorageManager_Prune tests that expired indexes and executions are deleted.
+func TestStorageManager_Prune(t *testing.T) {
+	today := executionHit("general", 0)
+	threeDaysAgo := executionHit("general", 3)
+	otherThreeDaysAgo := executionHit("other", 3)
+	fourDaysAgo := executionHit("other", 4)
+
+	newStorageManager := func() (*StorageManager, *MockClient) {
+		mockClient := new(MockClient)
+		mockClient.On("ListIndexes").Return(&ms.IndexesResults{Results: []*ms.IndexResult{
+			{UID: dayIndex(0)},
+			{UID: dayIndex(3)},
+			{UID: dayIndex(4)},
+			{UID: dayIndex(10)},
+			{UID: "other-index"},
+		}}, nil)
+		mockClient.On("GetDocuments", dayIndex(0), mock.Anything).Return(executionDocuments(today), nil)
+		mockClient.On("GetDocuments", dayIndex(3), mock.Anything).Return(executionDocuments(threeDaysAgo, otherThreeDaysAgo), nil)
+		mockClient.On("GetDocuments", dayIndex(4), mock.Anything).Return(executionDocuments(fourDaysAgo), nil)
+
+		return &StorageManager{
+			client:          mockClient,
+			currentIndexDay: dayIndex(0),
+			retention:       config.RetentionConfig{KeepDays: 7, KeepExecutions: 1},
+		}, mockClient
+	}
+
+	t.Run("dry_run", func(t *testing.T) {
+		sm, mockClient := newStorageManager()
+
+		report, err := sm.Prune(true)
+		assert.NoError(t, err)
+		assert.True(t, report.DryRun)
+		assert.ElementsMatch(t, []string{dayIndex(10), dayIndex(4)}, report.DeletedIndexes)
+		assert.ElementsMatch(t, []string{threeDaysAgo["ExecutionID"].(string), fourDaysAgo["ExecutionID"].(string)}, report.DeletedExecutions)
+		mockClient.AssertNotCalled(t, "DeleteIndex", mock.Anything)
+		mockClient.AssertNotCalled(t, "DeleteDocumentsByFilter", mock.Anything, mock.Anything)
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		sm, mockClient := newStorageManager()
+		mockClient.On("DeleteIndex", dayIndex(10)).Return(true, nil).Once()
+		mockClient.On("DeleteIndex", dayIndex(4)).Return(true, nil).Once()
+		mockClient.On("DeleteDocumentsByFilter", dayIndex(3), fmt.Sprintf(`ExecutionID = "%s"`, threeDaysAgo["ExecutionID"])).Return(nil).Once()
+
+		report, err := sm.Prune(false)
+		assert.NoError(t, err)
+		assert.False(t, report.DryRun)
+		assert.ElementsMatch(t, []string{dayIndex(10), dayIndex(4)}, report.DeletedIndexes)
+		mockClient.AssertExpectations(t)
+		mockClient.AssertNotCalled(t, "DeleteIndex", dayIndex(0))
+		mockClient.AssertNotCalled(t, "DeleteIndex", "other-index")
+	})
+}
+
+// executionDocuments returns the documents page of the given documents
+func executionDocuments(docs ...map[string]interface{}) *ms.DocumentsResult {
+	return &ms.DocumentsResult{Results: docs, Total: int64(len(docs))}
+}
+
+// TestStorageManager_Prune_ResourceDocuments tests that the executions are found by every document of every page,
+// so an index that holds only detected resources is pruned and an index with a kept execution on a later page is kept.
+func TestStorageManager_Prune_ResourceDocuments(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{
+		client:          mockClient,
+		currentIndexDay: dayIndex(0),
+		retention:       config.RetentionConfig{KeepExecutions: 1},
+	}
+
+	resource := func(executionID string) map[string]interface{} {
+		return map[string]interface{}{"ExecutionID": executionID, "EventType": "resource_detected"}
+	}
+	started := time.Now().In(time.UTC).AddDate(0, 0, -3).Unix()
+	firstPage := []map[string]interface{}{}
+	for i := 0; i < documentsPageSize; i++ {
+		firstPage = append(firstPage, resource(fmt.Sprintf("general_%d", started-int64(i))))
+	}
+	kept := resource(executionHit("other", 3)["ExecutionID"].(string))
+	expired := resource(executionHit("general", 4)["ExecutionID"].(string))
+
+	mockClient.On("ListIndexes").Return(&ms.IndexesResults{Results: []*ms.IndexResult{
+		{UID: dayIndex(0)},
+		{UID: dayIndex(3)},
+		{UID: dayIndex(4)},
+	}}, nil)
+	mockClient.On("GetDocuments", dayIndex(0), documentsPage(0)).Return(executionDocuments(executionHit("general", 0)), nil).Once()
+	mockClient.On("GetDocuments", dayIndex(3), documentsPage(0)).Return(&ms.DocumentsResult{Results: firstPage, Total: documentsPageSize + 1}, nil).Once()
+	mockClient.On("GetDocuments", dayIndex(3), documentsPage(documentsPageSize)).Return(&ms.DocumentsResult{
+		Results: []map[string]interface{}{kept},
+		Total:   documentsPageSize + 1,
+	}, nil).Once()
+	mockClient.On("GetDocuments", dayIndex(4), documentsPage(0)).Return(executionDocuments(expired, expired), nil).Once()
+
+	report, err := sm.Prune(true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{dayIndex(4)}, report.DeletedIndexes, "only the index of the expired execution resources should be deleted")
+	assert.Len(t, report.DeletedExecutions, documentsPageSize+1)
+	assert.Contains(t, report.DeletedExecutions, expired["ExecutionID"])
+	assert.NotContains(t, report.DeletedExecutions, kept["ExecutionID"])
+	mockClient.AssertExpectations(t)
+}
+
+// TestStorageManager_Prune_DocumentsWithoutExecution tests that an index with documents without an execution id is kept.
+func TestStorageManager_Prune_DocumentsWithoutExecution(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{
+		client:          mockClient,
+		currentIndexDay: dayIndex(0),
+		retention:       config.RetentionConfig{KeepExecutions: 1},
+	}
+
+	mockClient.On("ListIndexes").Return(&ms.IndexesResults{Results: []*ms.IndexResult{
+		{UID: dayIndex(0)},
+		{UID: dayIndex(3)},
+	}}, nil)
+	mockClient.On("GetDocuments", dayIndex(0), mock.Anything).Return(executionDocuments(executionHit("general", 0)), nil).Once()
+	mockClient.On("GetDocuments", dayIndex(3), mock.Anything).Return(executionDocuments(executionHit("general", 3), map[string]interface{}{"id": "a"}), nil).Once()
+
+	report, err := sm.Prune(true)
+	assert.NoError(t, err)
+	assert.Empty(t, report.DeletedIndexes)
+	assert.Equal(t, []string{executionHit("general", 3)["ExecutionID"].(string)}, report.DeletedExecutions)
+}
+
+// TestStorageManager_currentIndexDay_Concurrent tests that the daily rollover does not race with the index readers.
+func TestStorageManager_currentIndexDay_Concurrent(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{client: mockClient, currentIndexDay: dayIndex(1)}
+
+	mockClient.On("IndexExists", dayIndex(0)).Return(true, nil)
+	mockClient.On("ListIndexes").Return(&ms.IndexesResults{Results: []*ms.IndexResult{{UID: dayIndex(0)}, {UID: dayIndex(1)}}}, nil)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			sm.setCreateCurrentIndexDay()
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		_, err := sm.ListIndexes()
+		assert.NoError(t, err)
+	}
+	<-done
+	assert.Equal(t, dayIndex(0), sm.getCurrentIndexDay())
+}
+
+// TestStorageManager_Prune_Disabled tests that nothing is deleted without a retention policy.
+func TestStorageManager_Prune_Disabled(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{client: mockClient, currentIndexDay: dayIndex(0)}
+
+	report, err := sm.Prune(false)
+	assert.NoError(t, err)
+	assert.Empty(t, report.DeletedIndexes)
+	assert.Empty(t, report.DeletedExecutions)
+	mockClient.AssertNotCalled(t, "ListIndexes")
+}
+
+// TestStorageManager_DeleteIndex tests the deletion of a single daily index.
+func TestStorageManager_DeleteIndex(t *testing.T) {
+	mockClient := new(MockClient)
+	sm := &StorageManager{client: mockClient, currentIndexDay: dayIndex(0)}
+
+	mockClient.On("IndexExists", dayIndex(1)).Return(true, nil).Once()
+	mockClient.On("DeleteIndex", dayIndex(1)).Return(true, nil).Once()
+	mockClient.On("IndexExists", dayIndex(2)).Return(false, nil).Once()
+
+	assert.NoError(t, sm.DeleteIndex(dayIndex(1)))
+	assert.ErrorIs(t, sm.DeleteIndex(dayIndex(2)), storage.ErrIndexNotFound)
+	assert.ErrorIs(t, sm.DeleteIndex(dayIndex(0)), storage.ErrIndexInUse)
+	assert.ErrorIs(t, sm.DeleteIndex("other-index"), storage.ErrIndexNotFound)
+	mockClient.AssertExpectations(t)
+}
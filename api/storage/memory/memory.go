@@ -0,0 +1,364 @@
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"finala/api/storage"
+	"finala/interpolation"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// eventServiceStatus describes the status event of a collected resource type
+	eventServiceStatus = "service_status"
+
+	// eventResourceDetected describes a detected resource event
+	eventResourceDetected = "resource_detected"
+)
+
+// ErrInvalidEvent is returned when an event document is missing a mandatory field
+var ErrInvalidEvent = errors.New("invalid event")
+
+// event describes a saved event and the fields it is queried on
+type event struct {
+	executionID  string
+	resourceName string
+	eventType    string
+	eventTime    int64
+	// fields is the decoded document, used by the filters
+	fields map[string]interface{}
+	// document is the event as sent by the collector, including its id
+	document []byte
+}
+
+// StorageManager keeps the collectors events in memory. The events are lost when the process exits,
+// it is meant for demos and tests
+type StorageManager struct {
+	mu     sync.RWMutex
+	events map[string]event
+	// order holds the document ids in the order they were first saved
+	order []string
+}
+
+// NewStorageManager creates an empty in memory storage
+func NewStorageManager() *StorageManager {
+	return &StorageManager{
+		events: map[string]event{},
+	}
+}
+
+// Save new documents
+func (sm *StorageManager) Save(data string) bool {
+	result, _ := sm.SaveBatch([]string{data})
+	for _, failure := range result.Failed {
+		log.WithField("data", data).Error(failure.Error)
+	}
+	return result.Saved == 1
+}
+
+// SaveBatch saves the documents, a document with the id of a saved one replaces it. Documents that are
+// not valid are reported as failures and the others are still saved
+func (sm *StorageManager) SaveBatch(data []string) (storage.BatchResult, error) {
+	result := storage.BatchResult{}
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	for i, row := range data {
+		id, e, err := parseEvent(row)
+		if err != nil {
+			result.Failed = append(result.Failed, storage.BatchFailure{Index: i, Error: err.Error()})
+			continue
+		}
+		if _, ok := sm.events[id]; !ok {
+			sm.order = append(sm.order, id)
+		}
+		sm.events[id] = e
+		result.Saved++
+	}
+	return result, nil
+}
+
+// parseEvent parses an event document and returns its id
+func parseEvent(data string) (string, event, error) {
+	var doc map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(data))
+	// Keep the numbers as is, the event time is part of the document id
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return "", event{}, err
+	}
+
+	e := event{}
+	e.executionID, _ = doc["ExecutionID"].(string)
+	e.resourceName, _ = doc["ResourceName"].(string)
+	e.eventType, _ = doc["EventType"].(string)
+	if e.executionID == "" || e.resourceName == "" || e.eventType == "" {
+		return "", event{}, fmt.Errorf("%w: ExecutionID, ResourceName and EventType are mandatory", ErrInvalidEvent)
+	}
+
+	if eventTime, ok := doc["EventTime"].(json.Number); ok {
+		value, err := eventTime.Int64()
+		if err != nil {
+			return "", event{}, fmt.Errorf("%w: EventTime %s is not an integer", ErrInvalidEvent, eventTime)
+		}
+		e.eventTime = value
+	}
+
+	id, ok := doc["id"]
+	if !ok {
+		id = storage.DocumentID(doc)
+		doc["id"] = id
+	}
+
+	document, err := json.Marshal(doc)
+	if err != nil {
+		return "", event{}, err
+	}
+	// Decode the document again so the numbers are float64, as returned by the other storages
+	if err := json.Unmarshal(document, &e.fields); err != nil {
+		return "", event{}, err
+	}
+	e.document = document
+	return fmt.Sprint(id), e, nil
+}
+
+// each calls fn with the saved events in the order they were first saved
+func (sm *StorageManager) each(fn func(e event)) {
+	for _, id := range sm.order {
+		fn(sm.events[id])
+	}
+}
+
+// GetSummary returns executions summary, the filters apply to the detected resources
+func (sm *StorageManager) GetSummary(executionID string, filter storage.Expression) (map[string]storage.CollectorsSummary, error) {
+	summary := make(map[string]storage.CollectorsSummary)
+	pricedCount := map[string]int{}
+	if err := storage.Validate(filter); err != nil {
+		return summary, err
+	}
+
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	sm.each(func(e event) {
+		if e.executionID != executionID {
+			return
+		}
+
+		collector := summary[e.resourceName]
+		collector.ResourceName = e.resourceName
+		switch e.eventType {
+		case eventServiceStatus:
+			// The latest status of the resource type is kept
+			if collector.EventTime > e.eventTime {
+				break
+			}
+			collector.EventTime = e.eventTime
+			collector.Status = int(numberValue(storage.FieldValue(e.fields, "Data.Status")))
+			collector.ErrorMessage = stringValue(storage.FieldValue(e.fields, "Data.ErrorMessage"))
+		case eventResourceDetected:
+			if !storage.Matches(filter, e.fields) {
+				return
+			}
+			collector.ResourceCount++
+			if price := numberValue(storage.FieldValue(e.fields, "Data.PricePerMonth")); price > 0 {
+				collector.TotalSpent += price
+				pricedCount[e.resourceName]++
+			}
+			collector.HasPricing = pricedCount[e.resourceName] > 0
+			if collector.HasPricing {
+				collector.Category = "potential_cost_saving"
+			} else {
+				collector.Category = "unused_resource"
+			}
+		default:
+			return
+		}
+		summary[e.resourceName] = collector
+	})
+
+	return summary, nil
+}
+
+// GetExecutions returns list of executions
+func (sm *StorageManager) GetExecutions(queryLimit int) ([]storage.Executions, error) {
+	executions := []storage.Executions{}
+	seen := map[string]bool{}
+
+	sm.mu.RLock()
+	sm.each(func(e event) {
+		if seen[e.executionID] {
+			return
+		}
+		seen[e.executionID] = true
+
+		timestamp, err := interpolation.ExtractTimestamp(e.executionID)
+		if err != nil {
+			timestamp = 0
+		}
+		executions = append(executions, storage.Executions{
+			ID:   e.executionID,
+			Name: "Execution " + e.executionID,
+			Time: time.Unix(timestamp, 0),
+		})
+	})
+	sm.mu.RUnlock()
+
+	sort.Slice(executions, func(i, j int) bool {
+		if !executions[i].Time.Equal(executions[j].Time) {
+			return executions[i].Time.After(executions[j].Time)
+		}
+		return executions[i].ID > executions[j].ID
+	})
+	if queryLimit > 0 && len(executions) > queryLimit {
+		executions = executions[:queryLimit]
+	}
+
+	return executions, nil
+}
+
+// GetResources returns a page of resources, the search matches the resources that contain it, case insensitive
+func (sm *StorageManager) GetResources(resourceType string, executionID string, query storage.ResourcesQuery) (storage.ResourcesPage, error) {
+	if err := query.Validate(); err != nil {
+		return storage.ResourcesPage{}, err
+	}
+
+	resources := []map[string]interface{}{}
+	search := strings.ToLower(query.Search)
+
+	sm.mu.RLock()
+	sm.each(func(e event) {
+		if e.executionID != executionID || e.resourceName != resourceType || e.eventType != eventResourceDetected {
+			return
+		}
+		if search != "" && !strings.Contains(strings.ToLower(string(e.document)), search) {
+			return
+		}
+		if !storage.Matches(query.Filter, e.fields) {
+			return
+		}
+
+		rowData := make(map[string]interface{})
+		if err := json.Unmarshal(e.document, &rowData); err != nil {
+			log.WithError(err).Error("error when trying to parse resource document")
+			return
+		}
+		resources = append(resources, rowData)
+	})
+	sm.mu.RUnlock()
+
+	return storage.PageResources(resources, query), nil
+}
+
+// EachResource calls fn with every resource of the type in the execution that matches the filter, fn is
+// called once the resources are read and the lock is released
+func (sm *StorageManager) EachResource(resourceType string, executionID string, filter storage.Expression, fn func(resource map[string]interface{}) error) error {
+	page, err := sm.GetResources(resourceType, executionID, storage.ResourcesQuery{Filter: filter})
+	if err != nil {
+		return err
+	}
+	for _, resource := range page.Resources {
+		if err := fn(resource); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetResourceTrends returns the cost of the resource type in the latest executions, oldest first
+func (sm *StorageManager) GetResourceTrends(resourceType string, filter storage.Expression, limit int) ([]storage.ExecutionCost, error) {
+	resources := []storage.ExecutionCost{}
+	costs := map[string]float64{}
+	if err := storage.Validate(filter); err != nil {
+		return resources, err
+	}
+
+	sm.mu.RLock()
+	sm.each(func(e event) {
+		if e.resourceName != resourceType || e.eventType == eventServiceStatus || !storage.Matches(filter, e.fields) {
+			return
+		}
+		costs[e.executionID] += numberValue(storage.FieldValue(e.fields, "Data.PricePerMonth"))
+	})
+	sm.mu.RUnlock()
+
+	for executionID, costSum := range costs {
+		timestamp, err := interpolation.ExtractTimestamp(executionID)
+		if err != nil {
+			timestamp = 0
+		}
+		resources = append(resources, storage.ExecutionCost{
+			ExecutionID:        executionID,
+			ExtractedTimestamp: timestamp,
+			CostSum:            costSum,
+		})
+	}
+
+	sort.Slice(resources, func(i, j int) bool {
+		if resources[i].ExtractedTimestamp != resources[j].ExtractedTimestamp {
+			return resources[i].ExtractedTimestamp < resources[j].ExtractedTimestamp
+		}
+		return resources[i].ExecutionID < resources[j].ExecutionID
+	})
+	if limit > 0 && len(resources) > limit {
+		resources = resources[len(resources)-limit:]
+	}
+	return resources, nil
+}
+
+// GetExecutionTags returns the values of every tag of the execution resources, with the number of resources that have them
+func (sm *StorageManager) GetExecutionTags(executionID string) (map[string][]storage.TagValue, error) {
+	counter := storage.TagCounter{}
+
+	sm.mu.RLock()
+	sm.each(func(e event) {
+		if e.executionID != executionID || e.eventType != eventResourceDetected {
+			return
+		}
+		tags, _ := storage.FieldValue(e.fields, "Data.Tag").(map[string]interface{})
+		counter.Add(tags)
+	})
+	sm.mu.RUnlock()
+
+	return counter.Tags(), nil
+}
+
+// ExportEvents calls fn with every saved event document, in the order they were first saved
+func (sm *StorageManager) ExportEvents(fn func(document string) error) error {
+	documents := []string{}
+	sm.mu.RLock()
+	sm.each(func(e event) {
+		documents = append(documents, string(e.document))
+	})
+	sm.mu.RUnlock()
+
+	for _, document := range documents {
+		if err := fn(document); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// numberValue returns the value of a numeric document field, or 0 when the value is missing
+func numberValue(value interface{}) float64 {
+	number, _ := value.(float64)
+	return number
+}
+
+// stringValue returns the string form of a document value, or an empty string when the value is missing
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,175 @@
+package memory
+
+import (
+	"finala/api/storage"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func statusEvent(executionID, resourceName string, status int, eventTime int64) string {
+	return fmt.Sprintf(`{"ExecutionID":"%s","ResourceName":"%s","EventType":"service_status","EventTime":%d,"Data":{"Status":%d,"ErrorMessage":""}}`,
+		executionID, resourceName, eventTime, status)
+}
+
+func resourceEvent(executionID, resourceName, resourceID string, price float64, team string) string {
+	return fmt.Sprintf(`{"ExecutionID":"%s","ResourceName":"%s","EventType":"resource_detected","EventTime":1,`+
+		`"Data":{"ResourceID":"%s","PricePerMonth":%g,"Tag":{"Team":"%s"}}}`,
+		executionID, resourceName, resourceID, price, team)
+}
+
+// TestStorageManager tests the storage queries.
+func TestStorageManager(t *testing.T) {
+	sm := NewStorageManager()
+
+	first := "general_1700000000"
+	second := "general_1700086400"
+	result, err := sm.SaveBatch([]string{
+		statusEvent(first, "aws_ec2", 0, 1),
+		statusEvent(first, "aws_ec2", 2, 3),
+		statusEvent(first, "aws_ec2", 1, 2),
+		resourceEvent(first, "aws_ec2", "i-1", 10, "finops"),
+		resourceEvent(first, "aws_ec2", "i-2", 0, "platform"),
+		resourceEvent(first, "aws_ec2", "i-4", 5, "platform"),
+		statusEvent(second, "aws_ec2", 2, 4),
+		resourceEvent(second, "aws_ec2", "i-1", 12.5, "finops"),
+		resourceEvent(second, "aws_ec2", "i-3", 20, "platform"),
+		`{"ResourceName":"aws_ec2"}`,
+		`{"ResourceName":`,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 9, result.Saved)
+	assert.Len(t, result.Failed, 2)
+	assert.Equal(t, 9, result.Failed[0].Index)
+	assert.Equal(t, 10, result.Failed[1].Index)
+
+	// A resource that is sent twice replaces the saved one
+	assert.True(t, sm.Save(resourceEvent(first, "aws_ec2", "i-1", 15, "finops")))
+	assert.False(t, sm.Save(`{"ExecutionID":"general_1700000000"}`))
+
+	t.Run("summary", func(t *testing.T) {
+		summary, err := sm.GetSummary(first, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]storage.CollectorsSummary{
+			"aws_ec2": {ResourceName: "aws_ec2", ResourceCount: 3, TotalSpent: 20, Status: 2, EventTime: 3, HasPricing: true, Category: "potential_cost_saving"},
+		}, summary)
+
+		summary, err = sm.GetSummary("general_1", nil)
+		assert.NoError(t, err)
+		assert.Empty(t, summary)
+	})
+
+	t.Run("executions", func(t *testing.T) {
+		executions, err := sm.GetExecutions(0)
+		assert.NoError(t, err)
+		assert.Len(t, executions, 2)
+		assert.Equal(t, second, executions[0].ID)
+		assert.Equal(t, int64(1700086400), executions[0].Time.Unix())
+
+		executions, err = sm.GetExecutions(1)
+		assert.NoError(t, err)
+		assert.Len(t, executions, 1)
+	})
+
+	t.Run("resources", func(t *testing.T) {
+		page, err := sm.GetResources("aws_ec2", first, storage.ResourcesQuery{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), page.Total)
+		assert.Len(t, page.Resources, 3)
+		assert.Equal(t, "i-1", page.Resources[0]["Data"].(map[string]interface{})["ResourceID"])
+		assert.Equal(t, float64(15), page.Resources[0]["Data"].(map[string]interface{})["PricePerMonth"])
+
+		page, err = sm.GetResources("aws_ec2", first, storage.ResourcesQuery{Search: "I-2"})
+		assert.NoError(t, err)
+		assert.Len(t, page.Resources, 1)
+		assert.Equal(t, "i-2", page.Resources[0]["Data"].(map[string]interface{})["ResourceID"])
+		assert.NotEmpty(t, page.Resources[0]["id"])
+
+		page, err = sm.GetResources("aws_ec2", first, storage.ResourcesQuery{
+			Sort:   storage.SortField{Field: "Data.PricePerMonth", Descending: true},
+			Fields: []string{"Data.ResourceID"},
+			Offset: 1,
+			Limit:  1,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(3), page.Total)
+		assert.Equal(t, []map[string]interface{}{{"Data": map[string]interface{}{"ResourceID": "i-4"}}}, page.Resources)
+
+		_, err = sm.GetResources("aws_ec2", first, storage.ResourcesQuery{Sort: storage.SortField{Field: "Data') OR 1=1"}})
+		assert.ErrorIs(t, err, storage.ErrInvalidField)
+
+		page, err = sm.GetResources("aws_rds", first, storage.ResourcesQuery{})
+		assert.NoError(t, err)
+		assert.Empty(t, page.Resources)
+	})
+
+	t.Run("trends", func(t *testing.T) {
+		trends, err := sm.GetResourceTrends("aws_ec2", nil, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []storage.ExecutionCost{
+			{ExecutionID: first, ExtractedTimestamp: 1700000000, CostSum: 20},
+			{ExecutionID: second, ExtractedTimestamp: 1700086400, CostSum: 32.5},
+		}, trends)
+
+		trends, err = sm.GetResourceTrends("aws_ec2", storage.In("Data.Tag.Team", "platform"), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []storage.ExecutionCost{
+			{ExecutionID: second, ExtractedTimestamp: 1700086400, CostSum: 20},
+		}, trends)
+
+		trends, err = sm.GetResourceTrends("aws_ec2", storage.In("Data.ResourceID", "i-1", "i-4"), 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []storage.ExecutionCost{
+			{ExecutionID: first, ExtractedTimestamp: 1700000000, CostSum: 20},
+			{ExecutionID: second, ExtractedTimestamp: 1700086400, CostSum: 12.5},
+		}, trends)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		summary, err := sm.GetSummary(first, storage.In("Data.Tag.Team", "platform"))
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]storage.CollectorsSummary{
+			"aws_ec2": {ResourceName: "aws_ec2", ResourceCount: 2, TotalSpent: 5, Status: 2, EventTime: 3, HasPricing: true, Category: "potential_cost_saving"},
+		}, summary)
+
+		page, err := sm.GetResources("aws_ec2", first, storage.ResourcesQuery{Filter: storage.And{
+			storage.Compare("Data.PricePerMonth", storage.OpGreaterOrEqual, 1),
+			storage.Not{Expression: storage.In("Data.ResourceID", "i-1")},
+		}})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), page.Total)
+		assert.Equal(t, "i-4", page.Resources[0]["Data"].(map[string]interface{})["ResourceID"])
+
+		_, err = sm.GetSummary(first, storage.In("Data.Tag.", "platform"))
+		assert.ErrorIs(t, err, storage.ErrInvalidFilter)
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		tags, err := sm.GetExecutionTags(first)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]storage.TagValue{"Team": {{Value: "finops", Count: 1}, {Value: "platform", Count: 2}}}, tags)
+	})
+}
+
+// TestSaveBatch_Concurrent tests concurrent writes and reads.
+func TestSaveBatch_Concurrent(t *testing.T) {
+	sm := NewStorageManager()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			sm.Save(resourceEvent("general_1700000000", "aws_ec2", fmt.Sprintf("i-%d", i), 1, "finops"))
+			_, _ = sm.GetResources("aws_ec2", "general_1700000000", storage.ResourcesQuery{})
+		}(i)
+	}
+	wg.Wait()
+
+	summary, err := sm.GetSummary("general_1700000000", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), summary["aws_ec2"].ResourceCount)
+	assert.Equal(t, float64(10), summary["aws_ec2"].TotalSpent)
+}
@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"finala/api/config"
+	"finala/api/storage/sqlstorage"
+	"fmt"
+	"strings"
+
+	// Registers the postgres database/sql driver
+	_ "github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// driverName defines the database/sql driver of postgres
+	driverName = "postgres"
+
+	// migrationLockID defines the advisory lock that serializes the migrations of api instances
+	// that start at the same time, the hex encoding of "finala"
+	migrationLockID = 0x66696e616c61
+)
+
+// ErrMissingDSN is returned when the postgres connection string is not configured
+var ErrMissingDSN = errors.New("postgres dsn is not configured")
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// NewStorageManager connects to postgres and applies the pending schema migrations
+func NewStorageManager(conf config.PostgresConfig) (*sqlstorage.StorageManager, error) {
+	if conf.DSN == "" {
+		return nil, ErrMissingDSN
+	}
+
+	db, err := sql.Open(driverName, conf.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+	db.SetMaxOpenConns(conf.MaxOpenConns)
+	db.SetConnMaxLifetime(conf.ConnMaxLifetime)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+
+	storageManager, err := newStorageManager(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	log.Info("Successfully connected to postgres")
+	return storageManager, nil
+}
+
+// newStorageManager creates the relational storage on top of a postgres connection
+func newStorageManager(db *sql.DB) (*sqlstorage.StorageManager, error) {
+	dialect, err := newDialect()
+	if err != nil {
+		return nil, err
+	}
+	return sqlstorage.NewStorageManager(db, dialect)
+}
+
+// newDialect returns the postgres dialect with the embedded migrations
+func newDialect() (sqlstorage.Dialect, error) {
+	migrations, err := sqlstorage.LoadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return sqlstorage.Dialect{}, fmt.Errorf("could not load postgres migrations: %w", err)
+	}
+
+	return sqlstorage.Dialect{
+		Name:                 "postgres",
+		NumberedPlaceholders: true,
+		MigrationLock:        fmt.Sprintf("SELECT pg_advisory_xact_lock(%d)", migrationLockID),
+		Migrations:           migrations,
+		DocumentField: func(column string, path []string) string {
+			return fmt.Sprintf("%s #> '{%s}'", column, strings.Join(path, ","))
+		},
+		DocumentText: func(column string, path []string) string {
+			return fmt.Sprintf("%s #>> '{%s}'", column, strings.Join(path, ","))
+		},
+	}, nil
+}
@@ -0,0 +1,59 @@
+package postgres
+
+import (
+	"errors"
+	"finala/api/config"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNewStorageManager_MissingDSN tests that a connection string is required.
+func TestNewStorageManager_MissingDSN(t *testing.T) {
+	_, err := NewStorageManager(config.PostgresConfig{})
+	assert.ErrorIs(t, err, ErrMissingDSN)
+}
+
+// TestNewDialect tests that the embedded migrations are loaded and the document fields are read as jsonb.
+func TestNewDialect(t *testing.T) {
+	dialect, err := newDialect()
+	assert.NoError(t, err)
+	assert.True(t, dialect.NumberedPlaceholders)
+	assert.NotEmpty(t, dialect.Migrations)
+	assert.Equal(t, 1, dialect.Migrations[0].Version)
+	for _, table := range []string{"executions", "service_statuses", "resources", "resource_tags"} {
+		assert.Contains(t, dialect.Migrations[0].SQL, "CREATE TABLE "+table+" (")
+	}
+	assert.Equal(t, "r.document #> '{Data,PricePerMonth}'", dialect.DocumentField("r.document", []string{"Data", "PricePerMonth"}))
+	assert.Equal(t, "r.document #>> '{Data,Region}'", dialect.DocumentText("r.document", []string{"Data", "Region"}))
+}
+
+// TestNewStorageManager_Migrations tests that the schema is created under the migration lock.
+func TestNewStorageManager_Migrations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	dialect, err := newDialect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	migration := dialect.Migrations[0]
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(dialect.MigrationLock)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM schema_migrations WHERE version = $1")).
+		WithArgs(migration.Version).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta(strings.SplitN(migration.SQL, "\n", 2)[0])).WillReturnError(errors.New("permission denied for schema public"))
+	mock.ExpectRollback()
+
+	_, err = newStorageManager(db)
+	assert.ErrorContains(t, err, "permission denied for schema public")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrInvalidField is returned when a sort or projection field is not a dotted document path
+	ErrInvalidField = errors.New("invalid field")
+	// ErrPageOutOfRange is returned when the storage cannot read that far into the resources
+	ErrPageOutOfRange = errors.New("page out of range")
+)
+
+// fieldPattern matches a dotted document path such as Data.Tag.Team
+var fieldPattern = regexp.MustCompile(`^[A-Za-z0-9_]+(\.[A-Za-z0-9_]+)*$`)
+
+// ResourcesQuery describes which resources of an execution are returned and how
+type ResourcesQuery struct {
+	// Filter selects the resources, all the resources are returned when nil
+	Filter Expression
+	// Search is a full text search on the resource documents
+	Search string
+	// Sort orders the resources by a document field, the storage order is kept when the field is empty
+	Sort SortField
+	// Fields are the document paths that are returned, the whole document is returned when empty
+	Fields []string
+	Offset int
+	// Limit is the maximum number of returned resources, all the resources are returned when 0
+	Limit int
+}
+
+// SortField describes the document field the resources are sorted by
+type SortField struct {
+	Field      string
+	Descending bool
+}
+
+// ResourcesPage describes a page of resources and the number of resources that matched the query
+type ResourcesPage struct {
+	Resources []map[string]interface{}
+	Total     int64
+}
+
+// ValidateField returns an error when the field is not a dotted document path
+func ValidateField(field string) error {
+	if !fieldPattern.MatchString(field) {
+		return fmt.Errorf("%w: %q", ErrInvalidField, field)
+	}
+	return nil
+}
+
+// Validate returns an error when the offset or limit is negative, or the filter, sort or projection fields
+// are not dotted document paths
+func (q ResourcesQuery) Validate() error {
+	if q.Offset < 0 || q.Limit < 0 {
+		return fmt.Errorf("%w: offset and limit must not be negative", ErrPageOutOfRange)
+	}
+	if err := Validate(q.Filter); err != nil {
+		return err
+	}
+	if q.Sort.Field != "" {
+		if err := ValidateField(q.Sort.Field); err != nil {
+			return err
+		}
+	}
+	for _, field := range q.Fields {
+		if err := ValidateField(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PageResources sorts, pages and projects resources that were all read from the storage
+func PageResources(resources []map[string]interface{}, query ResourcesQuery) ResourcesPage {
+	if query.Sort.Field != "" {
+		SortResources(resources, query.Sort)
+	}
+
+	page := ResourcesPage{Resources: []map[string]interface{}{}, Total: int64(len(resources))}
+	if query.Offset < len(resources) {
+		resources = resources[query.Offset:]
+		if query.Limit > 0 && len(resources) > query.Limit {
+			resources = resources[:query.Limit]
+		}
+		for _, resource := range resources {
+			page.Resources = append(page.Resources, ProjectFields(resource, query.Fields))
+		}
+	}
+	return page
+}
+
+// SortResources sorts the resources by a document field. Numbers are compared by value and the other values
+// by their string form, the resources without the field are always last
+func SortResources(resources []map[string]interface{}, sortField SortField) {
+	sort.SliceStable(resources, func(i, j int) bool {
+		left := FieldValue(resources[i], sortField.Field)
+		right := FieldValue(resources[j], sortField.Field)
+		if left == nil || right == nil {
+			return left != nil
+		}
+		if sortField.Descending {
+			return compareValues(right, left) < 0
+		}
+		return compareValues(left, right) < 0
+	})
+}
+
+// compareValues compares two document values, numbers sort before the other values
+func compareValues(left, right interface{}) int {
+	leftNumber, leftIsNumber := left.(float64)
+	rightNumber, rightIsNumber := right.(float64)
+	switch {
+	case leftIsNumber && rightIsNumber:
+		if leftNumber < rightNumber {
+			return -1
+		} else if leftNumber > rightNumber {
+			return 1
+		}
+		return 0
+	case leftIsNumber:
+		return -1
+	case rightIsNumber:
+		return 1
+	}
+	return strings.Compare(fmt.Sprint(left), fmt.Sprint(right))
+}
+
+// ProjectFields returns a copy of the document with only the given dotted paths, the document is returned as is
+// when no field is given
+func ProjectFields(document map[string]interface{}, fields []string) map[string]interface{} {
+	if len(fields) == 0 {
+		return document
+	}
+
+	projected := map[string]interface{}{}
+	for _, field := range fields {
+		value := FieldValue(document, field)
+		if value == nil {
+			continue
+		}
+		keys := strings.Split(field, ".")
+		object := projected
+		for _, key := range keys[:len(keys)-1] {
+			child, ok := object[key].(map[string]interface{})
+			if !ok {
+				child = map[string]interface{}{}
+				object[key] = child
+			}
+			object = child
+		}
+		object[keys[len(keys)-1]] = value
+	}
+	return projected
+}
+
+// FieldValue returns the value of a dotted path in the document, such as Data.Tag.Team, or nil when it is missing
+func FieldValue(document map[string]interface{}, path string) interface{} {
+	var value interface{} = document
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[key]
+	}
+	return value
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func resource(id string, price interface{}) map[string]interface{} {
+	data := map[string]interface{}{"ResourceID": id, "Tag": map[string]interface{}{"Team": "finops"}}
+	if price != nil {
+		data["PricePerMonth"] = price
+	}
+	return map[string]interface{}{"ExecutionID": "general_1", "Data": data}
+}
+
+// TestPageResources tests that the resources are sorted before they are paged and projected.
+func TestPageResources(t *testing.T) {
+	resources := []map[string]interface{}{
+		resource("i-1", float64(10)),
+		resource("i-2", nil),
+		resource("i-3", float64(2)),
+		resource("i-4", float64(30)),
+	}
+
+	page := PageResources(resources, ResourcesQuery{
+		Sort:   SortField{Field: "Data.PricePerMonth", Descending: true},
+		Fields: []string{"Data.ResourceID", "Data.Tag.Team", "Data.Missing"},
+		Offset: 1,
+		Limit:  2,
+	})
+	assert.Equal(t, int64(4), page.Total)
+	assert.Equal(t, []map[string]interface{}{
+		{"Data": map[string]interface{}{"ResourceID": "i-1", "Tag": map[string]interface{}{"Team": "finops"}}},
+		{"Data": map[string]interface{}{"ResourceID": "i-3", "Tag": map[string]interface{}{"Team": "finops"}}},
+	}, page.Resources)
+
+	page = PageResources(resources, ResourcesQuery{Sort: SortField{Field: "Data.PricePerMonth"}})
+	assert.Equal(t, []interface{}{"i-3", "i-1", "i-4", "i-2"}, resourceIDs(page.Resources), "expected the resources without the field last")
+
+	page = PageResources(resources, ResourcesQuery{Offset: 10, Limit: 2})
+	assert.Equal(t, int64(4), page.Total)
+	assert.Empty(t, page.Resources)
+}
+
+// TestResourcesQuery_Validate tests that only dotted document paths are accepted as fields.
+func TestResourcesQuery_Validate(t *testing.T) {
+	assert.NoError(t, ResourcesQuery{Sort: SortField{Field: "Data.Tag.cost_center"}, Fields: []string{"ExecutionID"}}.Validate())
+	assert.ErrorIs(t, ResourcesQuery{Sort: SortField{Field: "Data..Tag"}}.Validate(), ErrInvalidField)
+	assert.ErrorIs(t, ResourcesQuery{Fields: []string{"Data') OR 1=1"}}.Validate(), ErrInvalidField)
+}
+
+func resourceIDs(resources []map[string]interface{}) []interface{} {
+	ids := []interface{}{}
+	for _, resource := range resources {
+		ids = append(ids, FieldValue(resource, "Data.ResourceID"))
+	}
+	return ids
+}
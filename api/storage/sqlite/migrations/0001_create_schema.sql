@@ -0,0 +1,41 @@
+CREATE TABLE executions (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	started_at INTEGER NOT NULL
+);
+
+CREATE INDEX executions_started_at_idx ON executions (started_at);
+
+CREATE TABLE service_statuses (
+	execution_id TEXT NOT NULL REFERENCES executions (id) ON DELETE CASCADE,
+	resource_name TEXT NOT NULL,
+	status INTEGER NOT NULL,
+	error_message TEXT NOT NULL,
+	event_time INTEGER NOT NULL,
+	PRIMARY KEY (execution_id, resource_name)
+);
+
+CREATE TABLE resources (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	document_id TEXT NOT NULL UNIQUE,
+	execution_id TEXT NOT NULL REFERENCES executions (id) ON DELETE CASCADE,
+	resource_name TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	event_time INTEGER NOT NULL,
+	resource_id TEXT NOT NULL,
+	metric TEXT NOT NULL,
+	price_per_month REAL,
+	document TEXT NOT NULL
+);
+
+CREATE INDEX resources_execution_idx ON resources (execution_id, resource_name, event_type);
+CREATE INDEX resources_resource_name_idx ON resources (resource_name, event_type);
+
+CREATE TABLE resource_tags (
+	resource_row_id INTEGER NOT NULL REFERENCES resources (id) ON DELETE CASCADE,
+	tag_key TEXT NOT NULL,
+	tag_value TEXT NOT NULL,
+	PRIMARY KEY (resource_row_id, tag_key)
+);
+
+CREATE INDEX resource_tags_tag_idx ON resource_tags (tag_key, tag_value);
@@ -0,0 +1,97 @@
+package sqlite
+
+import (
+	"database/sql"
+	"embed"
+	"finala/api/config"
+	"finala/api/storage/sqlstorage"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	// Registers the pure Go sqlite database/sql driver
+	_ "modernc.org/sqlite"
+)
+
+const (
+	// driverName defines the database/sql driver of sqlite
+	driverName = "sqlite"
+
+	// memoryPath defines the path of a database that is kept in memory only
+	memoryPath = ":memory:"
+)
+
+// pragmas are applied on every connection. Foreign keys are off by default in sqlite, and the busy
+// timeout makes a writer wait for the database lock instead of failing
+var pragmas = []string{"foreign_keys(1)", "busy_timeout(5000)", "journal_mode(WAL)"}
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// NewStorageManager opens the sqlite database file, creating it when missing, and applies the pending schema migrations
+func NewStorageManager(conf config.SQLiteConfig) (*sqlstorage.StorageManager, error) {
+	if conf.Path != memoryPath {
+		if err := os.MkdirAll(filepath.Dir(conf.Path), 0750); err != nil {
+			return nil, fmt.Errorf("could not create sqlite database directory: %w", err)
+		}
+	}
+
+	db, err := sql.Open(driverName, dataSourceName(conf.Path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database %s: %w", conf.Path, err)
+	}
+	// sqlite allows a single writer, a single connection serializes the writes instead of failing them
+	// with a locked database error. It also keeps an in memory database alive between queries
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open sqlite database %s: %w", conf.Path, err)
+	}
+
+	dialect, err := newDialect()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	storageManager, err := sqlstorage.NewStorageManager(db, dialect)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	log.WithField("path", conf.Path).Info("Successfully opened sqlite database")
+	return storageManager, nil
+}
+
+// dataSourceName returns the sqlite connection string of a database path with the connection pragmas
+func dataSourceName(path string) string {
+	query := url.Values{}
+	for _, pragma := range pragmas {
+		query.Add("_pragma", pragma)
+	}
+	return fmt.Sprintf("file:%s?%s", path, query.Encode())
+}
+
+// newDialect returns the sqlite dialect with the embedded migrations
+func newDialect() (sqlstorage.Dialect, error) {
+	migrations, err := sqlstorage.LoadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return sqlstorage.Dialect{}, fmt.Errorf("could not load sqlite migrations: %w", err)
+	}
+
+	return sqlstorage.Dialect{
+		Name:       "sqlite",
+		Migrations: migrations,
+		DocumentField: func(column string, path []string) string {
+			return fmt.Sprintf("json_extract(%s, '$.%s')", column, strings.Join(path, "."))
+		},
+		DocumentText: func(column string, path []string) string {
+			return fmt.Sprintf("CAST(json_extract(%s, '$.%s') AS TEXT)", column, strings.Join(path, "."))
+		},
+	}, nil
+}
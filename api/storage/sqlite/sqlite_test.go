@@ -0,0 +1,213 @@
+package sqlite
+
+import (
+	"errors"
+	"finala/api/config"
+	"finala/api/storage"
+	"finala/api/storage/sqlstorage"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestStorageManager opens a new sqlite database in a temporary directory
+func newTestStorageManager(t *testing.T) (*sqlstorage.StorageManager, string) {
+	path := filepath.Join(t.TempDir(), "data", "finala.db")
+	sm, err := NewStorageManager(config.SQLiteConfig{Path: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { sm.Close() })
+	return sm, path
+}
+
+func statusEvent(executionID, resourceName string, status int, eventTime int64) string {
+	return fmt.Sprintf(`{"ExecutionID":"%s","ResourceName":"%s","EventType":"service_status","EventTime":%d,"Data":{"Status":%d,"ErrorMessage":""}}`,
+		executionID, resourceName, eventTime, status)
+}
+
+func resourceEvent(executionID, resourceName, resourceID string, price float64, team string) string {
+	return fmt.Sprintf(`{"ExecutionID":"%s","ResourceName":"%s","EventType":"resource_detected","EventTime":1,`+
+		`"Data":{"ResourceID":"%s","PricePerMonth":%g,"Tag":{"Team":"%s"}}}`,
+		executionID, resourceName, resourceID, price, team)
+}
+
+// TestStorageManager tests the storage queries on a real database.
+func TestStorageManager(t *testing.T) {
+	sm, _ := newTestStorageManager(t)
+
+	first := "general_1700000000"
+	second := "general_1700086400"
+	result, err := sm.SaveBatch([]string{
+		statusEvent(first, "aws_ec2", 0, 1),
+		statusEvent(first, "aws_ec2", 2, 3),
+		statusEvent(first, "aws_ec2", 1, 2),
+		resourceEvent(first, "aws_ec2", "i-1", 10, "finops"),
+		resourceEvent(first, "aws_ec2", "i-2", 0, "platform"),
+		statusEvent(second, "aws_ec2", 2, 4),
+		resourceEvent(second, "aws_ec2", "i-1", 12.5, "finops"),
+		resourceEvent(second, "aws_ec2", "i-3", 20, "platform"),
+		`{"ResourceName":"aws_ec2"}`,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 8, result.Saved)
+	assert.Len(t, result.Failed, 1)
+
+	// A resource that is sent twice replaces the saved one
+	assert.True(t, sm.Save(resourceEvent(first, "aws_ec2", "i-1", 15, "finops")))
+
+	t.Run("summary", func(t *testing.T) {
+		summary, err := sm.GetSummary(first, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]storage.CollectorsSummary{
+			"aws_ec2": {ResourceName: "aws_ec2", ResourceCount: 2, TotalSpent: 15, Status: 2, EventTime: 3, HasPricing: true, Category: "potential_cost_saving"},
+		}, summary)
+	})
+
+	t.Run("executions", func(t *testing.T) {
+		executions, err := sm.GetExecutions(1)
+		assert.NoError(t, err)
+		assert.Len(t, executions, 1)
+		assert.Equal(t, second, executions[0].ID)
+		assert.Equal(t, int64(1700086400), executions[0].Time.Unix())
+	})
+
+	t.Run("resources", func(t *testing.T) {
+		page, err := sm.GetResources("aws_ec2", first, storage.ResourcesQuery{})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), page.Total)
+		assert.Len(t, page.Resources, 2)
+
+		page, err = sm.GetResources("aws_ec2", first, storage.ResourcesQuery{Search: "PLATFORM"})
+		assert.NoError(t, err)
+		assert.Len(t, page.Resources, 1)
+		assert.Equal(t, "i-2", page.Resources[0]["Data"].(map[string]interface{})["ResourceID"])
+		assert.NotEmpty(t, page.Resources[0]["id"])
+
+		page, err = sm.GetResources("aws_ec2", first, storage.ResourcesQuery{
+			Sort:   storage.SortField{Field: "Data.PricePerMonth"},
+			Fields: []string{"Data.ResourceID", "Data.Tag.Team"},
+			Limit:  1,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), page.Total)
+		assert.Equal(t, []map[string]interface{}{
+			{"Data": map[string]interface{}{"ResourceID": "i-2", "Tag": map[string]interface{}{"Team": "platform"}}},
+		}, page.Resources)
+
+		page, err = sm.GetResources("aws_ec2", first, storage.ResourcesQuery{
+			Sort:   storage.SortField{Field: "Data.PricePerMonth", Descending: true},
+			Offset: 1,
+			Limit:  1,
+		})
+		assert.NoError(t, err)
+		assert.Len(t, page.Resources, 1)
+		assert.Equal(t, "i-2", page.Resources[0]["Data"].(map[string]interface{})["ResourceID"])
+	})
+
+	t.Run("trends", func(t *testing.T) {
+		trends, err := sm.GetResourceTrends("aws_ec2", nil, 10)
+		assert.NoError(t, err)
+		assert.Equal(t, []storage.ExecutionCost{
+			{ExecutionID: first, ExtractedTimestamp: 1700000000, CostSum: 15},
+			{ExecutionID: second, ExtractedTimestamp: 1700086400, CostSum: 32.5},
+		}, trends)
+
+		trends, err = sm.GetResourceTrends("aws_ec2", storage.In("Data.Tag.Team", "platform"), 1)
+		assert.NoError(t, err)
+		assert.Equal(t, []storage.ExecutionCost{
+			{ExecutionID: second, ExtractedTimestamp: 1700086400, CostSum: 20},
+		}, trends)
+	})
+
+	t.Run("tags", func(t *testing.T) {
+		tags, err := sm.GetExecutionTags(first)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string][]storage.TagValue{"Team": {{Value: "finops", Count: 1}, {Value: "platform", Count: 1}}}, tags)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		summary, err := sm.GetSummary(first, storage.In("Data.Tag.Team", "platform"))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), summary["aws_ec2"].ResourceCount)
+		assert.Equal(t, float64(0), summary["aws_ec2"].TotalSpent)
+		assert.Equal(t, 2, summary["aws_ec2"].Status, "expected the status to be kept")
+
+		page, err := sm.GetResources("aws_ec2", first, storage.ResourcesQuery{
+			Filter: storage.And{storage.Compare("Data.PricePerMonth", storage.OpGreater, 0), storage.In("ExecutionID", first)},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), page.Total)
+		assert.Equal(t, "i-1", page.Resources[0]["Data"].(map[string]interface{})["ResourceID"])
+
+		page, err = sm.GetResources("aws_ec2", first, storage.ResourcesQuery{
+			Filter: storage.In("ExecutionID", "' OR '1'='1"),
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), page.Total)
+
+		page, err = sm.GetResources("aws_ec2", first, storage.ResourcesQuery{
+			Filter: storage.Not{Expression: storage.In("Data.Region", "us-east-1")},
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), page.Total, "expected the resources without the field to match the negation")
+	})
+
+	t.Run("export", func(t *testing.T) {
+		documents := []string{}
+		err := sm.ExportEvents(func(document string) error {
+			documents = append(documents, document)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Len(t, documents, 6, "expected the latest status of every execution and the resources")
+		assert.Contains(t, documents[0], `"EventTime":3`)
+
+		// The exported events are imported into another database with the same content
+		imported, _ := newTestStorageManager(t)
+		result, err := imported.SaveBatch(documents)
+		assert.NoError(t, err)
+		assert.Equal(t, 6, result.Saved)
+		for _, executionID := range []string{first, second} {
+			expected, _ := sm.GetSummary(executionID, nil)
+			summary, err := imported.GetSummary(executionID, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, summary)
+		}
+
+		assert.EqualError(t, sm.ExportEvents(func(document string) error { return errors.New("closed") }), "closed")
+	})
+}
+
+// TestNewStorageManager_Reopen tests that the saved events and the schema are kept when the database is opened again.
+func TestNewStorageManager_Reopen(t *testing.T) {
+	sm, path := newTestStorageManager(t)
+	assert.True(t, sm.Save(statusEvent("general_1700000000", "aws_ec2", 2, 1)))
+	assert.NoError(t, sm.Close())
+
+	reopened, err := NewStorageManager(config.SQLiteConfig{Path: path})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reopened.Close()
+
+	executions, err := reopened.GetExecutions(10)
+	assert.NoError(t, err)
+	assert.Len(t, executions, 1)
+}
+
+// TestNewStorageManager_Memory tests an in memory database.
+func TestNewStorageManager_Memory(t *testing.T) {
+	sm, err := NewStorageManager(config.SQLiteConfig{Path: memoryPath})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer sm.Close()
+
+	assert.True(t, sm.Save(statusEvent("general_1700000000", "aws_ec2", 2, 1)))
+	summary, err := sm.GetSummary("general_1700000000", nil)
+	assert.NoError(t, err)
+	assert.Len(t, summary, 1)
+}
@@ -0,0 +1,109 @@
+package sqlstorage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"finala/api/storage"
+	"fmt"
+	"strings"
+)
+
+const (
+	// eventServiceStatus describes the status event of a collected resource type
+	eventServiceStatus = "service_status"
+
+	// eventResourceDetected describes a detected resource event
+	eventResourceDetected = "resource_detected"
+)
+
+// ErrInvalidEvent is returned when an event document is missing a mandatory field
+var ErrInvalidEvent = errors.New("invalid event")
+
+// event describes the columns of a collected event
+type event struct {
+	documentID    string
+	executionID   string
+	resourceName  string
+	eventType     string
+	eventTime     int64
+	resourceID    string
+	metric        string
+	pricePerMonth sql.NullFloat64
+	tags          map[string]string
+	status        int64
+	errorMessage  string
+	// document is the event as sent by the collector, including its id
+	document string
+}
+
+// parseEvent parses an event document and extracts the fields that are stored in their own columns
+func parseEvent(data string) (event, error) {
+	var doc map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(data))
+	// Keep the numbers as is, the event time is part of the document id
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return event{}, err
+	}
+
+	e := event{tags: map[string]string{}}
+	e.executionID, _ = doc["ExecutionID"].(string)
+	e.resourceName, _ = doc["ResourceName"].(string)
+	e.eventType, _ = doc["EventType"].(string)
+	if e.executionID == "" || e.resourceName == "" || e.eventType == "" {
+		return event{}, fmt.Errorf("%w: ExecutionID, ResourceName and EventType are mandatory", ErrInvalidEvent)
+	}
+
+	if eventTime, ok := doc["EventTime"].(json.Number); ok {
+		value, err := eventTime.Int64()
+		if err != nil {
+			return event{}, fmt.Errorf("%w: EventTime %s is not an integer", ErrInvalidEvent, eventTime)
+		}
+		e.eventTime = value
+	}
+
+	if id, ok := doc["id"]; ok {
+		e.documentID = fmt.Sprint(id)
+	} else {
+		e.documentID = storage.DocumentID(doc)
+		doc["id"] = e.documentID
+	}
+
+	fields, _ := doc["Data"].(map[string]interface{})
+	e.resourceID = stringValue(fields["ResourceID"])
+	e.metric = stringValue(fields["Metric"])
+	e.errorMessage = stringValue(fields["ErrorMessage"])
+	if price, ok := fields["PricePerMonth"].(json.Number); ok {
+		if value, err := price.Float64(); err == nil {
+			e.pricePerMonth = sql.NullFloat64{Float64: value, Valid: true}
+		}
+	}
+	if status, ok := fields["Status"].(json.Number); ok {
+		e.status, _ = status.Int64()
+	}
+	if tags, ok := fields["Tag"].(map[string]interface{}); ok {
+		for key, value := range tags {
+			e.tags[key] = stringValue(value)
+		}
+	}
+
+	document, err := json.Marshal(doc)
+	if err != nil {
+		return event{}, err
+	}
+	e.document = string(document)
+	return e, nil
+}
+
+// stringValue returns the string form of a document value, or an empty string when the value is missing
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,121 @@
+package sqlstorage
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// createMigrationsTable keeps the versions of the applied migrations
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	applied_at BIGINT NOT NULL
+)`
+
+// Migration describes a versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// LoadMigrations reads the migrations of a directory ordered by version. Every migration
+// file is named <version>_<name>.sql, e.g. 0001_create_schema.sql
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := []Migration{}
+	versions := map[int]string{}
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		parts := strings.SplitN(name, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("invalid migration file name %s, expected <version>_<name>.sql", entry.Name())
+		}
+		if existing, ok := versions[version]; ok {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, existing, entry.Name())
+		}
+		versions[version] = entry.Name()
+
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: version, Name: parts[1], SQL: string(body)})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// migrate applies the dialect migrations that were not applied yet
+func (sm *StorageManager) migrate() error {
+	if _, err := sm.db.Exec(createMigrationsTable); err != nil {
+		return fmt.Errorf("could not create the schema migrations table: %w", err)
+	}
+
+	for _, migration := range sm.dialect.Migrations {
+		if err := sm.applyMigration(migration); err != nil {
+			return fmt.Errorf("could not apply migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration applies a single migration in a transaction, so a failed migration leaves the schema unchanged
+func (sm *StorageManager) applyMigration(migration Migration) error {
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if sm.dialect.MigrationLock != "" {
+		if _, err := tx.Exec(sm.dialect.MigrationLock); err != nil {
+			return err
+		}
+	}
+
+	var applied int
+	if err := tx.QueryRow(sm.rebind("SELECT COUNT(*) FROM schema_migrations WHERE version = ?"), migration.Version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec(migration.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(sm.rebind("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)"),
+		migration.Version, migration.Name, time.Now().Unix()); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"storage": sm.dialect.Name,
+		"version": migration.Version,
+		"name":    migration.Name,
+	}).Info("storage migration applied")
+	return nil
+}
@@ -0,0 +1,667 @@
+package sqlstorage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"finala/api/storage"
+	"finala/interpolation"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrUnsupportedFilter is returned when a filter cannot be applied on the field, such as a range on a text field
+	ErrUnsupportedFilter = fmt.Errorf("%w: unsupported filter", storage.ErrInvalidFilter)
+)
+
+const (
+	// tagFilterPrefix defines the filter key prefix of the resource tags, e.g. Data.Tag.Team
+	tagFilterPrefix = "Data.Tag."
+)
+
+// filterColumns maps the document fields that are stored in their own text column to the resources table columns
+var filterColumns = map[string]string{
+	"ResourceName":    "r.resource_name",
+	"EventType":       "r.event_type",
+	"Data.ResourceID": "r.resource_id",
+	"Data.Metric":     "r.metric",
+}
+
+// numberColumns maps the document fields that are stored in their own numeric column to the resources
+// table columns, these fields can also be filtered on ranges
+var numberColumns = map[string]string{
+	"EventTime":          "r.event_time",
+	"Data.PricePerMonth": "r.price_per_month",
+}
+
+// Dialect describes the differences between the supported SQL databases
+type Dialect struct {
+	// Name of the database, used in logs
+	Name string
+	// NumberedPlaceholders replaces the `?` query placeholders with $1, $2, ...
+	NumberedPlaceholders bool
+	// MigrationLock is executed at the start of every migration transaction to serialize concurrent migrations
+	MigrationLock string
+	// Migrations creates and updates the storage schema, ordered by version
+	Migrations []Migration
+	// DocumentField returns the SQL expression of a document field, by its path, that the resources are sorted on
+	DocumentField func(column string, path []string) string
+	// DocumentText returns the SQL expression of the text of a document field, by its path, that the resources are filtered on
+	DocumentText func(column string, path []string) string
+}
+
+// StorageManager describes a relational storage. Executions, service statuses, resources and resource tags
+// are kept in their own tables and the summaries are aggregated by the database
+type StorageManager struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+// NewStorageManager creates new relational storage and applies the pending schema migrations
+func NewStorageManager(db *sql.DB, dialect Dialect) (*StorageManager, error) {
+	storageManager := &StorageManager{
+		db:      db,
+		dialect: dialect,
+	}
+
+	if err := storageManager.migrate(); err != nil {
+		return nil, err
+	}
+	return storageManager, nil
+}
+
+// Close closes the database connections
+func (sm *StorageManager) Close() error {
+	return sm.db.Close()
+}
+
+// rebind replaces the `?` placeholders of a query with the dialect placeholders
+func (sm *StorageManager) rebind(query string) string {
+	if !sm.dialect.NumberedPlaceholders {
+		return query
+	}
+
+	var builder strings.Builder
+	position := 0
+	for _, char := range query {
+		if char == '?' {
+			position++
+			builder.WriteString("$" + strconv.Itoa(position))
+			continue
+		}
+		builder.WriteRune(char)
+	}
+	return builder.String()
+}
+
+// Save new documents
+func (sm *StorageManager) Save(data string) bool {
+	result, err := sm.SaveBatch([]string{data})
+	if err != nil || len(result.Failed) > 0 {
+		log.WithField("data", data).Error("Fail to save document")
+		return false
+	}
+	return true
+}
+
+// SaveBatch saves the documents in a single transaction. Documents that are not valid are reported
+// as failures and the others are still saved, an error is returned when the transaction failed
+func (sm *StorageManager) SaveBatch(data []string) (storage.BatchResult, error) {
+	result := storage.BatchResult{}
+	events := make([]event, 0, len(data))
+	positions := make([]int, 0, len(data))
+	for i, row := range data {
+		e, err := parseEvent(row)
+		if err != nil {
+			result.Failed = append(result.Failed, storage.BatchFailure{Index: i, Error: err.Error()})
+			continue
+		}
+		events = append(events, e)
+		positions = append(positions, i)
+	}
+
+	if len(events) == 0 {
+		return result, nil
+	}
+
+	if err := sm.saveEvents(events); err != nil {
+		log.WithFields(log.Fields{
+			"storage":   sm.dialect.Name,
+			"documents": len(events),
+		}).WithError(err).Error("Fail to save documents batch")
+		for _, position := range positions {
+			result.Failed = append(result.Failed, storage.BatchFailure{Index: position, Error: err.Error()})
+		}
+		sort.Slice(result.Failed, func(i, j int) bool {
+			return result.Failed[i].Index < result.Failed[j].Index
+		})
+		return result, err
+	}
+
+	result.Saved = len(events)
+	return result, nil
+}
+
+// saveEvents writes the events in a single transaction
+func (sm *StorageManager) saveEvents(events []event) error {
+	tx, err := sm.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, e := range events {
+		if err := sm.saveEvent(tx, e); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// saveEvent writes an event. The latest status of every resource type is kept, other events
+// replace the resource that has the same document id
+func (sm *StorageManager) saveEvent(tx *sql.Tx, e event) error {
+	name, _ := interpolation.ExtractExecutionName(e.executionID)
+	timestamp, err := interpolation.ExtractTimestamp(e.executionID)
+	if err != nil {
+		timestamp = 0
+	}
+
+	_, err = tx.Exec(sm.rebind(`INSERT INTO executions (id, name, started_at) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO NOTHING`), e.executionID, name, timestamp)
+	if err != nil {
+		return err
+	}
+
+	if e.eventType == eventServiceStatus {
+		_, err = tx.Exec(sm.rebind(`INSERT INTO service_statuses (execution_id, resource_name, status, error_message, event_time)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (execution_id, resource_name) DO UPDATE SET
+			status = excluded.status,
+			error_message = excluded.error_message,
+			event_time = excluded.event_time
+		WHERE excluded.event_time >= service_statuses.event_time`),
+			e.executionID, e.resourceName, e.status, e.errorMessage, e.eventTime)
+		return err
+	}
+
+	var rowID int64
+	err = tx.QueryRow(sm.rebind(`INSERT INTO resources (document_id, execution_id, resource_name, event_type, event_time, resource_id, metric, price_per_month, document)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (document_id) DO UPDATE SET
+			event_type = excluded.event_type,
+			event_time = excluded.event_time,
+			price_per_month = excluded.price_per_month,
+			document = excluded.document
+		RETURNING id`),
+		e.documentID, e.executionID, e.resourceName, e.eventType, e.eventTime, e.resourceID, e.metric, e.pricePerMonth, e.document).Scan(&rowID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(sm.rebind("DELETE FROM resource_tags WHERE resource_row_id = ?"), rowID); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(e.tags))
+	for key := range e.tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		_, err := tx.Exec(sm.rebind("INSERT INTO resource_tags (resource_row_id, tag_key, tag_value) VALUES (?, ?, ?)"), rowID, key, e.tags[key])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetSummary returns executions summary, the filters apply to the detected resources
+func (sm *StorageManager) GetSummary(executionID string, filter storage.Expression) (map[string]storage.CollectorsSummary, error) {
+	summary := make(map[string]storage.CollectorsSummary)
+
+	filterQuery, filterArgs, err := sm.filterClause(filter)
+	if err != nil {
+		return summary, err
+	}
+
+	rows, err := sm.db.Query(sm.rebind(`SELECT resource_name, status, error_message, event_time
+		FROM service_statuses
+		WHERE execution_id = ?`), executionID)
+	if err != nil {
+		log.WithError(err).Error("error when trying to get service_status summary data")
+		return summary, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		collector := storage.CollectorsSummary{}
+		if err := rows.Scan(&collector.ResourceName, &collector.Status, &collector.ErrorMessage, &collector.EventTime); err != nil {
+			return summary, err
+		}
+		summary[collector.ResourceName] = collector
+	}
+	if err := rows.Err(); err != nil {
+		return summary, err
+	}
+
+	resources, err := sm.db.Query(sm.rebind(`SELECT r.resource_name,
+			COUNT(*),
+			COALESCE(SUM(CASE WHEN r.price_per_month > 0 THEN r.price_per_month ELSE 0 END), 0),
+			COUNT(CASE WHEN r.price_per_month > 0 THEN 1 END)
+		FROM resources r
+		WHERE r.execution_id = ? AND r.event_type = ?`+filterQuery+`
+		GROUP BY r.resource_name`), append([]interface{}{executionID, eventResourceDetected}, filterArgs...)...)
+	if err != nil {
+		log.WithError(err).Error("error when trying to get resource_detected summary data")
+		return summary, err
+	}
+	defer resources.Close()
+
+	for resources.Next() {
+		var resourceName string
+		var resourceCount, pricedCount int64
+		var totalSpent float64
+		if err := resources.Scan(&resourceName, &resourceCount, &totalSpent, &pricedCount); err != nil {
+			return summary, err
+		}
+
+		collector := summary[resourceName]
+		collector.ResourceName = resourceName
+		collector.ResourceCount = resourceCount
+		collector.TotalSpent = totalSpent
+		collector.HasPricing = pricedCount > 0
+		if collector.HasPricing {
+			collector.Category = "potential_cost_saving"
+		} else {
+			collector.Category = "unused_resource"
+		}
+		summary[resourceName] = collector
+	}
+
+	return summary, resources.Err()
+}
+
+// GetExecutions returns list of executions
+func (sm *StorageManager) GetExecutions(queryLimit int) ([]storage.Executions, error) {
+	executions := []storage.Executions{}
+
+	query := "SELECT id, started_at FROM executions ORDER BY started_at DESC, id DESC"
+	args := []interface{}{}
+	if queryLimit > 0 {
+		query += " LIMIT ?"
+		args = append(args, queryLimit)
+	}
+
+	rows, err := sm.db.Query(sm.rebind(query), args...)
+	if err != nil {
+		log.WithError(err).Error("error when trying to get executions collectors")
+		return executions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var timestamp int64
+		if err := rows.Scan(&id, &timestamp); err != nil {
+			return executions, err
+		}
+		executions = append(executions, storage.Executions{
+			ID:   id,
+			Name: "Execution " + id,
+			Time: time.Unix(timestamp, 0),
+		})
+	}
+
+	return executions, rows.Err()
+}
+
+// GetResources returns a page of resources, sorted and paged by the database
+func (sm *StorageManager) GetResources(resourceType string, executionID string, query storage.ResourcesQuery) (storage.ResourcesPage, error) {
+	page := storage.ResourcesPage{Resources: []map[string]interface{}{}}
+	if err := query.Validate(); err != nil {
+		return page, err
+	}
+	filterQuery, filterArgs, err := sm.filterClause(query.Filter)
+	if err != nil {
+		return page, err
+	}
+
+	from := ` FROM resources r
+		WHERE r.execution_id = ? AND r.resource_name = ? AND r.event_type = ?` + filterQuery
+	args := append([]interface{}{executionID, resourceType, eventResourceDetected}, filterArgs...)
+	if query.Search != "" {
+		from += ` AND LOWER(CAST(r.document AS TEXT)) LIKE ? ESCAPE '\'`
+		args = append(args, "%"+escapeLike(strings.ToLower(query.Search))+"%")
+	}
+
+	if err := sm.db.QueryRow(sm.rebind("SELECT COUNT(*)"+from), args...).Scan(&page.Total); err != nil {
+		log.WithError(err).Error("error when trying to count resources")
+		return page, err
+	}
+
+	statement := "SELECT r.document" + from
+	if query.Sort.Field != "" {
+		if sm.dialect.DocumentField == nil {
+			return page, fmt.Errorf("%w: %s cannot sort on document fields", storage.ErrInvalidField, sm.dialect.Name)
+		}
+		field := sm.dialect.DocumentField("r.document", strings.Split(query.Sort.Field, "."))
+		direction := "ASC"
+		if query.Sort.Descending {
+			direction = "DESC"
+		}
+		// The resources without the field are last, whatever the direction
+		statement += fmt.Sprintf(" ORDER BY %s IS NULL, %s %s, r.id", field, field, direction)
+	} else {
+		statement += " ORDER BY r.id"
+	}
+	if query.Limit > 0 || query.Offset > 0 {
+		limit := query.Limit
+		if limit == 0 {
+			limit = math.MaxInt32
+		}
+		statement += " LIMIT ? OFFSET ?"
+		args = append(args, limit, query.Offset)
+	}
+
+	rows, err := sm.db.Query(sm.rebind(statement), args...)
+	if err != nil {
+		log.WithError(err).Error("error when trying to get resources")
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var document []byte
+		if err := rows.Scan(&document); err != nil {
+			return page, err
+		}
+
+		rowData := make(map[string]interface{})
+		if err := json.Unmarshal(document, &rowData); err != nil {
+			log.WithError(err).Error("error when trying to parse resource document")
+			continue
+		}
+		page.Resources = append(page.Resources, storage.ProjectFields(rowData, query.Fields))
+	}
+
+	return page, rows.Err()
+}
+
+// EachResource calls fn with every resource of the type in the execution that matches the filter, the
+// resources are read with a single query
+func (sm *StorageManager) EachResource(resourceType string, executionID string, filter storage.Expression, fn func(resource map[string]interface{}) error) error {
+	filterQuery, filterArgs, err := sm.filterClause(filter)
+	if err != nil {
+		return err
+	}
+
+	rows, err := sm.db.Query(sm.rebind(`SELECT r.document FROM resources r
+		WHERE r.execution_id = ? AND r.resource_name = ? AND r.event_type = ?`+filterQuery+`
+		ORDER BY r.id`), append([]interface{}{executionID, resourceType, eventResourceDetected}, filterArgs...)...)
+	if err != nil {
+		log.WithError(err).Error("error when trying to get resources")
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var document []byte
+		if err := rows.Scan(&document); err != nil {
+			return err
+		}
+
+		rowData := make(map[string]interface{})
+		if err := json.Unmarshal(document, &rowData); err != nil {
+			log.WithError(err).Error("error when trying to parse resource document")
+			continue
+		}
+		if err := fn(rowData); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// GetResourceTrends returns the cost of the resource type in the latest executions, oldest first
+func (sm *StorageManager) GetResourceTrends(resourceType string, filter storage.Expression, limit int) ([]storage.ExecutionCost, error) {
+	resources := []storage.ExecutionCost{}
+
+	filterQuery, filterArgs, err := sm.filterClause(filter)
+	if err != nil {
+		return resources, err
+	}
+
+	query := `SELECT r.execution_id, e.started_at, COALESCE(SUM(r.price_per_month), 0)
+		FROM resources r
+		JOIN executions e ON e.id = r.execution_id
+		WHERE r.resource_name = ? AND r.event_type <> ?` + filterQuery + `
+		GROUP BY r.execution_id, e.started_at
+		ORDER BY e.started_at DESC, r.execution_id DESC`
+	args := append([]interface{}{resourceType, eventServiceStatus}, filterArgs...)
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := sm.db.Query(sm.rebind(query), args...)
+	if err != nil {
+		log.WithError(err).Error("error when trying to get resource trends")
+		return resources, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		cost := storage.ExecutionCost{}
+		if err := rows.Scan(&cost.ExecutionID, &cost.ExtractedTimestamp, &cost.CostSum); err != nil {
+			return resources, err
+		}
+		resources = append(resources, cost)
+	}
+	if err := rows.Err(); err != nil {
+		return resources, err
+	}
+
+	for i, j := 0, len(resources)-1; i < j; i, j = i+1, j-1 {
+		resources[i], resources[j] = resources[j], resources[i]
+	}
+	return resources, nil
+}
+
+// GetExecutionTags returns the values of every tag of the execution resources, with the number of resources that have them
+func (sm *StorageManager) GetExecutionTags(executionID string) (map[string][]storage.TagValue, error) {
+	tags := map[string][]storage.TagValue{}
+
+	rows, err := sm.db.Query(sm.rebind(`SELECT t.tag_key, t.tag_value, COUNT(*)
+		FROM resource_tags t
+		JOIN resources r ON r.id = t.resource_row_id
+		WHERE r.execution_id = ? AND r.event_type = ?
+		GROUP BY t.tag_key, t.tag_value
+		ORDER BY t.tag_key, t.tag_value`), executionID, eventResourceDetected)
+	if err != nil {
+		log.WithError(err).Error("error when trying to get execution tags")
+		return tags, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		value := storage.TagValue{}
+		if err := rows.Scan(&key, &value.Value, &value.Count); err != nil {
+			return tags, err
+		}
+		tags[key] = append(tags[key], value)
+	}
+
+	return tags, rows.Err()
+}
+
+// ExportEvents calls fn with every saved event document. Only the latest status of every resource type
+// is kept, the status events are rebuilt from it
+func (sm *StorageManager) ExportEvents(fn func(document string) error) error {
+	statuses, err := sm.db.Query(`SELECT execution_id, resource_name, status, error_message, event_time
+		FROM service_statuses
+		ORDER BY execution_id, resource_name`)
+	if err != nil {
+		return err
+	}
+	defer statuses.Close()
+
+	for statuses.Next() {
+		var executionID, resourceName, errorMessage string
+		var status, eventTime int64
+		if err := statuses.Scan(&executionID, &resourceName, &status, &errorMessage, &eventTime); err != nil {
+			return err
+		}
+
+		doc := map[string]interface{}{
+			"ExecutionID":  executionID,
+			"ResourceName": resourceName,
+			"EventType":    eventServiceStatus,
+			"EventTime":    eventTime,
+			"Data": map[string]interface{}{
+				"Status":       status,
+				"ErrorMessage": errorMessage,
+			},
+		}
+		doc["id"] = storage.DocumentID(doc)
+		document, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		if err := fn(string(document)); err != nil {
+			return err
+		}
+	}
+	if err := statuses.Err(); err != nil {
+		return err
+	}
+
+	resources, err := sm.db.Query("SELECT document FROM resources ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer resources.Close()
+
+	for resources.Next() {
+		var document []byte
+		if err := resources.Scan(&document); err != nil {
+			return err
+		}
+		if err := fn(string(document)); err != nil {
+			return err
+		}
+	}
+	return resources.Err()
+}
+
+// filterClause returns the condition of the filter expression on the resources table prefixed with AND, or an
+// empty clause when there is no filter
+func (sm *StorageManager) filterClause(filter storage.Expression) (string, []interface{}, error) {
+	if filter == nil {
+		return "", nil, nil
+	}
+	if err := storage.Validate(filter); err != nil {
+		return "", nil, err
+	}
+
+	condition, args, err := sm.compileFilter(filter)
+	if err != nil {
+		return "", nil, err
+	}
+	return " AND " + condition, args, nil
+}
+
+// compileFilter returns the SQL condition of a filter expression. The tags are matched on the resource_tags
+// table, the other fields on their own column or on the document. A comparison is false when the field is
+// missing, so that NOT matches the resources without the field
+func (sm *StorageManager) compileFilter(filter storage.Expression) (string, []interface{}, error) {
+	switch e := filter.(type) {
+	case storage.And:
+		return sm.compileFilters(e, " AND ")
+	case storage.Or:
+		return sm.compileFilters(e, " OR ")
+	case storage.Not:
+		condition, args, err := sm.compileFilter(e.Expression)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT " + condition, args, nil
+	case storage.Comparison:
+		return sm.compileComparison(e)
+	}
+	return "", nil, fmt.Errorf("%w: unknown expression %T", storage.ErrInvalidFilter, filter)
+}
+
+// compileFilters returns the SQL conditions of the filter expressions of a group joined by the operator
+func (sm *StorageManager) compileFilters(filters []storage.Expression, operator string) (string, []interface{}, error) {
+	if len(filters) == 0 {
+		return "", nil, fmt.Errorf("%w: empty expression", storage.ErrInvalidFilter)
+	}
+
+	conditions := make([]string, 0, len(filters))
+	args := []interface{}{}
+	for _, filter := range filters {
+		condition, conditionArgs, err := sm.compileFilter(filter)
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, condition)
+		args = append(args, conditionArgs...)
+	}
+	return "(" + strings.Join(conditions, operator) + ")", args, nil
+}
+
+// compileComparison returns the SQL condition of a comparison
+func (sm *StorageManager) compileComparison(comparison storage.Comparison) (string, []interface{}, error) {
+	numberColumn, isNumber := numberColumns[comparison.Field]
+	if comparison.Operator.Ordered() {
+		if !isNumber {
+			return "", nil, fmt.Errorf("%w: %s cannot be compared with %s", ErrUnsupportedFilter, comparison.Field, comparison.Operator)
+		}
+		return fmt.Sprintf("(%[1]s IS NOT NULL AND %[1]s %[2]s ?)", numberColumn, comparison.Operator), []interface{}{*comparison.Values[0].Number}, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(comparison.Values)), ", ")
+	args := []interface{}{}
+	for _, value := range comparison.Values {
+		if !isNumber {
+			args = append(args, value.Text)
+			continue
+		}
+		if value.Number == nil {
+			return "", nil, fmt.Errorf("%w: %s is a number, got %q", storage.ErrInvalidFilter, comparison.Field, value.Text)
+		}
+		args = append(args, *value.Number)
+	}
+
+	var column string
+	switch {
+	case strings.HasPrefix(comparison.Field, tagFilterPrefix):
+		return fmt.Sprintf(`EXISTS (SELECT 1 FROM resource_tags t
+			WHERE t.resource_row_id = r.id AND t.tag_key = ? AND t.tag_value IN (%s))`, placeholders),
+			append([]interface{}{strings.TrimPrefix(comparison.Field, tagFilterPrefix)}, args...), nil
+	case isNumber:
+		column = numberColumn
+	case filterColumns[comparison.Field] != "":
+		column = filterColumns[comparison.Field]
+	case sm.dialect.DocumentText != nil:
+		column = sm.dialect.DocumentText("r.document", strings.Split(comparison.Field, "."))
+	default:
+		return "", nil, fmt.Errorf("%w: %s", ErrUnsupportedFilter, comparison.Field)
+	}
+	return fmt.Sprintf("(%[1]s IS NOT NULL AND %[1]s IN (%[2]s))", column, placeholders), args, nil
+}
+
+// escapeLike escapes the LIKE pattern characters of a value
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,308 @@
+package sqlstorage
+
+import (
+	"errors"
+	"finala/api/storage"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// newMockStorageManager returns a storage manager on top of a mocked database with numbered placeholders
+func newMockStorageManager(t *testing.T) (*StorageManager, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return &StorageManager{db: db, dialect: Dialect{Name: "mock", NumberedPlaceholders: true}}, mock
+}
+
+// TestLoadMigrations tests that the migration files are loaded by version.
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_index.sql":     {Data: []byte("CREATE INDEX a ON b (c)")},
+		"migrations/0001_create_schema.sql": {Data: []byte("CREATE TABLE b (c TEXT)")},
+		"migrations/README.md":              {Data: []byte("ignored")},
+	}
+
+	migrations, err := LoadMigrations(fsys, "migrations")
+	assert.NoError(t, err)
+	assert.Equal(t, []Migration{
+		{Version: 1, Name: "create_schema", SQL: "CREATE TABLE b (c TEXT)"},
+		{Version: 2, Name: "add_index", SQL: "CREATE INDEX a ON b (c)"},
+	}, migrations)
+
+	_, err = LoadMigrations(fstest.MapFS{"migrations/schema.sql": {Data: []byte("")}}, "migrations")
+	assert.Error(t, err)
+}
+
+// TestStorageManager_migrate tests that only the pending migrations are applied.
+func TestStorageManager_migrate(t *testing.T) {
+	sm, mock := newMockStorageManager(t)
+	sm.dialect.MigrationLock = "SELECT pg_advisory_xact_lock(1)"
+	sm.dialect.Migrations = []Migration{
+		{Version: 1, Name: "create_schema", SQL: "CREATE TABLE executions (id TEXT)"},
+		{Version: 2, Name: "add_index", SQL: "CREATE INDEX executions_idx ON executions (id)"},
+	}
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock(1)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM schema_migrations WHERE version = $1")).
+		WithArgs(1).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectRollback()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_xact_lock(1)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COUNT(*) FROM schema_migrations WHERE version = $1")).
+		WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec(regexp.QuoteMeta("CREATE INDEX executions_idx ON executions (id)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").
+		WithArgs(2, "add_index", sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, sm.migrate())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestStorageManager_migrate_Failure tests that a failed migration is rolled back and reported.
+func TestStorageManager_migrate_Failure(t *testing.T) {
+	sm, mock := newMockStorageManager(t)
+	sm.dialect.Migrations = []Migration{{Version: 1, Name: "create_schema", SQL: "CREATE TABLE executions (id TEXT)"}}
+
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT COUNT").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectExec("CREATE TABLE executions").WillReturnError(errors.New("permission denied"))
+	mock.ExpectRollback()
+
+	err := sm.migrate()
+	assert.ErrorContains(t, err, "1_create_schema")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestParseEvent tests the extraction of the event columns.
+func TestParseEvent(t *testing.T) {
+	e, err := parseEvent(`{"ExecutionID":"general_1700000000","ResourceName":"aws_ec2","EventType":"resource_detected","EventTime":1700000000000000001,` +
+		`"Data":{"ResourceID":"i-1","Metric":"CPU","PricePerMonth":12.5,"Tag":{"Team":"finops"}}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, "general_1700000000", e.executionID)
+	assert.Equal(t, int64(1700000000000000001), e.eventTime)
+	assert.Equal(t, "i-1", e.resourceID)
+	assert.Equal(t, "CPU", e.metric)
+	assert.Equal(t, 12.5, e.pricePerMonth.Float64)
+	assert.Equal(t, map[string]string{"Team": "finops"}, e.tags)
+	assert.Len(t, e.documentID, 64)
+	assert.Contains(t, e.document, `"id":"`+e.documentID+`"`)
+
+	status, err := parseEvent(`{"ExecutionID":"general_1700000000","ResourceName":"aws_ec2","EventType":"service_status","EventTime":2,` +
+		`"Data":{"Status":1,"ErrorMessage":"access denied"}}`)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), status.status)
+	assert.Equal(t, "access denied", status.errorMessage)
+	assert.False(t, status.pricePerMonth.Valid)
+
+	_, err = parseEvent(`{"ResourceName":"aws_ec2","EventType":"service_status"}`)
+	assert.ErrorIs(t, err, ErrInvalidEvent)
+}
+
+// TestStorageManager_SaveBatch tests that valid events are saved in a single transaction and invalid ones are reported.
+func TestStorageManager_SaveBatch(t *testing.T) {
+	sm, mock := newMockStorageManager(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO executions").
+		WithArgs("general_1700000000", "general", int64(1700000000)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO service_statuses").
+		WithArgs("general_1700000000", "aws_ec2", int64(2), "", int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO executions").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("INSERT INTO resources").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(7))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM resource_tags WHERE resource_row_id = $1")).
+		WithArgs(int64(7)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO resource_tags").WithArgs(int64(7), "Env", "prod").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("INSERT INTO resource_tags").WithArgs(int64(7), "Team", "finops").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	result, err := sm.SaveBatch([]string{
+		`{"ExecutionID":"general_1700000000","ResourceName":"aws_ec2","EventType":"service_status","EventTime":1,"Data":{"Status":2}}`,
+		`not json`,
+		`{"ExecutionID":"general_1700000000","ResourceName":"aws_ec2","EventType":"resource_detected","EventTime":2,` +
+			`"Data":{"ResourceID":"i-1","PricePerMonth":10,"Tag":{"Team":"finops","Env":"prod"}}}`,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, result.Saved)
+	assert.Len(t, result.Failed, 1)
+	assert.Equal(t, 1, result.Failed[0].Index)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestStorageManager_SaveBatch_Failure tests that all the events of a failed transaction are reported.
+func TestStorageManager_SaveBatch_Failure(t *testing.T) {
+	sm, mock := newMockStorageManager(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("INSERT INTO executions").WillReturnError(errors.New("connection reset"))
+	mock.ExpectRollback()
+
+	result, err := sm.SaveBatch([]string{
+		`{"ExecutionID":"general_1","ResourceName":"aws_ec2","EventType":"service_status","EventTime":1,"Data":{"Status":2}}`,
+		`{}`,
+		`{"ExecutionID":"general_1","ResourceName":"aws_rds","EventType":"service_status","EventTime":1,"Data":{"Status":2}}`,
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 0, result.Saved)
+	assert.Equal(t, []int{0, 1, 2}, []int{result.Failed[0].Index, result.Failed[1].Index, result.Failed[2].Index})
+	assert.False(t, sm.Save(`{}`))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestStorageManager_GetSummary tests that the statuses and the aggregated filtered resources are merged.
+func TestStorageManager_GetSummary(t *testing.T) {
+	sm, mock := newMockStorageManager(t)
+
+	mock.ExpectQuery("FROM service_statuses").WithArgs("general_1").WillReturnRows(
+		sqlmock.NewRows([]string{"resource_name", "status", "error_message", "event_time"}).
+			AddRow("aws_ec2", 2, "", 10).
+			AddRow("aws_rds", 1, "access denied", 11))
+	mock.ExpectQuery(regexp.QuoteMeta(`AND (((r.price_per_month IS NOT NULL AND r.price_per_month IN ($3)) OR `+
+		`(r.price_per_month IS NOT NULL AND r.price_per_month >= $4)) AND NOT EXISTS (SELECT 1 FROM resource_tags t`)).
+		WithArgs("general_1", "resource_detected", 0.0, 10.0, "Team", "finops").WillReturnRows(
+		sqlmock.NewRows([]string{"resource_name", "count", "total_spent", "priced_count"}).
+			AddRow("aws_ec2", 3, 25.5, 2).
+			AddRow("aws_lambda", 1, 0, 0))
+
+	summary, err := sm.GetSummary("general_1", storage.And{
+		storage.Or{storage.In("Data.PricePerMonth", "0"), storage.Compare("Data.PricePerMonth", storage.OpGreaterOrEqual, 10)},
+		storage.Not{Expression: storage.In("Data.Tag.Team", "finops")},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]storage.CollectorsSummary{
+		"aws_ec2":    {ResourceName: "aws_ec2", ResourceCount: 3, TotalSpent: 25.5, Status: 2, EventTime: 10, HasPricing: true, Category: "potential_cost_saving"},
+		"aws_rds":    {ResourceName: "aws_rds", Status: 1, ErrorMessage: "access denied", EventTime: 11},
+		"aws_lambda": {ResourceName: "aws_lambda", ResourceCount: 1, Category: "unused_resource"},
+	}, summary)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestStorageManager_GetExecutions tests that the executions are returned newest first.
+func TestStorageManager_GetExecutions(t *testing.T) {
+	sm, mock := newMockStorageManager(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, started_at FROM executions ORDER BY started_at DESC, id DESC LIMIT $1")).
+		WithArgs(2).WillReturnRows(sqlmock.NewRows([]string{"id", "started_at"}).
+		AddRow("general_1700000100", 1700000100).
+		AddRow("general_1700000000", 1700000000))
+
+	executions, err := sm.GetExecutions(2)
+	assert.NoError(t, err)
+	assert.Len(t, executions, 2)
+	assert.Equal(t, "general_1700000100", executions[0].ID)
+	assert.Equal(t, int64(1700000100), executions[0].Time.Unix())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestStorageManager_GetResources tests that the resource documents are counted, sorted and paged, and the search is escaped.
+func TestStorageManager_GetResources(t *testing.T) {
+	sm, mock := newMockStorageManager(t)
+	sm.dialect.DocumentField = func(column string, path []string) string {
+		return column + "->" + strings.Join(path, "->")
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT COUNT(*) FROM resources r`)).
+		WithArgs("general_1", "aws_ec2", "resource_detected", `%i-1\_a\%%`).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+	mock.ExpectQuery(regexp.QuoteMeta(`LOWER(CAST(r.document AS TEXT)) LIKE $4 ESCAPE '\' `+
+		`ORDER BY r.document->Data->PricePerMonth IS NULL, r.document->Data->PricePerMonth DESC, r.id LIMIT $5 OFFSET $6`)).
+		WithArgs("general_1", "aws_ec2", "resource_detected", `%i-1\_a\%%`, 2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"document"}).
+			AddRow([]byte(`{"ExecutionID":"general_1","Data":{"ResourceID":"i-1_a%"}}`)))
+
+	page, err := sm.GetResources("aws_ec2", "general_1", storage.ResourcesQuery{
+		Search: "I-1_a%",
+		Sort:   storage.SortField{Field: "Data.PricePerMonth", Descending: true},
+		Fields: []string{"Data.ResourceID"},
+		Offset: 2,
+		Limit:  2,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), page.Total)
+	assert.Equal(t, []map[string]interface{}{{"Data": map[string]interface{}{"ResourceID": "i-1_a%"}}}, page.Resources)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestStorageManager_EachResource tests that the resources are read with a single query, without a limit.
+func TestStorageManager_EachResource(t *testing.T) {
+	sm, mock := newMockStorageManager(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta(`t.tag_key = $4 AND t.tag_value IN ($5)) ORDER BY r.id`)+`$`).
+		WithArgs("general_1", "aws_ec2", "resource_detected", "Team", "finops").
+		WillReturnRows(sqlmock.NewRows([]string{"document"}).
+			AddRow([]byte(`{"Data":{"ResourceID":"i-1"}}`)).
+			AddRow([]byte(`{"Data":{"ResourceID":"i-2"}}`)))
+
+	resources := []map[string]interface{}{}
+	err := sm.EachResource("aws_ec2", "general_1", storage.In("Data.Tag.Team", "finops"), func(resource map[string]interface{}) error {
+		resources = append(resources, resource)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []map[string]interface{}{
+		{"Data": map[string]interface{}{"ResourceID": "i-1"}},
+		{"Data": map[string]interface{}{"ResourceID": "i-2"}},
+	}, resources)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestStorageManager_GetResourceTrends tests the trends query filters and order.
+func TestStorageManager_GetResourceTrends(t *testing.T) {
+	sm, mock := newMockStorageManager(t)
+
+	mock.ExpectQuery(regexp.QuoteMeta("t.tag_key = $3 AND t.tag_value IN ($4, $5)")).
+		WithArgs("aws_ec2", "service_status", "Team", "finops", "platform", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"execution_id", "started_at", "cost"}).
+			AddRow("general_2", 2, 20.0).
+			AddRow("general_1", 1, 10.0))
+
+	trends, err := sm.GetResourceTrends("aws_ec2", storage.In("Data.Tag.Team", "finops", "platform"), 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []storage.ExecutionCost{
+		{ExecutionID: "general_1", ExtractedTimestamp: 1, CostSum: 10},
+		{ExecutionID: "general_2", ExtractedTimestamp: 2, CostSum: 20},
+	}, trends)
+
+	_, err = sm.GetResourceTrends("aws_ec2", storage.In("Data.LaunchTime", "1"), 5)
+	assert.ErrorIs(t, err, ErrUnsupportedFilter)
+	_, err = sm.GetResourceTrends("aws_ec2", storage.Compare("Data.Tag.Team", storage.OpGreater, 1), 5)
+	assert.ErrorIs(t, err, storage.ErrInvalidFilter)
+	_, err = sm.GetResourceTrends("aws_ec2", storage.In("Data.PricePerMonth", "cheap"), 5)
+	assert.ErrorIs(t, err, storage.ErrInvalidFilter)
+	_, err = sm.GetResourceTrends("aws_ec2", storage.In("Data.Tag.Team') OR 1=1 --", "a"), 5)
+	assert.ErrorIs(t, err, storage.ErrInvalidFilter)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// TestStorageManager_GetExecutionTags tests that the tag values and their counts are grouped by key.
+func TestStorageManager_GetExecutionTags(t *testing.T) {
+	sm, mock := newMockStorageManager(t)
+
+	mock.ExpectQuery(`SELECT t.tag_key, t.tag_value, COUNT\(\*\)`).WithArgs("general_1", "resource_detected").
+		WillReturnRows(sqlmock.NewRows([]string{"tag_key", "tag_value", "count"}).
+			AddRow("Env", "prod", 3).
+			AddRow("Team", "finops", 2).
+			AddRow("Team", "platform", 1))
+
+	tags, err := sm.GetExecutionTags("general_1")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]storage.TagValue{
+		"Env":  {{Value: "prod", Count: 3}},
+		"Team": {{Value: "finops", Count: 2}, {Value: "platform", Count: 1}},
+	}, tags)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
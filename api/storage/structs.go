@@ -1,9 +1,17 @@
 package storage
 
 import (
+	"errors"
 	"time"
 )
 
+var (
+	// ErrIndexNotFound is returned when the requested storage index does not exist
+	ErrIndexNotFound = errors.New("index not found")
+	// ErrIndexInUse is returned when deleting the index that new events are written to
+	ErrIndexInUse = errors.New("index is in use")
+)
+
 const (
 	// GetExecutionsQueryLimit Describes the query limit results for GetExecutions API
 	GetExecutionsQueryLimit = "20"
@@ -11,11 +19,57 @@ const (
 
 type StorageDescriber interface {
 	Save(data string) bool
-	GetSummary(executionID string, filters map[string]string) (map[string]CollectorsSummary, error)
+	SaveBatch(data []string) (BatchResult, error)
+	GetSummary(executionID string, filter Expression) (map[string]CollectorsSummary, error)
 	GetExecutions(querylimit int) ([]Executions, error)
-	GetResources(resourceType string, executionID string, filters map[string]string, search string) ([]map[string]interface{}, error)
-	GetResourceTrends(resourceType string, filters map[string]string, limit int) ([]ExecutionCost, error)
-	GetExecutionTags(executionID string) (map[string][]string, error)
+	GetResources(resourceType string, executionID string, query ResourcesQuery) (ResourcesPage, error)
+	// EachResource calls fn with every resource of the type in the execution that matches the filter, in a
+	// single read of the storage that is not limited by a result window. It stops on the first error of fn
+	EachResource(resourceType string, executionID string, filter Expression, fn func(resource map[string]interface{}) error) error
+	GetResourceTrends(resourceType string, filter Expression, limit int) ([]ExecutionCost, error)
+	GetExecutionTags(executionID string) (map[string][]TagValue, error)
+}
+
+// BatchResult describes the outcome of saving a batch of documents
+type BatchResult struct {
+	Saved  int            `json:"saved"`
+	Failed []BatchFailure `json:"failed,omitempty"`
+}
+
+// BatchFailure describes a document of a batch that could not be saved
+type BatchFailure struct {
+	// Index is the position of the document in the batch
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// IndexLifecycleManager describes a storage that keeps the events in indexes that can be listed and pruned
+type IndexLifecycleManager interface {
+	ListIndexes() ([]IndexInfo, error)
+	DeleteIndex(name string) error
+	Prune(dryRun bool) (PruneReport, error)
+}
+
+// EventsExporter describes a storage that can read back all of its saved events
+type EventsExporter interface {
+	// ExportEvents calls fn with every saved event document, including its id. The export stops on the first error of fn
+	ExportEvents(fn func(document string) error) error
+}
+
+// IndexInfo describes a storage index
+type IndexInfo struct {
+	Name      string    `json:"name"`
+	Day       string    `json:"day"`
+	Current   bool      `json:"current"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// PruneReport describes the indexes and executions removed by the retention policy
+type PruneReport struct {
+	DryRun            bool     `json:"dry_run"`
+	DeletedIndexes    []string `json:"deleted_indexes"`
+	DeletedExecutions []string `json:"deleted_executions"`
 }
 
 // Executions defines the collectors execution  data
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TagValue describes a value of a resource tag and the number of resources that have it
+type TagValue struct {
+	Value string `json:"Value"`
+	Count int64  `json:"Count"`
+}
+
+// TagCounter counts the resources of every tag value
+type TagCounter map[string]map[string]int64
+
+// Add counts the tags of a resource, the values that are not strings are counted by their string form
+func (tc TagCounter) Add(tags map[string]interface{}) {
+	for key, value := range tags {
+		if value == nil {
+			continue
+		}
+		if tc[key] == nil {
+			tc[key] = map[string]int64{}
+		}
+		tc[key][fmt.Sprint(value)]++
+	}
+}
+
+// Tags returns the values of every tag key, sorted by value
+func (tc TagCounter) Tags() map[string][]TagValue {
+	tags := make(map[string][]TagValue, len(tc))
+	for key, counts := range tc {
+		values := make([]TagValue, 0, len(counts))
+		for value, count := range counts {
+			values = append(values, TagValue{Value: value, Count: count})
+		}
+		sort.Slice(values, func(i, j int) bool {
+			return values[i].Value < values[j].Value
+		})
+		tags[key] = values
+	}
+	return tags
+}
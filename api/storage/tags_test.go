@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestTagCounter tests that the tag values are counted, de-duplicated and sorted.
+func TestTagCounter(t *testing.T) {
+	counter := TagCounter{}
+	counter.Add(map[string]interface{}{"Team": "platform", "Env": "prod"})
+	counter.Add(map[string]interface{}{"Team": "finops", "Size": float64(3), "Owner": nil})
+	counter.Add(nil)
+	counter.Add(map[string]interface{}{"Team": "platform"})
+
+	assert.Equal(t, map[string][]TagValue{
+		"Env":  {{Value: "prod", Count: 1}},
+		"Size": {{Value: "3", Count: 1}},
+		"Team": {{Value: "finops", Count: 1}, {Value: "platform", Count: 2}},
+	}, counter.Tags())
+	assert.Empty(t, TagCounter{}.Tags())
+}
@@ -0,0 +1,178 @@
+package testutils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockOIDCCode describe an issued authorization code
+type mockOIDCCode struct {
+	redirectURI string
+	nonce       string
+	challenge   string
+}
+
+// MockOIDCProvider is a local OpenID Connect identity provider for tests
+type MockOIDCProvider struct {
+	Server   *httptest.Server
+	ClientID string
+	// Claims are added to the issued id tokens, overriding the default claims
+	Claims map[string]interface{}
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]mockOIDCCode
+}
+
+// NewMockOIDCProvider starts a new mock identity provider for the given client
+func NewMockOIDCProvider(clientID string) *MockOIDCProvider {
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	provider := &MockOIDCProvider{
+		ClientID: clientID,
+		Claims:   map[string]interface{}{},
+		key:      key,
+		codes:    map[string]mockOIDCCode{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", provider.discovery)
+	mux.HandleFunc("GET /authorize", provider.authorize)
+	mux.HandleFunc("POST /token", provider.token)
+	mux.HandleFunc("GET /jwks", provider.jwks)
+	provider.Server = httptest.NewServer(mux)
+
+	return provider
+}
+
+// URL returns the issuer url of the mock provider
+func (m *MockOIDCProvider) URL() string {
+	return m.Server.URL
+}
+
+// Close stops the mock provider
+func (m *MockOIDCProvider) Close() {
+	m.Server.Close()
+}
+
+func (m *MockOIDCProvider) discovery(resp http.ResponseWriter, req *http.Request) {
+	writeJSON(resp, http.StatusOK, map[string]string{
+		"issuer":                 m.Server.URL,
+		"authorization_endpoint": m.Server.URL + "/authorize",
+		"token_endpoint":         m.Server.URL + "/token",
+		"jwks_uri":               m.Server.URL + "/jwks",
+	})
+}
+
+// authorize approves every login and redirects back to the client with a new code
+func (m *MockOIDCProvider) authorize(resp http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	if query.Get("client_id") != m.ClientID || query.Get("code_challenge_method") != "S256" {
+		resp.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	code := base64.RawURLEncoding.EncodeToString(buf)
+	m.mu.Lock()
+	m.codes[code] = mockOIDCCode{
+		redirectURI: query.Get("redirect_uri"),
+		nonce:       query.Get("nonce"),
+		challenge:   query.Get("code_challenge"),
+	}
+	m.mu.Unlock()
+
+	redirect, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", query.Get("state"))
+	redirect.RawQuery = params.Encode()
+
+	http.Redirect(resp, req, redirect.String(), http.StatusFound)
+}
+
+// token exchanges a code for a signed id token, validating the PKCE verifier
+func (m *MockOIDCProvider) token(resp http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		writeJSON(resp, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	m.mu.Lock()
+	code, found := m.codes[req.PostForm.Get("code")]
+	delete(m.codes, req.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(req.PostForm.Get("code_verifier")))
+	if !found || code.redirectURI != req.PostForm.Get("redirect_uri") ||
+		code.challenge != base64.RawURLEncoding.EncodeToString(verifier[:]) {
+		writeJSON(resp, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":                m.Server.URL,
+		"aud":                m.ClientID,
+		"sub":                "user-1",
+		"preferred_username": "jane",
+		"nonce":              code.nonce,
+		"iat":                time.Now().Unix(),
+		"exp":                time.Now().Add(time.Minute).Unix(),
+	}
+	for name, value := range m.Claims {
+		claims[name] = value
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "mock"
+	idToken, err := token.SignedString(m.key)
+	if err != nil {
+		writeJSON(resp, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(resp, http.StatusOK, map[string]string{
+		"access_token": "mock",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+	})
+}
+
+func (m *MockOIDCProvider) jwks(resp http.ResponseWriter, req *http.Request) {
+	writeJSON(resp, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": "mock",
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+		}},
+	})
+}
+
+func writeJSON(resp http.ResponseWriter, statusCode int, data interface{}) {
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(statusCode)
+	_ = json.NewEncoder(resp).Encode(data)
+}
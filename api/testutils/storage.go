@@ -3,11 +3,14 @@ package testutils
 import (
 	"errors"
 	"finala/api/storage"
+	"strings"
 	"time"
 )
 
 type MockStorage struct {
 	Events int
+	// ResourcesQuery is the query of the last GetResources call
+	ResourcesQuery storage.ResourcesQuery
 }
 
 func NewMockStorage() *MockStorage {
@@ -22,7 +25,29 @@ func (ms *MockStorage) Save(data string) bool {
 	return true
 }
 
-func (ms *MockStorage) GetSummary(executionID string, filters map[string]string) (map[string]storage.CollectorsSummary, error) {
+func (ms *MockStorage) SaveBatch(data []string) (storage.BatchResult, error) {
+	result := storage.BatchResult{}
+	for _, row := range data {
+		if strings.Contains(row, `"ResourceName":"unavailable"`) {
+			err := errors.New("storage is unavailable")
+			for i := range data {
+				result.Failed = append(result.Failed, storage.BatchFailure{Index: i, Error: err.Error()})
+			}
+			return result, err
+		}
+	}
+	for i, row := range data {
+		if strings.Contains(row, `"ResourceName":"invalid"`) {
+			result.Failed = append(result.Failed, storage.BatchFailure{Index: i, Error: "invalid document"})
+			continue
+		}
+		ms.Events++
+		result.Saved++
+	}
+	return result, nil
+}
+
+func (ms *MockStorage) GetSummary(executionID string, filter storage.Expression) (map[string]storage.CollectorsSummary, error) {
 
 	if executionID == "err" {
 		return nil, errors.New("error")
@@ -69,12 +94,13 @@ func (ms *MockStorage) GetExecutions(queryLimit int) ([]storage.Executions, erro
 	return response, nil
 }
 
-func (ms *MockStorage) GetResources(resourceType string, executionID string, filters map[string]string, search string) ([]map[string]interface{}, error) {
+func (ms *MockStorage) GetResources(resourceType string, executionID string, query storage.ResourcesQuery) (storage.ResourcesPage, error) {
 
 	var response []map[string]interface{}
+	ms.ResourcesQuery = query
 
 	if executionID == "err" {
-		return nil, errors.New("error")
+		return storage.ResourcesPage{}, errors.New("error")
 	}
 
 	type tempStruct struct {
@@ -88,11 +114,25 @@ func (ms *MockStorage) GetResources(resourceType string, executionID string, fil
 	response = append(response, rowData)
 	response = append(response, rowData1)
 
-	return response, nil
+	return storage.PageResources(response, query), nil
 
 }
 
-func (ms *MockStorage) GetResourceTrends(resourceType string, filters map[string]string, limit int) ([]storage.ExecutionCost, error) {
+func (ms *MockStorage) EachResource(resourceType string, executionID string, filter storage.Expression, fn func(resource map[string]interface{}) error) error {
+
+	page, err := ms.GetResources(resourceType, executionID, storage.ResourcesQuery{Filter: filter})
+	if err != nil {
+		return err
+	}
+	for _, resource := range page.Resources {
+		if err := fn(resource); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ms *MockStorage) GetResourceTrends(resourceType string, filter storage.Expression, limit int) ([]storage.ExecutionCost, error) {
 	var response []storage.ExecutionCost
 
 	if resourceType == "err" {
@@ -118,17 +158,46 @@ func (ms *MockStorage) GetResourceTrends(resourceType string, filters map[string
 
 }
 
-func (ms *MockStorage) GetExecutionTags(executionID string) (map[string][]string, error) {
+func (ms *MockStorage) GetExecutionTags(executionID string) (map[string][]storage.TagValue, error) {
 
-	response := map[string][]string{}
+	response := map[string][]storage.TagValue{}
 
 	if executionID == "err" {
 		return response, errors.New("error")
 	}
 
-	response["Tagfact_worker_group"] = []string{"b2c", "web-staging", "data-collecton"}
-	response["Team"] = []string{"df", "web", "b2c", "bidev", "data-collection", "production-engineers"}
+	response["Tagfact_worker_group"] = []storage.TagValue{{Value: "b2c", Count: 2}, {Value: "data-collecton", Count: 1}, {Value: "web-staging", Count: 1}}
+	response["Team"] = []storage.TagValue{{Value: "b2c", Count: 1}, {Value: "bidev", Count: 3}, {Value: "data-collection", Count: 1}, {Value: "df", Count: 1}, {Value: "production-engineers", Count: 2}, {Value: "web", Count: 1}}
 
 	return response, nil
 
 }
+
+func (ms *MockStorage) ListIndexes() ([]storage.IndexInfo, error) {
+
+	return []storage.IndexInfo{
+		{Name: "finala-2024-01-02", Day: "2024-01-02", Current: true},
+		{Name: "finala-2024-01-01", Day: "2024-01-01"},
+	}, nil
+}
+
+func (ms *MockStorage) DeleteIndex(name string) error {
+
+	switch name {
+	case "finala-2024-01-02":
+		return storage.ErrIndexInUse
+	case "finala-2024-01-01":
+		return nil
+	default:
+		return storage.ErrIndexNotFound
+	}
+}
+
+func (ms *MockStorage) Prune(dryRun bool) (storage.PruneReport, error) {
+
+	return storage.PruneReport{
+		DryRun:            dryRun,
+		DeletedIndexes:    []string{"finala-2024-01-01"},
+		DeletedExecutions: []string{"general_1704067200"},
+	}, nil
+}
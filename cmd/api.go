@@ -1,15 +1,23 @@
 package cmd
 
 import (
+	"context"
 	"finala/api"
+	"finala/api/auth"
 	apiconfig "finala/api/config"
+	"finala/api/ingestion"
+	"finala/api/storage"
+	"finala/api/storage/elasticsearch"
 	"finala/api/storage/meilisearch"
+	"finala/api/storage/memory"
+	"finala/api/storage/postgres"
+	"finala/api/storage/sqlite"
 	"finala/serverutil"
 	"finala/visibility"
+	"net/http"
 	"os"
 	"os/signal"
-
-	appcfg "finala/config"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -26,9 +34,6 @@ var apiServer = &cobra.Command{
 	Short: "Launch RESTful API",
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		// Load authentication credentials first
-		appcfg.LoadCredentials("/etc/finala/config.yaml")
-
 		// Loading configuration file
 		configStruct, err := apiconfig.LoadAPI(cfgFile)
 		if err != nil {
@@ -39,14 +44,71 @@ var apiServer = &cobra.Command{
 		// Set application log level
 		visibility.SetLoggingLevel(configStruct.LogLevel)
 
-		storage, err := meilisearch.NewStorageManager(configStruct.Storage.Meilisearch)
+		if configStruct.Auth.JWTSecret != "" {
+			if err := auth.SetSigningKey(configStruct.Auth.JWTSecret); err != nil {
+				log.WithError(err).Error("invalid auth configuration")
+				os.Exit(1)
+			}
+		} else {
+			log.Warn("auth.jwt_secret is not configured, using a random secret. Tokens will be invalid after restart")
+		}
+
+		users, err := auth.NewUserStore(configStruct.Auth.UsersFile)
+		if err != nil {
+			log.WithError(err).Error("could not load api users")
+			os.Exit(1)
+		}
+
+		if err := bootstrapAdminUser(users, configStruct.Auth); err != nil {
+			log.WithError(err).Error("could not create the first admin user")
+			os.Exit(1)
+		}
+
+		sessions, err := auth.NewSessionManager(configStruct.Auth.SessionsFile, configStruct.Auth.AccessTokenTTL, configStruct.Auth.RefreshTokenTTL)
+		if err != nil {
+			log.WithError(err).Error("could not load api sessions")
+			os.Exit(1)
+		}
+
+		var oidcProvider *auth.OIDCProvider
+		if configStruct.Auth.OIDC.Enabled {
+			oidcProvider, err = auth.NewOIDCProvider(context.Background(), configStruct.Auth.OIDC, &http.Client{Timeout: 30 * time.Second})
+			if err != nil {
+				log.WithError(err).Error("could not configure oidc single sign-on")
+				os.Exit(1)
+			}
+		}
+
+		storage, err := newStorage(configStruct.Storage)
 		if err != nil {
+			log.WithError(err).Error("could not create the storage")
 			os.Exit(1)
 		}
 
-		apiManager := api.NewServer(port, storage, versionManager)
+		var collectorKeys *auth.CollectorKeyStore
+		if configStruct.CollectorAuth.Enabled {
+			collectorKeys, err = auth.NewCollectorKeyStore(configStruct.CollectorAuth.KeysFile)
+			if err != nil {
+				log.WithError(err).Error("could not load collector api keys")
+				os.Exit(1)
+			}
+		}
+
+		servers := []serverutil.Server{}
+		var ingestionQueue *ingestion.Queue
+		if configStruct.Ingestion.Mode == apiconfig.IngestionModeQueue {
+			ingestionQueue, err = ingestion.NewQueue(configStruct.Ingestion.QueueDir, configStruct.Ingestion.QueueSize, configStruct.Ingestion.RetryInterval, storage)
+			if err != nil {
+				log.WithError(err).Error("could not create the ingestion queue")
+				os.Exit(1)
+			}
+			servers = append(servers, ingestionQueue)
+		}
+
+		apiManager := api.NewServer(port, storage, versionManager, collectorKeys, users, sessions, oidcProvider, ingestionQueue)
+		servers = append(servers, apiManager)
 
-		apiStopper := serverutil.RunAll(apiManager).StopFunc
+		apiStopper := serverutil.RunAll(servers...).StopFunc
 
 		stop := make(chan os.Signal, 1)
 		signal.Notify(stop, os.Interrupt)
@@ -56,6 +118,27 @@ var apiServer = &cobra.Command{
 	},
 }
 
+// newStorage creates the storage backend selected in the configuration
+func newStorage(conf apiconfig.StorageConfig) (storage.StorageDescriber, error) {
+	if conf.Type != apiconfig.StorageTypeMeilisearch && conf.Retention.Enabled() {
+		log.Warn("storage retention is supported only by the meilisearch storage, the retention rules are ignored")
+	}
+
+	switch conf.Type {
+	case apiconfig.StorageTypeElasticsearch:
+		return elasticsearch.NewStorageManager(conf.ElasticSearch)
+	case apiconfig.StorageTypePostgres:
+		return postgres.NewStorageManager(conf.Postgres)
+	case apiconfig.StorageTypeSQLite:
+		return sqlite.NewStorageManager(conf.SQLite)
+	case apiconfig.StorageTypeMemory:
+		log.Warn("the events are kept in memory only and are lost when the api exits")
+		return memory.NewStorageManager(), nil
+	default:
+		return meilisearch.NewStorageManager(conf.Meilisearch, conf.Retention)
+	}
+}
+
 // init will add aws command
 func init() {
 	apiServer.PersistentFlags().IntVar(&port, "port", 8089, "lisinning port")
@@ -42,7 +42,11 @@ var collectorCMD = &cobra.Command{
 		req := request.NewHTTPClient()
 
 		// Init collector manager
-		collectorManager := collector.NewCollectorManager(ctx, &wg, req, configStruct.APIServer.BulkInterval, configStruct.Name, configStruct.APIServer.Addr)
+		collectorManager, err := collector.NewCollectorManager(ctx, &wg, req, configStruct.APIServer, configStruct.Name)
+		if err != nil {
+			log.WithError(err).Error("could not create collector manager")
+			os.Exit(1)
+		}
 
 		// Starting collect data
 		awsProvider := configStruct.Providers["aws"]
@@ -50,17 +54,61 @@ var collectorCMD = &cobra.Command{
 		// init metric manager
 		metricManager := collector.NewMetricManager(awsProvider)
 
-		awsManager := aws.NewAnalyzeManager(collectorManager, metricManager, awsProvider.Accounts)
+		awsManager := aws.NewAnalyzeManager(collectorManager, metricManager, awsProvider)
 
 		awsManager.All()
 
 		log.Info("Collector Done. Starting graceful shutdown")
 		cancelFn()
 		wg.Wait()
+
+		if undelivered := collectorManager.UndeliveredBatches(); undelivered > 0 {
+			log.WithField("undelivered_batches", undelivered).Error("Collector could not deliver all events to the api server")
+			os.Exit(1)
+		}
+	},
+}
+
+// collectorReplayCMD will re-send the events batches that remained in the spool from previous executions
+var collectorReplayCMD = &cobra.Command{
+	Use:   "replay",
+	Short: "Re-sends spooled events batches from previous collector executions",
+	Long:  ``,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		// Loading configuration file
+		configStruct, err := config.Load(cfgFile)
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+
+		// Set application log level
+		visibility.SetLoggingLevel(configStruct.LogLevel)
+
+		if configStruct.APIServer.SpoolDir == "" {
+			log.Error("api_server.spool_dir is not configured")
+			os.Exit(1)
+		}
+
+		spool, err := collector.NewSpool(configStruct.APIServer.SpoolDir)
+		if err != nil {
+			log.WithError(err).Error("could not open spool directory")
+			os.Exit(1)
+		}
+
+		sent, err := collector.ReplaySpool(request.NewHTTPClient(), configStruct.APIServer, spool)
+		if err != nil {
+			log.WithError(err).WithField("sent_batches", sent).Error("could not replay all spooled events batches")
+			os.Exit(1)
+		}
+
+		log.WithField("sent_batches", sent).Info("Replay Done")
 	},
 }
 
 // init will add aws command
 func init() {
+	collectorCMD.AddCommand(collectorReplayCMD)
 	rootCmd.AddCommand(collectorCMD)
 }
@@ -8,7 +8,6 @@ import (
 	"finala/visibility"
 	"fmt"
 	"os"
-	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -51,6 +50,16 @@ var notifierCMD = &cobra.Command{
 		request := request.NewHTTPClient()
 		dataFetcherManager := notifiers.NewDataFetcherManager(request, *notifierLog, notifierConfig.APIServerAddr)
 
+		// The api endpoints require a bearer token, the notifier logs in as its api user
+		if notifierConfig.Auth.Username == "" || notifierConfig.Auth.Password == "" {
+			notifierLog.Error("notifier requires auth.username and auth.password to log in to the api")
+			os.Exit(1)
+		}
+		if err := dataFetcherManager.Login(notifierConfig.Auth.Username, notifierConfig.Auth.Password); err != nil {
+			notifierLog.WithError(err).Error("could not log in to the api")
+			os.Exit(1)
+		}
+
 		notifierLog.Info("The command has started it's work")
 		// bring all data and executionID
 		notifierLog.Debug("Going to get the latest execution from Finala API")
@@ -69,7 +78,7 @@ var notifierCMD = &cobra.Command{
 
 				groupName = notificationGroup
 				for _, notifyTag := range notificationGroupSettings.Tags {
-					filterOptions[fmt.Sprintf("filter_Data.Tag.%s", strings.ToLower(notifyTag.Name))] = notifyTag.Value
+					filterOptions[fmt.Sprintf("filter_Data.Tag.%s", notifyTag.Name)] = notifyTag.Value
 				}
 				notifierLog.WithField("filter_options", filterOptions).
 					Debug("Going to get the execution summary from Finala API with the filters")
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"compress/gzip"
+	apiconfig "finala/api/config"
+	"finala/api/storage"
+	"finala/api/storage/archive"
+	"finala/visibility"
+	"io"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// stdioArchive defines the archive path of the standard input or output
+const stdioArchive = "-"
+
+var (
+	// archiveFile is the path of the exported or imported NDJSON archive
+	archiveFile string
+	// importBatchSize is the number of events saved per storage batch on import
+	importBatchSize int
+)
+
+// storageCMD will present the storage management commands
+var storageCMD = &cobra.Command{
+	Use:   "storage",
+	Short: "Manage the API storage",
+	Long:  ``,
+}
+
+// storageExportCMD will write all the events of the configured storage to an archive
+var storageExportCMD = &cobra.Command{
+	Use:   "export",
+	Short: "Export all the executions events of the API storage to an NDJSON archive",
+	Long: `Export all the executions events of the API storage to an NDJSON archive, one event per line.
+The archive is gzip compressed when the file name ends with .gz`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		storageManager := loadStorage()
+
+		var w io.Writer = os.Stdout
+		if archiveFile != stdioArchive {
+			file, err := os.OpenFile(archiveFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+			if err != nil {
+				log.WithError(err).WithField("file", archiveFile).Error("could not create archive")
+				os.Exit(1)
+			}
+			defer file.Close()
+			w = file
+		}
+
+		var gzipWriter *gzip.Writer
+		if strings.HasSuffix(archiveFile, ".gz") {
+			gzipWriter = gzip.NewWriter(w)
+			w = gzipWriter
+		}
+
+		exported, err := archive.Export(w, storageManager)
+		if err == nil && gzipWriter != nil {
+			err = gzipWriter.Close()
+		}
+		if err != nil {
+			log.WithError(err).WithField("events", exported).Error("could not export storage")
+			os.Exit(1)
+		}
+
+		log.WithFields(log.Fields{
+			"file":   archiveFile,
+			"events": exported,
+		}).Info("storage exported")
+	},
+}
+
+// storageImportCMD will save the events of an archive in the configured storage
+var storageImportCMD = &cobra.Command{
+	Use:   "import",
+	Short: "Import an NDJSON archive into the API storage",
+	Long: `Import an NDJSON archive, created by the export command, into the API storage.
+Events that are already saved are replaced, so an archive can be imported again`,
+	Run: func(cmd *cobra.Command, args []string) {
+
+		storageManager := loadStorage()
+
+		var r io.Reader = os.Stdin
+		if archiveFile != stdioArchive {
+			file, err := os.Open(archiveFile)
+			if err != nil {
+				log.WithError(err).WithField("file", archiveFile).Error("could not open archive")
+				os.Exit(1)
+			}
+			defer file.Close()
+			r = file
+		}
+
+		if strings.HasSuffix(archiveFile, ".gz") {
+			gzipReader, err := gzip.NewReader(r)
+			if err != nil {
+				log.WithError(err).WithField("file", archiveFile).Error("could not open archive")
+				os.Exit(1)
+			}
+			defer gzipReader.Close()
+			r = gzipReader
+		}
+
+		result, err := archive.Import(r, storageManager, importBatchSize)
+		for _, failure := range result.Failed {
+			log.WithFields(log.Fields{
+				"line":  failure.Index + 1,
+				"error": failure.Error,
+			}).Warn("could not import event")
+		}
+		if err != nil {
+			log.WithError(err).WithField("saved", result.Saved).Error("could not import archive")
+			os.Exit(1)
+		}
+
+		log.WithFields(log.Fields{
+			"file":   archiveFile,
+			"saved":  result.Saved,
+			"failed": len(result.Failed),
+		}).Info("archive imported")
+	},
+}
+
+// loadStorage connects to the storage of the api configuration
+func loadStorage() storage.StorageDescriber {
+
+	configStruct, err := apiconfig.LoadAPI(cfgFile)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+
+	// Set application log level
+	visibility.SetLoggingLevel(configStruct.LogLevel)
+
+	storageManager, err := newStorage(configStruct.Storage)
+	if err != nil {
+		log.WithError(err).Error("could not initialize storage")
+		os.Exit(1)
+	}
+
+	return storageManager
+}
+
+// init will add storage command
+func init() {
+	for _, command := range []*cobra.Command{storageExportCMD, storageImportCMD} {
+		command.PersistentFlags().StringVarP(&archiveFile, "file", "f", stdioArchive, "path of the NDJSON archive, - for the standard output or input")
+	}
+	storageImportCMD.PersistentFlags().IntVar(&importBatchSize, "batch-size", archive.DefaultBatchSize, "number of events saved per storage batch")
+	storageCMD.AddCommand(storageExportCMD, storageImportCMD)
+	rootCmd.AddCommand(storageCMD)
+}
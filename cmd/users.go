@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"finala/api/auth"
+	apiconfig "finala/api/config"
+	"finala/serverutil"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// defaultAdminUsername defines the username of the first admin user
+	defaultAdminUsername = "admin"
+
+	// generatedPasswordLength defines the length of the generated users passwords
+	generatedPasswordLength = 20
+)
+
+var (
+	// userRole is the role of the added user
+	userRole string
+	// passwordStdin reads the user password from the standard input
+	passwordStdin bool
+)
+
+// usersCMD will present the api users management commands
+var usersCMD = &cobra.Command{
+	Use:   "users",
+	Short: "Manage the API users",
+	Long:  ``,
+}
+
+// usersAddCMD will add a new api user
+var usersAddCMD = &cobra.Command{
+	Use:   "add <username>",
+	Short: "Add an API user",
+	Long:  ``,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		users := loadUsers()
+
+		role, err := auth.ParseRole(userRole)
+		if err != nil {
+			log.Error(err)
+			os.Exit(1)
+		}
+
+		password, generated := readUserPassword()
+		if err := users.Add(args[0], password, role); err != nil {
+			log.WithError(err).WithField("username", args[0]).Error("could not add user")
+			os.Exit(1)
+		}
+
+		log.WithFields(log.Fields{
+			"username": args[0],
+			"role":     role,
+		}).Info("user added")
+		printGeneratedPassword(password, generated)
+	},
+}
+
+// usersRemoveCMD will remove an api user
+var usersRemoveCMD = &cobra.Command{
+	Use:   "remove <username>",
+	Short: "Remove an API user",
+	Long:  ``,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		users := loadUsers()
+		if err := users.Remove(args[0]); err != nil {
+			log.WithError(err).WithField("username", args[0]).Error("could not remove user")
+			os.Exit(1)
+		}
+
+		log.WithField("username", args[0]).Info("user removed")
+	},
+}
+
+// usersPasswdCMD will replace the password of an api user
+var usersPasswdCMD = &cobra.Command{
+	Use:   "passwd <username>",
+	Short: "Change the password of an API user",
+	Long:  ``,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+
+		users := loadUsers()
+
+		password, generated := readUserPassword()
+		if err := users.SetPassword(args[0], password); err != nil {
+			log.WithError(err).WithField("username", args[0]).Error("could not change user password")
+			os.Exit(1)
+		}
+
+		log.WithField("username", args[0]).Info("user password changed")
+		printGeneratedPassword(password, generated)
+	},
+}
+
+// loadUsers loads the users store of the api configuration
+func loadUsers() *auth.UserStore {
+
+	configStruct, err := apiconfig.LoadAPI(cfgFile)
+	if err != nil {
+		log.Error(err)
+		os.Exit(1)
+	}
+
+	users, err := auth.NewUserStore(configStruct.Auth.UsersFile)
+	if err != nil {
+		log.WithError(err).Error("could not load api users")
+		os.Exit(1)
+	}
+
+	return users
+}
+
+// readUserPassword reads the password from the standard input when requested, otherwise a random password is generated
+func readUserPassword() (string, bool) {
+
+	if passwordStdin {
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && password == "" {
+			log.WithError(err).Error("could not read password from stdin")
+			os.Exit(1)
+		}
+		return strings.TrimRight(password, "\r\n"), false
+	}
+
+	password, err := serverutil.GenerateRandomPassword(generatedPasswordLength)
+	if err != nil {
+		log.WithError(err).Error("could not generate password")
+		os.Exit(1)
+	}
+	return password, true
+}
+
+// printGeneratedPassword prints the generated password, it is not stored in clear text anywhere
+func printGeneratedPassword(password string, generated bool) {
+	if generated {
+		fmt.Printf("Generated password: %s\n", password)
+	}
+}
+
+// bootstrapAdminUser creates the first admin user when the users store is empty.
+// The legacy auth credentials are used when configured, otherwise a random password is generated and logged once.
+func bootstrapAdminUser(users *auth.UserStore, authConfig apiconfig.AuthConfig) error {
+
+	if len(users.List()) > 0 {
+		return nil
+	}
+
+	if authConfig.Username != "" && authConfig.Password != "" {
+		err := users.Add(authConfig.Username, authConfig.Password, auth.RoleAdmin)
+		if err == nil {
+			log.WithField("username", authConfig.Username).Warn("created admin user from auth.username / auth.password, remove the clear text password from the configuration file")
+			return nil
+		}
+		if !errors.Is(err, auth.ErrWeakPassword) {
+			return err
+		}
+		log.WithError(err).Warn("auth.password is too weak, generating an admin password instead")
+	}
+
+	password, err := serverutil.GenerateRandomPassword(generatedPasswordLength)
+	if err != nil {
+		return err
+	}
+	if err := users.Add(defaultAdminUsername, password, auth.RoleAdmin); err != nil {
+		if errors.Is(err, auth.ErrUserExists) {
+			return nil
+		}
+		return err
+	}
+
+	log.WithFields(log.Fields{
+		"username": defaultAdminUsername,
+		"password": password,
+	}).Warn("created admin user with a generated password, change it with `finala users passwd`")
+	return nil
+}
+
+// init will add users command
+func init() {
+	usersAddCMD.PersistentFlags().StringVar(&userRole, "role", string(auth.RoleViewer), "user role (viewer, reporter, admin)")
+	for _, command := range []*cobra.Command{usersAddCMD, usersPasswdCMD} {
+		command.PersistentFlags().BoolVar(&passwordStdin, "password-stdin", false, "read the password from stdin, a random password is generated otherwise")
+	}
+	usersCMD.AddCommand(usersAddCMD, usersRemoveCMD, usersPasswdCMD)
+	rootCmd.AddCommand(usersCMD)
+}
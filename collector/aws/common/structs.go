@@ -30,4 +30,5 @@ type AWSManager interface {
 	GetAccountIdentity() *sts.GetCallerIdentityOutput
 	SetGlobal(resourceName collector.ResourceIdentifier)
 	IsGlobalSet(resourceName collector.ResourceIdentifier) bool
+	TrySetGlobal(resourceName collector.ResourceIdentifier) bool
 }
@@ -39,21 +39,31 @@ type DetectorManager struct {
 	awsConfig        *awsClient.Config
 	accountIdentity  *sts.GetCallerIdentityOutput
 	region           string
-	global           map[string]struct{}
+	global           *GlobalResources
 }
 
-// NewDetectorManager create new instance of detector manager
-func NewDetectorManager(awsAuth AuthDescriptor, collector collector.CollectorDescriber, account config.AWSAccount, stsManager *STSManager, global map[string]struct{}, region string) *DetectorManager {
+// NewDetectorManager create new instance of detector manager.
+// When a rate limiter is given, it is applied on every AWS API request of the detector sessions
+func NewDetectorManager(awsAuth AuthDescriptor, collector collector.CollectorDescriber, account config.AWSAccount, stsManager *STSManager, global *GlobalResources, rateLimiter *RateLimiter, region string) *DetectorManager {
 
 	priceSession, _ := awsAuth.Login(defaultRegionPrice)
-	pricingManager := pricing.NewPricingManager(awsPricing.New(priceSession), defaultRegionPrice)
-
 	regionSession, regionConfig := awsAuth.Login(region)
+	if rateLimiter != nil {
+		priceSession.Handlers.Send.PushFrontNamed(rateLimiter.Handler(account.Name, defaultRegionPrice))
+		regionSession.Handlers.Send.PushFrontNamed(rateLimiter.Handler(account.Name, region))
+	}
+
+	pricingManager := pricing.NewPricingManager(awsPricing.New(priceSession), defaultRegionPrice)
 	cloudWatchCLient := cloudwatch.NewCloudWatchManager(awsCloudwatch.New(regionSession, regionConfig))
 
 	callerIdentityOutput, _ := stsManager.client.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	accountID := account.Name
+	if callerIdentityOutput != nil && callerIdentityOutput.Account != nil {
+		accountID = *callerIdentityOutput.Account
+	}
+
 	return &DetectorManager{
-		collector:        collector,
+		collector:        &accountCollector{CollectorDescriber: collector, accountID: accountID},
 		cloudWatchClient: cloudWatchCLient,
 		pricing:          pricingManager,
 		region:           region,
@@ -64,12 +74,25 @@ func NewDetectorManager(awsAuth AuthDescriptor, collector collector.CollectorDes
 	}
 }
 
+// accountCollector adds the account of the detector to the resources it collects
+type accountCollector struct {
+	collector.CollectorDescriber
+	accountID string
+}
+
+// AddResource adds the detected resource with the detector account
+func (ac *accountCollector) AddResource(data collector.EventCollector) {
+	data.AccountID = ac.accountID
+	ac.CollectorDescriber.AddResource(data)
+}
+
 // GetResourceIdentifier returns the resource identifier name
 func (dm *DetectorManager) GetResourceIdentifier(name string) collector.ResourceIdentifier {
 	return collector.ResourceIdentifier(fmt.Sprintf("%s_%s", "aws", name))
 }
 
-// GetCollector return the collector instance
+// GetCollector return the collector instance, the resources it collects are added with the account id of
+// the caller identity, or with the account name when the identity is unknown
 func (dm *DetectorManager) GetCollector() collector.CollectorDescriber {
 	return dm.collector
 }
@@ -101,11 +124,16 @@ func (dm *DetectorManager) GetAccountIdentity() *sts.GetCallerIdentityOutput {
 
 // SetGlobal marked resource as global
 func (dm *DetectorManager) SetGlobal(resourceName collector.ResourceIdentifier) {
-	dm.global[string(resourceName)] = struct{}{}
+	dm.global.Set(string(resourceName))
 }
 
 // IsGlobalSet return true if the resource already exists in global slice
 func (dm *DetectorManager) IsGlobalSet(resourceName collector.ResourceIdentifier) bool {
-	_, isExists := dm.global[string(resourceName)]
-	return isExists
+	return dm.global.IsSet(string(resourceName))
+}
+
+// TrySetGlobal marked resource as global and return true, or return false if the resource was already marked.
+// Unlike IsGlobalSet followed by SetGlobal, the check and the set are done atomically
+func (dm *DetectorManager) TrySetGlobal(resourceName collector.ResourceIdentifier) bool {
+	return dm.global.TrySet(string(resourceName))
 }
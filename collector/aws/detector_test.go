@@ -1,6 +1,7 @@
 package aws
 
 import (
+	finalaCollector "finala/collector"
 	"finala/collector/config"
 	collectorTestutils "finala/collector/testutils"
 	"testing"
@@ -54,8 +55,8 @@ func TestDetector(t *testing.T) {
 	mockAuth := &mockAuth{}
 	mockSTS := NewMockSTS()
 	collector := collectorTestutils.NewMockCollector()
-	global := make(map[string]struct{})
-	detector := NewDetectorManager(mockAuth, collector, account, mockSTS, global, region)
+	global := NewGlobalResources()
+	detector := NewDetectorManager(mockAuth, collector, account, mockSTS, global, nil, region)
 
 	if detector.GetRegion() != region {
 		t.Fatalf("unexpected collector region, got %s expected %s", detector.GetRegion(), region)
@@ -70,4 +71,9 @@ func TestDetector(t *testing.T) {
 		t.Fatalf("unexpected account identifier, got %s expected %s", *accountIdentity.Account, "foo")
 	}
 
+	detector.GetCollector().AddResource(finalaCollector.EventCollector{ResourceName: "aws_foo", EventType: "resource_detected"})
+	if len(collector.Events) != 1 || collector.Events[0].AccountID != "foo" {
+		t.Fatalf("unexpected collected resources, got %v expected the account %s", collector.Events, "foo")
+	}
+
 }
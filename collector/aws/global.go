@@ -0,0 +1,45 @@
+package aws
+
+import (
+	"sync"
+)
+
+// GlobalResources holds the resources that are detected once, and shared between all the detections.
+// It is safe for concurrent use.
+type GlobalResources struct {
+	mu        sync.Mutex
+	resources map[string]struct{}
+}
+
+// NewGlobalResources creates new global resources instance
+func NewGlobalResources() *GlobalResources {
+	return &GlobalResources{
+		resources: make(map[string]struct{}),
+	}
+}
+
+// Set marks the resource as global
+func (gr *GlobalResources) Set(name string) {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+	gr.resources[name] = struct{}{}
+}
+
+// IsSet returns true if the resource was already marked as global
+func (gr *GlobalResources) IsSet(name string) bool {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+	_, isExists := gr.resources[name]
+	return isExists
+}
+
+// TrySet marks the resource as global and returns true, or returns false if it was already marked
+func (gr *GlobalResources) TrySet(name string) bool {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+	if _, isExists := gr.resources[name]; isExists {
+		return false
+	}
+	gr.resources[name] = struct{}{}
+	return true
+}
@@ -0,0 +1,124 @@
+package aws
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"finala/collector/config"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// RateLimiter limits the AWS API requests per second, per account, region and service
+type RateLimiter struct {
+	config  config.RateLimitConfig
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// tokenBucket describe a single rate limit bucket
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates new AWS API rate limiter
+func NewRateLimiter(conf config.RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		config:  conf,
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// ServiceRate returns the allowed requests per second of the given service, 0 means unlimited
+func (rl *RateLimiter) ServiceRate(service string) float64 {
+	if rate, found := rl.config.Services[service]; found {
+		return rate
+	}
+	return rl.config.Default
+}
+
+// Wait blocks until a request of the given service is allowed or the context is done
+func (rl *RateLimiter) Wait(ctx context.Context, accountName, region, service string) error {
+
+	rate := rl.ServiceRate(service)
+	if rate <= 0 {
+		return nil
+	}
+
+	delay := rl.bucket(fmt.Sprintf("%s/%s/%s", accountName, region, service), rate).reserve(time.Now())
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Handler returns an AWS SDK request handler that applies the rate limit on every sent request
+func (rl *RateLimiter) Handler(accountName, region string) request.NamedHandler {
+	return request.NamedHandler{
+		Name: "finala.RateLimiter",
+		Fn: func(r *request.Request) {
+			if err := rl.Wait(r.Context(), accountName, region, r.ClientInfo.ServiceName); err != nil {
+				r.Error = err
+			}
+		},
+	}
+}
+
+// bucket returns the bucket of the given key, and creates it if not exists
+func (rl *RateLimiter) bucket(key string, rate float64) *tokenBucket {
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	bucket, found := rl.buckets[key]
+	if !found {
+		burst := rate
+		if burst < 1 {
+			burst = 1
+		}
+		bucket = &tokenBucket{
+			rate:   rate,
+			burst:  burst,
+			tokens: burst,
+		}
+		rl.buckets[key] = bucket
+	}
+
+	return bucket
+}
+
+// reserve takes a token from the bucket and returns how long the caller should wait before using it
+func (tb *tokenBucket) reserve(now time.Time) time.Duration {
+
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	if !tb.last.IsZero() {
+		tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+		if tb.tokens > tb.burst {
+			tb.tokens = tb.burst
+		}
+	}
+	tb.last = now
+
+	tb.tokens--
+	if tb.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-tb.tokens / tb.rate * float64(time.Second))
+}
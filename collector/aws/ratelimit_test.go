@@ -0,0 +1,75 @@
+package aws
+
+import (
+	"context"
+	"finala/collector/config"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterServiceRate(t *testing.T) {
+
+	rateLimiter := NewRateLimiter(config.RateLimitConfig{
+		Default: 5,
+		Services: map[string]float64{
+			"ec2": 20,
+		},
+	})
+
+	if rateLimiter.ServiceRate("ec2") != 20 {
+		t.Fatalf("unexpected ec2 rate, got %f expected %d", rateLimiter.ServiceRate("ec2"), 20)
+	}
+
+	if rateLimiter.ServiceRate("rds") != 5 {
+		t.Fatalf("unexpected default rate, got %f expected %d", rateLimiter.ServiceRate("rds"), 5)
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+
+	rateLimiter := NewRateLimiter(config.RateLimitConfig{
+		Services: map[string]float64{
+			"ec2": 10,
+		},
+	})
+
+	ctx := context.Background()
+	start := time.Now()
+
+	// the first 10 requests use the bucket burst, the next 5 wait for 100ms each
+	for i := 0; i < 15; i++ {
+		if err := rateLimiter.Wait(ctx, "account", "us-east-1", "ec2"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	elapsed := time.Since(start)
+	if elapsed < time.Millisecond*400 {
+		t.Fatalf("unexpected rate limit wait time, got %s expected at least %s", elapsed, time.Millisecond*400)
+	}
+
+	// unlimited service, and a different region bucket are not affected
+	start = time.Now()
+	for i := 0; i < 10; i++ {
+		_ = rateLimiter.Wait(ctx, "account", "us-east-1", "rds")
+		_ = rateLimiter.Wait(ctx, "account", "us-west-2", "ec2")
+	}
+	if time.Since(start) > time.Millisecond*400 {
+		t.Fatalf("unexpected rate limit for unlimited service or different region")
+	}
+}
+
+func TestRateLimiterWaitCanceled(t *testing.T) {
+
+	rateLimiter := NewRateLimiter(config.RateLimitConfig{
+		Default: 0.1,
+	})
+
+	ctx, cancelFn := context.WithCancel(context.Background())
+	cancelFn()
+
+	_ = rateLimiter.Wait(ctx, "account", "us-east-1", "ec2")
+	if err := rateLimiter.Wait(ctx, "account", "us-east-1", "ec2"); err == nil {
+		t.Fatalf("expected context error when the context is canceled")
+	}
+}
@@ -44,11 +44,10 @@ func init() {
 func NewIAMUseranager(awsManager common.AWSManager, client interface{}) (common.ResourceDetection, error) {
 
 	resourceName := awsManager.GetResourceIdentifier("iam_users")
-	if awsManager.IsGlobalSet(resourceName) {
+	if !awsManager.TrySetGlobal(resourceName) {
 		log.Info("resource defined ad global resource")
 		return nil, nil
 	}
-	awsManager.SetGlobal(resourceName)
 
 	if client == nil {
 		client = iam.New(awsManager.GetSession())
@@ -2,9 +2,12 @@ package aws
 
 import (
 	"finala/collector"
+	"finala/collector/aws/common"
 	"finala/collector/aws/register"
 	_ "finala/collector/aws/resources"
 	"finala/collector/config"
+	"sort"
+	"sync"
 
 	"github.com/aws/aws-sdk-go/service/sts"
 	log "github.com/sirupsen/logrus"
@@ -20,51 +23,116 @@ type Analyze struct {
 	cl            collector.CollectorDescriber
 	metricManager collector.MetricDescriptor
 	awsAccounts   []config.AWSAccount
-	global        map[string]struct{}
+	concurrency   config.ConcurrencyConfig
+	rateLimiter   *RateLimiter
+	global        *GlobalResources
 }
 
 // NewAnalyzeManager will charge to execute aws resources
-func NewAnalyzeManager(cl collector.CollectorDescriber, metricsManager collector.MetricDescriptor, awsAccounts []config.AWSAccount) *Analyze {
+func NewAnalyzeManager(cl collector.CollectorDescriber, metricsManager collector.MetricDescriptor, provider config.ProviderConfig) *Analyze {
 	return &Analyze{
 		cl:            cl,
 		metricManager: metricsManager,
-		awsAccounts:   awsAccounts,
-		global:        make(map[string]struct{}),
+		awsAccounts:   provider.Accounts,
+		concurrency:   provider.Concurrency,
+		rateLimiter:   NewRateLimiter(provider.RateLimit),
+		global:        NewGlobalResources(),
 	}
 }
 
-// All will loop on all the aws provider settings, and check from the configuration of the metric should be reported
+// All will loop on all the aws provider settings, and check from the configuration of the metric should be reported.
+// Accounts, regions and resources are analyzed in parallel according to the concurrency configuration
 func (app *Analyze) All() {
 
-	for _, account := range app.awsAccounts {
-
-		awsAuth := NewAuth(account)
-		globalsession, globalConfig := awsAuth.Login("")
-		stsManager := NewSTSManager(sts.New(globalsession, globalConfig))
-
-		for _, region := range account.Regions {
-			resourcesDetection := NewDetectorManager(awsAuth, app.cl, account, stsManager, app.global, region)
-			for resourceType, resourceDetector := range register.GetResources() {
-
-				resource, err := resourceDetector(resourcesDetection, nil)
-				if err != nil {
-					log.Error(err)
-					continue
-				}
-				if resource == nil {
-					continue
-				}
-
-				metrics, err := app.metricManager.IsResourceMetricsEnable(resourceType)
-				if err != nil {
-					continue
-				}
-
-				_, err = resource.Detect(metrics)
-				if err != nil {
-					log.Error("could not detect unused data")
-				}
+	log.WithFields(log.Fields{
+		"accounts":  app.concurrency.Accounts,
+		"regions":   app.concurrency.Regions,
+		"resources": app.concurrency.Resources,
+	}).Info("starting to analyze aws accounts")
+
+	runParallel(len(app.awsAccounts), app.concurrency.Accounts, func(i int) {
+		app.analyzeAccount(app.awsAccounts[i])
+	})
+}
+
+// analyzeAccount analyzes all the regions of the given account
+func (app *Analyze) analyzeAccount(account config.AWSAccount) {
+
+	awsAuth := NewAuth(account)
+	globalsession, globalConfig := awsAuth.Login("")
+	stsManager := NewSTSManager(sts.New(globalsession, globalConfig))
+
+	runParallel(len(account.Regions), app.concurrency.Regions, func(i int) {
+		app.analyzeRegion(awsAuth, account, stsManager, account.Regions[i])
+	})
+}
+
+// analyzeRegion runs all the registered resources detections of the given account region
+func (app *Analyze) analyzeRegion(awsAuth AuthDescriptor, account config.AWSAccount, stsManager *STSManager, region string) {
+
+	resourcesDetection := NewDetectorManager(awsAuth, app.cl, account, stsManager, app.global, app.rateLimiter, region)
+
+	resources := register.GetResources()
+	resourceTypes := make([]string, 0, len(resources))
+	for resourceType := range resources {
+		resourceTypes = append(resourceTypes, resourceType)
+	}
+	sort.Strings(resourceTypes)
+
+	runParallel(len(resourceTypes), app.concurrency.Resources, func(i int) {
+		app.detectResource(resourcesDetection, resourceTypes[i], resources[resourceTypes[i]])
+	})
+}
+
+// detectResource runs the given resource detection
+func (app *Analyze) detectResource(resourcesDetection *DetectorManager, resourceType string, resourceDetector common.DetectResourceMaker) {
+
+	resource, err := resourceDetector(resourcesDetection, nil)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	if resource == nil {
+		return
+	}
+
+	metrics, err := app.metricManager.IsResourceMetricsEnable(resourceType)
+	if err != nil {
+		return
+	}
+
+	_, err = resource.Detect(metrics)
+	if err != nil {
+		log.Error("could not detect unused data")
+	}
+}
+
+// runParallel calls fn for every index in [0, count) using up to concurrency workers.
+// A concurrency lower than 1 runs the calls sequentially
+func runParallel(count, concurrency int, fn func(i int)) {
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > count {
+		concurrency = count
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < concurrency; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				fn(i)
 			}
-		}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		indexes <- i
 	}
+	close(indexes)
+	wg.Wait()
 }
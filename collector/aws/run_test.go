@@ -0,0 +1,81 @@
+package aws
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunParallel(t *testing.T) {
+
+	testCases := []struct {
+		count       int
+		concurrency int
+		expectedMax int32
+	}{
+		{10, 0, 1},
+		{10, 1, 1},
+		{10, 3, 3},
+		{2, 5, 2},
+		{0, 5, 0},
+	}
+
+	for _, test := range testCases {
+		t.Run(fmt.Sprintf("count_%d_concurrency_%d", test.count, test.concurrency), func(t *testing.T) {
+
+			var running, maxRunning int32
+			called := make([]bool, test.count)
+			var mu sync.Mutex
+
+			runParallel(test.count, test.concurrency, func(i int) {
+				current := atomic.AddInt32(&running, 1)
+				mu.Lock()
+				if current > maxRunning {
+					maxRunning = current
+				}
+				called[i] = true
+				mu.Unlock()
+				time.Sleep(time.Millisecond * 20)
+				atomic.AddInt32(&running, -1)
+			})
+
+			if maxRunning != test.expectedMax {
+				t.Fatalf("unexpected max parallel calls, got %d expected %d", maxRunning, test.expectedMax)
+			}
+
+			for i, isCalled := range called {
+				if !isCalled {
+					t.Fatalf("index %d was not called", i)
+				}
+			}
+		})
+	}
+}
+
+func TestGlobalResourcesTrySet(t *testing.T) {
+
+	global := NewGlobalResources()
+
+	var claimed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if global.TrySet("aws_iam_users") {
+				atomic.AddInt32(&claimed, 1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if claimed != 1 {
+		t.Fatalf("unexpected global resource claims, got %d expected %d", claimed, 1)
+	}
+
+	if !global.IsSet("aws_iam_users") {
+		t.Fatalf("expected global resource to be set")
+	}
+}
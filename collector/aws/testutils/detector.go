@@ -77,3 +77,12 @@ func (dm *MockAWSManager) IsGlobalSet(resourceName collector.ResourceIdentifier)
 	return isExists
 
 }
+
+// TrySetGlobal marked resource as global and return true, or return false if the resource was already marked
+func (dm *MockAWSManager) TrySetGlobal(resourceName collector.ResourceIdentifier) bool {
+	if dm.IsGlobalSet(resourceName) {
+		return false
+	}
+	dm.SetGlobal(resourceName)
+	return true
+}
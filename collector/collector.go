@@ -1,13 +1,10 @@
 package collector
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"finala/collector/config"
 	"finala/request"
-	"finala/visibility"
 	"fmt"
-	"net/http"
 	"sync"
 	"time"
 
@@ -35,27 +32,53 @@ type CollectorDescriber interface {
 type CollectorManager struct {
 	collectChan    chan EventCollector
 	collectorMutex *sync.RWMutex
-	request        *request.HTTPClient
+	sender         *eventsSender
 	sendData       []EventCollector
 	sendInterval   time.Duration
 	executionID    string
-	apiEndpoint    string
+	spool          *Spool
+	retry          RetryPolicy
+
+	// failedAttempts counts the consecutive failed deliveries of the current batch
+	failedAttempts int
+	// nextAttempt is the time of the next scheduled retry, zero when no retry is scheduled
+	nextAttempt time.Time
+	// undeliveredBatches counts the batches that were given up
+	undeliveredBatches int
+	// abandonedBatches holds the spool batches that were given up in this execution
+	abandonedBatches map[string]struct{}
 }
 
-// NewCollectorManager create new collector instance
-func NewCollectorManager(ctx context.Context, wg *sync.WaitGroup, req *request.HTTPClient, sendInterval time.Duration, name, apiEndpoint string) *CollectorManager {
+// NewCollectorManager create new collector instance.
+// When a spool directory is configured, every events batch is persisted before it is sent
+// and removed only after the api server acknowledged it.
+// Failed deliveries are retried with backoff according to the api server retry configuration.
+// Events are sent in batches limited by events count and bytes size, optionally gzip compressed.
+func NewCollectorManager(ctx context.Context, wg *sync.WaitGroup, req *request.HTTPClient, apiServer config.APIServerConfig, name string) (*CollectorManager, error) {
+
+	var spool *Spool
+	if apiServer.SpoolDir != "" {
+		var err error
+		spool, err = NewSpool(apiServer.SpoolDir)
+		if err != nil {
+			return nil, err
+		}
+		log.WithField("spool_dir", apiServer.SpoolDir).Info("collector events spool is enabled")
+	}
 
 	wg.Add(2)
 	executionID := fmt.Sprintf("%s_%v", name, time.Now().Unix())
 	log.WithField("id", executionID).Info("generate collector execution id")
 	collectorManager := &CollectorManager{
-		collectChan:    make(chan EventCollector),
-		collectorMutex: &sync.RWMutex{},
-		request:        req,
-		sendData:       []EventCollector{},
-		sendInterval:   sendInterval,
-		executionID:    executionID,
-		apiEndpoint:    apiEndpoint,
+		collectChan:      make(chan EventCollector),
+		collectorMutex:   &sync.RWMutex{},
+		sender:           newEventsSender(req, apiServer),
+		sendData:         []EventCollector{},
+		sendInterval:     apiServer.BulkInterval,
+		executionID:      executionID,
+		spool:            spool,
+		retry:            NewRetryPolicy(apiServer),
+		abandonedBatches: map[string]struct{}{},
 	}
 
 	go func(collectorManager *CollectorManager) {
@@ -75,7 +98,7 @@ func NewCollectorManager(ctx context.Context, wg *sync.WaitGroup, req *request.H
 	go func(collectorManager *CollectorManager) {
 		for {
 			select {
-			case <-time.After(collectorManager.sendInterval):
+			case <-time.After(collectorManager.nextSendDelay()):
 				log.Debug("Send bulk events")
 				collectorManager.sendBulk()
 			case <-ctx.Done():
@@ -87,7 +110,7 @@ func NewCollectorManager(ctx context.Context, wg *sync.WaitGroup, req *request.H
 		}
 	}(collectorManager)
 
-	return collectorManager
+	return collectorManager, nil
 }
 
 // AddResource add resource data
@@ -130,9 +153,18 @@ func (cm *CollectorManager) CollectError(resourceName ResourceIdentifier, err er
 
 // GetCollectorEvent returns current events list
 func (cm *CollectorManager) GetCollectorEvent() []EventCollector {
+	cm.collectorMutex.RLock()
+	defer cm.collectorMutex.RUnlock()
 	return cm.sendData
 }
 
+// UndeliveredBatches returns the number of events batches that could not be delivered to the api server
+func (cm *CollectorManager) UndeliveredBatches() int {
+	cm.collectorMutex.RLock()
+	defer cm.collectorMutex.RUnlock()
+	return cm.undeliveredBatches
+}
+
 // updateServiceStatus add status on resource collector
 func (cm *CollectorManager) updateServiceStatus(data EventCollector) {
 	data.EventType = eventServiceStatus
@@ -143,63 +175,249 @@ func (cm *CollectorManager) updateServiceStatus(data EventCollector) {
 // collect append all the given event to the one array of events
 func (cm *CollectorManager) saveEvent(data EventCollector) {
 
-	cm.collectorMutex.RLock()
-	defer cm.collectorMutex.RUnlock()
+	cm.collectorMutex.Lock()
+	defer cm.collectorMutex.Unlock()
 	cm.sendData = append(cm.sendData, data)
 }
 
 // sendBulk will send all event data to to api server.
 func (cm *CollectorManager) sendBulk() bool {
 
-	cm.collectorMutex.RLock()
-	defer cm.collectorMutex.RUnlock()
+	cm.collectorMutex.Lock()
+	defer cm.collectorMutex.Unlock()
 
-	status := cm.send(cm.sendData)
-	if status {
-		cm.sendData = []EventCollector{}
+	if cm.spool != nil {
+		return cm.sendSpool()
 	}
 
-	return status
+	if len(cm.sendData) == 0 {
+		log.Debug("skip send events")
+		return false
+	}
 
-}
+	status := true
+	for _, batch := range cm.sender.encodeBatches(cm.sendData) {
+		err := cm.sender.post(cm.executionID, batch.body)
+		if err == nil {
+			cm.resetAttempts()
+			cm.sendData = cm.sendData[batch.events:]
+			continue
+		}
 
-// gracefulShutdown will send the last events
-func (cm *CollectorManager) gracefulShutdown() {
+		status = false
+		if cm.scheduleRetry(err) {
+			return false
+		}
 
-	time.Sleep(cm.sendInterval)
-	if len(cm.sendData) > 0 {
-		log.WithField("event_count", len(cm.sendData)).Info("Found more event to send")
-		cm.sendBulk()
-		cm.gracefulShutdown()
+		log.WithField("event_count", batch.events).Error("dropping undelivered events")
+		cm.sendData = cm.sendData[batch.events:]
 	}
 
+	cm.sendData = []EventCollector{}
+	return status
+
 }
 
-// send will get all the events and send them to the api server
-func (cm *CollectorManager) send(events []EventCollector) bool {
+// sendSpool persists the in-memory events as new spool batches and sends all the pending batches
+// of the current execution. Batches are sent by creation order and a retryable failure stops the loop
+// in order to keep the events order on the api server.
+func (cm *CollectorManager) sendSpool() bool {
+
+	for _, batch := range cm.sender.encodeBatches(cm.sendData) {
+		if _, err := cm.spool.Write(cm.executionID, batch.body); err != nil {
+			log.WithError(err).Error("could not persist events batch to spool")
+			if !cm.scheduleRetry(err) {
+				log.WithField("event_count", len(cm.sendData)).Error("dropping undelivered events")
+				cm.sendData = []EventCollector{}
+			}
+			return false
+		}
+		cm.sendData = cm.sendData[batch.events:]
+	}
+
+	batches, err := cm.pendingBatches()
+	if err != nil {
+		log.WithError(err).Error("could not list spool batches")
+		return false
+	}
 
-	if len(events) == 0 {
+	if len(batches) == 0 {
 		log.Debug("skip send events")
 		return false
 	}
 
-	buf, err := json.Marshal(events)
-	if err != nil {
-		log.Fatal(err)
+	status := true
+	for _, batch := range batches {
+		err := sendSpoolBatch(cm.sender, cm.spool, batch)
+		if err == nil {
+			cm.resetAttempts()
+			continue
+		}
+
+		status = false
+		if cm.scheduleRetry(err) {
+			break
+		}
+
+		log.WithField("batch", batch.Path).Error("events batch was kept in spool, it can be re-sent with the collector replay command")
+		cm.abandonedBatches[batch.Path] = struct{}{}
 	}
-	req, err := cm.request.Request("POST", fmt.Sprintf("%s/api/v1/detect-events/%s", cm.apiEndpoint, cm.executionID), nil, bytes.NewBuffer(buf))
+
+	return status
+}
+
+// pendingBatches returns the spool batches of the current execution that were not given up
+func (cm *CollectorManager) pendingBatches() ([]SpoolBatch, error) {
+
+	batches, err := cm.spool.List(cm.executionID)
 	if err != nil {
-		log.WithError(err).Error("could not create HTTP client request")
+		return nil, err
+	}
+
+	pending := []SpoolBatch{}
+	for _, batch := range batches {
+		if _, abandoned := cm.abandonedBatches[batch.Path]; !abandoned {
+			pending = append(pending, batch)
+		}
+	}
+
+	return pending, nil
+}
+
+// scheduleRetry schedules the next attempt of a failed delivery. It returns false when the batch
+// was given up, either because the failure is fatal or the delivery attempts were exhausted.
+func (cm *CollectorManager) scheduleRetry(err error) bool {
+
+	cm.failedAttempts++
+	logger := log.WithError(err).WithFields(log.Fields{
+		"attempt":      cm.failedAttempts,
+		"max_attempts": cm.retry.MaxAttempts,
+	})
+
+	if !IsRetryable(err) {
+		logger.Error("events delivery failed with a non retryable error, giving up")
+		cm.giveUp()
 		return false
 	}
-	req.Header.Set("Content-Type", "application/json")
-	defer visibility.Elapsed("api webserver request")()
-	res, err := cm.request.DO(req)
 
+	if cm.failedAttempts >= cm.retry.MaxAttempts {
+		logger.Error("events delivery attempts exhausted, giving up")
+		cm.giveUp()
+		return false
+	}
+
+	backoff := cm.retry.BackoffDuration(cm.failedAttempts)
+	cm.nextAttempt = time.Now().Add(backoff)
+	logger.WithField("retry_in", backoff).Warn("events delivery failed, retrying")
+	return true
+}
+
+// giveUp marks the current batch as undelivered and resets the retry state for the next batch
+func (cm *CollectorManager) giveUp() {
+	cm.undeliveredBatches++
+	cm.resetAttempts()
+}
+
+// resetAttempts clears the retry state
+func (cm *CollectorManager) resetAttempts() {
+	cm.failedAttempts = 0
+	cm.nextAttempt = time.Time{}
+}
+
+// nextSendDelay returns the wait time until the next delivery, a scheduled retry comes before the bulk interval
+func (cm *CollectorManager) nextSendDelay() time.Duration {
+
+	if cm.nextAttempt.IsZero() {
+		return cm.sendInterval
+	}
+
+	delay := time.Until(cm.nextAttempt)
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// hasPendingEvents returns true if there are events that were not acknowledged by the api server
+func (cm *CollectorManager) hasPendingEvents() bool {
+
+	cm.collectorMutex.RLock()
+	defer cm.collectorMutex.RUnlock()
+
+	if len(cm.sendData) > 0 {
+		return true
+	}
+
+	if cm.spool == nil {
+		return false
+	}
+
+	batches, err := cm.pendingBatches()
 	if err != nil {
-		log.WithError(err).Error("could not send HTTP client request")
+		log.WithError(err).Error("could not list spool batches")
 		return false
 	}
 
-	return res.StatusCode == http.StatusAccepted
+	return len(batches) > 0
+}
+
+// gracefulShutdown will send the last events until all of them were delivered or the max shutdown duration passed
+func (cm *CollectorManager) gracefulShutdown() {
+
+	deadline := time.Now().Add(cm.retry.MaxShutdownDuration)
+	for {
+		delay := cm.nextSendDelay()
+		if remaining := time.Until(deadline); delay > remaining {
+			delay = remaining
+		}
+		time.Sleep(delay)
+
+		if !cm.hasPendingEvents() {
+			return
+		}
+
+		if !time.Now().Before(deadline) {
+			cm.abortPending()
+			return
+		}
+
+		log.Info("Found more event to send")
+		cm.sendBulk()
+	}
+
+}
+
+// abortPending gives up all the events that were not delivered until the shutdown deadline.
+// When the spool is enabled the in-memory events are persisted, so they can be replayed later.
+func (cm *CollectorManager) abortPending() {
+
+	cm.collectorMutex.Lock()
+	defer cm.collectorMutex.Unlock()
+
+	logger := log.WithField("max_shutdown_duration", cm.retry.MaxShutdownDuration)
+
+	batches := cm.sender.encodeBatches(cm.sendData)
+	cm.sendData = []EventCollector{}
+
+	if cm.spool == nil {
+		logger.WithField("batches", len(batches)).Error("shutdown deadline exceeded, dropping undelivered events")
+		cm.undeliveredBatches += len(batches)
+		return
+	}
+
+	for _, batch := range batches {
+		if _, err := cm.spool.Write(cm.executionID, batch.body); err != nil {
+			logger.WithError(err).WithField("event_count", batch.events).Error("could not persist events batch to spool")
+			cm.undeliveredBatches++
+		}
+	}
+
+	pending, err := cm.pendingBatches()
+	if err != nil {
+		logger.WithError(err).Error("could not list spool batches")
+		return
+	}
+
+	cm.undeliveredBatches += len(pending)
+	logger.WithField("pending_batches", len(pending)).Error("shutdown deadline exceeded, events batches were kept in spool")
 }
@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"finala/collector"
+	"finala/collector/config"
 	"finala/request"
 	"fmt"
 	"io"
@@ -49,9 +50,19 @@ func (rd *ReceivedData) HandleRequestHandler(resp http.ResponseWriter, req *http
 
 func newCollector(wg *sync.WaitGroup, ctx context.Context, port int) *collector.CollectorManager {
 
+	return newCollectorWithConfig(wg, ctx, config.APIServerConfig{
+		BulkInterval: time.Duration(time.Second * 1),
+		Addr:         fmt.Sprintf("http://127.0.0.1:%d", port),
+	})
+}
+
+func newCollectorWithConfig(wg *sync.WaitGroup, ctx context.Context, apiServer config.APIServerConfig) *collector.CollectorManager {
+
 	req := request.NewHTTPClient()
-	duration := time.Duration(time.Second * 1)
-	coll := collector.NewCollectorManager(ctx, wg, req, duration, "collector_name", fmt.Sprintf("http://127.0.0.1:%d", port))
+	coll, err := collector.NewCollectorManager(ctx, wg, req, apiServer, "collector_name")
+	if err != nil {
+		log.Fatal(err)
+	}
 	return coll
 }
 func TestAddEvent(t *testing.T) {
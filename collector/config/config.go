@@ -43,16 +43,51 @@ type MetricConfig struct {
 	Constraint  MetricConstraintConfig    `yaml:"constraint"`
 }
 
+// ConcurrencyConfig describe how many detections run in parallel on each level
+type ConcurrencyConfig struct {
+	Accounts  int `yaml:"accounts"`
+	Regions   int `yaml:"regions"`
+	Resources int `yaml:"resources"`
+}
+
+// RateLimitConfig describe the allowed provider API requests per second.
+// Services are keyed by the AWS endpoint prefix (e.g. ec2, rds, monitoring), 0 means unlimited
+type RateLimitConfig struct {
+	Default  float64            `yaml:"default"`
+	Services map[string]float64 `yaml:"services"`
+}
+
 // ProviderConfig describe the available providers
 type ProviderConfig struct {
-	Accounts []AWSAccount              `yaml:"accounts"`
-	Metrics  map[string][]MetricConfig `yaml:"metrics"`
+	Accounts    []AWSAccount              `yaml:"accounts"`
+	Metrics     map[string][]MetricConfig `yaml:"metrics"`
+	Concurrency ConcurrencyConfig         `yaml:"concurrency"`
+	RateLimit   RateLimitConfig           `yaml:"rate_limit"`
 }
 
 // APIServerConfig descrive the api configuration
 type APIServerConfig struct {
 	BulkInterval time.Duration `yaml:"bulk_interval"`
 	Addr         string        `yaml:"address"`
+	// SpoolDir is the directory where events batches are persisted until the api server acknowledges them.
+	// When empty, events are kept in memory only.
+	SpoolDir string `yaml:"spool_dir"`
+	// MaxAttempts is the number of delivery attempts of an events batch before giving up
+	MaxAttempts int `yaml:"max_attempts"`
+	// RetryBackoff is the wait time before the first retry, it doubles on every failed attempt
+	RetryBackoff time.Duration `yaml:"retry_backoff"`
+	// MaxRetryBackoff is the upper bound of the wait time between retries
+	MaxRetryBackoff time.Duration `yaml:"max_retry_backoff"`
+	// MaxShutdownDuration is how long the collector keeps sending events after the collection finished
+	MaxShutdownDuration time.Duration `yaml:"max_shutdown_duration"`
+	// MaxBatchEvents is the max number of events sent in a single request
+	MaxBatchEvents int `yaml:"max_batch_events"`
+	// MaxBatchBytes is the max size in bytes of a single request body before compression
+	MaxBatchBytes int `yaml:"max_batch_bytes"`
+	// Gzip compresses the requests body with gzip
+	Gzip bool `yaml:"gzip"`
+	// APIKey authenticates the collector on the api server events ingestion
+	APIKey string `yaml:"api_key"`
 }
 
 // CollectorConfig present the application config
@@ -0,0 +1,101 @@
+package collector
+
+import (
+	"errors"
+	"finala/collector/config"
+	"finala/request"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+const (
+	// defaultMaxAttempts defines the default number of delivery attempts of an events batch
+	defaultMaxAttempts = 5
+
+	// defaultRetryBackoff defines the default wait time before the first retry
+	defaultRetryBackoff = time.Second
+
+	// defaultMaxRetryBackoff defines the default upper bound of the wait time between retries
+	defaultMaxRetryBackoff = time.Minute
+
+	// defaultMaxShutdownDuration defines the default time the collector keeps sending events after the collection finished
+	defaultMaxShutdownDuration = 5 * time.Minute
+)
+
+// ErrInvalidRequest defines the error when the events request could not be created
+var ErrInvalidRequest = errors.New("could not create events request")
+
+// RetryPolicy describe how failed events deliveries are retried
+type RetryPolicy struct {
+	MaxAttempts         int
+	Backoff             time.Duration
+	MaxBackoff          time.Duration
+	MaxShutdownDuration time.Duration
+}
+
+// NewRetryPolicy creates the retry policy from the api server configuration, missing values are set to defaults
+func NewRetryPolicy(apiServer config.APIServerConfig) RetryPolicy {
+
+	policy := RetryPolicy{
+		MaxAttempts:         apiServer.MaxAttempts,
+		Backoff:             apiServer.RetryBackoff,
+		MaxBackoff:          apiServer.MaxRetryBackoff,
+		MaxShutdownDuration: apiServer.MaxShutdownDuration,
+	}
+
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = defaultMaxAttempts
+	}
+	if policy.Backoff <= 0 {
+		policy.Backoff = defaultRetryBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = defaultMaxRetryBackoff
+	}
+	if policy.MaxBackoff < policy.Backoff {
+		policy.MaxBackoff = policy.Backoff
+	}
+	if policy.MaxShutdownDuration <= 0 {
+		policy.MaxShutdownDuration = defaultMaxShutdownDuration
+	}
+
+	return policy
+}
+
+// BackoffDuration returns the wait time before the next attempt, given the number of failed attempts.
+// The wait time grows exponentially up to MaxBackoff, and a random jitter of up to half
+// of the duration is subtracted to avoid collectors retrying at the same moment.
+func (rp RetryPolicy) BackoffDuration(failedAttempts int) time.Duration {
+
+	duration := rp.Backoff
+	for i := 1; i < failedAttempts && duration < rp.MaxBackoff; i++ {
+		duration *= 2
+	}
+	if duration > rp.MaxBackoff {
+		duration = rp.MaxBackoff
+	}
+
+	half := int64(duration / 2)
+	if half <= 0 {
+		return duration
+	}
+
+	return duration - time.Duration(rand.Int63n(half+1))
+}
+
+// IsRetryable returns true when a failed delivery may succeed on a later attempt.
+// Network errors, 5xx and 429 responses are retryable, any other failure is fatal.
+func IsRetryable(err error) bool {
+
+	if errors.Is(err, ErrInvalidRequest) {
+		return false
+	}
+
+	var httpErr *request.HttpError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= http.StatusInternalServerError || httpErr.StatusCode == http.StatusTooManyRequests
+	}
+
+	return true
+}
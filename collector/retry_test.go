@@ -0,0 +1,154 @@
+package collector_test
+
+import (
+	"context"
+	"errors"
+	"finala/collector"
+	"finala/collector/config"
+	"finala/request"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewRetryPolicyDefaults(t *testing.T) {
+
+	policy := collector.NewRetryPolicy(config.APIServerConfig{})
+	if policy.MaxAttempts <= 0 || policy.Backoff <= 0 || policy.MaxBackoff <= 0 || policy.MaxShutdownDuration <= 0 {
+		t.Fatalf("unexpected retry policy defaults, got %+v", policy)
+	}
+
+	policy = collector.NewRetryPolicy(config.APIServerConfig{
+		MaxAttempts:     3,
+		RetryBackoff:    time.Second * 10,
+		MaxRetryBackoff: time.Second,
+	})
+	if policy.MaxAttempts != 3 {
+		t.Fatalf("unexpected max attempts, got %d expected %d", policy.MaxAttempts, 3)
+	}
+	if policy.MaxBackoff != policy.Backoff {
+		t.Fatalf("unexpected max backoff, got %s expected %s", policy.MaxBackoff, policy.Backoff)
+	}
+}
+
+func TestBackoffDuration(t *testing.T) {
+
+	policy := collector.RetryPolicy{
+		MaxAttempts: 10,
+		Backoff:     time.Second,
+		MaxBackoff:  time.Second * 8,
+	}
+
+	testCases := []struct {
+		failedAttempts int
+		max            time.Duration
+	}{
+		{1, time.Second},
+		{2, time.Second * 2},
+		{3, time.Second * 4},
+		{4, time.Second * 8},
+		{9, time.Second * 8},
+	}
+
+	for _, test := range testCases {
+		t.Run(fmt.Sprintf("attempt_%d", test.failedAttempts), func(t *testing.T) {
+			duration := policy.BackoffDuration(test.failedAttempts)
+			if duration > test.max || duration < test.max/2 {
+				t.Fatalf("unexpected backoff duration, got %s expected between %s and %s", duration, test.max/2, test.max)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+
+	testCases := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"network", errors.New("connection refused"), true},
+		{"server_error", &request.HttpError{StatusCode: http.StatusBadGateway}, true},
+		{"too_many_requests", &request.HttpError{StatusCode: http.StatusTooManyRequests}, true},
+		{"bad_request", &request.HttpError{StatusCode: http.StatusBadRequest}, false},
+		{"unauthorized", &request.HttpError{StatusCode: http.StatusUnauthorized}, false},
+		{"invalid_request", fmt.Errorf("%w: bad url", collector.ErrInvalidRequest), false},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			if collector.IsRetryable(test.err) != test.expected {
+				t.Fatalf("unexpected retryable result for %v, expected %t", test.err, test.expected)
+			}
+		})
+	}
+}
+
+func TestAddEventFatalResponse(t *testing.T) {
+
+	var wg sync.WaitGroup
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	coll := newCollectorWithConfig(&wg, ctx, config.APIServerConfig{
+		BulkInterval: time.Second,
+		Addr:         ts.URL,
+	})
+
+	coll.CollectStart(collector.ResourceIdentifier("test"))
+	time.Sleep(time.Millisecond * 1500)
+
+	if len(coll.GetCollectorEvent()) != 0 {
+		t.Fatalf("unexpected collector events after fatal response, got %d, expected %d", len(coll.GetCollectorEvent()), 0)
+	}
+
+	if coll.UndeliveredBatches() != 1 {
+		t.Fatalf("unexpected undelivered batches, got %d, expected %d", coll.UndeliveredBatches(), 1)
+	}
+}
+
+func TestGracefulShutdownDeadline(t *testing.T) {
+
+	var wg sync.WaitGroup
+	ctx, cancelFn := context.WithCancel(context.Background())
+
+	ts := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	coll := newCollectorWithConfig(&wg, ctx, config.APIServerConfig{
+		BulkInterval:        time.Millisecond * 100,
+		Addr:                ts.URL,
+		MaxAttempts:         100,
+		RetryBackoff:        time.Millisecond * 100,
+		MaxShutdownDuration: time.Millisecond * 500,
+	})
+
+	coll.CollectStart(collector.ResourceIdentifier("test"))
+	cancelFn()
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatalf("graceful shutdown did not stop after the max shutdown duration")
+	}
+
+	if coll.UndeliveredBatches() != 1 {
+		t.Fatalf("unexpected undelivered batches, got %d, expected %d", coll.UndeliveredBatches(), 1)
+	}
+}
@@ -0,0 +1,176 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"finala/collector/config"
+	"finala/request"
+	"finala/visibility"
+	"fmt"
+	"io"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultMaxBatchEvents defines the default max number of events in a single request
+	defaultMaxBatchEvents = 1000
+
+	// defaultMaxBatchBytes defines the default max size of a single request body before compression
+	defaultMaxBatchBytes = 4 * 1024 * 1024
+)
+
+// eventsBatch describe an encoded events batch
+type eventsBatch struct {
+	events int
+	body   []byte
+}
+
+// eventsSender sends encoded events batches to the api server
+type eventsSender struct {
+	request        *request.HTTPClient
+	apiEndpoint    string
+	apiKey         string
+	gzip           bool
+	maxBatchEvents int
+	maxBatchBytes  int
+}
+
+// newEventsSender creates new events sender from the api server configuration, missing values are set to defaults
+func newEventsSender(req *request.HTTPClient, apiServer config.APIServerConfig) *eventsSender {
+
+	sender := &eventsSender{
+		request:        req,
+		apiEndpoint:    apiServer.Addr,
+		apiKey:         apiServer.APIKey,
+		gzip:           apiServer.Gzip,
+		maxBatchEvents: apiServer.MaxBatchEvents,
+		maxBatchBytes:  apiServer.MaxBatchBytes,
+	}
+
+	if sender.maxBatchEvents <= 0 {
+		sender.maxBatchEvents = defaultMaxBatchEvents
+	}
+	if sender.maxBatchBytes <= 0 {
+		sender.maxBatchBytes = defaultMaxBatchBytes
+	}
+
+	return sender
+}
+
+// encodeBatches encodes the given events into JSON arrays, each one limited by the events count and the bytes size.
+// An event bigger than the bytes limit is encoded in its own batch.
+func (s *eventsSender) encodeBatches(events []EventCollector) []eventsBatch {
+
+	batches := []eventsBatch{}
+	current := eventsBatch{body: []byte{'['}}
+
+	for _, event := range events {
+		buf, err := json.Marshal(event)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// the batch size includes the closing bracket and the separator before the event
+		size := len(current.body) + len(buf) + 2
+		if current.events > 0 && (current.events >= s.maxBatchEvents || size > s.maxBatchBytes) {
+			current.body = append(current.body, ']')
+			batches = append(batches, current)
+			current = eventsBatch{body: []byte{'['}}
+		}
+
+		if current.events > 0 {
+			current.body = append(current.body, ',')
+		}
+		current.body = append(current.body, buf...)
+		current.events++
+	}
+
+	if current.events > 0 {
+		current.body = append(current.body, ']')
+		batches = append(batches, current)
+	}
+
+	return batches
+}
+
+// batchFailures describes the api server response when some events of a batch could not be saved
+type batchFailures struct {
+	Saved  int `json:"saved"`
+	Failed []struct {
+		Index int    `json:"index"`
+		Error string `json:"error"`
+	} `json:"failed"`
+}
+
+// logRejectedEvents logs the events of a batch that were rejected by the api server. Rejected events are
+// not sent again since the same events would be rejected again
+func (s *eventsSender) logRejectedEvents(executionID string, body io.Reader) {
+	failures := batchFailures{}
+	if err := json.NewDecoder(body).Decode(&failures); err != nil {
+		log.WithError(err).Warn("some events were rejected by the api server")
+		return
+	}
+	for _, failure := range failures.Failed {
+		log.WithFields(log.Fields{
+			"execution_id": executionID,
+			"event":        failure.Index,
+			"error":        failure.Error,
+		}).Warn("event was rejected by the api server")
+	}
+}
+
+// post sends the encoded events of the given execution to the api server
+func (s *eventsSender) post(executionID string, body []byte) error {
+
+	contentEncoding := ""
+	if s.gzip {
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		if _, err := writer.Write(body); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+		}
+		if err := writer.Close(); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+		}
+		body = compressed.Bytes()
+		contentEncoding = "gzip"
+	}
+
+	httpRequest, err := s.request.Request("POST", fmt.Sprintf("%s/api/v1/detect-events/%s", s.apiEndpoint, executionID), nil, bytes.NewBuffer(body))
+	if err != nil {
+		log.WithError(err).Error("could not create HTTP client request")
+		return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+	if contentEncoding != "" {
+		httpRequest.Header.Set("Content-Encoding", contentEncoding)
+	}
+	if s.apiKey != "" {
+		httpRequest.Header.Set("X-API-Key", s.apiKey)
+	}
+	defer visibility.Elapsed("api webserver request")()
+	res, err := s.request.DO(httpRequest)
+
+	if err != nil {
+		log.WithError(err).Error("could not send HTTP client request")
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusMultiStatus {
+		s.logRejectedEvents(executionID, res.Body)
+		return nil
+	}
+
+	if res.StatusCode != http.StatusAccepted {
+		return &request.HttpError{
+			Status:     res.Status,
+			StatusCode: res.StatusCode,
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,172 @@
+package collector_test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"finala/collector"
+	"finala/collector/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type batchReceiver struct {
+	mu           sync.Mutex
+	requests     int
+	events       int
+	gzipRequests int
+}
+
+func (br *batchReceiver) handler(resp http.ResponseWriter, req *http.Request) {
+
+	body := io.Reader(req.Body)
+	isGzip := req.Header.Get("Content-Encoding") == "gzip"
+	if isGzip {
+		gzipReader, err := gzip.NewReader(req.Body)
+		if err != nil {
+			resp.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body = gzipReader
+	}
+
+	var events []DetectEvents
+	if err := json.NewDecoder(body).Decode(&events); err != nil {
+		resp.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	br.mu.Lock()
+	br.requests++
+	br.events += len(events)
+	if isGzip {
+		br.gzipRequests++
+	}
+	br.mu.Unlock()
+	resp.WriteHeader(http.StatusAccepted)
+}
+
+func TestSendBatches(t *testing.T) {
+
+	testCases := []struct {
+		name             string
+		apiServer        config.APIServerConfig
+		expectedRequests int
+		expectedGzip     int
+	}{
+		{"single_batch", config.APIServerConfig{}, 1, 0},
+		{"max_events", config.APIServerConfig{MaxBatchEvents: 2}, 2, 0},
+		{"max_bytes", config.APIServerConfig{MaxBatchBytes: 10}, 3, 0},
+		{"gzip", config.APIServerConfig{Gzip: true}, 1, 1},
+	}
+
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+
+			var wg sync.WaitGroup
+			ctx, cancelFn := context.WithCancel(context.Background())
+			defer cancelFn()
+
+			receiver := &batchReceiver{}
+			ts := httptest.NewServer(http.HandlerFunc(receiver.handler))
+			defer ts.Close()
+
+			test.apiServer.BulkInterval = time.Second
+			test.apiServer.Addr = ts.URL
+			coll := newCollectorWithConfig(&wg, ctx, test.apiServer)
+
+			coll.CollectStart(collector.ResourceIdentifier("test"))
+			coll.AddResource(collector.EventCollector{ResourceName: "test1", Data: "test data"})
+			coll.CollectFinish(collector.ResourceIdentifier("test"))
+			time.Sleep(time.Millisecond * 1500)
+
+			receiver.mu.Lock()
+			defer receiver.mu.Unlock()
+			if receiver.events != 3 {
+				t.Fatalf("unexpected received events, got %d expected %d", receiver.events, 3)
+			}
+			if receiver.requests != test.expectedRequests {
+				t.Fatalf("unexpected requests count, got %d expected %d", receiver.requests, test.expectedRequests)
+			}
+			if receiver.gzipRequests != test.expectedGzip {
+				t.Fatalf("unexpected gzip requests count, got %d expected %d", receiver.gzipRequests, test.expectedGzip)
+			}
+		})
+	}
+}
+
+func TestSendAPIKey(t *testing.T) {
+
+	var wg sync.WaitGroup
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	var mu sync.Mutex
+	apiKeys := []string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		apiKeys = append(apiKeys, req.Header.Get("X-API-Key"))
+		mu.Unlock()
+		resp.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	coll := newCollectorWithConfig(&wg, ctx, config.APIServerConfig{
+		BulkInterval: time.Second,
+		Addr:         ts.URL,
+		APIKey:       "fck_test",
+	})
+
+	coll.CollectStart(collector.ResourceIdentifier("test"))
+	time.Sleep(time.Millisecond * 1500)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(apiKeys) == 0 {
+		t.Fatalf("expected events request to be sent")
+	}
+	for _, apiKey := range apiKeys {
+		if apiKey != "fck_test" {
+			t.Fatalf("unexpected api key header, got %s expected %s", apiKey, "fck_test")
+		}
+	}
+}
+
+func TestSendPartialFailure(t *testing.T) {
+
+	var wg sync.WaitGroup
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	var mu sync.Mutex
+	requests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		resp.WriteHeader(http.StatusMultiStatus)
+		_, _ = resp.Write([]byte(`{"saved": 0, "failed": [{"index": 0, "error": "invalid document id"}]}`))
+	}))
+	defer ts.Close()
+
+	coll := newCollectorWithConfig(&wg, ctx, config.APIServerConfig{
+		BulkInterval: time.Second,
+		Addr:         ts.URL,
+	})
+
+	coll.CollectStart(collector.ResourceIdentifier("test"))
+	time.Sleep(time.Millisecond * 1500)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 1 {
+		t.Fatalf("unexpected requests count, got %d expected %d", requests, 1)
+	}
+	if coll.UndeliveredBatches() != 0 {
+		t.Fatalf("unexpected undelivered batches, got %d, expected %d", coll.UndeliveredBatches(), 0)
+	}
+}
@@ -0,0 +1,221 @@
+package collector
+
+import (
+	"finala/collector/config"
+	"finala/request"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// spoolBatchExtension describe the file extension of a persisted events batch
+	spoolBatchExtension = ".json"
+
+	// spoolTempExtension describe the file extension of a batch that was not fully written yet
+	spoolTempExtension = ".tmp"
+)
+
+// SpoolBatch describe a persisted events batch that waits to be sent to the api server
+type SpoolBatch struct {
+	ExecutionID string
+	Path        string
+}
+
+// Spool persists events batches on disk until the api server acknowledges them
+type Spool struct {
+	dir string
+}
+
+// NewSpool creates the spool directory (if not exists) and returns a spool instance
+func NewSpool(dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("could not create spool directory %s: %w", dir, err)
+	}
+
+	return &Spool{
+		dir: dir,
+	}, nil
+}
+
+// Write persists the given encoded events batch under the execution directory.
+// The batch is written to a temporary file first and renamed once synced, so a
+// crash never leaves a partial batch behind.
+func (s *Spool) Write(executionID string, body []byte) (SpoolBatch, error) {
+
+	executionDir := filepath.Join(s.dir, executionID)
+	if err := os.MkdirAll(executionDir, 0750); err != nil {
+		return SpoolBatch{}, err
+	}
+
+	path := filepath.Join(executionDir, fmt.Sprintf("%020d%s", time.Now().UnixNano(), spoolBatchExtension))
+	tempPath := path + spoolTempExtension
+
+	file, err := os.OpenFile(tempPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return SpoolBatch{}, err
+	}
+
+	_, err = file.Write(body)
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tempPath)
+		return SpoolBatch{}, err
+	}
+
+	if err := os.Rename(tempPath, path); err != nil {
+		_ = os.Remove(tempPath)
+		return SpoolBatch{}, err
+	}
+
+	return SpoolBatch{
+		ExecutionID: executionID,
+		Path:        path,
+	}, nil
+}
+
+// Read returns the encoded events of the given batch
+func (s *Spool) Read(batch SpoolBatch) ([]byte, error) {
+	return os.ReadFile(batch.Path)
+}
+
+// Remove deletes the given batch, and the execution directory once it is empty
+func (s *Spool) Remove(batch SpoolBatch) error {
+	if err := os.Remove(batch.Path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// The directory removal fails while other batches still exist, which is expected
+	_ = os.Remove(filepath.Dir(batch.Path))
+	return nil
+}
+
+// List returns the pending batches of the given execution ordered by creation time.
+// When executionID is empty, the pending batches of all executions are returned.
+func (s *Spool) List(executionID string) ([]SpoolBatch, error) {
+
+	batches := []SpoolBatch{}
+
+	executionIDs := []string{executionID}
+	if executionID == "" {
+		entries, err := os.ReadDir(s.dir)
+		if err != nil {
+			return batches, err
+		}
+
+		executionIDs = []string{}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				executionIDs = append(executionIDs, entry.Name())
+			}
+		}
+	}
+
+	for _, id := range executionIDs {
+		entries, err := os.ReadDir(filepath.Join(s.dir, id))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return batches, err
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.HasSuffix(entry.Name(), spoolBatchExtension) {
+				continue
+			}
+			batches = append(batches, SpoolBatch{
+				ExecutionID: id,
+				Path:        filepath.Join(s.dir, id, entry.Name()),
+			})
+		}
+	}
+
+	sort.SliceStable(batches, func(i, j int) bool {
+		return filepath.Base(batches[i].Path) < filepath.Base(batches[j].Path)
+	})
+
+	return batches, nil
+}
+
+// ReplaySpool sends all the batches that remained in the spool from previous executions.
+// Each execution is replayed separately, so one unreachable execution does not block the others.
+// It returns the number of delivered batches.
+func ReplaySpool(req *request.HTTPClient, apiServer config.APIServerConfig, spool *Spool) (int, error) {
+
+	sender := newEventsSender(req, apiServer)
+
+	batches, err := spool.List("")
+	if err != nil {
+		return 0, err
+	}
+
+	executionIDs := []string{}
+	executionBatches := map[string][]SpoolBatch{}
+	for _, batch := range batches {
+		if _, found := executionBatches[batch.ExecutionID]; !found {
+			executionIDs = append(executionIDs, batch.ExecutionID)
+		}
+		executionBatches[batch.ExecutionID] = append(executionBatches[batch.ExecutionID], batch)
+	}
+
+	var replayErr error
+	total := 0
+	for _, executionID := range executionIDs {
+		sent, err := sendSpoolBatches(sender, spool, executionBatches[executionID])
+		total += sent
+
+		logger := log.WithFields(log.Fields{
+			"execution_id": executionID,
+			"sent":         sent,
+			"batches":      len(executionBatches[executionID]),
+		})
+		if err != nil {
+			logger.WithError(err).Error("could not replay execution spool batches")
+			replayErr = err
+			continue
+		}
+		logger.Info("execution spool batches replayed")
+	}
+
+	return total, replayErr
+}
+
+// sendSpoolBatches sends the given batches by order and removes every acknowledged batch from the spool.
+// It stops on the first batch that could not be delivered and returns the number of delivered batches.
+func sendSpoolBatches(sender *eventsSender, spool *Spool, batches []SpoolBatch) (int, error) {
+
+	for i, batch := range batches {
+		if err := sendSpoolBatch(sender, spool, batch); err != nil {
+			return i, err
+		}
+	}
+
+	return len(batches), nil
+}
+
+// sendSpoolBatch sends the given batch and removes it from the spool once acknowledged
+func sendSpoolBatch(sender *eventsSender, spool *Spool, batch SpoolBatch) error {
+
+	body, err := spool.Read(batch)
+	if err != nil {
+		return err
+	}
+
+	if err := sender.post(batch.ExecutionID, body); err != nil {
+		return err
+	}
+
+	return spool.Remove(batch)
+}
@@ -0,0 +1,141 @@
+package collector_test
+
+import (
+	"context"
+	"finala/collector"
+	"finala/collector/config"
+	"finala/request"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSpoolWriteListRemove(t *testing.T) {
+
+	spool, err := collector.NewSpool(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, executionID := range []string{"a_1", "b_2", "a_1"} {
+		if _, err := spool.Write(executionID, []byte(`[]`)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	batches, err := spool.List("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(batches) != 3 {
+		t.Fatalf("unexpected batches count, got %d expected %d", len(batches), 3)
+	}
+
+	batches, err = spool.List("a_1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(batches) != 2 {
+		t.Fatalf("unexpected execution batches count, got %d expected %d", len(batches), 2)
+	}
+
+	if err := spool.Remove(batches[0]); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	batches, _ = spool.List("a_1")
+	if len(batches) != 1 {
+		t.Fatalf("unexpected execution batches count after remove, got %d expected %d", len(batches), 1)
+	}
+
+	batches, _ = spool.List("not_exists")
+	if len(batches) != 0 {
+		t.Fatalf("unexpected batches count for unknown execution, got %d expected %d", len(batches), 0)
+	}
+}
+
+func TestReplaySpool(t *testing.T) {
+
+	received := map[string]string{}
+	var mu sync.Mutex
+	ts := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		executionID := strings.TrimPrefix(req.URL.Path, "/api/v1/detect-events/")
+		if executionID == "broken_1" {
+			resp.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		mu.Lock()
+		received[executionID] = string(body)
+		mu.Unlock()
+		resp.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	spool, err := collector.NewSpool(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, _ = spool.Write("valid_1", []byte(`[{"EventType":"resource_detected"}]`))
+	_, _ = spool.Write("broken_1", []byte(`[]`))
+
+	sent, err := collector.ReplaySpool(request.NewHTTPClient(), config.APIServerConfig{Addr: ts.URL}, spool)
+	if err == nil {
+		t.Fatalf("expected replay error for unacknowledged batch")
+	}
+	if sent != 1 {
+		t.Fatalf("unexpected sent batches, got %d expected %d", sent, 1)
+	}
+
+	if received["valid_1"] != `[{"EventType":"resource_detected"}]` {
+		t.Fatalf("unexpected replayed body, got %s", received["valid_1"])
+	}
+
+	batches, _ := spool.List("")
+	if len(batches) != 1 || batches[0].ExecutionID != "broken_1" {
+		t.Fatalf("unexpected pending batches after replay, got %v", batches)
+	}
+}
+
+func TestAddEventSpoolServerUnavailable(t *testing.T) {
+
+	var wg sync.WaitGroup
+	ctx, cancelFn := context.WithCancel(context.Background())
+	defer cancelFn()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		resp.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	spoolDir := t.TempDir()
+	coll := newCollectorWithConfig(&wg, ctx, config.APIServerConfig{
+		BulkInterval: time.Duration(time.Second * 1),
+		Addr:         ts.URL,
+		SpoolDir:     spoolDir,
+	})
+
+	coll.CollectStart(collector.ResourceIdentifier("test"))
+	coll.AddResource(collector.EventCollector{
+		ResourceName: "test1",
+		Data:         "test data",
+	})
+	time.Sleep(time.Second * 2)
+
+	if len(coll.GetCollectorEvent()) != 0 {
+		t.Fatalf("unexpected in memory events, got %d, expected %d", len(coll.GetCollectorEvent()), 0)
+	}
+
+	spool, _ := collector.NewSpool(spoolDir)
+	batches, err := spool.List("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(batches) == 0 {
+		t.Fatalf("expected events batch to be persisted in spool")
+	}
+}
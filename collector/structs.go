@@ -36,10 +36,12 @@ type PriceDetectedFields struct {
 	Tag           map[string]string
 }
 
-// EventCollector collector event data structure
+// EventCollector collector event data structure. AccountID is the cloud account of a detected resource,
+// the api server records it as the Data.AccountID field of the event
 type EventCollector struct {
 	EventType    string
 	ResourceName ResourceIdentifier
 	EventTime    int64
+	AccountID    string `json:",omitempty"`
 	Data         interface{}
 }
@@ -9,11 +9,18 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+// NotifierAuthConfig describes the api user the notifier logs in with
+type NotifierAuthConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
 // NotifierConfig describes the configuration for the notifier subcommand
 type NotifierConfig struct {
 	LogLevel            string                      `yaml:"log_level"`
 	APIServerAddr       string                      `yaml:"api_server_address"`
 	UIAddr              string                      `yaml:"ui_address"`
+	Auth                NotifierAuthConfig          `yaml:"auth"`
 	NotifiersConfigs    notifierCommon.ConfigByName `yaml:"notifiers"`
 	registeredNotifiers []notifierCommon.Notifier
 }
@@ -47,5 +54,13 @@ func Load(location string, notifierLog log.Entry) (config NotifierConfig, err er
 		return config, err
 	}
 
+	overridePassword := os.Getenv("OVERRIDE_NOTIFIER_PASSWORD")
+	if overridePassword != "" {
+		notifierLog.WithFields(log.Fields{
+			"environment_variable": "OVERRIDE_NOTIFIER_PASSWORD",
+		}).Info("override notifier password")
+		config.Auth.Password = overridePassword
+	}
+
 	return config, nil
 }
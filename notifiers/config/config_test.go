@@ -29,6 +29,20 @@ func TestConfig(t *testing.T) {
 		if reflect.TypeOf(config).String() != "config.NotifierConfig" {
 			t.Fatalf("unexpected configuration data")
 		}
+		if config.Auth.Username != "notifier" || config.Auth.Password != "notifier-password" {
+			t.Fatalf("unexpected auth configuration, got %+v", config.Auth)
+		}
+	})
+
+	t.Run("override_password", func(t *testing.T) {
+		t.Setenv("OVERRIDE_NOTIFIER_PASSWORD", "override-password")
+		config, err := config.Load(fmt.Sprintf("%s/testutil/mock/config.yaml", currentFolderPath), *log)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if config.Auth.Password != "override-password" {
+			t.Fatalf("unexpected password, got %s expected %s", config.Auth.Password, "override-password")
+		}
 	})
 
 	t.Run("invalid_config", func(t *testing.T) {
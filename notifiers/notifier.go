@@ -1,8 +1,11 @@
 package notifiers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	notifierCommon "finala/notifiers/common"
+	"net/http"
 	"net/url"
 
 	"finala/request"
@@ -17,11 +20,16 @@ const notRegisteredTemplate = "notifier by the name %s was not registered"
 
 var registeredNotifiers = map[notifierCommon.NotifierName]NotifierMaker{}
 
+// ErrMissingToken is returned when the api login response does not hold a token
+var ErrMissingToken = errors.New("login response does not hold a token")
+
 // DataFetcherManager will hold all the data for Finala notifier
 type DataFetcherManager struct {
 	client      request.HTTPClientDescriber
 	log         log.Entry
 	apiEndpoint string
+	// token is sent as the bearer token of the api requests, set by Login
+	token string
 }
 
 // NewDataFetcherManager will fetch all the data requests from Finala API.
@@ -33,6 +41,64 @@ func NewDataFetcherManager(client request.HTTPClientDescriber, log log.Entry, ap
 	}
 }
 
+// Login logs in to the api with the given user, the token is sent with the following api requests
+func (dfm *DataFetcherManager) Login(username, password string) error {
+	body, err := json.Marshal(map[string]string{
+		"username": username,
+		"password": password,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := dfm.client.Request("POST", fmt.Sprintf("%s/api/v1/auth/login", dfm.apiEndpoint), nil, bytes.NewReader(body))
+	if err != nil {
+		dfm.log.WithError(err).Error("could not create HTTP client request")
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := dfm.do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&login); err != nil {
+		return err
+	}
+	if login.Token == "" {
+		return ErrMissingToken
+	}
+
+	dfm.token = login.Token
+	return nil
+}
+
+// do sends the request with the bearer token, a response that is not 2xx is returned as a request.HttpError
+func (dfm *DataFetcherManager) do(req *http.Request) (*http.Response, error) {
+	if dfm.token != "" {
+		req.Header.Set("Authorization", "Bearer "+dfm.token)
+	}
+
+	res, err := dfm.client.DO(req)
+	if err != nil {
+		dfm.log.WithError(err).Error("could not send HTTP client request")
+		return nil, err
+	}
+
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		res.Body.Close()
+		err := &request.HttpError{Status: res.Status, StatusCode: res.StatusCode}
+		dfm.log.WithError(err).WithField("url", req.URL.Path).Error("unexpected HTTP response status")
+		return nil, err
+	}
+	return res, nil
+}
+
 // GetLatestExecution will get the Collector's latest execution
 func (dfm *DataFetcherManager) GetLatestExecution() (latestExecution string, err error) {
 	req, err := dfm.client.Request("GET", fmt.Sprintf("%s/api/v1/executions?querylimit=1", dfm.apiEndpoint), nil, nil)
@@ -41,9 +107,8 @@ func (dfm *DataFetcherManager) GetLatestExecution() (latestExecution string, err
 		return "", err
 	}
 
-	res, err := dfm.client.DO(req)
+	res, err := dfm.do(req)
 	if err != nil {
-		dfm.log.WithError(err).Error("could not send HTTP client request")
 		return "", err
 	}
 
@@ -67,9 +132,8 @@ func (dfm *DataFetcherManager) GetExecutionSummary(executionID string, filterOpt
 		return nil, err
 	}
 
-	res, err := dfm.client.DO(req)
+	res, err := dfm.do(req)
 	if err != nil {
-		dfm.log.WithError(err).Error("could not send HTTP client request")
 		return nil, err
 	}
 
@@ -1,7 +1,10 @@
 package notifiers_test
 
 import (
+	"encoding/json"
+	"errors"
 	"finala/notifiers"
+	"finala/request"
 	"fmt"
 	"io"
 	"net/http"
@@ -49,20 +52,38 @@ const (
 	}`
 )
 
+const mockToken = "notifier-token"
+
 type dataFetcherMockClient struct {
 	Error error
+	// authorization holds the Authorization header of the last api request
+	authorization string
 }
 
 func (mc *dataFetcherMockClient) DO(r *http.Request) (*http.Response, error) {
 	var newBody io.ReadCloser
 	switch r.URL.Path {
+	case "/api/v1/auth/login":
+		var login struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&login); err != nil || login.Username != "notifier" || login.Password != "password" {
+			return &http.Response{StatusCode: http.StatusUnauthorized, Status: "401 Unauthorized", Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(fmt.Sprintf(`{"token": %q}`, mockToken)))}, nil
 	case "/api/v1/executions":
 		newBody = io.NopCloser(strings.NewReader(expectedLatestExecutionsResponse))
 	case fmt.Sprintf("/api/v1/summary/%s", expectedLatestExecutionID):
 		newBody = io.NopCloser(strings.NewReader(expectedSummaryResponse))
 	}
+	mc.authorization = r.Header.Get("Authorization")
+	if mc.authorization != "Bearer "+mockToken {
+		return &http.Response{StatusCode: http.StatusUnauthorized, Status: "401 Unauthorized", Body: io.NopCloser(strings.NewReader(`{}`))}, nil
+	}
 	return &http.Response{
-		Body: newBody,
+		StatusCode: http.StatusOK,
+		Body:       newBody,
 	}, nil
 }
 
@@ -83,15 +104,45 @@ func MockClient() *dataFetcherMockClient {
 	return &dataFetcherMockClient{}
 }
 
-func MockDataFetcherManager() *notifiers.DataFetcherManager {
+func MockDataFetcherManager(t *testing.T) *notifiers.DataFetcherManager {
 	log := log.WithField("test", "testNotifier")
 	client := MockClient()
 	mockDataFetcherManager := notifiers.NewDataFetcherManager(client, *log, "http://finala-api")
+	if err := mockDataFetcherManager.Login("notifier", "password"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 	return mockDataFetcherManager
 }
 
+func TestLogin(t *testing.T) {
+	log := log.WithField("test", "testNotifier")
+	client := MockClient()
+	dataFetcher := notifiers.NewDataFetcherManager(client, *log, "http://finala-api")
+
+	// the api requests are rejected without a token
+	if _, err := dataFetcher.GetLatestExecution(); err == nil {
+		t.Fatalf("expected an error without a token")
+	}
+
+	err := dataFetcher.Login("notifier", "wrong-password")
+	var httpErr *request.HttpError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("unexpected error, got %v expected %d", err, http.StatusUnauthorized)
+	}
+
+	if err := dataFetcher.Login("notifier", "password"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := dataFetcher.GetExecutionSummary(expectedLatestExecutionID, map[string]string{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.authorization != "Bearer "+mockToken {
+		t.Fatalf("unexpected authorization header, got %s expected %s", client.authorization, "Bearer "+mockToken)
+	}
+}
+
 func TestGetLatestExecution(t *testing.T) {
-	dataFetcher := MockDataFetcherManager()
+	dataFetcher := MockDataFetcherManager(t)
 	latestExecution, _ := dataFetcher.GetLatestExecution()
 	t.Run("check tags format", func(t *testing.T) {
 		if latestExecution != "general_1591084693" {
@@ -102,7 +153,7 @@ func TestGetLatestExecution(t *testing.T) {
 
 func TestGetExecutionSummary(t *testing.T) {
 	filterOptions := map[string]string{}
-	dataFetcher := MockDataFetcherManager()
+	dataFetcher := MockDataFetcherManager(t)
 	executionSummary, _ := dataFetcher.GetExecutionSummary(expectedLatestExecutionID, filterOptions)
 	t.Run("check tags format", func(t *testing.T) {
 		if len(executionSummary) != 2 {
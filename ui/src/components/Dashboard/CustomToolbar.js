@@ -7,7 +7,10 @@ import Modal from "@mui/material/Modal";
 import Alert from "@mui/material/Alert";
 import Snackbar from "@mui/material/Snackbar";
 import { FormControl, FormLabel, TextField, Button } from "@mui/material";
-import { http } from "../../services/request.service";
+import {
+  http,
+  authorizationHeaders,
+} from "../../services/request.service";
 
 /* eslint-disable no-console */
 console.log("Some debug message");
@@ -127,6 +130,7 @@ const CustomToolbar = (props) => {
     try {
       fetch(fullUrl, {
         method: "POST", // Specify the HTTP method
+        headers: authorizationHeaders(),
         body: JSON.stringify(formData), // Collect form data
       })
         .then((response) => response.json()) // Read response as text
@@ -181,7 +181,7 @@ const FilterBar = ({
       const option = options.find((row) => {
         return (
           (row.type === "tag:option" && row.id === currentValue) ||
-          (row.type === "tag:value" && row.title === currentValue)
+          (row.type === "tag:value" && row.value === currentValue)
         );
       });
       if (option) {
@@ -202,10 +202,10 @@ const FilterBar = ({
   const getTagValueList = (tagId) => {
     const tagValuesList = tags[tagId].map((opt) => {
       return {
-        title: `${opt}`,
-        filterTitle: `${tagId}:${opt}`,
-        id: `${tagId}:${opt}`,
-        value: opt,
+        title: `${opt.Value} (${opt.Count})`,
+        filterTitle: `${tagId}:${opt.Value}`,
+        id: `${tagId}:${opt.Value}`,
+        value: opt.Value,
         type: "tag:value",
       };
     });
@@ -16,6 +16,7 @@ import ResourceTable from "./ResourceTable";
 import ExecutionIndex from "../Executions/Index";
 import Logo from "../Logo";
 import { Grid, Box } from "@mui/material";
+import { http, logout } from "../../services/request.service";
 
 const useStyles = makeStyles(() => ({
   root: {
@@ -125,8 +126,7 @@ const DashboardIndex = ({
               <Button
                 variant="outlined"
                 onClick={() => {
-                  localStorage.removeItem("finalaAuthToken");
-                  navigate("/login");
+                  logout(http.baseURL).then(() => navigate("/login"));
                 }}
                 className={classes.logoutButton}
               >
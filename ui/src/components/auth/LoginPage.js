@@ -26,6 +26,19 @@ const LoginPage = () => {
   const [apiBaseUrl, setApiBaseUrl] = useState("");
   const [configLoading, setConfigLoading] = useState(true);
   const [configError, setConfigError] = useState("");
+  const [ssoLogin, setSSOLogin] = useState(false);
+
+  // Single sign-on redirects back to the login page with the token in the url fragment
+  useEffect(() => {
+    const params = new URLSearchParams(window.location.hash.substring(1));
+    const token = params.get("token");
+    if (token) {
+      localStorage.setItem("finalaAuthToken", token);
+      localStorage.setItem("finalaRefreshToken", params.get("refresh_token"));
+      window.history.replaceState(null, "", window.location.pathname);
+      navigate("/");
+    }
+  }, [navigate]);
 
   useEffect(() => {
     const fetchApiConfig = async () => {
@@ -38,6 +51,7 @@ const LoginPage = () => {
         const configData = await response.json();
         if (configData && configData.api_endpoint) {
           setApiBaseUrl(configData.api_endpoint);
+          setSSOLogin(!!configData.sso_login);
         } else {
           throw new Error("API endpoint not found in settings");
         }
@@ -117,6 +131,7 @@ const LoginPage = () => {
         const data = JSON.parse(responseText);
         if (data.token) {
           localStorage.setItem("finalaAuthToken", data.token);
+          localStorage.setItem("finalaRefreshToken", data.refresh_token);
           setUsername("");
           setPassword("");
           navigate("/");
@@ -276,6 +291,24 @@ const LoginPage = () => {
               "Log In"
             )}
           </Button>
+          {ssoLogin && (
+            <Button
+              fullWidth
+              variant="outlined"
+              href={`${apiBaseUrl}/api/v1/auth/oidc/login`}
+              sx={{
+                mb: 2,
+                color: "#DC143C",
+                borderColor: "#DC143C",
+                "&:hover": {
+                  borderColor: "#B01030",
+                },
+              }}
+              disabled={loading || !!configError}
+            >
+              Log In with SSO
+            </Button>
+          )}
         </Box>
       </Paper>
     </Container>
@@ -16,6 +16,7 @@ class Http {
   request(url, action, customRequestOptions = {}) {
     let defaultRequestOptions = {
       method: action,
+      headers: authorizationHeaders(),
     };
     merge(defaultRequestOptions, customRequestOptions);
     let fullUrl = "";
@@ -25,10 +26,93 @@ class Http {
       fullUrl = `${this.baseURL}/${url}`;
     }
 
-    return fetch(`${fullUrl}`, defaultRequestOptions).then(handleResponse);
+    return fetch(`${fullUrl}`, defaultRequestOptions).then((response) => {
+      if (response.status !== 401 || customRequestOptions.retried) {
+        return handleResponse(response);
+      }
+      // the access token expired, refresh the session and retry once
+      return refreshSession(this.baseURL).then((refreshed) => {
+        if (!refreshed) {
+          return handleResponse(response);
+        }
+        return this.request(
+          url,
+          action,
+          merge({}, customRequestOptions, {
+            retried: true,
+            headers: authorizationHeaders(),
+          }),
+        );
+      });
+    });
   }
 }
 
+/**
+ * Exchanges the stored refresh token for new session tokens
+ *
+ * @param {string} baseURL api base url
+ * @returns {Promise<boolean>} true when the session was refreshed
+ */
+export function refreshSession(baseURL) {
+  const refreshToken = localStorage.getItem("finalaRefreshToken");
+  if (!refreshToken) {
+    return Promise.resolve(false);
+  }
+  return fetch(`${baseURL}/api/v1/auth/refresh`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ refresh_token: refreshToken }),
+  })
+    .then((response) => (response.ok ? response.json() : null))
+    .then((data) => {
+      if (!data || !data.token) {
+        clearSession();
+        return false;
+      }
+      localStorage.setItem("finalaAuthToken", data.token);
+      localStorage.setItem("finalaRefreshToken", data.refresh_token);
+      return true;
+    })
+    .catch(() => false);
+}
+
+/**
+ * Revokes the current session in the api and removes the stored tokens
+ *
+ * @param {string} baseURL api base url
+ * @returns {Promise}
+ */
+export function logout(baseURL) {
+  return fetch(`${baseURL}/api/v1/auth/logout`, {
+    method: "POST",
+    headers: authorizationHeaders(),
+  })
+    .catch(() => null)
+    .then(() => clearSession());
+}
+
+/**
+ * Removes the stored session tokens
+ */
+export function clearSession() {
+  localStorage.removeItem("finalaAuthToken");
+  localStorage.removeItem("finalaRefreshToken");
+}
+
+/**
+ * Returns the authorization header of the logged in user
+ *
+ * @returns {object}
+ */
+export function authorizationHeaders() {
+  const token = localStorage.getItem("finalaAuthToken");
+  if (!token) {
+    return {};
+  }
+  return { Authorization: `Bearer ${token}` };
+}
+
 /**
  * Manage http request response
  *
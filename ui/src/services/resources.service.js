@@ -64,22 +64,32 @@ function Summary(executionID, filters = []) {
 }
 
 /**
- *
+ * Resources page size, the API max
+ */
+const CONTENT_PAGE_SIZE = 1000;
+
+/**
+ * Get all the resources of a resource type, page by page
  * @param {string} name resource name
  * @param {string} executionID execution id to query
  * @param {array} filters filters list
  */
-function GetContent(name, executionID, filters = []) {
-  const params = {
-    ...{ executionID },
-    ...getTransformedFilters(filters),
-  };
-  const searchParams = new window.URLSearchParams(params).toString();
+async function GetContent(name, executionID, filters = []) {
+  const resources = [];
+  for (let page = 1; ; page++) {
+    const params = {
+      ...{ executionID, page, page_size: CONTENT_PAGE_SIZE },
+      ...getTransformedFilters(filters),
+    };
+    const searchParams = new window.URLSearchParams(params).toString();
 
-  return http
-    .send(`api/v1/resources/${name}?${searchParams}`, `get`)
-    .then(this.handleResponse)
-    .then((response) => {
-      return response;
-    });
+    const response = await http
+      .send(`api/v1/resources/${name}?${searchParams}`, `get`)
+      .then(this.handleResponse);
+
+    resources.push(...response.resources);
+    if (!response.resources.length || resources.length >= response.total) {
+      return resources;
+    }
+  }
 }
@@ -11,6 +11,8 @@ import (
 // APIServerConfig descrive the api configuration
 type APIServerConfig struct {
 	Addr string `yaml:"address"`
+	// SSOLogin shows the single sign-on login, when the api enables oidc
+	SSOLogin bool `yaml:"sso_login"`
 }
 
 // WebserverConfig present the application config
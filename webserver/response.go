@@ -2,6 +2,7 @@ package webserver
 
 type SettingsResponse struct {
 	APIEndpoint string `json:"api_endpoint"`
+	SSOLogin    bool   `json:"sso_login"`
 }
 
 // HealthResponse is returned when healtcheck requested
@@ -6,7 +6,10 @@ import (
 
 // SettingsHandler return ui settings
 func (server *Server) SettingsHandler(resp http.ResponseWriter, req *http.Request) {
-	server.JSONWrite(resp, http.StatusOK, SettingsResponse{APIEndpoint: server.config.APIServer.Addr})
+	server.JSONWrite(resp, http.StatusOK, SettingsResponse{
+		APIEndpoint: server.config.APIServer.Addr,
+		SSOLogin:    server.config.APIServer.SSOLogin,
+	})
 }
 
 // HealthCheckHandler returns ok if server is up